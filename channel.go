@@ -0,0 +1,52 @@
+package twitch
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// normalizeChannel returns the name of a channel as the client keys its state by, lowercase and without the leading #.
+// Returns ErrInvalidChannel for an empty name or a name with spaces, commas or control characters, the normalized name is returned either way
+func normalizeChannel(channel string) (string, error) {
+	name := strings.ToLower(strings.TrimPrefix(channel, "#"))
+	if name == "" || strings.ContainsAny(name, " ,") || strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return name, fmt.Errorf("%w: %q", ErrInvalidChannel, channel)
+	}
+
+	return name, nil
+}
+
+// normalizeChannels normalizes the channels and removes duplicates, keeping the order of the first occurrence
+func normalizeChannels(channels []string) ([]string, error) {
+	normalized := make([]string, 0, len(channels))
+	seen := make(map[string]bool, len(channels))
+	for _, channel := range channels {
+		name, err := normalizeChannel(channel)
+		if err != nil {
+			return nil, err
+		}
+
+		if !seen[name] {
+			seen[name] = true
+			normalized = append(normalized, name)
+		}
+	}
+
+	return normalized, nil
+}
+
+// checkText returns ErrInvalidText if the text of a message contains line breaks or other control characters,
+// which would end the line and let the rest of the text be sent as another command.
+// The \x01 of the CTCP ACTION framing and tabs are allowed
+func checkText(text string) error {
+	if strings.IndexFunc(text, isForbiddenTextRune) >= 0 {
+		return fmt.Errorf("%w: %q", ErrInvalidText, text)
+	}
+
+	return nil
+}
+
+func isForbiddenTextRune(r rune) bool {
+	return unicode.IsControl(r) && r != '\x01' && r != '\t'
+}
@@ -0,0 +1,181 @@
+package twitch
+
+// ChannelHandlers attaches callbacks that are only called for the messages of a single channel, see Client.Channel.
+// The callbacks are attached to the client, so they can be detached with Client.RemoveHandler
+type ChannelHandlers struct {
+	client  *Client
+	channel string
+}
+
+// Channel returns a ChannelHandlers to attach callbacks that are only called for the messages of the given channel,
+// instead of checking the channel in every callback:
+//
+//	client.Channel("pajlada").OnPrivateMessage(func(message twitch.PrivateMessage) {
+//		// only messages sent in #pajlada
+//	})
+//
+// Only the events of messages sent in a channel are available
+func (c *Client) Channel(channel string) *ChannelHandlers {
+	channel, _ = normalizeChannel(channel)
+
+	return &ChannelHandlers{
+		client:  c,
+		channel: channel,
+	}
+}
+
+// Name returns the channel the callbacks are attached for
+func (h *ChannelHandlers) Name() string {
+	return h.channel
+}
+
+func (h *ChannelHandlers) add(event handlerEvent, callback func(payload interface{})) HandlerID {
+	return h.client.handlers.add(event, func(payload interface{}) {
+		if messageChannel(payload) == h.channel {
+			callback(payload)
+		}
+	})
+}
+
+// OnPrivateMessage attaches callback to new standard chat messages of the channel
+func (h *ChannelHandlers) OnPrivateMessage(callback func(message PrivateMessage)) HandlerID {
+	return h.add(privateMessageEvent, func(payload interface{}) {
+		callback(*payload.(*PrivateMessage))
+	})
+}
+
+// OnClearChatMessage attaches callback to new messages of the channel such as timeouts
+func (h *ChannelHandlers) OnClearChatMessage(callback func(message ClearChatMessage)) HandlerID {
+	return h.add(clearChatMessageEvent, func(payload interface{}) {
+		callback(*payload.(*ClearChatMessage))
+	})
+}
+
+// OnClearMessage attaches callback when a single message of the channel is deleted
+func (h *ChannelHandlers) OnClearMessage(callback func(message ClearMessage)) HandlerID {
+	return h.add(clearMessageEvent, func(payload interface{}) {
+		callback(*payload.(*ClearMessage))
+	})
+}
+
+// OnRoomStateMessage attaches callback to new room states of the channel
+func (h *ChannelHandlers) OnRoomStateMessage(callback func(message RoomStateMessage)) HandlerID {
+	return h.add(roomStateMessageEvent, func(payload interface{}) {
+		callback(*payload.(*RoomStateMessage))
+	})
+}
+
+// OnUserNoticeMessage attaches callback to new usernotice messages of the channel such as sub, resub, and raids
+func (h *ChannelHandlers) OnUserNoticeMessage(callback func(message UserNoticeMessage)) HandlerID {
+	return h.add(userNoticeMessageEvent, func(payload interface{}) {
+		callback(*payload.(*UserNoticeMessage))
+	})
+}
+
+// OnUserStateMessage attaches callback to new userstates of the channel
+func (h *ChannelHandlers) OnUserStateMessage(callback func(message UserStateMessage)) HandlerID {
+	return h.add(userStateMessageEvent, func(payload interface{}) {
+		callback(*payload.(*UserStateMessage))
+	})
+}
+
+// OnNoticeMessage attaches callback to new notice messages of the channel
+func (h *ChannelHandlers) OnNoticeMessage(callback func(message NoticeMessage)) HandlerID {
+	return h.add(noticeMessageEvent, func(payload interface{}) {
+		callback(*payload.(*NoticeMessage))
+	})
+}
+
+// OnUserJoinMessage attaches callback to user joins of the channel
+func (h *ChannelHandlers) OnUserJoinMessage(callback func(message UserJoinMessage)) HandlerID {
+	return h.add(userJoinMessageEvent, func(payload interface{}) {
+		callback(*payload.(*UserJoinMessage))
+	})
+}
+
+// OnUserPartMessage attaches callback to user parts of the channel
+func (h *ChannelHandlers) OnUserPartMessage(callback func(message UserPartMessage)) HandlerID {
+	return h.add(userPartMessageEvent, func(payload interface{}) {
+		callback(*payload.(*UserPartMessage))
+	})
+}
+
+// OnSelfJoinMessage attaches callback to the client's own user joining the channel
+func (h *ChannelHandlers) OnSelfJoinMessage(callback func(message UserJoinMessage)) HandlerID {
+	return h.add(selfJoinMessageEvent, func(payload interface{}) {
+		callback(*payload.(*UserJoinMessage))
+	})
+}
+
+// OnSelfPartMessage attaches callback to the client's own user parting the channel
+func (h *ChannelHandlers) OnSelfPartMessage(callback func(message UserPartMessage)) HandlerID {
+	return h.add(selfPartMessageEvent, func(payload interface{}) {
+		callback(*payload.(*UserPartMessage))
+	})
+}
+
+// OnNamesMessage attaches callback to /names responses of the channel
+func (h *ChannelHandlers) OnNamesMessage(callback func(message NamesMessage)) HandlerID {
+	return h.add(namesMessageEvent, func(payload interface{}) {
+		callback(*payload.(*NamesMessage))
+	})
+}
+
+// OnSendError attaches callback to messages sent to the channel being rejected by Twitch, see Client.OnSendError
+func (h *ChannelHandlers) OnSendError(callback func(reason NoticeID, notice NoticeMessage)) HandlerID {
+	return h.add(sendErrorEvent, func(payload interface{}) {
+		rejected := payload.(sendError)
+		callback(rejected.reason, *rejected.notice)
+	})
+}
+
+// OnUserlistChange attaches callback to changes of the userlist of the channel, see Client.OnUserlistChange
+func (h *ChannelHandlers) OnUserlistChange(callback func(joined, parted []string)) HandlerID {
+	return h.add(userlistChangeEvent, func(payload interface{}) {
+		change := payload.(userlistChange)
+		callback(change.joined, change.parted)
+	})
+}
+
+// OnEmoteOnly attaches callback to emote-only mode being enabled or disabled in the channel, see Client.OnEmoteOnly
+func (h *ChannelHandlers) OnEmoteOnly(callback func(enabled bool)) HandlerID {
+	return h.add(emoteOnlyEvent, func(payload interface{}) {
+		callback(payload.(roomModeChange).value == 1)
+	})
+}
+
+// OnSubMode attaches callback to subscribers-only mode being enabled or disabled in the channel, see Client.OnSubMode
+func (h *ChannelHandlers) OnSubMode(callback func(enabled bool)) HandlerID {
+	return h.add(subModeEvent, func(payload interface{}) {
+		callback(payload.(roomModeChange).value == 1)
+	})
+}
+
+// OnSlowMode attaches callback to the slow mode of the channel changing, see Client.OnSlowMode
+func (h *ChannelHandlers) OnSlowMode(callback func(seconds int)) HandlerID {
+	return h.add(slowModeEvent, func(payload interface{}) {
+		callback(payload.(roomModeChange).value)
+	})
+}
+
+// OnFollowersMode attaches callback to the followers-only mode of the channel changing, see Client.OnFollowersMode
+func (h *ChannelHandlers) OnFollowersMode(callback func(minutes int)) HandlerID {
+	return h.add(followersModeEvent, func(payload interface{}) {
+		callback(payload.(roomModeChange).value)
+	})
+}
+
+// OnRoomStateChange attaches callback to settings of the channel changing, see Client.OnRoomStateChange
+func (h *ChannelHandlers) OnRoomStateChange(callback func(changes []RoomStateChange)) HandlerID {
+	return h.add(roomStateChangeEvent, func(payload interface{}) {
+		callback(payload.(roomStateChanges).changes)
+	})
+}
+
+// OnHost attaches callback to the channel starting or stopping to host another channel, see Client.OnHost
+func (h *ChannelHandlers) OnHost(callback func(target string, viewers int)) HandlerID {
+	return h.add(hostEvent, func(payload interface{}) {
+		change := payload.(hostChange)
+		callback(change.target, change.viewers)
+	})
+}
@@ -0,0 +1,62 @@
+package twitch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChannelHandlersAreOnlyCalledForTheirChannel(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+
+	client := newTestClient(server.Addr)
+	received := make(chan string, 4)
+	client.Channel("#Pajlada").OnPrivateMessage(func(message PrivateMessage) {
+		received <- message.Channel + ": " + message.Message
+	})
+	client.Channel("nymn").OnUserJoinMessage(func(message UserJoinMessage) {
+		received <- message.Channel + ": " + message.User + " joined"
+	})
+	disconnected := connectAndEnsureGoodDisconnect(t, client)
+	waitForLine(t, server, "NICK")
+
+	send(t, server,
+		":gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #nymn :not for pajlada",
+		":gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :for pajlada",
+		":gempir!gempir@gempir.tmi.twitch.tv JOIN #pajlada",
+		":gempir!gempir@gempir.tmi.twitch.tv JOIN #nymn",
+	)
+
+	for _, expected := range []string{"pajlada: for pajlada", "nymn: gempir joined"} {
+		select {
+		case message := <-received:
+			assertStringsEqual(t, expected, message)
+		case <-time.After(time.Second * 3):
+			t.Fatal("channel handler not called")
+		}
+	}
+
+	client.Disconnect()
+	<-disconnected
+
+	select {
+	case message := <-received:
+		t.Fatal("channel handler called for another channel: " + message)
+	default:
+	}
+}
+
+func TestCanRemoveChannelHandlers(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123123")
+
+	called := false
+	id := client.Channel("pajlada").OnPrivateMessage(func(message PrivateMessage) {
+		called = true
+	})
+	assertTrue(t, client.RemoveHandler(id), "channel handler not removed")
+
+	client.callHandlers(privateMessageEvent, ParseMessage(":gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :hi"))
+	assertFalse(t, called, "removed channel handler was called")
+	assertStringsEqual(t, "pajlada", client.Channel("#PAJLADA").Name())
+}
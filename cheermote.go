@@ -0,0 +1,74 @@
+package twitch
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Cheermote is a cheer in the text of a message with bits, like "Cheer100". The cheers of a PrivateMessage are only parsed if it has Bits.
+// Start and End are the positions of the first and last character of the cheer in the message, inclusive and counted
+// in UTF-16 code units like the positions of emotes
+type Cheermote struct {
+	Prefix string `json:"prefix"`
+	Amount int    `json:"amount"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+}
+
+// parseCheermotes finds the cheers in the text of a message with bits. A cheer is a word made of letters followed by the
+// number of bits, the prefixes aren't checked against the cheermotes available in the channel.
+// So in a message with bits, a word like "abc123" is taken for a cheer as well
+func parseCheermotes(text string) []Cheermote {
+	var cheermotes []Cheermote
+
+	position := 0
+	for rest, hasNext := text, true; hasNext; {
+		var word string
+		word, rest, hasNext = cutByte(rest, ' ')
+
+		if cheermote, ok := parseCheermote(word); ok {
+			cheermote.Start = position
+			cheermote.End = position + len(word) - 1
+			cheermotes = append(cheermotes, cheermote)
+		}
+
+		position += utf16Length(word) + 1
+	}
+
+	return cheermotes
+}
+
+// parseCheermote parses a single word, a cheer is only made of ASCII characters
+func parseCheermote(word string) (Cheermote, bool) {
+	digits := strings.IndexAny(word, "0123456789")
+	if digits < 1 {
+		return Cheermote{}, false
+	}
+
+	for i := 0; i < digits; i++ {
+		if c := word[i] | 0x20; c < 'a' || c > 'z' {
+			return Cheermote{}, false
+		}
+	}
+
+	// Atoi fails for anything but digits after the prefix
+	amount, err := strconv.Atoi(word[digits:])
+	if err != nil || amount < 1 || word[digits] == '0' {
+		return Cheermote{}, false
+	}
+
+	return Cheermote{Prefix: word[:digits], Amount: amount}, true
+}
+
+// utf16Length returns the length of s in UTF-16 code units
+func utf16Length(s string) int {
+	length := 0
+	for _, r := range s {
+		length++
+		if r >= 0x10000 {
+			length++
+		}
+	}
+
+	return length
+}
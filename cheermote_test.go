@@ -0,0 +1,57 @@
+package twitch
+
+import "testing"
+
+func assertCheermotesEqual(t *testing.T, expected, actual []Cheermote) {
+	t.Helper()
+
+	if len(expected) != len(actual) {
+		t.Fatalf("expected %d cheermotes, got %d: %v", len(expected), len(actual), actual)
+	}
+
+	for i := range expected {
+		if expected[i] != actual[i] {
+			t.Errorf("expected cheermote %v, got %v", expected[i], actual[i])
+		}
+	}
+}
+
+func TestCanParseCheermotes(t *testing.T) {
+	t.Parallel()
+	testMessage := "@badges=bits/100;bits=150;color=;display-name=gempir;emotes=;id=7eb848c9-1060-4e5e-9f4c-612877982e79;mod=0;room-id=11148817;subscriber=0;tmi-sent-ts=1490382457309;turbo=0;user-id=77829817;user-type= :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :Cheer100 nice Cheer50"
+
+	message := ParseMessage(testMessage).(*PrivateMessage)
+
+	assertIntsEqual(t, 150, message.Bits)
+	assertCheermotesEqual(t, []Cheermote{
+		{Prefix: "Cheer", Amount: 100, Start: 0, End: 7},
+		{Prefix: "Cheer", Amount: 50, Start: 14, End: 20},
+	}, message.Cheermotes)
+}
+
+func TestCheermotesAreOnlyParsedWithBits(t *testing.T) {
+	t.Parallel()
+	testMessage := "@badges=;color=;display-name=gempir;emotes=;id=7eb848c9-1060-4e5e-9f4c-612877982e79;mod=0;room-id=11148817;subscriber=0;tmi-sent-ts=1490382457309;turbo=0;user-id=77829817;user-type= :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :Cheer100 nice Cheer50"
+
+	message := ParseMessage(testMessage).(*PrivateMessage)
+
+	assertCheermotesEqual(t, nil, message.Cheermotes)
+}
+
+func TestCanParseCheermotesOfText(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		text     string
+		expected []Cheermote
+	}{
+		{"PogChamp50", []Cheermote{{"PogChamp", 50, 0, 9}}},
+		{"🎉 cheer1 bday10", []Cheermote{{"cheer", 1, 3, 8}, {"bday", 10, 10, 15}}},
+		{"Cheer0 Cheer01 100 Cheer 4Head Cheer10k Chéer10", nil},
+		{"", nil},
+	}
+
+	for _, test := range tests {
+		assertCheermotesEqual(t, test.expected, parseCheermotes(test.text))
+	}
+}
@@ -2,21 +2,33 @@ package twitch
 
 import (
 	"bufio"
+	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/textproto"
+	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	// ircTwitch constant for twitch irc chat address
-	ircTwitchTLS = "irc.chat.twitch.tv:6697"
-	ircTwitch    = "irc.chat.twitch.tv:6667"
+	// DefaultIrcAddressTLS is the address of twitch irc chat the client connects to with TLS, which is enabled by default
+	DefaultIrcAddressTLS = "irc.chat.twitch.tv:" + ircTwitchTLSPort
+	// DefaultIrcAddress is the address of twitch irc chat the client connects to when TLS is disabled
+	DefaultIrcAddress = "irc.chat.twitch.tv:" + ircTwitchPort
+
+	ircTwitchTLSPort = "6697"
+	ircTwitchPort    = "6667"
 
 	pingSignature = "go-twitch-irc"
 	pingMessage   = "PING :" + pingSignature
@@ -38,10 +50,39 @@ var (
 	// ErrLoginAuthenticationFailed returned from Connect() when either the wrong or a malformed oauth token is used
 	ErrLoginAuthenticationFailed = errors.New("login authentication failed")
 
-	// ErrConnectionIsNotOpen is returned by Disconnect in case you call it without being connected
+	// ErrConnectionIsNotOpen is returned by Disconnect in case you call it without being connected,
+	// and by Say, Reply and the chat commands while not connected if SetQueueEarlySends is disabled
 	ErrConnectionIsNotOpen = errors.New("connection is not open")
 
-	// WriteBufferSize can be modified to change the write channel buffer size.
+	// ErrInvalidIrcAddress returned from Connect() and SetIrcAddress when the IrcAddress can't be dialed, e.g. because of a bad port
+	ErrInvalidIrcAddress = errors.New("invalid irc address")
+
+	// ErrConnectionIsOpen returned from SetIrcAddress when it's called while Connect is running
+	ErrConnectionIsOpen = errors.New("connection is open")
+
+	// ErrChannelNotAllowed returned from Say, Reply and the chat commands when the channel isn't in the allowlist of SetSendAllowlist
+	ErrChannelNotAllowed = errors.New("channel is not in the send allowlist")
+
+	// ErrAnonymousClient returned from Say, Reply and the chat commands of a client created with NewAnonymousClient, which can't send messages
+	ErrAnonymousClient = errors.New("anonymous clients can't send messages")
+
+	// ErrInvalidChannel returned from Join, Depart, Say, Reply and the chat commands when the channel name is empty or contains spaces, commas or control characters
+	ErrInvalidChannel = errors.New("invalid channel name")
+
+	// ErrInvalidText returned from Say, Reply, SendMe and the chat commands when the text contains line breaks or other control characters,
+	// and from SendRaw when the line contains a line break before its end
+	ErrInvalidText = errors.New("text contains line breaks or control characters")
+
+	// ErrMessageRejected returned from SayAndWait when Twitch rejected the message, it wraps the NoticeID of the reason
+	ErrMessageRejected = errors.New("message was rejected")
+
+	// ErrMessageUnconfirmed returned from SayAndWait when Twitch didn't acknowledge the message within the SendConfirmationTimeout
+	ErrMessageUnconfirmed = errors.New("message was not confirmed")
+
+	// ErrQueueFull returned from Say, Reply and the chat commands when WriteBufferSize messages are already waiting to be written
+	ErrQueueFull = errors.New("write queue is full")
+
+	// WriteBufferSize can be modified to change the write channel buffer size, which is the size of each of the write queues.
 	// Must be configured before NewClient is called to take effect
 	WriteBufferSize = 512
 
@@ -49,6 +90,15 @@ var (
 	// Must be configured before NewClient is called to take effect
 	ReadBufferSize = 64
 
+	// MaxPendingSends can be modified to change how many sent messages can wait for their confirmation at once.
+	// Once exceeded, the oldest messages are reported to OnMessageSent as unconfirmed.
+	// Must be configured before NewClient is called to take effect
+	MaxPendingSends = 1000
+
+	// MessagesBufferSize can be modified to change the buffer size of the channel returned by Messages.
+	// Must be configured before Messages is called to take effect
+	MessagesBufferSize = 256
+
 	// DefaultCapabilities is the default caps when creating a new Client
 	DefaultCapabilities = []string{TagsCapability, CommandsCapability}
 )
@@ -60,13 +110,92 @@ var (
 
 // User data you receive from TMI
 type User struct {
-	ID          string
-	Name        string
-	DisplayName string
-	Color       string
-	Badges      map[string]int
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	DisplayName string         `json:"display_name,omitempty"`
+	Color       string         `json:"color,omitempty"`
+	Badges      map[string]int `json:"badges,omitempty"`
+	UserType    UserType       `json:"user_type,omitempty"`
+	Turbo       bool           `json:"turbo,omitempty"`
+}
+
+// DisplayNameOrName returns the display name of the user for rendering, or the login name if the display name is empty
+func (u User) DisplayNameOrName() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+
+	return u.Name
+}
+
+// RGB returns the red, green and blue components of the user's color, which Twitch sends as a hex color like "#1E90FF".
+// ok is false if the user never set a color, in which case Color is empty, or the color isn't a hex color
+func (u User) RGB() (r, g, b uint8, ok bool) {
+	if len(u.Color) != 7 || u.Color[0] != '#' {
+		return 0, 0, 0, false
+	}
+
+	rgb, err := strconv.ParseUint(u.Color[1:], 16, 32)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+
+	return uint8(rgb >> 16), uint8(rgb >> 8), uint8(rgb), true
+}
+
+// IsStaff reports whether the user has rights on all of Twitch, as Twitch staff, an admin or a global moderator
+func (u User) IsStaff() bool {
+	switch u.UserType {
+	case UserTypeStaff, UserTypeAdmin, UserTypeGlobalMod:
+		return true
+	}
+
+	return false
+}
+
+// anonymousGifterLogin and anonymousGifterID are the user anonymous gifts are attributed to
+const (
+	anonymousGifterLogin = "ananonymousgifter"
+	anonymousGifterID    = "274598607"
+)
+
+// IsAnonymous reports whether the user is the placeholder user "AnAnonymousGifter", which anonymous gifts are attributed to
+func (u User) IsAnonymous() bool {
+	return u.Name == anonymousGifterLogin || u.ID == anonymousGifterID
+}
+
+// IsSubscriber reports whether the user is subscribed to the channel the message was sent in.
+// Founders, the first subscribers of a channel, have the founder badge instead of the subscriber badge, so they count as well
+func (u User) IsSubscriber() bool {
+	_, subscriber := u.Badges["subscriber"]
+
+	return subscriber || u.IsFounder()
+}
+
+// IsFounder reports whether the user is one of the first subscribers of the channel the message was sent in
+func (u User) IsFounder() bool {
+	_, founder := u.Badges["founder"]
+
+	return founder
 }
 
+// UserType is the type of a user from the user-type tag
+// See https://dev.twitch.tv/docs/irc/tags/#privmsg-tags
+type UserType string
+
+const (
+	// UserTypeNormal is a normal user, the user-type tag is empty
+	UserTypeNormal UserType = ""
+	// UserTypeMod is a moderator of the channel the message was sent in
+	UserTypeMod UserType = "mod"
+	// UserTypeGlobalMod is a global moderator
+	UserTypeGlobalMod UserType = "global_mod"
+	// UserTypeAdmin is a Twitch admin
+	UserTypeAdmin UserType = "admin"
+	// UserTypeStaff is a Twitch employee
+	UserTypeStaff UserType = "staff"
+)
+
 // Message interface that all messages implement
 type Message interface {
 	GetType() MessageType
@@ -74,11 +203,18 @@ type Message interface {
 
 // RawMessage data you receive from TMI
 type RawMessage struct {
-	Raw     string
-	Type    MessageType
-	RawType string
-	Tags    map[string]string
-	Message string
+	Raw     string            `json:"raw,omitempty"`
+	Type    MessageType       `json:"type"`
+	RawType string            `json:"raw_type"`
+	Tags    map[string]string `json:"tags,omitempty"`
+	// Channel is the first param if it is a channel, without the leading #
+	Channel string `json:"channel,omitempty"`
+	// Message is the trailing param, empty if the line has none
+	Message string `json:"message,omitempty"`
+	// Params are all params of the line, including the channel and the trailing param
+	Params []string `json:"params,omitempty"`
+	// Source is the prefix of the line, nil if the line has none
+	Source *IRCMessageSource `json:"source,omitempty"`
 }
 
 // GetType implements the Message interface, and returns this message's type
@@ -88,18 +224,19 @@ func (msg *RawMessage) GetType() MessageType {
 
 // WhisperMessage data you receive from WHISPER message type
 type WhisperMessage struct {
-	User User
+	User User `json:"user"`
 
-	Raw       string
-	Type      MessageType
-	RawType   string
-	Tags      map[string]string
-	Message   string
-	Target    string
-	MessageID string
-	ThreadID  string
-	Emotes    []*Emote
-	Action    bool
+	Raw       string            `json:"raw,omitempty"`
+	Type      MessageType       `json:"type"`
+	RawType   string            `json:"raw_type"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Message   string            `json:"message"`
+	Target    string            `json:"target,omitempty"`
+	MessageID string            `json:"message_id,omitempty"`
+	ThreadID  string            `json:"thread_id,omitempty"`
+	Emotes    []*Emote          `json:"emotes,omitempty"`
+	Action    bool              `json:"action,omitempty"`
+	Source    *IRCMessageSource `json:"source,omitempty"`
 }
 
 // GetType implements the Message interface, and returns this message's type
@@ -109,31 +246,49 @@ func (msg *WhisperMessage) GetType() MessageType {
 
 // PrivateMessage data you receive from PRIVMSG message type
 type PrivateMessage struct {
-	User User
-
-	Raw            string
-	Type           MessageType
-	RawType        string
-	Tags           map[string]string
-	Message        string
-	Channel        string
-	RoomID         string
-	ID             string
-	Time           time.Time
-	Emotes         []*Emote
-	Bits           int
-	Action         bool
-	FirstMessage   bool
-	Reply          *Reply
-	CustomRewardID string
+	User User `json:"user"`
+
+	Raw            string            `json:"raw,omitempty"`
+	Type           MessageType       `json:"type"`
+	RawType        string            `json:"raw_type"`
+	Tags           map[string]string `json:"tags,omitempty"`
+	Message        string            `json:"message"`
+	Channel        string            `json:"channel"`
+	RoomID         string            `json:"room_id,omitempty"`
+	ID             string            `json:"id"`
+	Time           time.Time         `json:"time"`
+	Emotes         []*Emote          `json:"emotes,omitempty"`
+	Bits           int               `json:"bits,omitempty"`
+	Cheermotes     []Cheermote       `json:"cheermotes,omitempty"`
+	Action         bool              `json:"action,omitempty"`
+	FirstMessage   bool              `json:"first_message,omitempty"`
+	Reply          *Reply            `json:"reply,omitempty"`
+	CustomRewardID string            `json:"custom_reward_id,omitempty"`
+	ClientNonce    string            `json:"client_nonce,omitempty"`
+	// EmoteOnly whether the message consists only of emotes
+	EmoteOnly bool `json:"emote_only,omitempty"`
+	// MsgID marks special messages, e.g. "highlighted-message" for messages highlighted with channel points, or
+	// "skip-subs-mode-message" for messages sent in subscribers-only mode with channel points. Empty for regular messages
+	MsgID string `json:"msg_id,omitempty"`
+	// Flags are the spans of the message AutoMod flagged, empty if none
+	Flags []MessageFlag `json:"flags,omitempty"`
+	// Source is the prefix of the line, unrelated to the shared chat fields below
+	Source *IRCMessageSource `json:"source,omitempty"`
+
+	// Shared chat: messages sent in another channel of the shared chat session carry the
+	// room id, message id and badges of the channel the message originates from.
+	// Empty for messages that were sent in this channel
+	SourceRoomID string         `json:"source_room_id,omitempty"`
+	SourceID     string         `json:"source_id,omitempty"`
+	SourceBadges map[string]int `json:"source_badges,omitempty"`
 }
 
 type Reply struct {
-	ParentMsgID       string
-	ParentUserID      string
-	ParentUserLogin   string
-	ParentDisplayName string
-	ParentMsgBody     string
+	ParentMsgID       string `json:"parent_msg_id,omitempty"`
+	ParentUserID      string `json:"parent_user_id,omitempty"`
+	ParentUserLogin   string `json:"parent_user_login,omitempty"`
+	ParentDisplayName string `json:"parent_display_name,omitempty"`
+	ParentMsgBody     string `json:"parent_msg_body,omitempty"`
 }
 
 // GetType implements the Message interface, and returns this message's type
@@ -143,17 +298,19 @@ func (msg *PrivateMessage) GetType() MessageType {
 
 // ClearChatMessage data you receive from CLEARCHAT message type
 type ClearChatMessage struct {
-	Raw            string
-	Type           MessageType
-	RawType        string
-	Tags           map[string]string
-	Message        string
-	Channel        string
-	RoomID         string
-	Time           time.Time
-	BanDuration    int
-	TargetUserID   string
-	TargetUsername string
+	Raw            string            `json:"raw,omitempty"`
+	Type           MessageType       `json:"type"`
+	RawType        string            `json:"raw_type"`
+	Tags           map[string]string `json:"tags,omitempty"`
+	Message        string            `json:"message,omitempty"`
+	Channel        string            `json:"channel"`
+	RoomID         string            `json:"room_id,omitempty"`
+	Time           time.Time         `json:"time"`
+	BanDuration    time.Duration     `json:"ban_duration,omitempty"`
+	TargetUserID   string            `json:"target_user_id,omitempty"`
+	TargetUsername string            `json:"target_username,omitempty"`
+	// BanReason is the legacy ban-reason tag, which Twitch doesn't send anymore. It's only set in old logs
+	BanReason string `json:"ban_reason,omitempty"`
 }
 
 // GetType implements the Message interface, and returns this message's type
@@ -161,16 +318,31 @@ func (msg *ClearChatMessage) GetType() MessageType {
 	return msg.Type
 }
 
+// IsFullChatClear reports whether all messages of the channel were cleared, e.g. with /clear, instead of the messages of a single user
+func (msg *ClearChatMessage) IsFullChatClear() bool {
+	return msg.TargetUsername == "" && msg.TargetUserID == ""
+}
+
+// IsTimeout reports whether the target user was timed out for BanDuration
+func (msg *ClearChatMessage) IsTimeout() bool {
+	return !msg.IsFullChatClear() && msg.BanDuration > 0
+}
+
+// IsPermanentBan reports whether the target user was banned permanently, which is a clear without a ban duration
+func (msg *ClearChatMessage) IsPermanentBan() bool {
+	return !msg.IsFullChatClear() && msg.BanDuration <= 0
+}
+
 // ClearMessage data you receive from CLEARMSG message type
 type ClearMessage struct {
-	Raw         string
-	Type        MessageType
-	RawType     string
-	Tags        map[string]string
-	Message     string
-	Channel     string
-	Login       string
-	TargetMsgID string
+	Raw         string            `json:"raw,omitempty"`
+	Type        MessageType       `json:"type"`
+	RawType     string            `json:"raw_type"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Message     string            `json:"message,omitempty"`
+	Channel     string            `json:"channel"`
+	Login       string            `json:"login,omitempty"`
+	TargetMsgID string            `json:"target_msg_id,omitempty"`
 }
 
 // GetType implements the Message interface, and returns this message's type
@@ -180,14 +352,14 @@ func (msg *ClearMessage) GetType() MessageType {
 
 // RoomStateMessage data you receive from ROOMSTATE message type
 type RoomStateMessage struct {
-	Raw     string
-	Type    MessageType
-	RawType string
-	Tags    map[string]string
-	Message string
-	Channel string
-	RoomID  string
-	State   map[string]int
+	Raw     string            `json:"raw,omitempty"`
+	Type    MessageType       `json:"type"`
+	RawType string            `json:"raw_type"`
+	Tags    map[string]string `json:"tags,omitempty"`
+	Message string            `json:"message,omitempty"`
+	Channel string            `json:"channel"`
+	RoomID  string            `json:"room_id,omitempty"`
+	State   map[string]int    `json:"state,omitempty"`
 }
 
 // GetType implements the Message interface, and returns this message's type
@@ -197,21 +369,22 @@ func (msg *RoomStateMessage) GetType() MessageType {
 
 // UserNoticeMessage  data you receive from USERNOTICE message type
 type UserNoticeMessage struct {
-	User User
-
-	Raw       string
-	Type      MessageType
-	RawType   string
-	Tags      map[string]string
-	Message   string
-	Channel   string
-	RoomID    string
-	ID        string
-	Time      time.Time
-	Emotes    []*Emote
-	MsgID     string
-	MsgParams map[string]string
-	SystemMsg string
+	User User `json:"user"`
+
+	Raw       string            `json:"raw,omitempty"`
+	Type      MessageType       `json:"type"`
+	RawType   string            `json:"raw_type"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Message   string            `json:"message,omitempty"`
+	Channel   string            `json:"channel"`
+	RoomID    string            `json:"room_id,omitempty"`
+	ID        string            `json:"id"`
+	Time      time.Time         `json:"time"`
+	Emotes    []*Emote          `json:"emotes,omitempty"`
+	MsgID     string            `json:"msg_id,omitempty"`
+	MsgParams map[string]string `json:"msg_params,omitempty"`
+	// SystemMsg is the text Twitch shows for the notice, e.g. "X subscribed at Tier 1.", already unescaped
+	SystemMsg string `json:"system_msg,omitempty"`
 }
 
 // GetType implements the Message interface, and returns this message's type
@@ -221,15 +394,15 @@ func (msg *UserNoticeMessage) GetType() MessageType {
 
 // UserStateMessage data you receive from the USERSTATE message type
 type UserStateMessage struct {
-	User User
+	User User `json:"user"`
 
-	Raw       string
-	Type      MessageType
-	RawType   string
-	Tags      map[string]string
-	Message   string
-	Channel   string
-	EmoteSets []string
+	Raw       string            `json:"raw,omitempty"`
+	Type      MessageType       `json:"type"`
+	RawType   string            `json:"raw_type"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Message   string            `json:"message,omitempty"`
+	Channel   string            `json:"channel"`
+	EmoteSets []string          `json:"emote_sets,omitempty"`
 }
 
 // GetType implements the Message interface, and returns this message's type
@@ -239,13 +412,15 @@ func (msg *UserStateMessage) GetType() MessageType {
 
 // NoticeMessage data you receive from the NOTICE message type
 type NoticeMessage struct {
-	Raw     string
-	Type    MessageType
-	RawType string
-	Tags    map[string]string
-	Message string
-	Channel string
-	MsgID   string
+	Raw     string            `json:"raw,omitempty"`
+	Type    MessageType       `json:"type"`
+	RawType string            `json:"raw_type"`
+	Tags    map[string]string `json:"tags,omitempty"`
+	Message string            `json:"message,omitempty"`
+	Channel string            `json:"channel"`
+	MsgID   string            `json:"msg_id,omitempty"`
+	// Source is the prefix of the line, tmi.twitch.tv for notices of the server
+	Source *IRCMessageSource `json:"source,omitempty"`
 }
 
 // GetType implements the Message interface, and returns this message's type
@@ -256,15 +431,15 @@ func (msg *NoticeMessage) GetType() MessageType {
 // UserJoinMessage desJoines the message that is sent whenever a user joins a channel we're connected to
 // See https://dev.twitch.tv/docs/irc/membership/#join-twitch-membership
 type UserJoinMessage struct {
-	Raw     string
-	Type    MessageType
-	RawType string
+	Raw     string      `json:"raw,omitempty"`
+	Type    MessageType `json:"type"`
+	RawType string      `json:"raw_type"`
 
 	// Channel name
-	Channel string
+	Channel string `json:"channel"`
 
 	// User name
-	User string
+	User string `json:"user"`
 }
 
 // GetType implements the Message interface, and returns this message's type
@@ -275,15 +450,15 @@ func (msg *UserJoinMessage) GetType() MessageType {
 // UserPartMessage describes the message that is sent whenever a user leaves a channel we're connected to
 // See https://dev.twitch.tv/docs/irc/membership/#part-twitch-membership
 type UserPartMessage struct {
-	Raw     string
-	Type    MessageType
-	RawType string
+	Raw     string      `json:"raw,omitempty"`
+	Type    MessageType `json:"type"`
+	RawType string      `json:"raw_type"`
 
 	// Channel name
-	Channel string
+	Channel string `json:"channel"`
 
 	// User name
-	User string
+	User string `json:"user"`
 }
 
 // GetType implements the Message interface, and returns this message's type
@@ -294,13 +469,13 @@ func (msg *UserPartMessage) GetType() MessageType {
 // GlobalUserStateMessage On successful login, provides data about the current logged-in user through IRC tags
 // See https://dev.twitch.tv/docs/irc/tags/#globaluserstate-twitch-tags
 type GlobalUserStateMessage struct {
-	User User
+	User User `json:"user"`
 
-	Raw       string
-	Type      MessageType
-	RawType   string
-	Tags      map[string]string
-	EmoteSets []string
+	Raw       string            `json:"raw,omitempty"`
+	Type      MessageType       `json:"type"`
+	RawType   string            `json:"raw_type"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	EmoteSets []string          `json:"emote_sets,omitempty"`
 }
 
 // GetType implements the Message interface, and returns this message's type
@@ -310,9 +485,9 @@ func (msg *GlobalUserStateMessage) GetType() MessageType {
 
 // ReconnectMessage describes the
 type ReconnectMessage struct {
-	Raw     string
-	Type    MessageType
-	RawType string
+	Raw     string      `json:"raw,omitempty"`
+	Type    MessageType `json:"type"`
+	RawType string      `json:"raw_type"`
 }
 
 // GetType implements the Message interface, and returns this message's type
@@ -320,18 +495,18 @@ func (msg *ReconnectMessage) GetType() MessageType {
 	return msg.Type
 }
 
-// NamesMessage describes the data posted in response to a /names command
+// NamesMessage describes the data posted in response to a /names command, the END_OF_NAMES message is parsed into a NamesMessage without users.
 // See https://www.alien.net.au/irc/irc2numerics.html#353
 type NamesMessage struct {
-	Raw     string
-	Type    MessageType
-	RawType string
+	Raw     string      `json:"raw,omitempty"`
+	Type    MessageType `json:"type"`
+	RawType string      `json:"raw_type"`
 
 	// Channel name
-	Channel string
+	Channel string `json:"channel"`
 
 	// List of user names
-	Users []string
+	Users []string `json:"users,omitempty"`
 }
 
 // GetType implements the Message interface, and returns this message's type
@@ -341,11 +516,11 @@ func (msg *NamesMessage) GetType() MessageType {
 
 // PingMessage describes an IRC PING message
 type PingMessage struct {
-	Raw     string
-	Type    MessageType
-	RawType string
+	Raw     string      `json:"raw,omitempty"`
+	Type    MessageType `json:"type"`
+	RawType string      `json:"raw_type"`
 
-	Message string
+	Message string `json:"message,omitempty"`
 }
 
 // GetType implements the Message interface, and returns this message's type
@@ -355,11 +530,11 @@ func (msg *PingMessage) GetType() MessageType {
 
 // PongMessage describes an IRC PONG message
 type PongMessage struct {
-	Raw     string
-	Type    MessageType
-	RawType string
+	Raw     string      `json:"raw,omitempty"`
+	Type    MessageType `json:"type"`
+	RawType string      `json:"raw_type"`
 
-	Message string
+	Message string `json:"message,omitempty"`
 }
 
 // GetType implements the Message interface, and returns this message's type
@@ -367,44 +542,52 @@ func (msg *PongMessage) GetType() MessageType {
 	return msg.Type
 }
 
-// Client client to control your connection and attach callbacks
+// Client client to control your connection and attach callbacks.
+// Its methods can be called from any go-routine, including from inside callbacks.
+// The callbacks of received messages and OnConnect are called one after another on the go-routine handling the read lines,
+// see SetDispatchMode. The exceptions may run at the same time as them: OnChannelIdle and the OnMessageSent callbacks of
+// unconfirmed messages are called on a timer go-routine, OnSendQueueFull on the go-routine sending the message,
+// and OnStateChange on the go-routine changing the state
 type Client struct {
-	IrcAddress               string
-	ircUser                  string
-	ircToken                 string
-	TLS                      bool
-	connActive               tAtomBool
-	channels                 map[string]bool
-	channelUserlistMutex     *sync.RWMutex
-	channelUserlist          map[string]map[string]bool
-	channelsMtx              *sync.RWMutex
-	onConnect                func()
-	onWhisperMessage         func(message WhisperMessage)
-	onPrivateMessage         func(message PrivateMessage)
-	onClearChatMessage       func(message ClearChatMessage)
-	onRoomStateMessage       func(message RoomStateMessage)
-	onClearMessage           func(message ClearMessage)
-	onUserNoticeMessage      func(message UserNoticeMessage)
-	onUserStateMessage       func(message UserStateMessage)
-	onGlobalUserStateMessage func(message GlobalUserStateMessage)
-	onNoticeMessage          func(message NoticeMessage)
-	onUserJoinMessage        func(message UserJoinMessage)
-	onUserPartMessage        func(message UserPartMessage)
-	onSelfJoinMessage        func(message UserJoinMessage)
-	onSelfPartMessage        func(message UserPartMessage)
-	onReconnectMessage       func(message ReconnectMessage)
-	onNamesMessage           func(message NamesMessage)
-	onPingMessage            func(message PingMessage)
-	onPongMessage            func(message PongMessage)
-	onUnsetMessage           func(message RawMessage)
-
-	onPingSent func()
+	// unknownMessages is accessed atomically and comes first, so it's 64-bit aligned on 32-bit platforms
+	unknownMessages uint64
+
+	IrcAddress           string
+	ircUser              string
+	tokenProvider        TokenProvider
+	tokenRetryDelay      time.Duration
+	TLS                  bool
+	connActive           tAtomBool
+	running              tAtomBool
+	connectedMtx         *sync.Mutex
+	connected            chan struct{}
+	state                ConnectionState
+	stopped              chan struct{}
+	stopErr              error
+	channels             map[string]bool
+	joinsReady           bool
+	channelUserlistMutex *sync.RWMutex
+	channelUserlist      map[string]map[string]bool
+	trackUsers           tAtomBool
+	channelsMtx          *sync.RWMutex
+	handlers             *handlerRegistry
+	idleTimers           *idleTimers
+	roomStates           *roomStateCache
+	userStates           *userStateCache
+	emoteSets            []string
+	sendTracker          *sendTracker
+	trackSends           tAtomBool
+	emoteSetsMtx         *sync.RWMutex
 
 	// read is the incoming messages channel, normally buffered with ReadBufferSize
 	read chan string
 
-	// write is the outgoing messages channel, normally buffered with WriteBufferSize
+	// write is the outgoing chat messages channel, normally buffered with WriteBufferSize
 	write chan string
+	// writeMembership is the outgoing JOIN and PART channel, written before the chat messages
+	writeMembership chan string
+	// writeProtocol is the outgoing PING and PONG channel, written before all other lines
+	writeProtocol chan string
 
 	// clientReconnect is closed whenever the client needs to reconnect for connection issue reasons
 	clientReconnect chanCloser
@@ -412,6 +595,9 @@ type Client struct {
 	// userDisconnect is closed when the user calls Disconnect
 	userDisconnect chanCloser
 
+	// welcomePending is set by handleWelcome, the OnConnect callbacks are called once the welcome line is handled
+	welcomePending tAtomBool
+
 	// pongReceived is listened to by the pinger go-routine after it has sent off a ping. will be triggered by handleLine
 	pongReceived chan bool
 
@@ -439,181 +625,724 @@ type Client struct {
 	// If this is an empty list or nil, no CAP REQ message is sent at all
 	Capabilities []string
 
+	// SendClientNonce is the option whether a random client-nonce tag is added to every message sent with Say, SendMe or Reply.
+	// Twitch echoes the nonce back, which lets you correlate your own sent messages with the messages you receive.
+	// The variable may only be modified before calling Connect
+	SendClientNonce bool
+
+	// SendConfirmationTimeout is the time to wait for Twitch to acknowledge a sent message,
+	// before it's reported to OnMessageSent as unconfirmed.
+	// The variable may only be modified before calling Connect
+	SendConfirmationTimeout time.Duration
+
+	// RecoverPanics is the option whether panics inside of callbacks are recovered.
+	// A recovered panic is passed to the OnHandlerPanic callbacks, and the client keeps handling the next messages.
+	// Disable it if you prefer a panicking callback to crash your program.
+	// The variable may only be modified before calling Connect
+	RecoverPanics bool
+
+	// messages is the channel returned by Messages, created on the first call
+	messages        chan Message
+	messagesDropped uint64
+	messagesMtx     sync.Mutex
+
+	// Options of the worker pool callbacks are called on, see SetDispatchMode
+	dispatchMode           DispatchMode
+	dispatchWorkers        int
+	dispatchQueueSize      int
+	dispatchOverflowPolicy OverflowPolicy
+
+	// dispatchPool is only set while connected in DispatchAsync mode
+	dispatchPool *dispatchPool
+
 	// The ratelimits the client will respect when sending messages
 	joinRateLimiter RateLimiter
+
+	// writeTimeout is the deadline of every write to the connection, see SetWriteTimeout
+	writeTimeout time.Duration
+
+	// connectTimeout is the deadline of dialing the server, including the TLS handshake, see SetConnectTimeout
+	connectTimeout time.Duration
+
+	// parseOptions turn off parsing fields of received messages, see SetParseOptions
+	parseOptions ParseOptions
+
+	// metrics receives the metrics of the connection, see SetMetricsCollector
+	metrics MetricsCollector
+	// stats are the counters returned by Stats
+	stats *clientStats
+
+	// logger receives the log messages about internal events, see SetLogger
+	logger Logger
+
+	// sendAllowlist are the only channels messages can be sent to, all channels if empty, see SetSendAllowlist
+	sendAllowlist    map[string]bool
+	sendAllowlistMtx sync.RWMutex
+
+	// recorder writes the read and sent lines to the recording, nil if the client isn't recording, see SetRecording
+	recorder *recorder
+
+	// anonymous whether the client was created with NewAnonymousClient and logs in without a token
+	anonymous bool
+
+	// notifyInitialRoomModes whether the room mode callbacks are called for the state received when joining, see SetNotifyInitialRoomModes
+	notifyInitialRoomModes bool
+
+	// sendQueueHighWaterMark is the number of queued lines OnSendQueueFull is called at, see SetSendQueueHighWaterMark
+	sendQueueHighWaterMark int
+	sendQueueFull          tAtomBool
+
+	// queueEarlySends whether messages sent before Twitch welcomed the client are queued instead of rejected, see SetQueueEarlySends
+	queueEarlySends bool
+
+	// pendingNames are the NAMES messages of each channel merged until the END_OF_NAMES message.
+	// Only accessed by the go-routine handling the lines
+	pendingNames map[string]*pendingNames
 }
 
-// NewClient to create a new client
+// NewClient to create a new client. The oauth token is accepted with or without the "oauth:" prefix
 func NewClient(username, oauth string) *Client {
-	return &Client{
+	client := &Client{
 		ircUser:         username,
-		ircToken:        oauth,
+		tokenProvider:   StaticToken(oauth),
+		tokenRetryDelay: defaultTokenRetryDelay,
 		TLS:             true,
 		channels:        map[string]bool{},
 		channelUserlist: map[string]map[string]bool{},
 		channelsMtx:     &sync.RWMutex{},
+		connectedMtx:    &sync.Mutex{},
+		connected:       make(chan struct{}),
+		stopped:         make(chan struct{}),
+		handlers:        newHandlerRegistry(),
+		idleTimers:      newIdleTimers(),
+		roomStates:      newRoomStateCache(),
+		userStates:      newUserStateCache(),
+		sendTracker:     newSendTracker(MaxPendingSends),
+		emoteSetsMtx:    &sync.RWMutex{},
 		messageReceived: make(chan bool),
 
-		read:  make(chan string, ReadBufferSize),
-		write: make(chan string, WriteBufferSize),
+		read:            make(chan string, ReadBufferSize),
+		write:           make(chan string, WriteBufferSize),
+		writeMembership: make(chan string, WriteBufferSize),
+		writeProtocol:   make(chan string, WriteBufferSize),
 
 		// NOTE: IdlePingInterval must be higher than PongTimeout
 		SendPings:        true,
 		IdlePingInterval: time.Second * 15,
 		PongTimeout:      time.Second * 5,
 
+		RecoverPanics: true,
+
+		SendConfirmationTimeout: time.Second * 10,
+
+		queueEarlySends:        true,
+		sendQueueHighWaterMark: WriteBufferSize * 3 / 4,
+
+		writeTimeout:   time.Second * 10,
+		connectTimeout: time.Second * 10,
+
 		channelUserlistMutex: &sync.RWMutex{},
 
 		Capabilities: DefaultCapabilities,
 
 		joinRateLimiter: CreateDefaultRateLimiter(),
+
+		metrics: NoopMetricsCollector{},
+		stats:   &clientStats{},
+		logger:  NoopLogger{},
 	}
+
+	client.trackUsers.set(true)
+
+	return client
 }
 
-// NewAnonymousClient to create a new client without login requirements (anonymous user)
-// Do note that the Say and Whisper functions will be ineffectual when using this constructor
+// NewAnonymousClient to create a new client without login requirements (anonymous user).
+// It logs in as a random justinfan user without sending a PASS line, which Twitch accepts for reading chat.
+// Anonymous clients can't send messages, Say, Reply and the chat commands return ErrAnonymousClient
 func NewAnonymousClient() *Client {
-	return NewClient("justinfan123123", "oauth:59301")
+	client := NewClient(newAnonymousUsername(), "")
+	client.anonymous = true
+
+	return client
+}
+
+// newAnonymousUsername returns a random username of the form justinfan<digits> that Twitch accepts without a token
+func newAnonymousUsername() string {
+	number := make([]byte, 4)
+	_, _ = rand.Read(number)
+
+	return fmt.Sprintf("justinfan%d", 10000+binary.BigEndian.Uint32(number)%90000)
 }
 
-// OnConnect attach callback to when a connection has been established
-func (c *Client) OnConnect(callback func()) {
-	c.onConnect = callback
+// OnConnect attach callback to when a connection has been established. The callback is called before the callbacks of the welcome message
+func (c *Client) OnConnect(callback func()) HandlerID {
+	return c.handlers.add(connectEvent, func(interface{}) {
+		callback()
+	})
 }
 
 // OnWhisperMessage attach callback to new whisper
-func (c *Client) OnWhisperMessage(callback func(message WhisperMessage)) {
-	c.onWhisperMessage = callback
+func (c *Client) OnWhisperMessage(callback func(message WhisperMessage)) HandlerID {
+	return c.handlers.add(whisperMessageEvent, func(payload interface{}) {
+		callback(*payload.(*WhisperMessage))
+	})
 }
 
 // OnPrivateMessage attach callback to new standard chat messages
-func (c *Client) OnPrivateMessage(callback func(message PrivateMessage)) {
-	c.onPrivateMessage = callback
+func (c *Client) OnPrivateMessage(callback func(message PrivateMessage)) HandlerID {
+	return c.handlers.add(privateMessageEvent, func(payload interface{}) {
+		callback(*payload.(*PrivateMessage))
+	})
 }
 
 // OnClearChatMessage attach callback to new messages such as timeouts
-func (c *Client) OnClearChatMessage(callback func(message ClearChatMessage)) {
-	c.onClearChatMessage = callback
+func (c *Client) OnClearChatMessage(callback func(message ClearChatMessage)) HandlerID {
+	return c.handlers.add(clearChatMessageEvent, func(payload interface{}) {
+		callback(*payload.(*ClearChatMessage))
+	})
 }
 
 // OnClearMessage attach callback when a single message is deleted
-func (c *Client) OnClearMessage(callback func(message ClearMessage)) {
-	c.onClearMessage = callback
+func (c *Client) OnClearMessage(callback func(message ClearMessage)) HandlerID {
+	return c.handlers.add(clearMessageEvent, func(payload interface{}) {
+		callback(*payload.(*ClearMessage))
+	})
 }
 
 // OnRoomStateMessage attach callback to new messages such as submode enabled
-func (c *Client) OnRoomStateMessage(callback func(message RoomStateMessage)) {
-	c.onRoomStateMessage = callback
+func (c *Client) OnRoomStateMessage(callback func(message RoomStateMessage)) HandlerID {
+	return c.handlers.add(roomStateMessageEvent, func(payload interface{}) {
+		callback(*payload.(*RoomStateMessage))
+	})
 }
 
 // OnUserNoticeMessage attach callback to new usernotice message such as sub, resub, and raids
-func (c *Client) OnUserNoticeMessage(callback func(message UserNoticeMessage)) {
-	c.onUserNoticeMessage = callback
+func (c *Client) OnUserNoticeMessage(callback func(message UserNoticeMessage)) HandlerID {
+	return c.handlers.add(userNoticeMessageEvent, func(payload interface{}) {
+		callback(*payload.(*UserNoticeMessage))
+	})
 }
 
 // OnUserStateMessage attach callback to new userstate
-func (c *Client) OnUserStateMessage(callback func(message UserStateMessage)) {
-	c.onUserStateMessage = callback
+func (c *Client) OnUserStateMessage(callback func(message UserStateMessage)) HandlerID {
+	return c.handlers.add(userStateMessageEvent, func(payload interface{}) {
+		callback(*payload.(*UserStateMessage))
+	})
 }
 
 // OnGlobalUserStateMessage attach callback to new global user state
-func (c *Client) OnGlobalUserStateMessage(callback func(message GlobalUserStateMessage)) {
-	c.onGlobalUserStateMessage = callback
+func (c *Client) OnGlobalUserStateMessage(callback func(message GlobalUserStateMessage)) HandlerID {
+	return c.handlers.add(globalUserStateMessageEvent, func(payload interface{}) {
+		callback(*payload.(*GlobalUserStateMessage))
+	})
 }
 
 // OnNoticeMessage attach callback to new notice message such as hosts
-func (c *Client) OnNoticeMessage(callback func(message NoticeMessage)) {
-	c.onNoticeMessage = callback
+func (c *Client) OnNoticeMessage(callback func(message NoticeMessage)) HandlerID {
+	return c.handlers.add(noticeMessageEvent, func(payload interface{}) {
+		callback(*payload.(*NoticeMessage))
+	})
 }
 
 // OnUserJoinMessage attaches callback to user joins
-func (c *Client) OnUserJoinMessage(callback func(message UserJoinMessage)) {
-	c.onUserJoinMessage = callback
+func (c *Client) OnUserJoinMessage(callback func(message UserJoinMessage)) HandlerID {
+	return c.handlers.add(userJoinMessageEvent, func(payload interface{}) {
+		callback(*payload.(*UserJoinMessage))
+	})
 }
 
 // OnUserPartMessage attaches callback to user parts
-func (c *Client) OnUserPartMessage(callback func(message UserPartMessage)) {
-	c.onUserPartMessage = callback
+func (c *Client) OnUserPartMessage(callback func(message UserPartMessage)) HandlerID {
+	return c.handlers.add(userPartMessageEvent, func(payload interface{}) {
+		callback(*payload.(*UserPartMessage))
+	})
 }
 
 // OnSelfJoinMessage attaches callback to user JOINs of client's own user
 // Twitch will send us JOIN messages for our own user even without requesting twitch.tv/membership capability
-func (c *Client) OnSelfJoinMessage(callback func(message UserJoinMessage)) {
-	c.onSelfJoinMessage = callback
+func (c *Client) OnSelfJoinMessage(callback func(message UserJoinMessage)) HandlerID {
+	return c.handlers.add(selfJoinMessageEvent, func(payload interface{}) {
+		callback(*payload.(*UserJoinMessage))
+	})
 }
 
 // OnSelfJoinMessage attaches callback to user PARTs of client's own user
 // Twitch will send us PART messages for our own user even without requesting twitch.tv/membership capability
-func (c *Client) OnSelfPartMessage(callback func(message UserPartMessage)) {
-	c.onSelfPartMessage = callback
+func (c *Client) OnSelfPartMessage(callback func(message UserPartMessage)) HandlerID {
+	return c.handlers.add(selfPartMessageEvent, func(payload interface{}) {
+		callback(*payload.(*UserPartMessage))
+	})
 }
 
-// OnReconnectMessage attaches callback that is triggered whenever the twitch servers tell us to reconnect
-func (c *Client) OnReconnectMessage(callback func(message ReconnectMessage)) {
-	c.onReconnectMessage = callback
+// OnReconnectMessage attaches callback that is triggered whenever the twitch servers tell us to reconnect.
+// The client reconnects and rejoins all channels on its own, the callback is only a notification
+func (c *Client) OnReconnectMessage(callback func(message ReconnectMessage)) HandlerID {
+	return c.handlers.add(reconnectMessageEvent, func(payload interface{}) {
+		callback(*payload.(*ReconnectMessage))
+	})
 }
 
-// OnNamesMessage attaches callback to /names response
-func (c *Client) OnNamesMessage(callback func(message NamesMessage)) {
-	c.onNamesMessage = callback
+// OnNamesMessage attaches callback to /names response. The NAMES messages of a channel are merged,
+// callback is called once with all names when the END_OF_NAMES message of the channel arrives
+func (c *Client) OnNamesMessage(callback func(message NamesMessage)) HandlerID {
+	return c.handlers.add(namesMessageEvent, func(payload interface{}) {
+		callback(*payload.(*NamesMessage))
+	})
 }
 
 // OnPingMessage attaches callback to PING message
-func (c *Client) OnPingMessage(callback func(message PingMessage)) {
-	c.onPingMessage = callback
+func (c *Client) OnPingMessage(callback func(message PingMessage)) HandlerID {
+	return c.handlers.add(pingMessageEvent, func(payload interface{}) {
+		callback(*payload.(*PingMessage))
+	})
 }
 
 // OnPongMessage attaches callback to PONG message
-func (c *Client) OnPongMessage(callback func(message PongMessage)) {
-	c.onPongMessage = callback
+func (c *Client) OnPongMessage(callback func(message PongMessage)) HandlerID {
+	return c.handlers.add(pongMessageEvent, func(payload interface{}) {
+		callback(*payload.(*PongMessage))
+	})
 }
 
 // OnUnsetMessage attaches callback to message types we currently don't support
-func (c *Client) OnUnsetMessage(callback func(message RawMessage)) {
-	c.onUnsetMessage = callback
+func (c *Client) OnUnsetMessage(callback func(message RawMessage)) HandlerID {
+	return c.handlers.add(unsetMessageEvent, func(payload interface{}) {
+		callback(*payload.(*RawMessage))
+	})
+}
+
+// OnUnknownMessage attaches callback to messages of commands the library doesn't know about, like a command newly introduced by Twitch.
+// Unlike OnUnsetMessage, it isn't called for the commands that are known but not parsed into their own type, like the welcome messages
+func (c *Client) OnUnknownMessage(callback func(message RawMessage)) HandlerID {
+	return c.handlers.add(unknownMessageEvent, func(payload interface{}) {
+		callback(*payload.(*RawMessage))
+	})
 }
 
 // OnPingSent attaches callback that's called whenever the client sends out a ping message
-func (c *Client) OnPingSent(callback func()) {
-	c.onPingSent = callback
+func (c *Client) OnPingSent(callback func()) HandlerID {
+	return c.handlers.add(pingSentEvent, func(interface{}) {
+		callback()
+	})
+}
+
+// OnHandlerPanic attaches callback that's called whenever one of the other callbacks panics.
+// message is the message that was being handled, and is nil for callbacks without a message like OnConnect.
+// Only called if RecoverPanics is enabled
+func (c *Client) OnHandlerPanic(callback func(message Message, recovered interface{}, stack []byte)) HandlerID {
+	return c.handlers.add(handlerPanicEvent, func(payload interface{}) {
+		panicked := payload.(handlerPanic)
+		callback(panicked.message, panicked.recovered, panicked.stack)
+	})
+}
+
+// OnMessageDropped attaches callback that's called whenever a message is dropped because the worker queue is full.
+// Only called in DispatchAsync mode with a dropping OverflowPolicy. The callback is called on the reading go-routine, so keep it fast
+func (c *Client) OnMessageDropped(callback func(message Message)) HandlerID {
+	return c.handlers.add(messageDroppedEvent, func(payload interface{}) {
+		message, _ := payload.(Message)
+		callback(message)
+	})
+}
+
+// OnEmoteSetsChanged attaches callback that's called whenever the emote sets of the client's own user change.
+// The emote sets are taken from USERSTATE and GLOBALUSERSTATE messages, the first received emote sets are all reported as added
+func (c *Client) OnEmoteSetsChanged(callback func(added, removed []string)) HandlerID {
+	return c.handlers.add(emoteSetsChangedEvent, func(payload interface{}) {
+		change := payload.(emoteSetsChange)
+		callback(change.added, change.removed)
+	})
+}
+
+// OnMessageSent attaches callback that's called whenever Twitch acknowledged a message sent with Say, SendMe or Reply,
+// or gave up waiting for the acknowledgment after the SendConfirmationTimeout.
+// Attaching the callback adds a client-nonce tag to all sent messages, which is how sent messages are recognized.
+// Unconfirmed messages are reported from another go-routine than the messages read from the connection
+func (c *Client) OnMessageSent(callback func(confirmation SentMessageConfirmation)) HandlerID {
+	c.trackSends.set(true)
+
+	return c.handlers.add(messageSentEvent, func(payload interface{}) {
+		callback(payload.(SentMessageConfirmation))
+	})
+}
+
+// OnSendError attaches callback that's called whenever Twitch rejects a message sent by the client, e.g. because
+// the client's user is banned or the channel is in followers-only mode. Twitch reports the rejection with a NOTICE message.
+// If OnMessageSent is used as well, the oldest pending message of the channel is reported to it as rejected
+func (c *Client) OnSendError(callback func(channel string, reason NoticeID, notice NoticeMessage)) HandlerID {
+	return c.handlers.add(sendErrorEvent, func(payload interface{}) {
+		rejected := payload.(sendError)
+		callback(rejected.notice.Channel, rejected.reason, *rejected.notice)
+	})
+}
+
+// OnUserlistChange attaches callback that's called whenever users are added to or removed from the userlist of a channel,
+// see SetTrackUsers. joined or parted is nil if no user joined or parted
+func (c *Client) OnUserlistChange(callback func(channel string, joined, parted []string)) HandlerID {
+	return c.handlers.add(userlistChangeEvent, func(payload interface{}) {
+		change := payload.(userlistChange)
+		callback(change.channel, change.joined, change.parted)
+	})
+}
+
+// OnRawLine attaches callback that's called with every line read from the connection, before it's parsed.
+// The line is passed as received, without the trailing \r\n. The callback is called on the reading go-routine
+// in all dispatch modes, so keep it fast
+func (c *Client) OnRawLine(callback func(line string)) HandlerID {
+	return c.handlers.add(rawLineEvent, func(payload interface{}) {
+		callback(payload.(string))
+	})
+}
+
+// OnHost attaches callback to a channel starting or stopping to host another channel. target is empty when the channel stopped hosting,
+// viewers is 0 when the number of viewers is unknown. Host changes are read from both HOSTTARGET messages and the host_on and host_off NOTICEs,
+// so a single host can be reported more than once.
+// Twitch removed hosting in 2022, but the messages may still be sent in some contexts, e.g. by replayed logs or other IRC servers
+func (c *Client) OnHost(callback func(channel, target string, viewers int)) HandlerID {
+	return c.handlers.add(hostEvent, func(payload interface{}) {
+		change := payload.(hostChange)
+		callback(change.channel, change.target, change.viewers)
+	})
 }
 
-// Say write something in a chat
-func (c *Client) Say(channel, text string) {
-	channel = strings.ToLower(channel)
+// OnEmoteOnly attaches callback to emote-only mode being enabled or disabled in a channel.
+// Only called for changes, not for the state received when joining the channel, see SetNotifyInitialRoomModes
+func (c *Client) OnEmoteOnly(callback func(channel string, enabled bool)) HandlerID {
+	return c.handlers.add(emoteOnlyEvent, func(payload interface{}) {
+		change := payload.(roomModeChange)
+		callback(change.channel, change.value == 1)
+	})
+}
+
+// OnSubMode attaches callback to subscribers-only mode being enabled or disabled in a channel.
+// Only called for changes, not for the state received when joining the channel, see SetNotifyInitialRoomModes
+func (c *Client) OnSubMode(callback func(channel string, enabled bool)) HandlerID {
+	return c.handlers.add(subModeEvent, func(payload interface{}) {
+		change := payload.(roomModeChange)
+		callback(change.channel, change.value == 1)
+	})
+}
+
+// OnSlowMode attaches callback to the slow mode of a channel changing. seconds is the time users have to wait between messages,
+// 0 if slow mode was disabled. Only called for changes, not for the state received when joining the channel, see SetNotifyInitialRoomModes
+func (c *Client) OnSlowMode(callback func(channel string, seconds int)) HandlerID {
+	return c.handlers.add(slowModeEvent, func(payload interface{}) {
+		change := payload.(roomModeChange)
+		callback(change.channel, change.value)
+	})
+}
+
+// OnFollowersMode attaches callback to the followers-only mode of a channel changing. minutes is the time users have to follow
+// the channel to chat, 0 means all followers can chat and -1 that followers-only mode was disabled.
+// Only called for changes, not for the state received when joining the channel, see SetNotifyInitialRoomModes
+func (c *Client) OnFollowersMode(callback func(channel string, minutes int)) HandlerID {
+	return c.handlers.add(followersModeEvent, func(payload interface{}) {
+		change := payload.(roomModeChange)
+		callback(change.channel, change.value)
+	})
+}
+
+// OnRoomStateChange attaches callback to settings of a channel changing, e.g. "slow: 0 -> 30" when a moderator enabled slow mode.
+// The changes are computed by merging each ROOMSTATE message into the room state, see GetRoomState. The state received when
+// joining a channel is reported with all settings changing from unknown, their OldValue is nil
+func (c *Client) OnRoomStateChange(callback func(channel string, changes []RoomStateChange)) HandlerID {
+	return c.handlers.add(roomStateChangeEvent, func(payload interface{}) {
+		change := payload.(roomStateChanges)
+		callback(change.channel, change.changes)
+	})
+}
+
+// OnSendQueueFull attaches callback to the number of lines waiting to be written reaching the high-water mark of
+// SetSendQueueHighWaterMark, e.g. to stop sending until the backlog shrank, see PendingSends. It's called once
+// until the number dropped below the mark again. The callback is called on the go-routine sending the message
+func (c *Client) OnSendQueueFull(callback func()) HandlerID {
+	return c.handlers.add(sendQueueFullEvent, func(interface{}) {
+		callback()
+	})
+}
+
+// OnChannelIdle attaches callback to no PRIVMSG being seen in the channel for the given duration, e.g. to notice that chat died
+// or the stream ended. The timer starts once the channel is joined, or right away if it's already joined, and restarts with every message.
+// callback is called once per quiet period, the next message starts the timer again. Depart and Disconnect stop the timer,
+// joining the channel again restarts it. The callback is called on the go-routine of the timer
+func (c *Client) OnChannelIdle(channel string, after time.Duration, callback func(channel string)) HandlerID {
+	channel, _ = normalizeChannel(channel)
+
+	var id HandlerID
+	id = c.handlers.add(channelIdleEvent, func(payload interface{}) {
+		idle := payload.(channelIdle)
+		if idle.id == id {
+			callback(idle.channel)
+		}
+	})
+
+	c.channelsMtx.RLock()
+	joined := c.channels[channel]
+	c.channelsMtx.RUnlock()
+
+	c.idleTimers.add(id, channel, after, func() {
+		c.callHandlers(channelIdleEvent, channelIdle{id: id, channel: channel})
+	}, joined)
+
+	return id
+}
+
+// RemoveHandler detaches a callback previously attached with one of the On... methods.
+// Returns false if no callback with the given id is attached
+func (c *Client) RemoveHandler(id HandlerID) bool {
+	c.idleTimers.remove(id)
+
+	return c.handlers.remove(id)
+}
+
+// Say write something in a chat.
+// Returns ErrInvalidText if the text contains line breaks or other control characters, so it can't be used to send other commands.
+// Returns ErrInvalidChannel for an invalid channel name, or ErrChannelNotAllowed if the channel isn't in the allowlist of SetSendAllowlist.
+// Anonymous clients return ErrAnonymousClient. The message is only queued to be written, if the queue is full ErrQueueFull is returned
+func (c *Client) Say(channel, text string) error {
+	return c.sendPrivateMessage(map[string]string{}, channel, text)
+}
+
+// SayAndWait write something in a chat like Say, and block until Twitch acknowledged or rejected the message.
+// Returns the message as posted, with the ID Twitch gave it and the client's own user from the acknowledging USERSTATE.
+// Returns ErrMessageRejected wrapping the reason if Twitch rejected the message, e.g. because of the rate limit or a ban,
+// ErrMessageUnconfirmed if Twitch didn't acknowledge it within the SendConfirmationTimeout, or the error of ctx once it's done.
+// The message is reported to OnMessageSent as well
+func (c *Client) SayAndWait(ctx context.Context, channel, text string) (PrivateMessage, error) {
+	done := make(chan SentMessageConfirmation, 1)
+
+	channel, err := c.sendTrackedPrivateMessage(map[string]string{}, channel, text, done)
+	if err != nil {
+		return PrivateMessage{}, err
+	}
+
+	select {
+	case confirmation := <-done:
+		return c.sentPrivateMessage(confirmation)
+	case <-ctx.Done():
+		return PrivateMessage{}, ctx.Err()
+	}
+}
+
+// sentPrivateMessage returns the message acknowledged by Twitch, or the error the message was rejected or given up on with
+func (c *Client) sentPrivateMessage(confirmation SentMessageConfirmation) (PrivateMessage, error) {
+	if confirmation.RejectReason != "" {
+		return PrivateMessage{}, fmt.Errorf("%w: %s", ErrMessageRejected, confirmation.RejectReason)
+	}
+	if !confirmation.Confirmed {
+		return PrivateMessage{}, ErrMessageUnconfirmed
+	}
+
+	message := PrivateMessage{
+		Type:        PRIVMSG,
+		RawType:     "PRIVMSG",
+		Tags:        map[string]string{"client-nonce": confirmation.Nonce, "id": confirmation.MessageID},
+		Message:     confirmation.Text,
+		Channel:     confirmation.Channel,
+		ID:          confirmation.MessageID,
+		Time:        confirmation.SentAt,
+		ClientNonce: confirmation.Nonce,
+	}
+	if userState, ok := c.userStates.get(confirmation.Channel); ok {
+		message.User = userState.User
+	}
+	if roomState, ok := c.roomStates.get(confirmation.Channel); ok {
+		message.RoomID = roomState.RoomID
+	}
+
+	return message, nil
+}
+
+// SayWithNonce write something in a chat, with the given client-nonce tag instead of a random one.
+// The nonce is echoed back by Twitch, see SendClientNonce
+func (c *Client) SayWithNonce(channel, text, nonce string) error {
+	return c.sendPrivateMessage(map[string]string{"client-nonce": nonce}, channel, text)
+}
+
+// SendMe write something in a chat as an action, like the /me command.
+// The text is wrapped in the CTCP ACTION framing, which Twitch renders in the user's color
+func (c *Client) SendMe(channel, text string) error {
+	return c.Say(channel, "\u0001ACTION "+text+"\u0001")
+}
+
+// Reply to a message previously sent in the same channel using the twitch reply feature.
+// Returns ErrInvalidText if the text or parentMsgId contain line breaks or other control characters
+func (c *Client) Reply(channel, parentMsgId string, text string) error {
+	if err := checkText(parentMsgId); err != nil {
+		return err
+	}
+
+	return c.sendPrivateMessage(map[string]string{"reply-parent-msg-id": parentMsgId}, channel, text)
+}
+
+// SendRaw sends a raw IRC line, e.g. a command the client has no method for. A trailing line break is removed,
+// any other line break returns ErrInvalidText, so a single line is sent. Unlike Say the line isn't checked otherwise,
+// it's queued like the lines the client sends itself
+func (c *Client) SendRaw(line string) error {
+	line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+	if strings.ContainsAny(line, "\r\n") {
+		return fmt.Errorf("%w: %q", ErrInvalidText, line)
+	}
+
+	c.send(line)
+
+	return nil
+}
+
+// SetSendAllowlist restricts the channels the client sends messages and chat commands to, e.g. to keep a bot that sends
+// to channels taken from user input from spamming other channels. Sending to any other channel returns ErrChannelNotAllowed.
+// An empty allowlist, the default, allows all channels. Can be called at any time
+func (c *Client) SetSendAllowlist(channels []string) {
+	allowlist := make(map[string]bool, len(channels))
+	for _, channel := range channels {
+		name, _ := normalizeChannel(channel)
+		allowlist[name] = true
+	}
 
-	c.send(fmt.Sprintf("PRIVMSG #%s :%s", channel, text))
+	c.sendAllowlistMtx.Lock()
+	defer c.sendAllowlistMtx.Unlock()
+
+	c.sendAllowlist = allowlist
+}
+
+// checkEarlySend returns ErrConnectionIsNotOpen if the client isn't connected and early sends aren't queued, see SetQueueEarlySends
+func (c *Client) checkEarlySend() error {
+	if !c.queueEarlySends && !c.connActive.get() {
+		return ErrConnectionIsNotOpen
+	}
+
+	return nil
+}
+
+// checkSendAllowed returns ErrChannelNotAllowed if the channel isn't in the allowlist of SetSendAllowlist
+func (c *Client) checkSendAllowed(channel string) error {
+	c.sendAllowlistMtx.RLock()
+	defer c.sendAllowlistMtx.RUnlock()
+
+	if len(c.sendAllowlist) > 0 && !c.sendAllowlist[channel] {
+		c.logger.Warnf("not sending to #%s, it's not in the send allowlist", channel)
+		return fmt.Errorf("%w: #%s", ErrChannelNotAllowed, channel)
+	}
+
+	return nil
+}
+
+// sendPrivateMessage sends a PRIVMSG with the given tags, and a client-nonce tag if SendClientNonce is enabled
+func (c *Client) sendPrivateMessage(tags map[string]string, channel, text string) error {
+	_, err := c.sendTrackedPrivateMessage(tags, channel, text, nil)
+	return err
+}
+
+// sendTrackedPrivateMessage sends a PRIVMSG like sendPrivateMessage. If done isn't nil the message is tracked even without
+// OnMessageSent, and done receives it once it's confirmed, rejected or given up on. Returns the normalized channel
+func (c *Client) sendTrackedPrivateMessage(tags map[string]string, channel, text string, done chan<- SentMessageConfirmation) (string, error) {
+	if c.anonymous {
+		return "", ErrAnonymousClient
+	}
+
+	if err := c.checkEarlySend(); err != nil {
+		return "", err
+	}
+
+	channel, err := normalizeChannel(channel)
+	if err != nil {
+		return "", err
+	}
+
+	if err := c.checkSendAllowed(channel); err != nil {
+		return "", err
+	}
+
+	if err := checkText(text); err != nil {
+		return "", err
+	}
+
+	tracked := c.trackSends.get() || done != nil
+	if _, ok := tags["client-nonce"]; !ok && (c.SendClientNonce || tracked) {
+		tags["client-nonce"] = newClientNonce()
+	}
+
+	if tracked {
+		confirmation := SentMessageConfirmation{
+			Channel: channel,
+			Nonce:   tags["client-nonce"],
+			Text:    text,
+			SentAt:  time.Now(),
+		}
+
+		// Unconfirmed messages are reported outside of the dispatcher, which may have been stopped when they expire
+		evicted, ok := c.sendTracker.add(confirmation, c.SendConfirmationTimeout, func(expired SentMessageConfirmation) {
+			c.callHandlers(messageSentEvent, expired)
+		}, done)
+		if ok {
+			c.callHandlers(messageSentEvent, evicted)
+		}
+	}
+
+	line := fmt.Sprintf("PRIVMSG #%s :%s", channel, text)
+	if len(tags) > 0 {
+		line = formatIRCTags(tags) + " " + line
+	}
+
+	if err := c.sendMessage(line); err != nil {
+		if tracked {
+			c.sendTracker.remove(tags["client-nonce"])
+		}
+		return "", err
+	}
+
+	return channel, nil
 }
 
-// Reply to a message previously sent in the same channel using the twitch reply feature
-func (c *Client) Reply(channel, parentMsgId string, text string) {
-	channel = strings.ToLower(channel)
+// newClientNonce returns a random nonce in the format Twitch's web chat uses, 32 hex characters
+func newClientNonce() string {
+	nonce := make([]byte, 16)
+	_, _ = rand.Read(nonce)
 
-	c.send(fmt.Sprintf("@reply-parent-msg-id=%s PRIVMSG #%s :%s", parentMsgId, channel, text))
+	return hex.EncodeToString(nonce)
 }
 
 // Join enter a twitch channel to read more messages.
 // It will respect the given ratelimits.
-// This is not a blocking operation.
-func (c *Client) Join(channels ...string) {
-	messages, joined := c.createJoinMessages(channels...)
+// This is not a blocking operation. It can be called at any time, channels joined before Twitch welcomed the client
+// are joined once connected, each channel once.
+// The channels are lowercased and may start with #. Returns ErrInvalidChannel without joining any of the channels
+// if one of them is empty or contains spaces or commas
+func (c *Client) Join(channels ...string) error {
+	channels, err := normalizeChannels(channels)
+	if err != nil {
+		return err
+	}
 
-	// If we have an active connection, explicitly join
-	// before we add the joined channels to our map
 	c.channelsMtx.Lock()
-	for _, message := range messages {
-		if c.connActive.get() {
+	defer c.channelsMtx.Unlock()
+
+	c.join(channels)
+
+	return nil
+}
+
+// join must be called with channelsMtx held. Once Twitch welcomed the client the channels not joined yet are joined,
+// before that they're only added to the map and joined by initialJoins
+func (c *Client) join(channels []string) {
+	messages, joined := c.createJoinMessages(channels...)
+
+	if c.joinsReady {
+		for _, message := range messages {
 			c.send(message)
 		}
 	}
 
 	for _, channel := range joined {
-		c.channels[channel] = c.connActive.get()
-		c.channelUserlistMutex.Lock()
-		c.channelUserlist[channel] = map[string]bool{}
-		c.channelUserlistMutex.Unlock()
+		c.channels[channel] = c.joinsReady
+		if c.trackUsers.get() {
+			c.channelUserlistMutex.Lock()
+			c.channelUserlist[channel] = map[string]bool{}
+			c.channelUserlistMutex.Unlock()
+		}
 	}
-	c.channelsMtx.Unlock()
+	c.metrics.JoinedChannels(len(c.channels))
 }
 
 // Creates an irc join message to join the given channels.
@@ -636,13 +1365,10 @@ func (c *Client) createJoinMessages(channels ...string) ([]string, []string) {
 
 	for _, channel := range channels {
 		channel = strings.ToLower(channel)
-		// If the channel already exists in the map we don't need to re-join it
-		c.channelsMtx.Lock()
+		// If the channel was already joined on this connection we don't need to re-join it
 		if c.channels[channel] {
-			c.channelsMtx.Unlock()
 			continue
 		}
-		c.channelsMtx.Unlock()
 		if sb.Len()+len(channel)+2 > maxMessageLength || (!c.joinRateLimiter.IsUnlimited() && channelsWritten >= c.joinRateLimiter.GetLimit()) {
 			joinMessages = append(joinMessages, sb.String())
 			sb.Reset()
@@ -664,23 +1390,37 @@ func (c *Client) createJoinMessages(channels ...string) ([]string, []string) {
 	return joinMessages, joined
 }
 
-// Depart leave a twitch channel
-func (c *Client) Depart(channel string) {
-	if c.connActive.get() {
-		c.send(fmt.Sprintf("PART #%s", channel))
+// Depart leave a twitch channel.
+// Returns ErrInvalidChannel if the channel is empty or contains spaces or commas
+func (c *Client) Depart(channel string) error {
+	channel, err := normalizeChannel(channel)
+	if err != nil {
+		return err
 	}
 
 	c.channelsMtx.Lock()
+	if c.joinsReady {
+		c.send(fmt.Sprintf("PART #%s", channel))
+	}
 	delete(c.channels, channel)
 	c.channelUserlistMutex.Lock()
 	delete(c.channelUserlist, channel)
 	c.channelUserlistMutex.Unlock()
+	c.metrics.JoinedChannels(len(c.channels))
 	c.channelsMtx.Unlock()
+
+	c.roomStates.remove(channel)
+	c.userStates.remove(channel)
+	c.idleTimers.stop(channel)
+
+	return nil
 }
 
-// Disconnect close current connection
+// Disconnect close current connection, or stops connecting if Connect is still trying to connect
 func (c *Client) Disconnect() error {
-	if !c.connActive.get() {
+	c.idleTimers.stopAll()
+
+	if !c.running.get() {
 		return ErrConnectionIsNotOpen
 	}
 
@@ -691,13 +1431,26 @@ func (c *Client) Disconnect() error {
 
 // Connect connect the client to the irc server
 func (c *Client) Connect() error {
+	// userDisconnect is only reset here, so a Disconnect between two connection attempts isn't forgotten
+	c.userDisconnect.Reset()
+	c.running.set(true)
+	defer c.running.set(false)
+
 	if c.IrcAddress == "" && c.TLS {
-		c.IrcAddress = ircTwitchTLS
+		c.IrcAddress = DefaultIrcAddressTLS
 	} else if c.IrcAddress == "" && !c.TLS {
-		c.IrcAddress = ircTwitch
+		c.IrcAddress = DefaultIrcAddress
 	}
 
-	dialer := &net.Dialer{
+	address, err := normalizeIrcAddress(c.IrcAddress, c.TLS)
+	if err != nil {
+		c.setStopped(err)
+		return err
+	}
+	c.IrcAddress = address
+
+	dialer := &net.Dialer{
+		Timeout:   c.connectTimeout,
 		KeepAlive: time.Second * 10,
 	}
 
@@ -714,21 +1467,140 @@ func (c *Client) Connect() error {
 		}
 	}
 
+	defer c.closeMessages()
+
+	stopRecording := c.recorder.start()
+	defer stopRecording()
+
+	stopDispatchPool := c.startDispatchPool()
+	defer stopDispatchPool()
+
+	c.setState(StateConnecting)
 	for {
-		err := c.makeConnection(dialer, conf)
+		err = c.makeConnection(dialer, conf)
+		if err != errReconnect {
+			c.setStopped(err)
+		}
 
 		switch err {
 		case errReconnect:
+			c.setState(StateReconnecting)
+			c.logger.Infof("reconnecting to %s", c.IrcAddress)
+			c.metrics.ReconnectAttempt()
+			c.stats.reconnected()
 			continue
 
+		case ErrClientDisconnected:
+			c.logger.Infof("disconnected from %s", c.IrcAddress)
+			return err
+
 		default:
+			c.logger.Errorf("connection to %s failed: %s", c.IrcAddress, err)
 			return err
 		}
 	}
 }
 
+// startDispatchPool starts the workers of DispatchAsync mode, the returned function stops them again
+func (c *Client) startDispatchPool() func() {
+	if c.dispatchMode != DispatchAsync {
+		return func() {}
+	}
+
+	c.dispatchPool = newDispatchPool(c, c.dispatchWorkers, c.dispatchQueueSize, c.dispatchOverflowPolicy)
+	c.dispatchPool.start()
+
+	return func() {
+		c.dispatchPool.stop()
+		c.dispatchPool = nil
+	}
+}
+
+// SetIrcAddress sets the IrcAddress after validating it, so an invalid address fails right away instead of when calling Connect.
+// A bare host gets the default twitch port applied. The address may start with irc:// to connect without TLS
+// or ircs:// to connect with TLS, which sets TLS accordingly, e.g. "irc://127.0.0.1:3030".
+// Returns ErrInvalidIrcAddress for an invalid address or any other scheme.
+// Must be called before Connect, while Connect is running the address isn't changed and ErrConnectionIsOpen is returned
+func (c *Client) SetIrcAddress(address string) error {
+	if c.running.get() {
+		return ErrConnectionIsOpen
+	}
+
+	useTLS := c.TLS
+	if index := strings.Index(address, "://"); index >= 0 {
+		switch scheme := strings.ToLower(address[:index]); scheme {
+		case "irc":
+			useTLS = false
+		case "ircs":
+			useTLS = true
+		default:
+			return fmt.Errorf("%w: unsupported scheme %q, use irc:// or ircs://", ErrInvalidIrcAddress, scheme)
+		}
+		address = address[index+3:]
+	}
+
+	normalized, err := normalizeIrcAddress(address, useTLS)
+	if err != nil {
+		return err
+	}
+
+	c.IrcAddress = normalized
+	c.TLS = useTLS
+
+	return nil
+}
+
+// normalizeIrcAddress turns the given address into a dialable host:port pair.
+// A bare host gets the default twitch port applied, ":port" keeps dialing localhost.
+func normalizeIrcAddress(address string, useTLS bool) (string, error) {
+	address = strings.TrimSpace(address)
+
+	if strings.Contains(address, "://") {
+		return "", fmt.Errorf("%w: %q must not contain a scheme, use host:port", ErrInvalidIrcAddress, address)
+	}
+
+	if strings.ContainsAny(address, " /?#@") {
+		return "", fmt.Errorf("%w: %q is not a host:port pair", ErrInvalidIrcAddress, address)
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		// No port given, so the whole address is the host. IPv6 addresses without a port fail
+		// with "too many colons", and are accepted if they parse as IP
+		if strings.Contains(address, ":") && net.ParseIP(address) == nil {
+			return "", fmt.Errorf("%w: %s", ErrInvalidIrcAddress, err)
+		}
+
+		host = address
+		port = ircTwitchPort
+		if useTLS {
+			port = ircTwitchTLSPort
+		}
+	}
+
+	if portNumber, err := strconv.Atoi(port); err != nil || portNumber < 1 || portNumber > 65535 {
+		return "", fmt.Errorf("%w: invalid port %q", ErrInvalidIrcAddress, port)
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
 func (c *Client) makeConnection(dialer *net.Dialer, conf *tls.Config) (err error) {
-	c.connActive.set(false)
+	// The token is requested on every connect, so a refreshed token is used after reconnecting
+	token, err := c.fetchToken()
+	if err != nil {
+		return err
+	}
+
+	// Disconnect may have been called between two connection attempts
+	select {
+	case <-c.userDisconnect.channel:
+		return ErrClientDisconnected
+	default:
+	}
+
+	c.logger.Infof("connecting to %s", c.IrcAddress)
+
 	var conn net.Conn
 	if c.TLS {
 		conn, err = tls.DialWithDialer(dialer, "tcp", c.IrcAddress, conf)
@@ -739,9 +1611,10 @@ func (c *Client) makeConnection(dialer *net.Dialer, conf *tls.Config) (err error
 		return
 	}
 
+	c.resetChannelStates()
+
 	wg := sync.WaitGroup{}
 	c.clientReconnect.Reset()
-	c.userDisconnect.Reset()
 
 	// Start the connection reader in a separate go-routine
 	wg.Add(1)
@@ -756,7 +1629,8 @@ func (c *Client) makeConnection(dialer *net.Dialer, conf *tls.Config) (err error
 	}
 
 	// Send the initial connection messages (like logging in, getting the CAP REQ stuff)
-	c.setupConnection(conn)
+	c.setState(StateAuthenticating)
+	c.setupConnection(conn, token)
 
 	// Start the connection writer in a separate go-routine
 	wg.Add(1)
@@ -776,8 +1650,102 @@ func (c *Client) makeConnection(dialer *net.Dialer, conf *tls.Config) (err error
 	return
 }
 
-// Userlist returns the userlist for a given channel
+// resetChannelStates forgets the states of all channels before connecting. The room and user states are rebuilt from
+// the ROOMSTATE and USERSTATE messages sent when rejoining the channels, the userlists from the NAMES messages
+func (c *Client) resetChannelStates() {
+	c.resetJoins()
+	c.roomStates.reset()
+	c.userStates.reset()
+	c.resetUserlists()
+	c.pendingNames = nil
+}
+
+// Connected returns whether the client is connected and authenticated, which is the case from receiving the
+// welcome message of Twitch until the connection is closed. It's the same as State() == StateConnected
+func (c *Client) Connected() bool {
+	return c.connActive.get()
+}
+
+// WaitForConnect blocks until the client is connected and authenticated, or the context is done, like WaitConnected.
+// Unlike WaitConnected it also returns once Connect gave up, with the error Connect returned, e.g. ErrLoginAuthenticationFailed.
+// If the last Connect already returned, its error is returned right away, until Connect is called again.
+// Returns ErrConnectionIsNotOpen if the stream of ConnectWithConn or Replay ended without an error
+func (c *Client) WaitForConnect(ctx context.Context) error {
+	c.connectedMtx.Lock()
+	connected := c.connected
+	stopped := c.stopped
+	c.connectedMtx.Unlock()
+
+	select {
+	case <-connected:
+		return nil
+	case <-stopped:
+		c.connectedMtx.Lock()
+		defer c.connectedMtx.Unlock()
+
+		if c.stopErr == nil {
+			return ErrConnectionIsNotOpen
+		}
+		return c.stopErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WaitConnected blocks until the client is connected and authenticated, or the context is done.
+// It returns immediately if the client is already connected
+func (c *Client) WaitConnected(ctx context.Context) error {
+	c.connectedMtx.Lock()
+	connected := c.connected
+	c.connectedMtx.Unlock()
+
+	select {
+	case <-connected:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetTrackUsers enables or disables tracking which users are present in the joined channels, which is enabled by default.
+// The userlists are built from the NAMES, JOIN and PART messages Twitch sends with the membership capability.
+// Twitch only sends them for channels with less than about 1000 chatters, so the userlists of bigger channels are incomplete.
+// Disabling the tracking clears all userlists
+func (c *Client) SetTrackUsers(track bool) {
+	c.channelsMtx.RLock()
+	defer c.channelsMtx.RUnlock()
+	c.channelUserlistMutex.Lock()
+	defer c.channelUserlistMutex.Unlock()
+
+	c.trackUsers.set(track)
+
+	c.channelUserlist = map[string]map[string]bool{}
+	if track {
+		for channel := range c.channels {
+			c.channelUserlist[channel] = map[string]bool{}
+		}
+	}
+}
+
+// resetUserlists empties the userlists of all joined channels
+func (c *Client) resetUserlists() {
+	c.channelUserlistMutex.Lock()
+	defer c.channelUserlistMutex.Unlock()
+
+	for channel := range c.channelUserlist {
+		c.channelUserlist[channel] = map[string]bool{}
+	}
+}
+
+// Userlist returns the userlist for a given channel.
+// Returns an error if the channel isn't joined or tracking users is disabled, see SetTrackUsers
 func (c *Client) Userlist(channel string) ([]string, error) {
+	channel, _ = normalizeChannel(channel)
+
+	if !c.trackUsers.get() {
+		return nil, fmt.Errorf("tracking users is disabled, could not find userlist for channel '%s' in client", channel)
+	}
+
 	c.channelUserlistMutex.RLock()
 	defer c.channelUserlistMutex.RUnlock()
 	usermap, ok := c.channelUserlist[channel]
@@ -795,10 +1763,172 @@ func (c *Client) Userlist(channel string) ([]string, error) {
 	return userlist, nil
 }
 
+// EnablePresenceTracking tracks which users are present in the joined channels, see Viewers. It enables SetTrackUsers
+// and adds the membership capability to the Capabilities, without which Twitch doesn't send the JOIN, PART and NAMES
+// messages of other users. The membership messages are noisy, and Twitch batches and throttles them in big channels,
+// so the presence is only approximate. Must be called before Connect
+func (c *Client) EnablePresenceTracking() {
+	c.SetTrackUsers(true)
+
+	for _, capability := range c.Capabilities {
+		if capability == MembershipCapability {
+			return
+		}
+	}
+
+	// Copy the capabilities, they may be shared with other clients through DefaultCapabilities
+	capabilities := make([]string, 0, len(c.Capabilities)+1)
+	capabilities = append(capabilities, c.Capabilities...)
+	c.Capabilities = append(capabilities, MembershipCapability)
+}
+
+// Viewers returns the users present in the channel sorted by name, taken from the NAMES, JOIN and PART messages of the channel.
+// Returns nil if the channel isn't joined or users aren't tracked, see EnablePresenceTracking
+func (c *Client) Viewers(channel string) []string {
+	userlist, err := c.Userlist(channel)
+	if err != nil {
+		return nil
+	}
+
+	sort.Strings(userlist)
+	return userlist
+}
+
+// SetDispatchMode sets on which go-routine the callbacks are called.
+// In DispatchAsync mode, callbacks are called on the given number of workers, each with a queue of queueSize messages.
+// Answering PINGs and other internal bookkeeping always happens right away on the reading go-routine.
+// Must be called before Connect
+func (c *Client) SetDispatchMode(mode DispatchMode, workers, queueSize int) {
+	c.dispatchMode = mode
+	c.dispatchWorkers = workers
+	c.dispatchQueueSize = queueSize
+}
+
+// SetHandlerConcurrency sets how many workers call the callbacks, so a slow callback doesn't stall reading from the connection.
+// 0 calls them on the go-routine reading from the connection, which is the default. Messages of the same channel are always
+// handled in the order they were received, messages of different channels can be handled in any order.
+// It's a shorthand for SetDispatchMode with DispatchAsync and a queue of ReadBufferSize messages per worker.
+// Must be called before Connect
+func (c *Client) SetHandlerConcurrency(workers int) {
+	if workers <= 0 {
+		c.SetDispatchMode(DispatchSync, 0, 0)
+		return
+	}
+
+	c.SetDispatchMode(DispatchAsync, workers, ReadBufferSize)
+}
+
+// SetDispatchOverflowPolicy sets what happens to a message when a worker queue is full in DispatchAsync mode.
+// Must be called before Connect
+func (c *Client) SetDispatchOverflowPolicy(policy OverflowPolicy) {
+	c.dispatchOverflowPolicy = policy
+}
+
+// Messages returns a channel that receives every parsed message, as an alternative to attaching callbacks.
+// Every call returns the same channel, so multiple readers share the messages between them.
+// The channel is buffered with MessagesBufferSize. If the buffer is full, new messages are dropped
+// instead of blocking the client, see MessagesDropped.
+// The channel is closed when Connect returns, call Messages again after reconnecting to get a new channel
+func (c *Client) Messages() <-chan Message {
+	c.messagesMtx.Lock()
+	defer c.messagesMtx.Unlock()
+
+	if c.messages == nil {
+		c.messages = make(chan Message, MessagesBufferSize)
+	}
+
+	return c.messages
+}
+
+// MessagesDropped returns how many messages were dropped because the channel returned by Messages was full
+func (c *Client) MessagesDropped() uint64 {
+	c.messagesMtx.Lock()
+	defer c.messagesMtx.Unlock()
+
+	return c.messagesDropped
+}
+
+func (c *Client) publishMessage(message Message) {
+	c.messagesMtx.Lock()
+	defer c.messagesMtx.Unlock()
+
+	if c.messages == nil {
+		return
+	}
+
+	select {
+	case c.messages <- message:
+	default:
+		c.logger.Warnf("messages channel is full, dropping message")
+		c.messagesDropped++
+	}
+}
+
+func (c *Client) closeMessages() {
+	c.messagesMtx.Lock()
+	defer c.messagesMtx.Unlock()
+
+	if c.messages != nil {
+		close(c.messages)
+		c.messages = nil
+	}
+}
+
+// GetRoomState returns the current state of a channel, merged from all ROOMSTATE messages received since joining it.
+// The second return value is false if no ROOMSTATE message was received for the channel yet
+func (c *Client) GetRoomState(channel string) (RoomState, bool) {
+	channel, _ = normalizeChannel(channel)
+	return c.roomStates.get(channel)
+}
+
+// RoomState returns the current state of a channel like GetRoomState, or an empty RoomState with
+// followers-only mode disabled if no ROOMSTATE message was received for the channel yet
+func (c *Client) RoomState(channel string) RoomState {
+	roomState, ok := c.GetRoomState(channel)
+	if !ok {
+		channel, _ = normalizeChannel(channel)
+		return newRoomState(channel, "", nil)
+	}
+
+	return roomState
+}
+
+// GetUserState returns the state of the client's own user in a channel, from the last USERSTATE message of the channel.
+// The second return value is false if no USERSTATE message was received for the channel yet
+func (c *Client) GetUserState(channel string) (UserState, bool) {
+	channel, _ = normalizeChannel(channel)
+	return c.userStates.get(channel)
+}
+
+// IsModIn returns whether the client's own user is a moderator or the broadcaster of the channel
+func (c *Client) IsModIn(channel string) bool {
+	userState, _ := c.GetUserState(channel)
+	return userState.Mod
+}
+
+// EmoteSets returns the emote sets of the client's own user from the last USERSTATE or GLOBALUSERSTATE message
+func (c *Client) EmoteSets() []string {
+	c.emoteSetsMtx.RLock()
+	defer c.emoteSetsMtx.RUnlock()
+
+	emoteSets := make([]string, len(c.emoteSets))
+	copy(emoteSets, c.emoteSets)
+
+	return emoteSets
+}
+
 // SetIRCToken updates the oauth token for this client used for authentication
 // This will not cause a reconnect, but is meant more for "on next connect, use this new token" in case the old token has expired
 func (c *Client) SetIRCToken(ircToken string) {
-	c.ircToken = ircToken
+	c.tokenProvider = StaticToken(ircToken)
+}
+
+// SetTokenProvider sets the provider of the oauth token for this client used for authentication, replacing the token given to NewClient.
+// The provider is called on every connect and reconnect, and may return the token with or without the "oauth:" prefix.
+// If it returns an error, it's called again after a delay doubling from one second up to 30 seconds,
+// until it succeeds or Disconnect is called. Connect returns the error once the provider failed 10 times in a row
+func (c *Client) SetTokenProvider(provider TokenProvider) {
+	c.tokenProvider = provider
 }
 
 // SetJoinRateLimiter will set the rate limits for the client.
@@ -808,6 +1938,100 @@ func (c *Client) SetJoinRateLimiter(rateLimiter RateLimiter) {
 	c.joinRateLimiter = rateLimiter
 }
 
+// SetParseOptions turns off parsing the given fields of received messages, e.g. SkipEmotes|SkipBadges.
+// Everything is parsed by default. Must be called before Connect
+func (c *Client) SetParseOptions(options ParseOptions) {
+	c.parseOptions = options
+}
+
+// SetWriteTimeout sets how long a write to the connection may block, 10 seconds by default.
+// A write that times out, e.g. because of a half-dead connection, makes the client reconnect and send the message again.
+// A timeout of 0 lets writes block forever. Must be called before Connect
+func (c *Client) SetWriteTimeout(timeout time.Duration) {
+	c.writeTimeout = timeout
+}
+
+// SetSendQueueHighWaterMark sets the number of lines waiting to be written at which OnSendQueueFull is called,
+// by default three quarters of WriteBufferSize, the size of the chat message queue. Must be called before Connect
+func (c *Client) SetSendQueueHighWaterMark(lines int) {
+	c.sendQueueHighWaterMark = lines
+}
+
+// SetQueueEarlySends sets whether messages and chat commands sent before Twitch welcomed the client are queued,
+// which is the default. Queued messages are written in order once the client is connected, after joining the channels.
+// Disabling it makes Say, Reply, SendMe and the chat commands return ErrConnectionIsNotOpen while the client isn't connected.
+// Joins are always queued. Must be called before Connect
+func (c *Client) SetQueueEarlySends(queue bool) {
+	c.queueEarlySends = queue
+}
+
+// SetConnectTimeout sets how long dialing the server, including the TLS handshake, may take, 10 seconds by default.
+// A connect that times out makes Connect return the error, instead of waiting for the operating system to give up.
+// A timeout of 0 leaves the timeout to the operating system. Must be called before Connect
+func (c *Client) SetConnectTimeout(timeout time.Duration) {
+	c.connectTimeout = timeout
+}
+
+// SetMetricsCollector sets the collector that receives the metrics of the client, like the number of messages received
+// and the ping latency. Metrics are ignored by default. Must be called before Connect
+func (c *Client) SetMetricsCollector(collector MetricsCollector) {
+	if collector == nil {
+		collector = NoopMetricsCollector{}
+	}
+
+	c.metrics = collector
+}
+
+// SetRecording sets a writer that receives every line read from the connection, before it's parsed, one line per line.
+// With RecordAll, the lines sent by the client are recorded as well, prefixed with "> " and with the oauth token of the PASS line redacted.
+// The lines are buffered and written on another go-routine, so a slow writer doesn't block the client. Lines that don't fit into
+// the buffer of RecordingBufferSize lines are dropped, see RecordingDropped. Connect returns once all recorded lines are written.
+// Recordings can be replayed with Replay. Must be called before Connect
+func (c *Client) SetRecording(writer io.Writer, mode RecordMode) {
+	if writer == nil {
+		c.recorder = nil
+		return
+	}
+
+	c.recorder = &recorder{
+		client:     c,
+		writer:     writer,
+		mode:       mode,
+		bufferSize: RecordingBufferSize,
+	}
+}
+
+// RecordingDropped returns how many lines weren't written to the recording, because the writer was too slow or failed
+func (c *Client) RecordingDropped() uint64 {
+	if c.recorder == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&c.recorder.dropped)
+}
+
+// UnknownMessageCount returns how many messages of commands the library doesn't know about were received, see OnUnknownMessage
+func (c *Client) UnknownMessageCount() uint64 {
+	return atomic.LoadUint64(&c.unknownMessages)
+}
+
+// SetNotifyInitialRoomModes sets whether the room mode callbacks like OnSlowMode are called for the modes of the state Twitch sends
+// when joining a channel, which is disabled by default. Must be called before Connect
+func (c *Client) SetNotifyInitialRoomModes(notify bool) {
+	c.notifyInitialRoomModes = notify
+}
+
+// SetLogger sets the logger that receives log messages about internal events of the client, like reconnects, dropped messages
+// and lines that can't be parsed. Sent lines are logged at the debug level, with the oauth token redacted.
+// Nothing is logged by default. Must be called before Connect
+func (c *Client) SetLogger(logger Logger) {
+	if logger == nil {
+		logger = NoopLogger{}
+	}
+
+	c.logger = logger
+}
+
 func (c *Client) startReader(reader io.Reader, wg *sync.WaitGroup) {
 	defer func() {
 		c.clientReconnect.Close()
@@ -815,6 +2039,8 @@ func (c *Client) startReader(reader io.Reader, wg *sync.WaitGroup) {
 		wg.Done()
 	}()
 
+	// ReadLine buffers partial reads until a full line arrived, splits reads containing multiple lines,
+	// and isn't limited in line length, unlike a bufio.Scanner with its default buffer
 	tp := textproto.NewReader(bufio.NewReader(reader))
 
 	for {
@@ -822,20 +2048,31 @@ func (c *Client) startReader(reader io.Reader, wg *sync.WaitGroup) {
 		if err != nil {
 			return
 		}
-		messages := strings.Split(line, "\r\n")
-		for _, msg := range messages {
-			if !c.connActive.get() && strings.Contains(msg, ":tmi.twitch.tv 001") {
-				c.connActive.set(true)
-				c.initialJoins()
-				if c.onConnect != nil {
-					c.onConnect()
-				}
-			}
-			c.read <- msg
-		}
+		// ReadLine strips the \r\n ending every line
+		c.metrics.BytesRead(len(line) + 2)
+		c.recorder.recordReceived(line)
+
+		c.handleWelcome(line)
+		c.read <- line
+	}
+}
+
+// handleWelcome marks the client as connected once the server welcomed it, and joins the channels
+func (c *Client) handleWelcome(line string) {
+	if !c.connActive.get() && isWelcome(line) {
+		c.logger.Infof("logged in to %s as %s", c.IrcAddress, c.ircUser)
+		// The joins are queued before the writer is woken up, so they're written before the queued chat messages
+		c.initialJoins()
+		c.welcomePending.set(true)
+		c.setState(StateConnected)
 	}
 }
 
+// isWelcome returns whether line is the welcome message Twitch sends after authenticating
+func isWelcome(line string) bool {
+	return strings.Contains(line, ":tmi.twitch.tv 001")
+}
+
 func (c *Client) startPinger(closer io.Closer, wg *sync.WaitGroup) {
 	c.pongReceived = make(chan bool, 1)
 
@@ -857,18 +2094,21 @@ func (c *Client) startPinger(closer io.Closer, wg *sync.WaitGroup) {
 				continue
 
 			case <-time.After(c.IdlePingInterval):
-				if c.onPingSent != nil {
-					c.onPingSent()
-				}
+				c.dispatch(pingSentEvent, nil)
 				c.send(pingMessage)
+				pingSent := time.Now()
 
 				select {
 				case <-c.pongReceived:
 					// Received pong message within the time limit, we're good
+					latency := time.Since(pingSent)
+					c.metrics.PingLatency(latency)
+					c.stats.setLatency(latency)
 					continue
 
 				case <-time.After(c.PongTimeout):
 					// No pong message was received within the pong timeout, disconnect
+					c.logger.Warnf("no PONG received within %s, reconnecting", c.PongTimeout)
 					c.clientReconnect.Close()
 					closer.Close()
 				}
@@ -877,49 +2117,164 @@ func (c *Client) startPinger(closer io.Closer, wg *sync.WaitGroup) {
 	}()
 }
 
-func (c *Client) setupConnection(conn net.Conn) {
+func (c *Client) setupConnection(conn net.Conn, token string) {
+	c.setWriteDeadline(conn)
+
 	if c.SetupCmd != "" {
-		conn.Write([]byte(c.SetupCmd + "\r\n"))
+		_ = c.writeLine(conn, c.SetupCmd)
 	}
 	if len(c.Capabilities) > 0 {
-		_, _ = conn.Write([]byte("CAP REQ :" + strings.Join(c.Capabilities, " ") + "\r\n"))
+		_ = c.writeLine(conn, "CAP REQ :"+strings.Join(c.Capabilities, " "))
+	}
+	if !c.anonymous {
+		_ = c.writeLine(conn, "PASS "+formatToken(token))
+	}
+	_ = c.writeLine(conn, "NICK "+c.ircUser)
+}
+
+// writeLine writes a line to the connection, and counts it in the metrics if it was written
+func (c *Client) writeLine(conn net.Conn, line string) error {
+	c.logger.Debugf("sending %s", redactLine(line))
+	c.recorder.recordSent(line)
+
+	n, err := conn.Write([]byte(line + "\r\n"))
+	c.metrics.BytesWritten(n)
+	if err == nil {
+		c.metrics.MessageSent()
+		c.stats.messageSent()
 	}
-	conn.Write([]byte("PASS " + c.ircToken + "\r\n"))
-	conn.Write([]byte("NICK " + c.ircUser + "\r\n"))
+
+	return err
 }
 
-func (c *Client) startWriter(writer io.WriteCloser, wg *sync.WaitGroup) {
+func (c *Client) startWriter(conn net.Conn, wg *sync.WaitGroup) {
 	defer func() {
 		wg.Done()
 	}()
 	for {
+		msg, ok := c.nextWrite()
+		if !ok {
+			return
+		}
+
+		c.updateWriteQueueLength()
+		c.writeMessage(conn, msg)
+	}
+}
+
+// nextWrite waits for the next line to write, which is the queued line of the highest priority.
+// Until Twitch welcomed the client only PINGs and PONGs are written, Twitch would drop joins and chat messages.
+// Returns false once the client reconnects or disconnects
+func (c *Client) nextWrite() (string, bool) {
+	for {
+		c.connectedMtx.Lock()
+		connected := c.connected
+		c.connectedMtx.Unlock()
+
+		select {
+		case <-connected:
+			return c.nextQueuedWrite()
+		default:
+		}
+
 		select {
 		case <-c.clientReconnect.channel:
-			return
+			return "", false
 		case <-c.userDisconnect.channel:
-			return
-		case msg := <-c.write:
-			c.writeMessage(writer, msg)
+			return "", false
+		case line := <-c.writeProtocol:
+			return line, true
+		case <-connected:
 		}
 	}
 }
 
-func (c *Client) writeMessage(writer io.WriteCloser, msg string) {
+// nextQueuedWrite waits for the next line of any queue, the queued line of the highest priority is returned first
+func (c *Client) nextQueuedWrite() (string, bool) {
+	if line, ok := c.queuedWrite(); ok {
+		return line, true
+	}
+
+	select {
+	case <-c.clientReconnect.channel:
+		return "", false
+	case <-c.userDisconnect.channel:
+		return "", false
+	case line := <-c.writeProtocol:
+		return line, true
+	case line := <-c.writeMembership:
+		return line, true
+	case line := <-c.write:
+		return line, true
+	}
+}
+
+// queuedWrite returns the queued line of the highest priority without waiting, false if no line is queued
+func (c *Client) queuedWrite() (string, bool) {
+	for _, queue := range []chan string{c.writeProtocol, c.writeMembership, c.write} {
+		select {
+		case line := <-queue:
+			return line, true
+		default:
+		}
+	}
+
+	return "", false
+}
+
+// writeQueue returns the queue of a line by its priority: PING and PONG are written first, JOIN and PART next, then the chat messages
+func (c *Client) writeQueue(line string) chan string {
+	command := line
+	if strings.HasPrefix(command, "@") {
+		if index := strings.IndexByte(command, ' '); index >= 0 {
+			command = command[index+1:]
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(command, "PING") || strings.HasPrefix(command, "PONG"):
+		return c.writeProtocol
+	case strings.HasPrefix(command, "JOIN ") || strings.HasPrefix(command, "PART "):
+		return c.writeMembership
+	}
+
+	return c.write
+}
+
+func (c *Client) writeQueueLength() int {
+	return len(c.writeProtocol) + len(c.writeMembership) + len(c.write)
+}
+
+func (c *Client) writeMessage(conn net.Conn, msg string) {
 	if strings.HasPrefix(msg, "JOIN") {
 		splits := strings.Split(msg, ",")
+		if !c.joinRateLimiter.IsUnlimited() {
+			c.logger.Debugf("waiting for the join rate limit to join %d channels", len(splits))
+		}
 		c.joinRateLimiter.Throttle(len(splits))
 	}
 
-	_, err := writer.Write([]byte(msg + "\r\n"))
+	c.setWriteDeadline(conn)
+
+	err := c.writeLine(conn, msg)
 	if err != nil {
+		c.logger.Warnf("failed to write to %s, reconnecting: %s", c.IrcAddress, err)
+
 		// Attempt to re-send failed messages
-		c.write <- msg
+		c.send(msg)
 
-		writer.Close()
+		conn.Close()
 		c.clientReconnect.Close()
 	}
 }
 
+// setWriteDeadline makes the next writes to the connection fail once the write timeout has passed
+func (c *Client) setWriteDeadline(conn net.Conn) {
+	if c.writeTimeout > 0 {
+		_ = conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+}
+
 func (c *Client) startParser() error {
 	for {
 		// reader
@@ -938,28 +2293,86 @@ func (c *Client) startParser() error {
 	}
 }
 
+// initialJoins joins the channels added before Twitch welcomed the client, or rejoins them after reconnecting.
+// Joins from then on are sent right away, a channel joined concurrently is joined once
 func (c *Client) initialJoins() {
-	// join or rejoin channels on connection
-	channels := []string{}
+	c.channelsMtx.Lock()
+	defer c.channelsMtx.Unlock()
+
+	c.joinsReady = true
+
+	channels := make([]string, 0, len(c.channels))
 	for channel := range c.channels {
 		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	c.join(channels)
+}
+
+// resetJoins marks all channels as not joined on the new connection, joins wait for initialJoins again
+func (c *Client) resetJoins() {
+	c.channelsMtx.Lock()
+	defer c.channelsMtx.Unlock()
+
+	c.joinsReady = false
+	for channel := range c.channels {
 		c.channels[channel] = false
 	}
-	c.Join(channels...)
 }
 
+// send queues a line to be written, in the queue of its priority
 func (c *Client) send(line string) {
+	queue := c.writeQueue(line)
+
 	select {
-	case c.write <- line:
+	case queue <- line:
+		c.updateWriteQueueLength()
 	default:
-		// The buffer of c.write is full, queue up the message to be sent later.
+		// The buffer of the queue is full, queue up the message to be sent later.
 		// We have no guarantee of order anymore if the buffer is full
+		c.logger.Warnf("write queue is full, messages may be sent out of order")
 		go func() {
-			c.write <- line
+			queue <- line
 		}()
 	}
 }
 
+// sendMessage queues a chat message to be written like send, but returns ErrQueueFull instead of waiting if the queue is full
+func (c *Client) sendMessage(line string) error {
+	select {
+	case c.write <- line:
+		c.updateWriteQueueLength()
+		return nil
+	default:
+		c.logger.Warnf("write queue is full, not sending %s", line)
+		c.updateWriteQueueLength()
+		return ErrQueueFull
+	}
+}
+
+// updateWriteQueueLength reports the length of the write queues to the metrics, and calls the OnSendQueueFull callbacks
+// once the length reaches the high-water mark. They're called again after the length dropped below the mark
+func (c *Client) updateWriteQueueLength() {
+	length := c.writeQueueLength()
+	c.metrics.WriteQueueLength(length)
+
+	if length < c.sendQueueHighWaterMark {
+		c.sendQueueFull.set(false)
+		return
+	}
+
+	if !c.sendQueueFull.swap(true) {
+		c.logger.Warnf("%d lines are waiting to be written", length)
+		c.callHandlers(sendQueueFullEvent, nil)
+	}
+}
+
+// PendingSends returns the number of lines waiting to be written, e.g. because the join rate limiter holds back the writer
+// or the connection is slow. See OnSendQueueFull
+func (c *Client) PendingSends() int {
+	return c.writeQueueLength()
+}
+
 // Errors returned from handleLine break out of readConnections, which starts a reconnect
 // This means that we should only return fatal errors as errors here
 func (c *Client) handleLine(line string) error {
@@ -971,129 +2384,211 @@ func (c *Client) handleLine(line string) error {
 		}
 	}()
 
-	message := ParseMessage(line)
+	// The OnConnect callbacks are called here instead of in handleWelcome, so they run on the same go-routine as the other callbacks
+	if isWelcome(line) && c.welcomePending.swap(false) {
+		c.dispatch(connectEvent, nil)
+	}
+
+	// Raw lines are handled right away, even in DispatchAsync mode, so they are seen before the parsed message
+	for _, h := range c.handlers.get(rawLineEvent) {
+		c.callHandler(h, line)
+	}
+
+	message, err := parseMessage(line, c.parseOptions)
+	if err != nil {
+		c.logger.Warnf("failed to parse line %q: %s", line, err)
+		c.metrics.ParseError()
+	}
+	c.metrics.MessageReceived(message.GetType())
+	c.stats.messageReceived(message.GetType())
+	c.publishMessage(message)
 
 	switch msg := message.(type) {
 	case *WhisperMessage:
-		if c.onWhisperMessage != nil {
-			c.onWhisperMessage(*msg)
-		}
+		c.dispatch(whisperMessageEvent, msg)
 		return nil
 
 	case *PrivateMessage:
-		if c.onPrivateMessage != nil {
-			c.onPrivateMessage(*msg)
-		}
+		c.idleTimers.touch(msg.Channel)
+		c.dispatch(privateMessageEvent, msg)
 		return nil
 
 	case *ClearChatMessage:
-		if c.onClearChatMessage != nil {
-			c.onClearChatMessage(*msg)
-		}
+		c.dispatch(clearChatMessageEvent, msg)
 		return nil
 
 	case *ClearMessage:
-		if c.onClearMessage != nil {
-			c.onClearMessage(*msg)
-		}
+		c.dispatch(clearMessageEvent, msg)
 		return nil
 
 	case *RoomStateMessage:
-		if c.onRoomStateMessage != nil {
-			c.onRoomStateMessage(*msg)
+		before, after := c.roomStates.update(msg)
+		c.dispatch(roomStateMessageEvent, msg)
+		c.dispatchRoomModeChanges(before, after)
+		if changes := diffRoomStates(before, after); len(changes) > 0 {
+			c.dispatch(roomStateChangeEvent, roomStateChanges{channel: msg.Channel, changes: changes})
 		}
 		return nil
 
 	case *UserNoticeMessage:
-		if c.onUserNoticeMessage != nil {
-			c.onUserNoticeMessage(*msg)
-		}
+		c.dispatch(userNoticeMessageEvent, msg)
 		return nil
 
 	case *UserStateMessage:
-		if c.onUserStateMessage != nil {
-			c.onUserStateMessage(*msg)
-		}
+		c.userStates.update(msg)
+		c.dispatch(userStateMessageEvent, msg)
+		c.handleEmoteSets(msg.EmoteSets)
+		c.handleSentMessageConfirmation(msg)
 		return nil
 
 	case *GlobalUserStateMessage:
-		if c.onGlobalUserStateMessage != nil {
-			c.onGlobalUserStateMessage(*msg)
-		}
+		c.dispatch(globalUserStateMessageEvent, msg)
+		c.handleEmoteSets(msg.EmoteSets)
 		return nil
 
 	case *NoticeMessage:
-		if c.onNoticeMessage != nil {
-			c.onNoticeMessage(*msg)
+		c.dispatch(noticeMessageEvent, msg)
+		c.handleSendError(msg)
+		if change, ok := parseHostNotice(msg); ok {
+			c.dispatch(hostEvent, change)
 		}
 		return c.handleNoticeMessage(*msg)
 
 	case *UserJoinMessage:
 		c.handleUserJoinMessage(*msg)
 		if msg.User == c.ircUser {
-			if c.onSelfJoinMessage != nil {
-				c.onSelfJoinMessage(*msg)
-			}
+			c.idleTimers.touch(msg.Channel)
+			c.dispatch(selfJoinMessageEvent, msg)
 		} else {
-			if c.onUserJoinMessage != nil {
-				c.onUserJoinMessage(*msg)
-			}
+			c.dispatch(userJoinMessageEvent, msg)
 		}
 		return nil
 
 	case *UserPartMessage:
 		c.handleUserPartMessage(*msg)
 		if msg.User == c.ircUser {
-			if c.onSelfPartMessage != nil {
-				c.onSelfPartMessage(*msg)
-			}
+			// The NAMES of a channel parted before their END_OF_NAMES aren't merged into the NAMES after joining again
+			delete(c.pendingNames, msg.Channel)
+			c.dispatch(selfPartMessageEvent, msg)
 		} else {
-			if c.onUserPartMessage != nil {
-				c.onUserPartMessage(*msg)
-			}
+			c.dispatch(userPartMessageEvent, msg)
 		}
 		return nil
 
 	case *ReconnectMessage:
 		// https://dev.twitch.tv/docs/irc/commands/#reconnect-twitch-commands
-		if c.onReconnectMessage != nil {
-			c.onReconnectMessage(*msg)
-		}
+		// Connect redials on errReconnect, and the channels are joined again once the new connection is welcomed
+		c.logger.Infof("%s asked to reconnect", c.IrcAddress)
+		c.dispatch(reconnectMessageEvent, msg)
 		return errReconnect
 
 	case *NamesMessage:
-		if c.onNamesMessage != nil {
-			c.onNamesMessage(*msg)
+		if names, ok := c.mergeNamesMessage(msg); ok {
+			c.dispatch(namesMessageEvent, names)
+			c.handleNamesMessage(*names)
 		}
-		c.handleNamesMessage(*msg)
 		return nil
 
 	case *PingMessage:
-		if c.onPingMessage != nil {
-			c.onPingMessage(*msg)
-		}
+		c.dispatch(pingMessageEvent, msg)
 		c.handlePingMessage(*msg)
 		return nil
 
 	case *PongMessage:
-		if c.onPongMessage != nil {
-			c.onPongMessage(*msg)
-		}
+		c.dispatch(pongMessageEvent, msg)
 		c.handlePongMessage(*msg)
 		return nil
 
 	case *RawMessage:
-		if c.onUnsetMessage != nil {
-			c.onUnsetMessage(*msg)
+		c.handleCapMessage(msg)
+		c.dispatch(unsetMessageEvent, msg)
+		if isUnknownCommand(msg.RawType) {
+			atomic.AddUint64(&c.unknownMessages, 1)
+			c.logger.Debugf("received unknown command %s: %q", msg.RawType, msg.Raw)
+			c.dispatch(unknownMessageEvent, msg)
+		}
+		if change, ok := parseHostTarget(msg); ok {
+			c.dispatch(hostEvent, change)
 		}
 	}
 
 	return nil
 }
 
+// dispatch calls every handler attached to the given event, either right away or on the worker pool
+func (c *Client) dispatch(event handlerEvent, payload interface{}) {
+	if c.dispatchPool != nil {
+		c.dispatchPool.submit(dispatchJob{event: event, payload: payload})
+		return
+	}
+
+	c.callHandlers(event, payload)
+}
+
+// callHandlers calls every handler attached to the given event, in the order they were attached
+func (c *Client) callHandlers(event handlerEvent, payload interface{}) {
+	for _, h := range c.handlers.get(event) {
+		c.callHandler(h, payload)
+	}
+}
+
+func (c *Client) callHandler(h handler, payload interface{}) {
+	if c.RecoverPanics {
+		defer c.recoverHandlerPanic(payload)
+	}
+
+	h.callback(payload)
+}
+
+// recoverHandlerPanic must be deferred, it forwards a panic of a handler to the OnHandlerPanic callbacks
+func (c *Client) recoverHandlerPanic(payload interface{}) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+
+	message, _ := payload.(Message)
+	panicked := handlerPanic{
+		message:   message,
+		recovered: recovered,
+		stack:     debug.Stack(),
+	}
+	c.logger.Errorf("recovered panic in callback: %v\n%s", recovered, panicked.stack)
+
+	for _, h := range c.handlers.get(handlerPanicEvent) {
+		func() {
+			// A panicking panic handler is ignored, so we don't end up in an endless loop
+			defer func() {
+				_ = recover()
+			}()
+
+			h.callback(panicked)
+		}()
+	}
+}
+
+// dispatchRoomModeChanges dispatches the events of the room modes that differ between the states of a channel.
+// A mode missing from the state before was received for the first time, which usually is the state sent when joining
+func (c *Client) dispatchRoomModeChanges(before, after RoomState) {
+	for _, mode := range roomModes {
+		value, ok := after.State[mode.tag]
+		if !ok {
+			continue
+		}
+
+		previous, known := before.State[mode.tag]
+		if (known && previous == value) || (!known && !c.notifyInitialRoomModes) {
+			continue
+		}
+
+		c.dispatch(mode.event, roomModeChange{channel: after.Channel, value: value})
+	}
+}
+
 func (c *Client) handleNoticeMessage(msg NoticeMessage) error {
 	if msg.Channel == "*" {
 		if msg.Message == "Login authentication failed" || msg.Message == "Improperly formatted auth" || msg.Message == "Invalid NICK" || msg.Message == "Login unsuccessful" {
+			c.logger.Errorf("login as %s failed: %s", c.ircUser, msg.Message)
 			return ErrLoginAuthenticationFailed
 		}
 	}
@@ -1101,46 +2596,198 @@ func (c *Client) handleNoticeMessage(msg NoticeMessage) error {
 	return nil
 }
 
+// handleCapMessage logs the answer to the CAP REQ sent when connecting, e.g. ":tmi.twitch.tv CAP * ACK :twitch.tv/tags"
+func (c *Client) handleCapMessage(msg *RawMessage) {
+	if msg.RawType != "CAP" || len(msg.Params) < 3 {
+		return
+	}
+
+	switch msg.Params[1] {
+	case "ACK":
+		c.logger.Infof("capabilities acknowledged: %s", msg.Params[2])
+	case "NAK":
+		c.logger.Warnf("capabilities rejected: %s", msg.Params[2])
+	}
+}
+
+// handleSendError reports a NOTICE rejecting a message sent by the client
+func (c *Client) handleSendError(message *NoticeMessage) {
+	reason, ok := parseSendError(message)
+	if !ok {
+		return
+	}
+
+	c.dispatch(sendErrorEvent, sendError{reason: reason, notice: message})
+
+	if rejected, ok := c.sendTracker.reject(message.Channel, reason); ok {
+		c.dispatch(messageSentEvent, rejected)
+	}
+}
+
+// handleSentMessageConfirmation reports a message sent by the client as confirmed, when the USERSTATE echoes its client-nonce
+func (c *Client) handleSentMessageConfirmation(message *UserStateMessage) {
+	nonce := message.Tags["client-nonce"]
+	if nonce == "" {
+		return
+	}
+
+	if confirmation, ok := c.sendTracker.confirm(nonce, message.Tags["id"]); ok {
+		c.dispatch(messageSentEvent, confirmation)
+	}
+}
+
+func (c *Client) handleEmoteSets(emoteSets []string) {
+	c.emoteSetsMtx.Lock()
+	added, removed := diffStrings(c.emoteSets, emoteSets)
+	if len(added) > 0 || len(removed) > 0 {
+		c.emoteSets = emoteSets
+	}
+	c.emoteSetsMtx.Unlock()
+
+	if len(added) > 0 || len(removed) > 0 {
+		c.dispatch(emoteSetsChangedEvent, emoteSetsChange{added: added, removed: removed})
+	}
+}
+
+// diffStrings returns the strings that are only in after, and the strings that are only in before, ignoring the order
+func diffStrings(before, after []string) (added, removed []string) {
+	beforeSet := make(map[string]bool, len(before))
+	for _, value := range before {
+		beforeSet[value] = true
+	}
+
+	afterSet := make(map[string]bool, len(after))
+	for _, value := range after {
+		afterSet[value] = true
+		if !beforeSet[value] {
+			added = append(added, value)
+		}
+	}
+
+	for _, value := range before {
+		if !afterSet[value] {
+			removed = append(removed, value)
+		}
+	}
+
+	return added, removed
+}
+
 func (c *Client) handleUserJoinMessage(msg UserJoinMessage) {
 	// Self JOINs are handled on a separate callback
-	if msg.User == c.ircUser {
+	if msg.User == c.ircUser || !c.trackUsers.get() {
 		return
 	}
 
 	c.channelUserlistMutex.Lock()
-	defer c.channelUserlistMutex.Unlock()
 
 	if c.channelUserlist[msg.Channel] == nil {
 		c.channelUserlist[msg.Channel] = map[string]bool{}
 	}
 
-	if _, ok := c.channelUserlist[msg.Channel][msg.User]; !ok {
+	_, present := c.channelUserlist[msg.Channel][msg.User]
+	if !present {
 		c.channelUserlist[msg.Channel][msg.User] = true
 	}
+
+	c.channelUserlistMutex.Unlock()
+
+	if !present {
+		c.dispatch(userlistChangeEvent, userlistChange{channel: msg.Channel, joined: []string{msg.User}})
+	}
 }
 
 func (c *Client) handleUserPartMessage(msg UserPartMessage) {
 	// Self PARTs are handled on a separate callback
-	if msg.User == c.ircUser {
+	if msg.User == c.ircUser || !c.trackUsers.get() {
 		return
 	}
 
 	c.channelUserlistMutex.Lock()
-	defer c.channelUserlistMutex.Unlock()
 
+	_, present := c.channelUserlist[msg.Channel][msg.User]
 	delete(c.channelUserlist[msg.Channel], msg.User)
+
+	c.channelUserlistMutex.Unlock()
+
+	if present {
+		c.dispatch(userlistChangeEvent, userlistChange{channel: msg.Channel, parted: []string{msg.User}})
+	}
+}
+
+// mergeNamesMessage merges the NAMES messages of a channel, Twitch splits the names of big channels over many of them.
+// Returns the merged message without duplicate names once the END_OF_NAMES message of the channel arrives.
+// Raw is the raw lines of the NAMES messages separated by \r\n
+func (c *Client) mergeNamesMessage(msg *NamesMessage) (*NamesMessage, bool) {
+	if msg.Type == END_OF_NAMES {
+		pending, ok := c.pendingNames[msg.Channel]
+		if !ok {
+			return nil, false
+		}
+		delete(c.pendingNames, msg.Channel)
+
+		return pending.message, true
+	}
+
+	if c.pendingNames == nil {
+		c.pendingNames = map[string]*pendingNames{}
+	}
+
+	pending, ok := c.pendingNames[msg.Channel]
+	if !ok {
+		pending = &pendingNames{
+			message: &NamesMessage{
+				Raw:     msg.Raw,
+				Type:    msg.Type,
+				RawType: msg.RawType,
+				Channel: msg.Channel,
+			},
+			seen: map[string]bool{},
+		}
+		c.pendingNames[msg.Channel] = pending
+	} else {
+		pending.message.Raw += "\r\n" + msg.Raw
+	}
+
+	for _, user := range msg.Users {
+		if !pending.seen[user] {
+			pending.seen[user] = true
+			pending.message.Users = append(pending.message.Users, user)
+		}
+	}
+
+	return nil, false
+}
+
+// pendingNames is a NamesMessage being merged, see mergeNamesMessage
+type pendingNames struct {
+	message *NamesMessage
+	seen    map[string]bool
 }
 
 func (c *Client) handleNamesMessage(msg NamesMessage) {
+	if !c.trackUsers.get() {
+		return
+	}
+
 	c.channelUserlistMutex.Lock()
-	defer c.channelUserlistMutex.Unlock()
 
 	if c.channelUserlist[msg.Channel] == nil {
 		c.channelUserlist[msg.Channel] = map[string]bool{}
 	}
 
+	var joined []string
 	for _, user := range msg.Users {
-		c.channelUserlist[msg.Channel][user] = true
+		if _, present := c.channelUserlist[msg.Channel][user]; !present {
+			c.channelUserlist[msg.Channel][user] = true
+			joined = append(joined, user)
+		}
+	}
+
+	c.channelUserlistMutex.Unlock()
+
+	if len(joined) > 0 {
+		c.dispatch(userlistChangeEvent, userlistChange{channel: msg.Channel, joined: joined})
 	}
 }
 
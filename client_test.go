@@ -1,12 +1,12 @@
 package twitch
 
 import (
-	"bufio"
+	"bytes"
 	"context"
-	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"net"
-	"net/textproto"
 	"reflect"
 	"sort"
 	"strconv"
@@ -15,21 +15,12 @@ import (
 	"sync/atomic"
 	"testing"
 	"time"
-)
-
-var startPortMutex sync.Mutex
-var startPort = 10000
 
-func newPort() (r int) {
-	startPortMutex.Lock()
-	r = startPort
-	startPort++
-	startPortMutex.Unlock()
-	return
-}
+	"github.com/gempir/go-twitch-irc/v4/twitchtest"
+)
 
-func closeOnConnect(c chan struct{}) func(conn net.Conn) {
-	return func(conn net.Conn) {
+func closeOnConnect(c chan struct{}) func(conn *twitchtest.Conn) {
+	return func(conn *twitchtest.Conn) {
 		close(c)
 	}
 }
@@ -52,7 +43,7 @@ func closeOnPassReceived(pass *string, c chan struct{}) func(message string) {
 	}
 }
 
-func nothingOnConnect(conn net.Conn) {
+func nothingOnConnect(conn *twitchtest.Conn) {
 }
 
 func nothingOnMessage(message string) {
@@ -64,14 +55,14 @@ func clientCloseOnConnect(c chan struct{}) func() {
 	}
 }
 
-func postMessageOnConnect(message string) func(conn net.Conn) {
-	return func(conn net.Conn) {
+func postMessageOnConnect(message string) func(conn *twitchtest.Conn) {
+	return func(conn *twitchtest.Conn) {
 		fmt.Fprintf(conn, "%s\r\n", message)
 	}
 }
 
-func postMessagesOnConnect(messages []string) func(conn net.Conn) {
-	return func(conn net.Conn) {
+func postMessagesOnConnect(messages []string) func(conn *twitchtest.Conn) {
+	return func(conn *twitchtest.Conn) {
 		for _, message := range messages {
 			fmt.Fprintf(conn, "%s\r\n", message)
 		}
@@ -104,165 +95,6 @@ func connectAndEnsureGoodDisconnect(t *testing.T, client *Client) chan struct{}
 	return c
 }
 
-func handleTestConnection(t *testing.T, onConnect func(net.Conn), onMessage func(string), listener net.Listener, wg *sync.WaitGroup) {
-	conn, err := listener.Accept()
-	if err != nil {
-		t.Error(err)
-	}
-	defer func() {
-		time.Sleep(100 * time.Millisecond)
-		conn.Close()
-		wg.Done()
-	}()
-
-	reader := bufio.NewReader(conn)
-	tp := textproto.NewReader(reader)
-
-	for {
-		message, err := tp.ReadLine()
-		if err != nil {
-			return
-		}
-		message = strings.Replace(message, "\r\n", "", 1)
-
-		if strings.HasPrefix(message, "NICK") {
-			fmt.Fprintf(conn, ":tmi.twitch.tv 001 justinfan123123 :Welcome, GLHF!\r\n")
-			onConnect(conn)
-			continue
-		}
-
-		if strings.HasPrefix(message, "PASS") {
-			pass := strings.Split(message, " ")[1]
-			if !strings.HasPrefix(pass, "oauth:") {
-				fmt.Fprintf(conn, ":tmi.twitch.tv NOTICE * :Improperly formatted auth\r\n")
-				return
-			} else if pass == "oauth:wrong" {
-				fmt.Fprintf(conn, ":tmi.twitch.tv NOTICE * :Login authentication failed\r\n")
-				return
-			}
-		}
-
-		onMessage(message)
-	}
-}
-
-type testServer struct {
-	host string
-
-	stopped chan struct{}
-}
-
-func startServer(t *testing.T, onConnect func(net.Conn), onMessage func(string)) string {
-	s := startServer2(t, onConnect, onMessage)
-	return s.host
-}
-
-func startServer2(t *testing.T, onConnect func(net.Conn), onMessage func(string)) *testServer {
-	s := &testServer{
-		host: "127.0.0.1:" + strconv.Itoa(newPort()),
-
-		stopped: make(chan struct{}),
-	}
-
-	cert, err := tls.LoadX509KeyPair("test_resources/server.crt", "test_resources/server.key")
-	if err != nil {
-		t.Fatal(err)
-	}
-	config := &tls.Config{
-		MinVersion:   tls.VersionTLS12,
-		Certificates: []tls.Certificate{cert},
-	}
-	listener, err := tls.Listen("tcp", s.host, config)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	wg := sync.WaitGroup{}
-	wg.Add(1)
-	go handleTestConnection(t, onConnect, onMessage, listener, &wg)
-
-	go func() {
-		wg.Wait()
-		listener.Close()
-
-		close(s.stopped)
-	}()
-
-	return s
-}
-
-func startServerMultiConns(t *testing.T, numConns int, onConnect func(net.Conn), onMessage func(string)) string {
-	host := "127.0.0.1:" + strconv.Itoa(newPort())
-
-	cert, err := tls.LoadX509KeyPair("test_resources/server.crt", "test_resources/server.key")
-	if err != nil {
-		t.Fatal(err)
-	}
-	config := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-	}
-	listener, err := tls.Listen("tcp", host, config)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	wg := sync.WaitGroup{}
-	wg.Add(numConns)
-
-	for i := 0; i < numConns; i++ {
-		go handleTestConnection(t, onConnect, onMessage, listener, &wg)
-	}
-
-	go func() {
-		wg.Wait()
-		listener.Close()
-	}()
-
-	return host
-}
-
-func startServerMultiConnsNoTLS(t *testing.T, numConns int, onConnect func(net.Conn), onMessage func(string)) string {
-	host := "127.0.0.1:" + strconv.Itoa(newPort())
-
-	listener, err := net.Listen("tcp", host)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	wg := sync.WaitGroup{}
-	wg.Add(numConns)
-
-	for i := 0; i < numConns; i++ {
-		go handleTestConnection(t, onConnect, onMessage, listener, &wg)
-	}
-
-	go func() {
-		wg.Wait()
-		listener.Close()
-	}()
-
-	return host
-}
-
-func startNoTLSServer(t *testing.T, onConnect func(net.Conn), onMessage func(string)) string {
-	host := "127.0.0.1:" + strconv.Itoa(newPort())
-
-	listener, err := net.Listen("tcp", host)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	wg := sync.WaitGroup{}
-	wg.Add(1)
-	go handleTestConnection(t, onConnect, onMessage, listener, &wg)
-	go func() {
-		wg.Wait()
-		listener.Close()
-	}()
-
-	return host
-}
-
 func TestCanConnectAndAuthenticateWithoutTLS(t *testing.T) {
 	t.Parallel()
 	const oauthCode = "oauth:123123132"
@@ -321,6 +153,180 @@ func TestCanChangeOauthToken(t *testing.T) {
 	assertStringsEqual(t, "PASS "+oauthCode, received)
 }
 
+type refreshingTokenProvider struct {
+	refreshes int32
+}
+
+func (p *refreshingTokenProvider) Token() (string, error) {
+	return fmt.Sprintf("oauth:token%d", atomic.AddInt32(&p.refreshes, 1)), nil
+}
+
+func TestTokenProviderIsAskedOnReconnect(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+
+	client := newTestClient(server.Addr)
+	client.SetTokenProvider(&refreshingTokenProvider{})
+	go client.Connect()
+
+	assertStringsEqual(t, "PASS oauth:token1", waitForLine(t, server, "PASS"))
+	send(t, server, ":tmi.twitch.tv RECONNECT")
+	assertStringsEqual(t, "PASS oauth:token2", waitForLine(t, server, "PASS"))
+}
+
+var errNoToken = errors.New("no token")
+
+func TestTokenProviderIsAskedAgainAfterFailing(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+
+	calls := int32(0)
+
+	client := newTestClient(server.Addr)
+	client.tokenRetryDelay = time.Millisecond
+	client.SetTokenProvider(TokenFunc(func() (string, error) {
+		// The refresh before the reconnect fails once
+		switch call := atomic.AddInt32(&calls, 1); call {
+		case 2:
+			return "", errNoToken
+		default:
+			return fmt.Sprintf("oauth:token%d", call), nil
+		}
+	}))
+	go client.Connect()
+
+	assertStringsEqual(t, "PASS oauth:token1", waitForLine(t, server, "PASS"))
+	send(t, server, ":tmi.twitch.tv RECONNECT")
+	assertStringsEqual(t, "PASS oauth:token3", waitForLine(t, server, "PASS"))
+}
+
+func TestConnectReturnsTokenProviderErrorAfterRetrying(t *testing.T) {
+	t.Parallel()
+
+	calls := int32(0)
+
+	client := NewClient("justinfan123123", "oauth:123123132")
+	client.IrcAddress = "127.0.0.1:1"
+	client.tokenRetryDelay = time.Millisecond
+	client.SetTokenProvider(TokenFunc(func() (string, error) {
+		atomic.AddInt32(&calls, 1)
+		return "", errNoToken
+	}))
+
+	err := client.Connect()
+	assertTrue(t, errors.Is(err, errNoToken), "token provider error was not returned")
+	assertIntsEqual(t, maxTokenAttempts, int(atomic.LoadInt32(&calls)))
+}
+
+func TestCanDisconnectWhileTokenProviderIsRetrying(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+
+	calls := int32(0)
+	retrying := make(chan struct{})
+
+	client := newTestClient(server.Addr)
+	client.tokenRetryDelay = time.Millisecond * 20
+	client.SetTokenProvider(TokenFunc(func() (string, error) {
+		// Every refresh after the first connection fails, so the client keeps retrying
+		call := atomic.AddInt32(&calls, 1)
+		if call == 1 {
+			return "oauth:token1", nil
+		}
+		if call == 3 {
+			close(retrying)
+		}
+		return "", errNoToken
+	}))
+
+	connected := make(chan error)
+	go func() {
+		connected <- client.Connect()
+	}()
+
+	assertStringsEqual(t, "PASS oauth:token1", waitForLine(t, server, "PASS"))
+	send(t, server, ":tmi.twitch.tv RECONNECT")
+
+	select {
+	case <-retrying:
+	case <-time.After(time.Second * 3):
+		t.Fatal("token provider wasn't retried")
+	}
+	assertErrorsEqual(t, nil, client.Disconnect())
+
+	select {
+	case err := <-connected:
+		assertErrorsEqual(t, ErrClientDisconnected, err)
+	case <-time.After(time.Second * 3):
+		t.Fatal("Connect didn't return after Disconnect")
+	}
+}
+
+func TestCanDisconnectBetweenConnectionAttempts(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+
+	client := newTestClient(server.Addr)
+	client.SetTokenProvider(TokenFunc(func() (string, error) {
+		// The client is between two connection attempts while asking for the token of the next one
+		if client.State() == StateReconnecting {
+			assertErrorsEqual(t, nil, client.Disconnect())
+		}
+		return "oauth:123123132", nil
+	}))
+
+	connected := make(chan error)
+	go func() {
+		connected <- client.Connect()
+	}()
+
+	waitForLine(t, server, "PASS")
+	send(t, server, ":tmi.twitch.tv RECONNECT")
+
+	select {
+	case err := <-connected:
+		assertErrorsEqual(t, ErrClientDisconnected, err)
+	case <-time.After(time.Second * 3):
+		t.Fatal("Connect didn't return after Disconnect")
+	}
+}
+
+func TestCanUseTokenFuncWithoutPrefix(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+
+	calls := int32(0)
+
+	client := newTestClient(server.Addr)
+	client.SetTokenProvider(TokenFunc(func() (string, error) {
+		// Only the first token is returned without the prefix
+		if call := atomic.AddInt32(&calls, 1); call > 1 {
+			return fmt.Sprintf("oauth:token%d", call), nil
+		}
+
+		return "token1", nil
+	}))
+	go client.Connect()
+
+	assertStringsEqual(t, "PASS oauth:token1", waitForLine(t, server, "PASS"))
+	send(t, server, ":tmi.twitch.tv RECONNECT")
+	assertStringsEqual(t, "PASS oauth:token2", waitForLine(t, server, "PASS"))
+}
+
+func TestNewClientAcceptsTokenWithoutPrefix(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "123123123")
+
+	written := &bytes.Buffer{}
+	conn := struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader(":tmi.twitch.tv 001 justinfan123123 :Welcome, GLHF!"), written}
+	assertErrorsEqual(t, nil, client.ConnectWithConn(conn))
+
+	assertTrue(t, strings.Contains(written.String(), "PASS oauth:123123123\r\n"), "token was not prefixed: "+written.String())
+}
+
 func TestCanAddSetupCmd(t *testing.T) {
 	t.Parallel()
 	const oauthCode = "oauth:123123132"
@@ -433,14 +439,16 @@ func TestFullConnectAndDisconnect(t *testing.T) {
 }
 
 func TestCanConnectAndAuthenticateAnonymous(t *testing.T) {
-	const oauthCode = "oauth:59301"
-	waitPass := make(chan struct{})
 	waitServerConnect := make(chan struct{})
 	waitClientConnect := make(chan struct{})
 
-	var received string
+	var passes int32
 
-	server := startServer2(t, closeOnConnect(waitServerConnect), closeOnPassReceived(&received, waitPass))
+	server := startServer2(t, closeOnConnect(waitServerConnect), func(message string) {
+		if strings.HasPrefix(message, "PASS") {
+			atomic.AddInt32(&passes, 1)
+		}
+	})
 
 	client := newAnonymousTestClient(server.host)
 	client.OnConnect(clientCloseOnConnect(waitClientConnect))
@@ -456,14 +464,8 @@ func TestCanConnectAndAuthenticateAnonymous(t *testing.T) {
 		t.Fatal("no successful connection")
 	}
 
-	// Wait to receive password
-	select {
-	case <-waitPass:
-	case <-time.After(time.Second * 3):
-		t.Fatal("no oauth read")
-	}
-
-	assertStringsEqual(t, "PASS "+oauthCode, received)
+	// An anonymous client logs in with NICK alone, the PASS line would have been received before NICK
+	assertIntsEqual(t, 0, int(atomic.LoadInt32(&passes)))
 
 	// Disconnect client from server
 	err := client.Disconnect()
@@ -540,134 +542,286 @@ func TestCanReceivePRIVMSGMessage(t *testing.T) {
 	assertStringsEqual(t, "Thrashh5, FeelsWayTooAmazingMan kinda", received)
 }
 
-func TestCanReceiveWHISPERMessage(t *testing.T) {
+func TestQueuesJoinsAndMessagesUntilConnected(t *testing.T) {
 	t.Parallel()
-	testMessage := "@badges=;color=#00FF7F;display-name=Danielps1;emotes=;message-id=20;thread-id=32591953_77829817;turbo=0;user-id=32591953;user-type= :danielps1!danielps1@danielps1.tmi.twitch.tv WHISPER gempir :i like memes"
+	server := newTestServer(t)
+	client := newTestClient(server.Addr)
 
-	wait := make(chan struct{})
-	var received string
+	assertErrorsEqual(t, nil, client.Join("gempir"))
+	assertErrorsEqual(t, nil, client.Join("#Gempir", "pajlada"))
+	assertErrorsEqual(t, nil, client.Say("gempir", "first"))
+	assertErrorsEqual(t, nil, client.Say("gempir", "second"))
 
-	host := startServer(t, postMessageOnConnect(testMessage), nothingOnMessage)
-	client := newTestClient(host)
+	go client.Connect()
+	defer client.Disconnect()
 
-	client.OnWhisperMessage(func(message WhisperMessage) {
-		received = message.Message
-		assertMessageTypesEqual(t, WHISPER, message.GetType())
-		close(wait)
+	waitForLine(t, server, "PRIVMSG #gempir :second")
+
+	var written []string
+	for _, line := range server.Lines() {
+		if !strings.HasPrefix(line, "CAP") {
+			written = append(written, line)
+		}
+	}
+	assertStringSlicesEqual(t, []string{
+		"PASS oauth:123123132",
+		"NICK justinfan123123",
+		"JOIN #gempir,#pajlada",
+		"PRIVMSG #gempir :first",
+		"PRIVMSG #gempir :second",
+	}, written)
+}
+
+func TestCanRejectSendsUntilConnected(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123123")
+	client.SetQueueEarlySends(false)
+
+	assertErrorsEqual(t, ErrConnectionIsNotOpen, client.Say("gempir", "hello"))
+	assertErrorsEqual(t, ErrConnectionIsNotOpen, client.EnableEmoteOnly("gempir"))
+	assertErrorsEqual(t, nil, client.Join("gempir"))
+
+	written := &bytes.Buffer{}
+	conn := struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader(":tmi.twitch.tv 001 justinfan123123 :Welcome, GLHF!"), written}
+
+	client.OnConnect(func() {
+		assertErrorsEqual(t, nil, client.Say("gempir", "hello"))
 	})
+	assertErrorsEqual(t, nil, client.ConnectWithConn(conn))
+
+	lines := strings.Split(strings.TrimSuffix(written.String(), "\r\n"), "\r\n")
+	assertStringSlicesEqual(t, []string{"JOIN #gempir", "PRIVMSG #gempir :hello"}, lines[3:])
+}
+
+func TestCanWaitForConnect(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+	client := newTestClient(server.Addr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assertErrorsEqual(t, context.DeadlineExceeded, client.WaitForConnect(ctx))
+
+	connected := make(chan error)
+	go func() {
+		connected <- client.Connect()
+	}()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	assertErrorsEqual(t, nil, client.WaitForConnect(ctx))
+	assertTrue(t, client.Connected(), "client is not connected after WaitForConnect returned")
+
+	// Waiting again returns immediately while connected
+	assertErrorsEqual(t, nil, client.WaitForConnect(ctx))
+
+	assertErrorsEqual(t, nil, client.Disconnect())
+	assertErrorsEqual(t, ErrClientDisconnected, <-connected)
+	assertErrorsEqual(t, ErrClientDisconnected, client.WaitForConnect(ctx))
+}
+
+func TestWaitForConnectReturnsConnectError(t *testing.T) {
+	t.Parallel()
+	host := startServer(t, nothingOnConnect, nothingOnMessage)
+	client := NewClient("justinfan123123", "oauth:wrong")
+	client.IrcAddress = host
 
 	go client.Connect()
 
-	// wait for server to start
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	assertErrorsEqual(t, ErrLoginAuthenticationFailed, client.WaitForConnect(ctx))
+	assertFalse(t, client.Connected(), "client is connected after its login failed")
+}
+
+func TestCanWaitConnected(t *testing.T) {
+	t.Parallel()
+
+	host := startServer(t, nothingOnConnect, nothingOnMessage)
+	client := newTestClient(host)
+
+	assertFalse(t, client.Connected(), "client is connected before calling Connect")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assertErrorsEqual(t, context.DeadlineExceeded, client.WaitConnected(ctx))
+
+	clientDisconnected := connectAndEnsureGoodDisconnect(t, client)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	assertErrorsEqual(t, nil, client.WaitConnected(ctx))
+	assertTrue(t, client.Connected(), "client is not connected after WaitConnected returned")
+
+	// Waiting again returns immediately while connected
+	assertErrorsEqual(t, nil, client.WaitConnected(ctx))
+
+	client.Disconnect()
+
 	select {
-	case <-wait:
+	case <-clientDisconnected:
 	case <-time.After(time.Second * 3):
-		t.Fatal("no message sent")
+		t.Fatal("client did not disconnect")
 	}
 
-	assertStringsEqual(t, "i like memes", received)
+	assertFalse(t, client.Connected(), "client is connected after disconnecting")
 }
 
-func TestCanReceiveCLEARCHATMessage(t *testing.T) {
+func TestCanReceiveLongPRIVMSGMessageSplitAcrossReads(t *testing.T) {
 	t.Parallel()
-	testMessage := `@ban-duration=1;ban-reason=testing\sxd;room-id=11148817;target-user-id=40910607 :tmi.twitch.tv CLEARCHAT #pajlada :ampzyh`
+	const emoteCount = 5000
 
-	wait := make(chan struct{})
-	var received int
+	positions := make([]string, emoteCount)
+	for i := range positions {
+		positions[i] = strconv.Itoa(i*6) + "-" + strconv.Itoa(i*6+4)
+	}
+	text := strings.TrimSpace(strings.Repeat("Kappa ", emoteCount))
+	testMessage := "@badges=;color=;display-name=pajlada;emotes=25:" + strings.Join(positions, ",") + ";id=1;room-id=11148817;user-id=11148817 :pajlada!pajlada@pajlada.tmi.twitch.tv PRIVMSG #pajlada :" + text
+	assertTrue(t, len(testMessage) > 70*1024, "test message is shorter than 70KB")
 
-	host := startServer(t, postMessageOnConnect(testMessage), nothingOnMessage)
+	wait := make(chan struct{})
+	var received []PrivateMessage
+
+	host := startServer(t, func(conn *twitchtest.Conn) {
+		// deliver the long line in two parts, the second part together with another line
+		half := len(testMessage) / 2
+		fmt.Fprint(conn, testMessage[:half])
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprintf(conn, "%s\r\n:pajlada!pajlada@pajlada.tmi.twitch.tv PRIVMSG #pajlada :short\r\n", testMessage[half:])
+	}, nothingOnMessage)
 	client := newTestClient(host)
 
-	client.OnClearChatMessage(func(message ClearChatMessage) {
-		received = message.BanDuration
-		assertMessageTypesEqual(t, CLEARCHAT, message.GetType())
-		close(wait)
+	client.OnPrivateMessage(func(message PrivateMessage) {
+		received = append(received, message)
+		if len(received) == 2 {
+			close(wait)
+		}
 	})
 
 	go client.Connect()
 
-	// wait for server to start
 	select {
 	case <-wait:
 	case <-time.After(time.Second * 3):
 		t.Fatal("no message sent")
 	}
 
-	assertIntsEqual(t, 1, received)
+	assertStringsEqual(t, text, received[0].Message)
+	assertIntsEqual(t, 1, len(received[0].Emotes))
+	assertIntsEqual(t, emoteCount, len(received[0].Emotes[0].Positions))
+	assertStringsEqual(t, "short", received[1].Message)
 }
 
-func TestCanReceiveCLEARMSGMessage(t *testing.T) {
+func TestCanReceiveRawLines(t *testing.T) {
 	t.Parallel()
-	testMessage := `@login=ronni;target-msg-id=abc-123-def :tmi.twitch.tv CLEARMSG #dallas :HeyGuys`
+	testMessages := []string{
+		":tmi.twitch.tv CAP * ACK :twitch.tv/tags twitch.tv/commands",
+		":tmi.twitch.tv 372 justinfan123123 :You are in a maze of twisty passages.",
+		"@badges=;color=;display-name=pajlada;emotes=;room-id=11148817;user-id=11148817 :pajlada!pajlada@pajlada.tmi.twitch.tv PRIVMSG #pajlada :hello\\sworld",
+	}
 
 	wait := make(chan struct{})
-	var received string
+	var received []string
 
-	host := startServer(t, postMessageOnConnect(testMessage), nothingOnMessage)
+	host := startServer(t, postMessagesOnConnect(testMessages), nothingOnMessage)
 	client := newTestClient(host)
+	client.SetDispatchMode(DispatchAsync, 2, 8)
 
-	client.OnClearMessage(func(message ClearMessage) {
-		received = message.Login
-		assertMessageTypesEqual(t, CLEARMSG, message.GetType())
+	client.OnRawLine(func(line string) {
+		received = append(received, line)
+	})
+
+	client.OnPrivateMessage(func(message PrivateMessage) {
 		close(wait)
 	})
 
 	go client.Connect()
 
-	// wait for server to start
 	select {
 	case <-wait:
 	case <-time.After(time.Second * 3):
-		t.Fatal("no message sent")
+		t.Fatal("no message received")
 	}
 
-	assertStringsEqual(t, "ronni", received)
+	assertStringSlicesEqual(t, append([]string{":tmi.twitch.tv 001 justinfan123123 :Welcome, GLHF!"}, testMessages...), received)
 }
 
-func TestCanReceiveROOMSTATEMessage(t *testing.T) {
+func TestCanAttachMultiplePRIVMSGHandlers(t *testing.T) {
 	t.Parallel()
-	testMessage := `@slow=10 :tmi.twitch.tv ROOMSTATE #gempir`
+	testMessages := []string{
+		"@badges=;color=;display-name=pajlada;emotes=;mod=0;room-id=11148817;subscriber=0;tmi-sent-ts=1522855191000;turbo=0;user-id=11148817;user-type= :pajlada!pajlada@pajlada.tmi.twitch.tv PRIVMSG #pajlada :first",
+		"@badges=;color=;display-name=pajlada;emotes=;mod=0;room-id=11148817;subscriber=0;tmi-sent-ts=1522855191000;turbo=0;user-id=11148817;user-type= :pajlada!pajlada@pajlada.tmi.twitch.tv PRIVMSG #pajlada :second",
+	}
 
 	wait := make(chan struct{})
-	var received string
+	var received []string
+	var secondID HandlerID
 
-	host := startServer(t, postMessageOnConnect(testMessage), nothingOnMessage)
+	host := startServer(t, postMessagesOnConnect(testMessages), nothingOnMessage)
 	client := newTestClient(host)
 
-	client.OnRoomStateMessage(func(message RoomStateMessage) {
-		received = message.Tags["slow"]
-		assertMessageTypesEqual(t, ROOMSTATE, message.GetType())
-		close(wait)
+	client.OnPrivateMessage(func(message PrivateMessage) {
+		received = append(received, "first handler: "+message.Message)
+		if message.Message == "first" {
+			assertTrue(t, client.RemoveHandler(secondID), "second handler could not be removed")
+		} else {
+			close(wait)
+		}
+	})
+
+	secondID = client.OnPrivateMessage(func(message PrivateMessage) {
+		received = append(received, "second handler: "+message.Message)
 	})
 
 	go client.Connect()
 
-	// wait for server to start
 	select {
 	case <-wait:
 	case <-time.After(time.Second * 3):
 		t.Fatal("no message sent")
 	}
 
-	assertStringsEqual(t, "10", received)
+	assertStringSlicesEqual(t, []string{
+		"first handler: first",
+		"second handler: first",
+		"first handler: second",
+	}, received)
+	assertFalse(t, client.RemoveHandler(secondID), "second handler was removed twice")
 }
 
-func TestCanReceiveUSERNOTICEMessage(t *testing.T) {
+func TestCanRecoverFromPanickingHandler(t *testing.T) {
 	t.Parallel()
-	testMessage := `@badges=subscriber/12,premium/1;color=#5F9EA0;display-name=blahh;emotes=;id=9154ac04-c9ad-46d5-97ad-15d2dbf244f0;login=deliquid;mod=0;msg-id=resub;msg-param-months=16;msg-param-sub-plan-name=Channel\sSubscription\s(NOTHING);msg-param-sub-plan=Prime;room-id=23161357;subscriber=1;system-msg=blahh\sjust\ssubscribed\swith\sTwitch\sPrime.\sblahh\ssubscribed\sfor\s16\smonths\sin\sa\srow!;tmi-sent-ts=1517165351175;turbo=0;user-id=1234567890;user-type= :tmi.twitch.tv USERNOTICE #nothing`
+	testMessages := []string{
+		"@badges=;color=;display-name=pajlada;emotes=;mod=0;room-id=11148817;subscriber=0;tmi-sent-ts=1522855191000;turbo=0;user-id=11148817;user-type= :pajlada!pajlada@pajlada.tmi.twitch.tv PRIVMSG #pajlada :panic",
+		"@badges=;color=;display-name=pajlada;emotes=;mod=0;room-id=11148817;subscriber=0;tmi-sent-ts=1522855191000;turbo=0;user-id=11148817;user-type= :pajlada!pajlada@pajlada.tmi.twitch.tv PRIVMSG #pajlada :calm",
+	}
 
 	wait := make(chan struct{})
+	var panicMessage Message
+	var recovered interface{}
 	var received string
 
-	host := startServer(t, postMessageOnConnect(testMessage), nothingOnMessage)
+	host := startServer(t, postMessagesOnConnect(testMessages), nothingOnMessage)
 	client := newTestClient(host)
 
-	client.OnUserNoticeMessage(func(message UserNoticeMessage) {
-		received = message.Tags["msg-param-months"]
-		assertMessageTypesEqual(t, USERNOTICE, message.GetType())
+	client.OnPrivateMessage(func(message PrivateMessage) {
+		if message.Message == "panic" {
+			panic("handler panic")
+		}
+
+		received = message.Message
 		close(wait)
 	})
 
+	client.OnHandlerPanic(func(message Message, r interface{}, stack []byte) {
+		panicMessage = message
+		recovered = r
+		assertTrue(t, len(stack) > 0, "stack of panic is empty")
+	})
+
 	go client.Connect()
 
 	select {
@@ -676,88 +830,178 @@ func TestCanReceiveUSERNOTICEMessage(t *testing.T) {
 		t.Fatal("no message sent")
 	}
 
-	assertStringsEqual(t, "16", received)
+	assertStringsEqual(t, "calm", received)
+	assertStringsEqual(t, "handler panic", recovered.(string))
+	assertStringsEqual(t, "panic", panicMessage.(*PrivateMessage).Message)
 }
 
-func TestCanReceiveUSERNOTICEMessageResub(t *testing.T) {
+func TestCanDisablePanicRecovery(t *testing.T) {
 	t.Parallel()
-	testMessage := `@badges=moderator/1,subscriber/24;color=#1FD2FF;display-name=Karl_Kons;emotes=28087:0-6;flags=;id=7c95beea-a7ac-4c10-9e0a-d7dbf163c038;login=karl_kons;mod=1;msg-id=resub;msg-param-months=34;msg-param-sub-plan-name=look\sat\sthose\sshitty\semotes,\srip\s$5\sLUL;msg-param-sub-plan=1000;room-id=11148817;subscriber=1;system-msg=Karl_Kons\sjust\ssubscribed\swith\sa\sTier\s1\ssub.\sKarl_Kons\ssubscribed\sfor\s34\smonths\sin\sa\srow!;tmi-sent-ts=1540140252828;turbo=0;user-id=68706331;user-type=mod :tmi.twitch.tv USERNOTICE #pajlada :WutFace`
+	client := NewClient("justinfan123123", "oauth:123123132")
+	client.RecoverPanics = false
 
-	wait := make(chan struct{})
-	var received string
+	panicHandlerCalled := false
+	client.OnHandlerPanic(func(message Message, r interface{}, stack []byte) {
+		panicHandlerCalled = true
+	})
+	client.OnPrivateMessage(func(message PrivateMessage) {
+		panic("handler panic")
+	})
 
-	host := startServer(t, postMessageOnConnect(testMessage), nothingOnMessage)
+	defer func() {
+		assertTrue(t, recover() != nil, "panic was recovered")
+		assertFalse(t, panicHandlerCalled, "panic handler was called")
+	}()
+
+	client.dispatch(privateMessageEvent, &PrivateMessage{})
+}
+
+func TestSlowHandlerDoesNotStallAsyncDispatch(t *testing.T) {
+	t.Parallel()
+	testMessages := []string{
+		"@badges=;color=;display-name=pajlada;emotes=;mod=0;room-id=11148817;subscriber=0;tmi-sent-ts=1522855191000;turbo=0;user-id=11148817;user-type= :pajlada!pajlada@pajlada.tmi.twitch.tv PRIVMSG #pajlada :slow",
+		":tmi.twitch.tv PING :tmi.twitch.tv",
+	}
+
+	waitPong := make(chan struct{})
+	unblock := make(chan struct{})
+	waitHandled := make(chan struct{})
+
+	host := startServer(t, postMessagesOnConnect(testMessages), func(message string) {
+		if message == "PONG :tmi.twitch.tv" {
+			close(waitPong)
+		}
+	})
 	client := newTestClient(host)
+	client.SetDispatchMode(DispatchAsync, 2, 16)
 
-	client.OnUserNoticeMessage(func(message UserNoticeMessage) {
-		received = message.Tags["msg-param-months"]
-		close(wait)
+	client.OnPrivateMessage(func(message PrivateMessage) {
+		<-unblock
+		close(waitHandled)
 	})
 
 	go client.Connect()
 
 	select {
-	case <-wait:
+	case <-waitPong:
 	case <-time.After(time.Second * 3):
-		t.Fatal("no message sent")
+		t.Fatal("slow handler stalled the PONG response")
 	}
 
-	assertStringsEqual(t, "34", received)
+	close(unblock)
+
+	select {
+	case <-waitHandled:
+	case <-time.After(time.Second * 3):
+		t.Fatal("slow handler was not called")
+	}
 }
 
-func checkNoticeMessage(t *testing.T, testMessage string, requirements map[string]string) {
-	received := map[string]string{}
-	wait := make(chan struct{})
+func TestSlowHandlerDoesNotStallReadingWithHandlerConcurrency(t *testing.T) {
+	t.Parallel()
+	testMessages := []string{
+		"@badges=;color=;display-name=pajlada;emotes=;room-id=11148817;tmi-sent-ts=1522855191000;user-id=11148817;user-type= :pajlada!pajlada@pajlada.tmi.twitch.tv PRIVMSG #pajlada :first",
+		"@badges=;color=;display-name=pajlada;emotes=;room-id=11148817;tmi-sent-ts=1522855191000;user-id=11148817;user-type= :pajlada!pajlada@pajlada.tmi.twitch.tv PRIVMSG #pajlada :second",
+		"@badges=;color=;display-name=pajlada;emotes=;room-id=11148817;tmi-sent-ts=1522855191000;user-id=11148817;user-type= :pajlada!pajlada@pajlada.tmi.twitch.tv PRIVMSG #pajlada :third",
+		":tmi.twitch.tv PING :tmi.twitch.tv",
+	}
 
-	host := startServer(t, postMessageOnConnect(testMessage), nothingOnMessage)
+	waitPong := make(chan struct{})
+	unblock := make(chan struct{})
+	waitHandled := make(chan struct{})
+
+	host := startServer(t, postMessagesOnConnect(testMessages), func(message string) {
+		if message == "PONG :tmi.twitch.tv" {
+			close(waitPong)
+		}
+	})
 	client := newTestClient(host)
+	client.SetHandlerConcurrency(2)
 
-	client.OnNoticeMessage(func(message NoticeMessage) {
-		received["msg-id"] = message.Tags["msg-id"]
-		received["channel"] = message.Channel
-		received["text"] = message.Message
-		received["raw"] = message.Raw
-		assertMessageTypesEqual(t, NOTICE, message.GetType())
-		close(wait)
+	var received []string
+	client.OnPrivateMessage(func(message PrivateMessage) {
+		<-unblock
+		received = append(received, message.Message)
+		if len(received) == 3 {
+			close(waitHandled)
+		}
 	})
 
 	go client.Connect()
 
 	select {
-	case <-wait:
+	case <-waitPong:
 	case <-time.After(time.Second * 3):
-		t.Fatal("no message sent")
+		t.Fatal("slow handler stalled reading the PING")
 	}
 
-	assertStringsEqual(t, testMessage, received["raw"])
-	for key, requirement := range requirements {
-		assertStringsEqual(t, requirement, received[key])
+	close(unblock)
+
+	select {
+	case <-waitHandled:
+	case <-time.After(time.Second * 3):
+		t.Fatal("slow handler was not called")
 	}
+
+	// The messages of a channel are handled by one worker, in the order they were received
+	assertStringSlicesEqual(t, []string{"first", "second", "third"}, received)
 }
 
-func TestCanReceiveNOTICEMessage(t *testing.T) {
+func TestCanReceiveMessagesOnChannel(t *testing.T) {
 	t.Parallel()
-	testMessage := `@msg-id=host_on :tmi.twitch.tv NOTICE #pajlada :Now hosting KKona.`
-	checkNoticeMessage(t, testMessage, map[string]string{
-		"msg-id":  "host_on",
-		"channel": "pajlada",
-		"text":    "Now hosting KKona.",
-	})
+	testMessages := []string{
+		"@badges=;color=;display-name=pajlada;emotes=;mod=0;room-id=11148817;subscriber=0;tmi-sent-ts=1522855191000;turbo=0;user-id=11148817;user-type= :pajlada!pajlada@pajlada.tmi.twitch.tv PRIVMSG #pajlada :hello",
+		"@badges=;color=#00FF7F;display-name=Danielps1;emotes=;message-id=20;thread-id=32591953_77829817;turbo=0;user-id=32591953;user-type= :danielps1!danielps1@danielps1.tmi.twitch.tv WHISPER gempir :i like memes",
+	}
+
+	host := startServer(t, postMessagesOnConnect(testMessages), nothingOnMessage)
+	client := newTestClient(host)
+	messages := client.Messages()
+	clientDisconnected := connectAndEnsureGoodDisconnect(t, client)
+
+	var received []string
+	timeout := time.After(time.Second * 3)
+	for len(received) < 2 {
+		select {
+		case message := <-messages:
+			switch msg := message.(type) {
+			case *PrivateMessage:
+				received = append(received, msg.Message)
+			case *WhisperMessage:
+				received = append(received, msg.Message)
+			}
+		case <-timeout:
+			t.Fatal("no message received")
+		}
+	}
+
+	assertStringSlicesEqual(t, []string{"hello", "i like memes"}, received)
+	assertTrue(t, messages == client.Messages(), "Messages returned a different channel")
+
+	client.Disconnect()
+	<-clientDisconnected
+
+	for range messages {
+		// drain remaining messages until the channel is closed
+	}
 }
 
-func TestCanReceiveNOTICEMessageTimeout(t *testing.T) {
+func TestMessagesChannelDropsMessagesWhenFull(t *testing.T) {
 	t.Parallel()
-	testMessage := `@msg-id=timeout_success :tmi.twitch.tv NOTICE #forsen :thedl0rd has been timed out for 8 minutes 11 seconds.`
-	checkNoticeMessage(t, testMessage, map[string]string{
-		"msg-id":  "timeout_success",
-		"channel": "forsen",
-		"text":    "thedl0rd has been timed out for 8 minutes 11 seconds.",
-	})
+	client := NewClient("justinfan123123", "oauth:123123132")
+
+	messages := client.Messages()
+	for i := 0; i < MessagesBufferSize+2; i++ {
+		client.publishMessage(&PrivateMessage{})
+	}
+
+	assertIntsEqual(t, MessagesBufferSize, len(messages))
+	assertTrue(t, client.MessagesDropped() == 2, "dropped messages were not counted")
 }
 
-func TestCanReceiveUSERStateMessage(t *testing.T) {
+func TestCanReceiveWHISPERMessage(t *testing.T) {
 	t.Parallel()
-	testMessage := `@badges=moderator/1;color=;display-name=blahh;emote-sets=0;mod=1;subscriber=0;user-type=mod :tmi.twitch.tv USERSTATE #nothing`
+	testMessage := "@badges=;color=#00FF7F;display-name=Danielps1;emotes=;message-id=20;thread-id=32591953_77829817;turbo=0;user-id=32591953;user-type= :danielps1!danielps1@danielps1.tmi.twitch.tv WHISPER gempir :i like memes"
 
 	wait := make(chan struct{})
 	var received string
@@ -765,293 +1009,979 @@ func TestCanReceiveUSERStateMessage(t *testing.T) {
 	host := startServer(t, postMessageOnConnect(testMessage), nothingOnMessage)
 	client := newTestClient(host)
 
-	client.OnUserStateMessage(func(message UserStateMessage) {
-		received = message.Tags["mod"]
-		assertMessageTypesEqual(t, USERSTATE, message.GetType())
+	client.OnWhisperMessage(func(message WhisperMessage) {
+		received = message.Message
+		assertMessageTypesEqual(t, WHISPER, message.GetType())
 		close(wait)
 	})
 
 	go client.Connect()
 
+	// wait for server to start
 	select {
 	case <-wait:
 	case <-time.After(time.Second * 3):
 		t.Fatal("no message sent")
 	}
 
-	assertStringsEqual(t, "1", received)
+	assertStringsEqual(t, "i like memes", received)
 }
 
-func TestCanReceiveGlobalUserStateMessage(t *testing.T) {
+func TestCanReceiveCLEARCHATMessage(t *testing.T) {
 	t.Parallel()
-	testMessage := `@badge-info=;badges=;color=#00FF7F;display-name=gempbot;emote-sets=0,14417,300206298,300374282,300548762;user-id=99659894;user-type= :tmi.twitch.tv GLOBALUSERSTATE`
+	testMessage := `@ban-duration=1;ban-reason=testing\sxd;room-id=11148817;target-user-id=40910607 :tmi.twitch.tv CLEARCHAT #pajlada :ampzyh`
 
 	wait := make(chan struct{})
-	var received string
+	var received time.Duration
 
 	host := startServer(t, postMessageOnConnect(testMessage), nothingOnMessage)
 	client := newTestClient(host)
 
-	client.OnGlobalUserStateMessage(func(message GlobalUserStateMessage) {
-		received = message.Tags["user-id"]
-		assertMessageTypesEqual(t, GLOBALUSERSTATE, message.GetType())
+	client.OnClearChatMessage(func(message ClearChatMessage) {
+		received = message.BanDuration
+		assertMessageTypesEqual(t, CLEARCHAT, message.GetType())
 		close(wait)
 	})
 
-	//nolint
 	go client.Connect()
 
+	// wait for server to start
 	select {
 	case <-wait:
 	case <-time.After(time.Second * 3):
 		t.Fatal("no message sent")
 	}
 
-	assertStringsEqual(t, "99659894", received)
+	assertTrue(t, received == time.Second, "wrong ban duration "+received.String())
 }
 
-func TestCanReceiveJOINMessage(t *testing.T) {
+func TestCanGetRoomState(t *testing.T) {
 	t.Parallel()
-	testMessage := `:username123!username123@username123.tmi.twitch.tv JOIN #mychannel`
+	testMessages := []string{
+		"@emote-only=0;followers-only=-1;r9k=0;rituals=0;room-id=11148817;slow=0;subs-only=0 :tmi.twitch.tv ROOMSTATE #pajlada",
+		"@room-id=11148817;slow=10 :tmi.twitch.tv ROOMSTATE #pajlada",
+	}
 
 	wait := make(chan struct{})
-	var received UserJoinMessage
+	var received []RoomState
 
-	host := startServer(t, postMessageOnConnect(testMessage), nothingOnMessage)
+	host := startServer(t, postMessagesOnConnect(testMessages), nothingOnMessage)
 	client := newTestClient(host)
 
-	client.OnUserJoinMessage(func(message UserJoinMessage) {
-		received = message
-		close(wait)
+	_, ok := client.GetRoomState("pajlada")
+	assertFalse(t, ok, "room state exists before connecting")
+
+	client.OnRoomStateMessage(func(message RoomStateMessage) {
+		roomState, _ := client.GetRoomState(message.Channel)
+		received = append(received, roomState)
+		if len(received) == 2 {
+			close(wait)
+		}
 	})
 
 	go client.Connect()
 
-	// wait for server to start
 	select {
 	case <-wait:
 	case <-time.After(time.Second * 3):
 		t.Fatal("no message sent")
 	}
 
-	assertStringsEqual(t, "username123", received.User)
-	assertStringsEqual(t, "mychannel", received.Channel)
-	assertMessageTypesEqual(t, JOIN, received.GetType())
+	assertIntsEqual(t, 0, received[0].Slow)
+	assertIntsEqual(t, 10, received[1].Slow)
+	assertIntsEqual(t, -1, received[1].FollowersOnly)
+
+	roomState, ok := client.GetRoomState("Pajlada")
+	assertTrue(t, ok, "room state of pajlada is missing")
+	assertIntsEqual(t, 10, roomState.Slow)
+
+	client.Depart("pajlada")
+	_, ok = client.GetRoomState("pajlada")
+	assertFalse(t, ok, "room state of pajlada was not removed on depart")
 }
 
-func TestReceiveJOINMessageWithSelfJOIN(t *testing.T) {
+func TestRoomStateMergesDeltas(t *testing.T) {
 	t.Parallel()
 	testMessages := []string{
-		`:justinfan123123!justinfan123123@justinfan123123.tmi.twitch.tv JOIN #mychannel`,
-		`:username123!username123@username123.tmi.twitch.tv JOIN #mychannel`,
+		"@emote-only=1;followers-only=10;r9k=0;rituals=0;room-id=11148817;slow=0;subs-only=1 :tmi.twitch.tv ROOMSTATE #pajlada",
+		"@room-id=11148817;slow=10 :tmi.twitch.tv ROOMSTATE #pajlada",
 	}
 
-	var receivedOther UserJoinMessage
-	var receivedSelf UserJoinMessage
+	wait := make(chan struct{})
+	var deltas []map[string]int
 
 	host := startServer(t, postMessagesOnConnect(testMessages), nothingOnMessage)
 	client := newTestClient(host)
 
-	wg := new(sync.WaitGroup)
-	wg.Add(2)
+	assertIntsEqual(t, -1, client.RoomState("pajlada").FollowersOnly)
 
-	client.OnUserJoinMessage(func(message UserJoinMessage) {
-		receivedOther = message
-		wg.Done()
+	client.OnRoomStateMessage(func(message RoomStateMessage) {
+		deltas = append(deltas, message.State)
+		if len(deltas) == 2 {
+			close(wait)
+		}
 	})
 
-	client.OnSelfJoinMessage(func(message UserJoinMessage) {
-		receivedSelf = message
-		wg.Done()
+	go client.Connect()
+
+	select {
+	case <-wait:
+	case <-time.After(time.Second * 3):
+		t.Fatal("no message sent")
+	}
+
+	assertIntsEqual(t, 6, len(deltas[0]))
+	assertStringIntMapsEqual(t, map[string]int{"slow": 10}, deltas[1])
+
+	roomState := client.RoomState("pajlada")
+	assertStringsEqual(t, "11148817", roomState.RoomID)
+	assertTrue(t, roomState.EmoteOnly, "emote-only of the full state was lost")
+	assertTrue(t, roomState.SubsOnly, "subs-only of the full state was lost")
+	assertIntsEqual(t, 10, roomState.FollowersOnly)
+	assertIntsEqual(t, 10, roomState.Slow)
+}
+
+func TestCanReceiveCLEARMSGMessage(t *testing.T) {
+	t.Parallel()
+	testMessage := `@login=ronni;target-msg-id=abc-123-def :tmi.twitch.tv CLEARMSG #dallas :HeyGuys`
+
+	wait := make(chan struct{})
+	var received string
+
+	host := startServer(t, postMessageOnConnect(testMessage), nothingOnMessage)
+	client := newTestClient(host)
+
+	client.OnClearMessage(func(message ClearMessage) {
+		received = message.Login
+		assertMessageTypesEqual(t, CLEARMSG, message.GetType())
+		close(wait)
 	})
 
 	go client.Connect()
 
-	// hack with ctx makes it possible to use it in select statement below
-	ctx, cancel := context.WithCancel(context.Background())
-	go func() {
-		wg.Wait()
-		cancel()
-	}()
-
 	// wait for server to start
 	select {
-	case <-ctx.Done():
+	case <-wait:
 	case <-time.After(time.Second * 3):
 		t.Fatal("no message sent")
 	}
 
-	assertStringsEqual(t, "username123", receivedOther.User)
-	assertStringsEqual(t, "mychannel", receivedOther.Channel)
-	assertMessageTypesEqual(t, JOIN, receivedOther.GetType())
-
-	assertStringsEqual(t, "justinfan123123", receivedSelf.User)
-	assertStringsEqual(t, "mychannel", receivedSelf.Channel)
-	assertMessageTypesEqual(t, JOIN, receivedSelf.GetType())
+	assertStringsEqual(t, "ronni", received)
 }
 
-func TestCanReceivePARTMessage(t *testing.T) {
+func TestCanReceiveROOMSTATEMessage(t *testing.T) {
 	t.Parallel()
-	testMessage := `:username123!username123@username123.tmi.twitch.tv PART #mychannel`
+	testMessage := `@slow=10 :tmi.twitch.tv ROOMSTATE #gempir`
 
 	wait := make(chan struct{})
-	var received UserPartMessage
+	var received string
 
 	host := startServer(t, postMessageOnConnect(testMessage), nothingOnMessage)
 	client := newTestClient(host)
 
-	client.OnUserPartMessage(func(message UserPartMessage) {
-		received = message
-		close(wait)
-	})
+	client.OnRoomStateMessage(func(message RoomStateMessage) {
+		received = message.Tags["slow"]
+		assertMessageTypesEqual(t, ROOMSTATE, message.GetType())
+		close(wait)
+	})
+
+	go client.Connect()
+
+	// wait for server to start
+	select {
+	case <-wait:
+	case <-time.After(time.Second * 3):
+		t.Fatal("no message sent")
+	}
+
+	assertStringsEqual(t, "10", received)
+}
+
+func TestCanReceiveUSERNOTICEMessage(t *testing.T) {
+	t.Parallel()
+	testMessage := `@badges=subscriber/12,premium/1;color=#5F9EA0;display-name=blahh;emotes=;id=9154ac04-c9ad-46d5-97ad-15d2dbf244f0;login=deliquid;mod=0;msg-id=resub;msg-param-months=16;msg-param-sub-plan-name=Channel\sSubscription\s(NOTHING);msg-param-sub-plan=Prime;room-id=23161357;subscriber=1;system-msg=blahh\sjust\ssubscribed\swith\sTwitch\sPrime.\sblahh\ssubscribed\sfor\s16\smonths\sin\sa\srow!;tmi-sent-ts=1517165351175;turbo=0;user-id=1234567890;user-type= :tmi.twitch.tv USERNOTICE #nothing`
+
+	wait := make(chan struct{})
+	var received string
+
+	host := startServer(t, postMessageOnConnect(testMessage), nothingOnMessage)
+	client := newTestClient(host)
+
+	client.OnUserNoticeMessage(func(message UserNoticeMessage) {
+		received = message.Tags["msg-param-months"]
+		assertMessageTypesEqual(t, USERNOTICE, message.GetType())
+		close(wait)
+	})
+
+	go client.Connect()
+
+	select {
+	case <-wait:
+	case <-time.After(time.Second * 3):
+		t.Fatal("no message sent")
+	}
+
+	assertStringsEqual(t, "16", received)
+}
+
+func TestCanReceiveUSERNOTICEMessageResub(t *testing.T) {
+	t.Parallel()
+	testMessage := `@badges=moderator/1,subscriber/24;color=#1FD2FF;display-name=Karl_Kons;emotes=28087:0-6;flags=;id=7c95beea-a7ac-4c10-9e0a-d7dbf163c038;login=karl_kons;mod=1;msg-id=resub;msg-param-months=34;msg-param-sub-plan-name=look\sat\sthose\sshitty\semotes,\srip\s$5\sLUL;msg-param-sub-plan=1000;room-id=11148817;subscriber=1;system-msg=Karl_Kons\sjust\ssubscribed\swith\sa\sTier\s1\ssub.\sKarl_Kons\ssubscribed\sfor\s34\smonths\sin\sa\srow!;tmi-sent-ts=1540140252828;turbo=0;user-id=68706331;user-type=mod :tmi.twitch.tv USERNOTICE #pajlada :WutFace`
+
+	wait := make(chan struct{})
+	var received string
+
+	host := startServer(t, postMessageOnConnect(testMessage), nothingOnMessage)
+	client := newTestClient(host)
+
+	client.OnUserNoticeMessage(func(message UserNoticeMessage) {
+		received = message.Tags["msg-param-months"]
+		close(wait)
+	})
+
+	go client.Connect()
+
+	select {
+	case <-wait:
+	case <-time.After(time.Second * 3):
+		t.Fatal("no message sent")
+	}
+
+	assertStringsEqual(t, "34", received)
+}
+
+func checkNoticeMessage(t *testing.T, testMessage string, requirements map[string]string) {
+	received := map[string]string{}
+	wait := make(chan struct{})
+
+	host := startServer(t, postMessageOnConnect(testMessage), nothingOnMessage)
+	client := newTestClient(host)
+
+	client.OnNoticeMessage(func(message NoticeMessage) {
+		received["msg-id"] = message.Tags["msg-id"]
+		received["channel"] = message.Channel
+		received["text"] = message.Message
+		received["raw"] = message.Raw
+		assertMessageTypesEqual(t, NOTICE, message.GetType())
+		close(wait)
+	})
+
+	go client.Connect()
+
+	select {
+	case <-wait:
+	case <-time.After(time.Second * 3):
+		t.Fatal("no message sent")
+	}
+
+	assertStringsEqual(t, testMessage, received["raw"])
+	for key, requirement := range requirements {
+		assertStringsEqual(t, requirement, received[key])
+	}
+}
+
+func TestCanReceiveNOTICEMessage(t *testing.T) {
+	t.Parallel()
+	testMessage := `@msg-id=host_on :tmi.twitch.tv NOTICE #pajlada :Now hosting KKona.`
+	checkNoticeMessage(t, testMessage, map[string]string{
+		"msg-id":  "host_on",
+		"channel": "pajlada",
+		"text":    "Now hosting KKona.",
+	})
+}
+
+func TestCanReceiveNOTICEMessageTimeout(t *testing.T) {
+	t.Parallel()
+	testMessage := `@msg-id=timeout_success :tmi.twitch.tv NOTICE #forsen :thedl0rd has been timed out for 8 minutes 11 seconds.`
+	checkNoticeMessage(t, testMessage, map[string]string{
+		"msg-id":  "timeout_success",
+		"channel": "forsen",
+		"text":    "thedl0rd has been timed out for 8 minutes 11 seconds.",
+	})
+}
+
+func TestCanReceiveUSERStateMessage(t *testing.T) {
+	t.Parallel()
+	testMessage := `@badges=moderator/1;color=;display-name=blahh;emote-sets=0;mod=1;subscriber=0;user-type=mod :tmi.twitch.tv USERSTATE #nothing`
+
+	wait := make(chan struct{})
+	var received string
+
+	host := startServer(t, postMessageOnConnect(testMessage), nothingOnMessage)
+	client := newTestClient(host)
+
+	client.OnUserStateMessage(func(message UserStateMessage) {
+		received = message.Tags["mod"]
+		assertMessageTypesEqual(t, USERSTATE, message.GetType())
+		close(wait)
+	})
+
+	go client.Connect()
+
+	select {
+	case <-wait:
+	case <-time.After(time.Second * 3):
+		t.Fatal("no message sent")
+	}
+
+	assertStringsEqual(t, "1", received)
+}
+
+func TestCanGetUserState(t *testing.T) {
+	t.Parallel()
+	testMessages := []string{
+		"@badge-info=;badges=moderator/1;color=#1E90FF;display-name=JustinFan123123;emote-sets=0,33,50;mod=1;subscriber=0;user-type=mod :tmi.twitch.tv USERSTATE #pajlada",
+		"@badge-info=founder/12;badges=founder/0;color=#1E90FF;display-name=JustinFan123123;emote-sets=0,33,50;mod=0;subscriber=0;user-type= :tmi.twitch.tv USERSTATE #nymn",
+		"@badge-info=;badges=vip/1;color=#1E90FF;display-name=JustinFan123123;emote-sets=0,33,50;mod=0;subscriber=0;user-type= :tmi.twitch.tv USERSTATE #gempir",
+	}
+
+	wait := make(chan struct{})
+
+	host := startServer(t, postMessagesOnConnect(testMessages), nothingOnMessage)
+	client := newTestClient(host)
+
+	client.OnUserStateMessage(func(message UserStateMessage) {
+		if message.Channel == "gempir" {
+			close(wait)
+		}
+	})
+
+	go client.Connect()
+
+	select {
+	case <-wait:
+	case <-time.After(time.Second * 3):
+		t.Fatal("no message sent")
+	}
+
+	userState, ok := client.GetUserState("pajlada")
+	assertTrue(t, ok, "user state of pajlada is missing")
+	assertTrue(t, userState.Mod, "user is not a mod in pajlada")
+	assertStringSlicesEqual(t, []string{"0", "33", "50"}, userState.EmoteSets)
+	assertTrue(t, client.IsModIn("Pajlada"), "user is not a mod in pajlada")
+
+	userState, ok = client.GetUserState("gempir")
+	assertTrue(t, ok, "user state of gempir is missing")
+	assertTrue(t, userState.VIP, "user is not a vip in gempir")
+	assertFalse(t, userState.Subscriber, "user is a subscriber in gempir")
+	assertFalse(t, client.IsModIn("gempir"), "user is a mod in gempir")
+
+	userState, ok = client.GetUserState("nymn")
+	assertTrue(t, ok, "user state of nymn is missing")
+	assertTrue(t, userState.Subscriber, "founder is not a subscriber in nymn")
+	assertBoolEqual(t, userState.User.IsSubscriber(), userState.Subscriber)
+
+	assertFalse(t, client.IsModIn("forsen"), "user is a mod in a channel without user state")
+
+	client.Depart("pajlada")
+	_, ok = client.GetUserState("pajlada")
+	assertFalse(t, ok, "user state of pajlada was not removed on depart")
+}
+
+func TestCanTrackEmoteSetsChanges(t *testing.T) {
+	t.Parallel()
+	testMessages := []string{
+		"@badge-info=;badges=;color=#0000FF;display-name=JustinFan123123;emote-sets=0,33,50;user-id=123123;user-type= :tmi.twitch.tv GLOBALUSERSTATE",
+		"@badge-info=;badges=;color=#0000FF;display-name=JustinFan123123;emote-sets=50,0,33;mod=0;subscriber=0;user-type= :tmi.twitch.tv USERSTATE #pajlada",
+		"@badge-info=;badges=;color=#0000FF;display-name=JustinFan123123;emote-sets=0,50,1337;mod=0;subscriber=0;user-type= :tmi.twitch.tv USERSTATE #gempir",
+	}
+
+	wait := make(chan struct{})
+	var changes [][]string
+
+	host := startServer(t, postMessagesOnConnect(testMessages), nothingOnMessage)
+	client := newTestClient(host)
+
+	client.OnEmoteSetsChanged(func(added, removed []string) {
+		changes = append(changes, added, removed)
+		if len(changes) == 4 {
+			close(wait)
+		}
+	})
+
+	go client.Connect()
+
+	select {
+	case <-wait:
+	case <-time.After(time.Second * 3):
+		t.Fatal("no message sent")
+	}
+
+	if len(changes) != 4 {
+		t.Fatalf("expected 2 emote sets changes, got %d", len(changes)/2)
+	}
+	assertStringSlicesEqual(t, []string{"0", "33", "50"}, changes[0])
+	assertStringSlicesEqual(t, nil, changes[1])
+	assertStringSlicesEqual(t, []string{"1337"}, changes[2])
+	assertStringSlicesEqual(t, []string{"33"}, changes[3])
+	assertStringSlicesEqual(t, []string{"0", "50", "1337"}, client.EmoteSets())
+}
+
+func TestCanReceiveGlobalUserStateMessage(t *testing.T) {
+	t.Parallel()
+	testMessage := `@badge-info=;badges=;color=#00FF7F;display-name=gempbot;emote-sets=0,14417,300206298,300374282,300548762;user-id=99659894;user-type= :tmi.twitch.tv GLOBALUSERSTATE`
+
+	wait := make(chan struct{})
+	var received string
+
+	host := startServer(t, postMessageOnConnect(testMessage), nothingOnMessage)
+	client := newTestClient(host)
+
+	client.OnGlobalUserStateMessage(func(message GlobalUserStateMessage) {
+		received = message.Tags["user-id"]
+		assertMessageTypesEqual(t, GLOBALUSERSTATE, message.GetType())
+		close(wait)
+	})
+
+	//nolint
+	go client.Connect()
+
+	select {
+	case <-wait:
+	case <-time.After(time.Second * 3):
+		t.Fatal("no message sent")
+	}
+
+	assertStringsEqual(t, "99659894", received)
+}
+
+func TestCanReceiveJOINMessage(t *testing.T) {
+	t.Parallel()
+	testMessage := `:username123!username123@username123.tmi.twitch.tv JOIN #mychannel`
+
+	wait := make(chan struct{})
+	var received UserJoinMessage
+
+	host := startServer(t, postMessageOnConnect(testMessage), nothingOnMessage)
+	client := newTestClient(host)
+
+	client.OnUserJoinMessage(func(message UserJoinMessage) {
+		received = message
+		close(wait)
+	})
+
+	go client.Connect()
+
+	// wait for server to start
+	select {
+	case <-wait:
+	case <-time.After(time.Second * 3):
+		t.Fatal("no message sent")
+	}
+
+	assertStringsEqual(t, "username123", received.User)
+	assertStringsEqual(t, "mychannel", received.Channel)
+	assertMessageTypesEqual(t, JOIN, received.GetType())
+}
+
+func TestReceiveJOINMessageWithSelfJOIN(t *testing.T) {
+	t.Parallel()
+	testMessages := []string{
+		`:justinfan123123!justinfan123123@justinfan123123.tmi.twitch.tv JOIN #mychannel`,
+		`:username123!username123@username123.tmi.twitch.tv JOIN #mychannel`,
+	}
+
+	var receivedOther UserJoinMessage
+	var receivedSelf UserJoinMessage
+
+	host := startServer(t, postMessagesOnConnect(testMessages), nothingOnMessage)
+	client := newTestClient(host)
+
+	wg := new(sync.WaitGroup)
+	wg.Add(2)
+
+	client.OnUserJoinMessage(func(message UserJoinMessage) {
+		receivedOther = message
+		wg.Done()
+	})
+
+	client.OnSelfJoinMessage(func(message UserJoinMessage) {
+		receivedSelf = message
+		wg.Done()
+	})
+
+	go client.Connect()
+
+	// hack with ctx makes it possible to use it in select statement below
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		wg.Wait()
+		cancel()
+	}()
+
+	// wait for server to start
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second * 3):
+		t.Fatal("no message sent")
+	}
+
+	assertStringsEqual(t, "username123", receivedOther.User)
+	assertStringsEqual(t, "mychannel", receivedOther.Channel)
+	assertMessageTypesEqual(t, JOIN, receivedOther.GetType())
+
+	assertStringsEqual(t, "justinfan123123", receivedSelf.User)
+	assertStringsEqual(t, "mychannel", receivedSelf.Channel)
+	assertMessageTypesEqual(t, JOIN, receivedSelf.GetType())
+}
+
+func TestCanReceivePARTMessage(t *testing.T) {
+	t.Parallel()
+	testMessage := `:username123!username123@username123.tmi.twitch.tv PART #mychannel`
+
+	wait := make(chan struct{})
+	var received UserPartMessage
+
+	host := startServer(t, postMessageOnConnect(testMessage), nothingOnMessage)
+	client := newTestClient(host)
+
+	client.OnUserPartMessage(func(message UserPartMessage) {
+		received = message
+		close(wait)
+	})
+
+	go client.Connect()
+
+	// wait for server to start
+	select {
+	case <-wait:
+	case <-time.After(time.Second * 3):
+		t.Fatal("no message sent")
+	}
+
+	assertStringsEqual(t, "username123", received.User)
+	assertStringsEqual(t, "mychannel", received.Channel)
+	assertMessageTypesEqual(t, PART, received.GetType())
+}
+
+func TestReceivePARTMessageWithSelfPART(t *testing.T) {
+	t.Parallel()
+	testMessages := []string{
+		`:justinfan123123!justinfan123123@justinfan123123.tmi.twitch.tv PART #mychannel`,
+		`:username123!username123@username123.tmi.twitch.tv PART #mychannel`,
+	}
+
+	var receivedOther UserPartMessage
+	var receivedSelf UserPartMessage
+
+	host := startServer(t, postMessagesOnConnect(testMessages), nothingOnMessage)
+	client := newTestClient(host)
+
+	wg := new(sync.WaitGroup)
+	wg.Add(2)
+
+	client.OnUserPartMessage(func(message UserPartMessage) {
+		receivedOther = message
+		wg.Done()
+	})
+
+	client.OnSelfPartMessage(func(message UserPartMessage) {
+		receivedSelf = message
+		wg.Done()
+	})
+
+	go client.Connect()
+
+	// hack with ctx makes it possible to use it in select statement below
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		wg.Wait()
+		cancel()
+	}()
+
+	// wait for server to start
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second * 3):
+		t.Fatal("no message sent")
+	}
+
+	assertStringsEqual(t, "username123", receivedOther.User)
+	assertStringsEqual(t, "mychannel", receivedOther.Channel)
+	assertMessageTypesEqual(t, PART, receivedOther.GetType())
+
+	assertStringsEqual(t, "justinfan123123", receivedSelf.User)
+	assertStringsEqual(t, "mychannel", receivedSelf.Channel)
+	assertMessageTypesEqual(t, PART, receivedSelf.GetType())
+}
+
+func TestCanReceiveUNSETMessage(t *testing.T) {
+	t.Parallel()
+	testMessage := `@badges=moderator/1,subscriber/24;color=#1FD2FF;display-name=Karl_Kons;emotes=28087:0-6;flags=;id=7c95beea-a7ac-4c10-9e0a-d7dbf163c038;login=karl_kons;mod=1;msg-id=resub;msg-param-months=34;msg-param-sub-plan-name=look\sat\sthose\sshitty\semotes,\srip\s$5\sLUL;msg-param-sub-plan=1000;room-id=11148817;subscriber=1;system-msg=Karl_Kons\sjust\ssubscribed\swith\sa\sTier\s1\ssub.\sKarl_Kons\ssubscribed\sfor\s34\smonths\sin\sa\srow!;tmi-sent-ts=1540140252828;turbo=0;user-id=68706331;user-type=mod :tmi.twitch.tv MALFORMEDMESSAGETYPETHISWILLBEUNSET #pajlada :WutFace`
+
+	wait := make(chan struct{})
+	var received RawMessage
+
+	host := startServer(t, postMessageOnConnect(testMessage), nothingOnMessage)
+	client := newTestClient(host)
+
+	client.OnUnsetMessage(func(rawMessage RawMessage) {
+		if rawMessage.RawType == "MALFORMEDMESSAGETYPETHISWILLBEUNSET" {
+			received = rawMessage
+			close(wait)
+		}
+	})
+
+	go client.Connect()
+
+	select {
+	case <-wait:
+	case <-time.After(time.Second * 3):
+		t.Fatal("no message sent")
+	}
+
+	assertStringsEqual(t, testMessage, received.Raw)
+	assertMessageTypesEqual(t, UNSET, received.GetType())
+}
+
+func TestCanHandleRECONNECTMessage(t *testing.T) {
+	t.Parallel()
+	const testMessage = ":tmi.twitch.tv RECONNECT"
+
+	wait := make(chan bool)
+
+	var received ReconnectMessage
+
+	var connCount int32
+
+	host := startServerMultiConns(t, 2, func(conn *twitchtest.Conn) {
+		atomic.AddInt32(&connCount, 1)
+		wait <- true
+		time.AfterFunc(100*time.Millisecond, func() {
+			fmt.Fprintf(conn, "%s\r\n", testMessage)
+		})
+	}, nothingOnMessage)
+	client := newTestClient(host)
+	client.OnReconnectMessage(func(msg ReconnectMessage) {
+		received = msg
+	})
+
+	go client.Connect()
+
+	// wait for server to start
+	select {
+	case <-wait:
+	case <-time.After(time.Second * 3):
+		t.Fatal("no message sent")
+	}
+
+	assertInt32sEqual(t, 1, atomic.LoadInt32(&connCount))
+
+	select {
+	case <-wait:
+	case <-time.After(time.Second * 3):
+		t.Fatal("no message sent")
+	}
+
+	assertInt32sEqual(t, 2, atomic.LoadInt32(&connCount))
+
+	assertMessageTypesEqual(t, RECONNECT, received.GetType())
+}
+
+func TestCanSayMessage(t *testing.T) {
+	t.Parallel()
+	const testMessage = "Do not go gentle into that good night."
+
+	waitEnd := make(chan struct{})
+	var received string
+
+	host := startServer(t, nothingOnConnect, func(message string) {
+		if strings.HasPrefix(message, "PRIVMSG") {
+			received = message
+			close(waitEnd)
+		}
+	})
+
+	client := newTestClient(host)
+
+	client.OnConnect(func() {
+		client.Say("gempir", testMessage)
+	})
+
+	go client.Connect()
+
+	// wait for server to receive message
+	select {
+	case <-waitEnd:
+	case <-time.After(time.Second * 3):
+		t.Fatal("no privmsg received")
+	}
+
+	assertStringsEqual(t, "PRIVMSG #gempir :"+testMessage, received)
+}
+
+func TestCanSendMeMessage(t *testing.T) {
+	t.Parallel()
+	const testMessage = "dances"
+
+	waitEnd := make(chan struct{})
+	var received string
+
+	host := startServer(t, nothingOnConnect, func(message string) {
+		if strings.HasPrefix(message, "PRIVMSG") {
+			received = message
+			close(waitEnd)
+		}
+	})
+
+	client := newTestClient(host)
+
+	client.OnConnect(func() {
+		client.SendMe("gempir", testMessage)
+	})
+
+	go client.Connect()
+
+	// wait for server to receive message
+	select {
+	case <-waitEnd:
+	case <-time.After(time.Second * 3):
+		t.Fatal("no privmsg received")
+	}
+
+	assertStringsEqual(t, "PRIVMSG #gempir :\u0001ACTION "+testMessage+"\u0001", received)
+
+	parsed := ParseMessage(":gempir!gempir@gempir.tmi.twitch.tv " + received).(*PrivateMessage)
+	assertTrue(t, parsed.Action, "sent message was not parsed as an action")
+	assertStringsEqual(t, testMessage, parsed.Message)
+}
+
+func TestCanSayWithNonce(t *testing.T) {
+	t.Parallel()
+
+	waitEnd := make(chan struct{})
+	var received string
+
+	host := startServer(t, nothingOnConnect, func(message string) {
+		if strings.Contains(message, "PRIVMSG") {
+			received = message
+			close(waitEnd)
+		}
+	})
+
+	client := newTestClient(host)
+
+	client.OnConnect(func() {
+		client.SayWithNonce("gempir", "hello", "my nonce")
+	})
+
+	go client.Connect()
+
+	select {
+	case <-waitEnd:
+	case <-time.After(time.Second * 3):
+		t.Fatal("no privmsg received")
+	}
+
+	assertStringsEqual(t, `@client-nonce=my\snonce PRIVMSG #gempir :hello`, received)
+
+	// Twitch echoes the nonce back on the message
+	echo := strings.Replace(received, " PRIVMSG", " :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG", 1)
+	assertStringsEqual(t, "my nonce", ParseMessage(echo).(*PrivateMessage).ClientNonce)
+}
+
+func TestSendAllowlistRejectsOtherChannels(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+
+	client := newTestClient(server.Addr)
+	client.SetSendAllowlist([]string{"#Gempir"})
+	disconnected := connectAndEnsureGoodDisconnect(t, client)
+	waitForLine(t, server, "NICK")
+
+	err := client.Say("pajlada", "spam")
+	assertTrue(t, errors.Is(err, ErrChannelNotAllowed), "Say to a channel outside the allowlist didn't fail")
+	err = client.Reply("pajlada", "b34ccfc7-4977-403a-8a94-33c6bac34fb8", "spam")
+	assertTrue(t, errors.Is(err, ErrChannelNotAllowed), "Reply to a channel outside the allowlist didn't fail")
+	err = client.EnableEmoteOnly("pajlada")
+	assertTrue(t, errors.Is(err, ErrChannelNotAllowed), "chat command to a channel outside the allowlist didn't fail")
 
-	go client.Connect()
+	assertErrorsEqual(t, nil, client.Say("GEMPIR", "hello"))
 
-	// wait for server to start
-	select {
-	case <-wait:
-	case <-time.After(time.Second * 3):
-		t.Fatal("no message sent")
+	// The lines are written in order, so the rejected messages would have been received before
+	waitForLine(t, server, "PRIVMSG #gempir :hello")
+	for _, line := range server.Lines() {
+		assertFalse(t, strings.Contains(line, "#pajlada"), "message to a channel outside the allowlist was sent: "+line)
 	}
 
-	assertStringsEqual(t, "username123", received.User)
-	assertStringsEqual(t, "mychannel", received.Channel)
-	assertMessageTypesEqual(t, PART, received.GetType())
+	client.SetSendAllowlist(nil)
+	assertErrorsEqual(t, nil, client.Say("pajlada", "allowed again"))
+	waitForLine(t, server, "PRIVMSG #pajlada :allowed again")
+
+	client.Disconnect()
+	<-disconnected
 }
 
-func TestReceivePARTMessageWithSelfPART(t *testing.T) {
+func TestCanConfirmSentMessages(t *testing.T) {
 	t.Parallel()
-	testMessages := []string{
-		`:justinfan123123!justinfan123123@justinfan123123.tmi.twitch.tv PART #mychannel`,
-		`:username123!username123@username123.tmi.twitch.tv PART #mychannel`,
-	}
 
-	var receivedOther UserPartMessage
-	var receivedSelf UserPartMessage
+	var serverConn *twitchtest.Conn
+	sent := 0
 
-	host := startServer(t, postMessagesOnConnect(testMessages), nothingOnMessage)
-	client := newTestClient(host)
+	host := startServer(t, func(conn *twitchtest.Conn) {
+		serverConn = conn
+	}, func(message string) {
+		if !strings.Contains(message, "PRIVMSG") {
+			return
+		}
 
-	wg := new(sync.WaitGroup)
-	wg.Add(2)
+		// Only acknowledge the first message, the second one stays unconfirmed
+		sent++
+		if sent == 1 {
+			parsed, _ := ParseIRCLine(message)
+			fmt.Fprintf(serverConn, "@badges=;client-nonce=%s;color=;display-name=justinfan123123;emote-sets=0;id=b34ccfc7-4977-403a-8a94-33c6bac34fb8;mod=0;subscriber=0;user-type= :tmi.twitch.tv USERSTATE #gempir\r\n", parsed.Tags["client-nonce"])
+		}
+	})
 
-	client.OnUserPartMessage(func(message UserPartMessage) {
-		receivedOther = message
-		wg.Done()
+	client := newTestClient(host)
+	client.SendConfirmationTimeout = 500 * time.Millisecond
+
+	// Unconfirmed messages are reported from another go-routine
+	received := make(chan SentMessageConfirmation, 2)
+	client.OnMessageSent(func(confirmation SentMessageConfirmation) {
+		received <- confirmation
 	})
 
-	client.OnSelfPartMessage(func(message UserPartMessage) {
-		receivedSelf = message
-		wg.Done()
+	client.OnConnect(func() {
+		client.Say("gempir", "first")
+		client.Say("gempir", "second")
 	})
 
 	go client.Connect()
 
-	// hack with ctx makes it possible to use it in select statement below
-	ctx, cancel := context.WithCancel(context.Background())
-	go func() {
-		wg.Wait()
-		cancel()
-	}()
-
-	// wait for server to start
-	select {
-	case <-ctx.Done():
-	case <-time.After(time.Second * 3):
-		t.Fatal("no message sent")
+	var confirmations []SentMessageConfirmation
+	for len(confirmations) < 2 {
+		select {
+		case confirmation := <-received:
+			confirmations = append(confirmations, confirmation)
+		case <-time.After(time.Second * 3):
+			t.Fatal("sent messages were not reported")
+		}
 	}
 
-	assertStringsEqual(t, "username123", receivedOther.User)
-	assertStringsEqual(t, "mychannel", receivedOther.Channel)
-	assertMessageTypesEqual(t, PART, receivedOther.GetType())
+	assertTrue(t, confirmations[0].Confirmed, "acknowledged message is unconfirmed")
+	assertStringsEqual(t, "first", confirmations[0].Text)
+	assertStringsEqual(t, "gempir", confirmations[0].Channel)
+	assertStringsEqual(t, "b34ccfc7-4977-403a-8a94-33c6bac34fb8", confirmations[0].MessageID)
+	assertIntsEqual(t, 32, len(confirmations[0].Nonce))
 
-	assertStringsEqual(t, "justinfan123123", receivedSelf.User)
-	assertStringsEqual(t, "mychannel", receivedSelf.Channel)
-	assertMessageTypesEqual(t, PART, receivedSelf.GetType())
+	assertFalse(t, confirmations[1].Confirmed, "message without acknowledgment is confirmed")
+	assertStringsEqual(t, "second", confirmations[1].Text)
+	assertStringsEqual(t, "", confirmations[1].MessageID)
 }
 
-func TestCanReceiveUNSETMessage(t *testing.T) {
+func TestCanReceiveSendErrors(t *testing.T) {
 	t.Parallel()
-	testMessage := `@badges=moderator/1,subscriber/24;color=#1FD2FF;display-name=Karl_Kons;emotes=28087:0-6;flags=;id=7c95beea-a7ac-4c10-9e0a-d7dbf163c038;login=karl_kons;mod=1;msg-id=resub;msg-param-months=34;msg-param-sub-plan-name=look\sat\sthose\sshitty\semotes,\srip\s$5\sLUL;msg-param-sub-plan=1000;room-id=11148817;subscriber=1;system-msg=Karl_Kons\sjust\ssubscribed\swith\sa\sTier\s1\ssub.\sKarl_Kons\ssubscribed\sfor\s34\smonths\sin\sa\srow!;tmi-sent-ts=1540140252828;turbo=0;user-id=68706331;user-type=mod :tmi.twitch.tv MALFORMEDMESSAGETYPETHISWILLBEUNSET #pajlada :WutFace`
 
-	wait := make(chan struct{})
-	var received RawMessage
+	var serverConn *twitchtest.Conn
+
+	host := startServer(t, func(conn *twitchtest.Conn) {
+		serverConn = conn
+	}, func(message string) {
+		if strings.Contains(message, "PRIVMSG") {
+			fmt.Fprintf(serverConn, "@msg-id=msg_banned :tmi.twitch.tv NOTICE #forsen :You are permanently banned from talking in forsen.\r\n")
+		}
+	})
 
-	host := startServer(t, postMessageOnConnect(testMessage), nothingOnMessage)
 	client := newTestClient(host)
 
-	client.OnUnsetMessage(func(rawMessage RawMessage) {
-		if rawMessage.RawType == "MALFORMEDMESSAGETYPETHISWILLBEUNSET" {
-			received = rawMessage
-			close(wait)
-		}
+	type rejection struct {
+		channel string
+		reason  NoticeID
+		notice  NoticeMessage
+	}
+	rejections := make(chan rejection, 1)
+	confirmations := make(chan SentMessageConfirmation, 1)
+
+	client.OnSendError(func(channel string, reason NoticeID, notice NoticeMessage) {
+		rejections <- rejection{channel, reason, notice}
+	})
+	client.OnMessageSent(func(confirmation SentMessageConfirmation) {
+		confirmations <- confirmation
+	})
+
+	client.OnConnect(func() {
+		client.Say("forsen", "hello")
 	})
 
 	go client.Connect()
 
 	select {
-	case <-wait:
+	case received := <-rejections:
+		assertStringsEqual(t, "forsen", received.channel)
+		assertStringsEqual(t, string(NoticeBanned), string(received.reason))
+		assertStringsEqual(t, "You are permanently banned from talking in forsen.", received.notice.Message)
 	case <-time.After(time.Second * 3):
-		t.Fatal("no message sent")
+		t.Fatal("no send error received")
 	}
 
-	assertStringsEqual(t, testMessage, received.Raw)
-	assertMessageTypesEqual(t, UNSET, received.GetType())
+	select {
+	case confirmation := <-confirmations:
+		assertFalse(t, confirmation.Confirmed, "rejected message is confirmed")
+		assertStringsEqual(t, "hello", confirmation.Text)
+		assertStringsEqual(t, string(NoticeBanned), string(confirmation.RejectReason))
+	case <-time.After(time.Second * 3):
+		t.Fatal("rejected message was not reported")
+	}
 }
 
-func TestCanHandleRECONNECTMessage(t *testing.T) {
+func TestCanSayAndWait(t *testing.T) {
 	t.Parallel()
-	const testMessage = ":tmi.twitch.tv RECONNECT"
 
-	wait := make(chan bool)
-
-	var received ReconnectMessage
+	var serverConn *twitchtest.Conn
 
-	var connCount int32
+	host := startServer(t, func(conn *twitchtest.Conn) {
+		serverConn = conn
+	}, func(message string) {
+		parsed, _ := ParseIRCLine(message)
+		if parsed.Command != "PRIVMSG" {
+			return
+		}
 
-	host := startServerMultiConns(t, 2, func(conn net.Conn) {
-		atomic.AddInt32(&connCount, 1)
-		wait <- true
-		time.AfterFunc(100*time.Millisecond, func() {
-			fmt.Fprintf(conn, "%s\r\n", testMessage)
-		})
-	}, nothingOnMessage)
-	client := newTestClient(host)
-	client.OnReconnectMessage(func(msg ReconnectMessage) {
-		received = msg
+		// The first message is acknowledged, the second rejected and the third never answered
+		switch parsed.Params[1] {
+		case "first":
+			fmt.Fprintf(serverConn, "@badges=;client-nonce=%s;color=#1E90FF;display-name=JustinFan123123;emote-sets=0;id=b34ccfc7-4977-403a-8a94-33c6bac34fb8;mod=0;subscriber=0;user-type= :tmi.twitch.tv USERSTATE #gempir\r\n", parsed.Tags["client-nonce"])
+		case "second":
+			fmt.Fprintf(serverConn, "@msg-id=msg_ratelimit :tmi.twitch.tv NOTICE #gempir :Your message was not sent because you are sending messages too quickly.\r\n")
+		}
 	})
 
+	client := newTestClient(host)
 	go client.Connect()
 
-	// wait for server to start
-	select {
-	case <-wait:
-	case <-time.After(time.Second * 3):
-		t.Fatal("no message sent")
-	}
-
-	assertInt32sEqual(t, 1, atomic.LoadInt32(&connCount))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	assertErrorsEqual(t, nil, client.WaitForConnect(ctx))
 
-	select {
-	case <-wait:
-	case <-time.After(time.Second * 3):
-		t.Fatal("no message sent")
-	}
+	message, err := client.SayAndWait(ctx, "#Gempir", "first")
+	assertErrorsEqual(t, nil, err)
+	assertStringsEqual(t, "first", message.Message)
+	assertStringsEqual(t, "gempir", message.Channel)
+	assertStringsEqual(t, "b34ccfc7-4977-403a-8a94-33c6bac34fb8", message.ID)
+	assertStringsEqual(t, "JustinFan123123", message.User.DisplayName)
+	assertIntsEqual(t, 32, len(message.ClientNonce))
 
-	assertInt32sEqual(t, 2, atomic.LoadInt32(&connCount))
+	_, err = client.SayAndWait(ctx, "gempir", "second")
+	assertTrue(t, errors.Is(err, ErrMessageRejected), "rejected message didn't return ErrMessageRejected")
+	assertTrue(t, strings.Contains(err.Error(), string(NoticeRateLimit)), "error doesn't contain the reason: "+err.Error())
 
-	assertMessageTypesEqual(t, RECONNECT, received.GetType())
+	shortCtx, shortCancel := context.WithTimeout(ctx, time.Millisecond*100)
+	defer shortCancel()
+	_, err = client.SayAndWait(shortCtx, "gempir", "third")
+	assertErrorsEqual(t, context.DeadlineExceeded, err)
 }
 
-func TestCanSayMessage(t *testing.T) {
+func TestCanReplyMessage(t *testing.T) {
 	t.Parallel()
-	const testMessage = "Do not go gentle into that good night."
+	testMessage := "Do not go gentle into that good night."
+	testParentMessageId := "b34ccfc7-4977-403a-8a94-33c6bac34fb8"
 
 	waitEnd := make(chan struct{})
 	var received string
 
 	host := startServer(t, nothingOnConnect, func(message string) {
-		if strings.HasPrefix(message, "PRIVMSG") {
+		if strings.HasPrefix(message, "@reply") {
 			received = message
 			close(waitEnd)
 		}
@@ -1060,7 +1990,7 @@ func TestCanSayMessage(t *testing.T) {
 	client := newTestClient(host)
 
 	client.OnConnect(func() {
-		client.Say("gempir", testMessage)
+		client.Reply("gempir", testParentMessageId, testMessage)
 	})
 
 	go client.Connect()
@@ -1072,40 +2002,52 @@ func TestCanSayMessage(t *testing.T) {
 		t.Fatal("no privmsg received")
 	}
 
-	assertStringsEqual(t, "PRIVMSG #gempir :"+testMessage, received)
+	assertStringsEqual(t, "@reply-parent-msg-id="+testParentMessageId+" PRIVMSG #gempir :"+testMessage, received)
 }
 
-func TestCanReplyMessage(t *testing.T) {
+func TestCanSendClientNonce(t *testing.T) {
 	t.Parallel()
-	testMessage := "Do not go gentle into that good night."
 	testParentMessageId := "b34ccfc7-4977-403a-8a94-33c6bac34fb8"
 
 	waitEnd := make(chan struct{})
-	var received string
+	var received []string
 
 	host := startServer(t, nothingOnConnect, func(message string) {
-		if strings.HasPrefix(message, "@reply") {
-			received = message
-			close(waitEnd)
+		if strings.Contains(message, "PRIVMSG") {
+			received = append(received, message)
+			if len(received) == 2 {
+				close(waitEnd)
+			}
 		}
 	})
 
 	client := newTestClient(host)
+	client.SendClientNonce = true
 
 	client.OnConnect(func() {
-		client.Reply("gempir", testParentMessageId, testMessage)
+		client.Say("gempir", "hello")
+		client.Reply("gempir", testParentMessageId, "hello there")
 	})
 
 	go client.Connect()
 
-	// wait for server to receive message
 	select {
 	case <-waitEnd:
 	case <-time.After(time.Second * 3):
 		t.Fatal("no privmsg received")
 	}
 
-	assertStringsEqual(t, "@reply-parent-msg-id="+testParentMessageId+" PRIVMSG #gempir :"+testMessage, received)
+	say, err := ParseIRCLine(received[0])
+	assertErrorsEqual(t, nil, err)
+	reply, err := ParseIRCLine(received[1])
+	assertErrorsEqual(t, nil, err)
+
+	assertStringSlicesEqual(t, []string{"#gempir", "hello"}, say.Params)
+	assertIntsEqual(t, 32, len(say.Tags["client-nonce"]))
+	assertIntsEqual(t, 32, len(reply.Tags["client-nonce"]))
+	assertFalse(t, say.Tags["client-nonce"] == reply.Tags["client-nonce"], "client-nonce was reused")
+	assertStringsEqual(t, testParentMessageId, reply.Tags["reply-parent-msg-id"])
+	assertStringSlicesEqual(t, []string{"#gempir", "hello there"}, reply.Params)
 }
 
 func TestCanJoinChannel(t *testing.T) {
@@ -1353,92 +2295,231 @@ func TestCanDepartChannel(t *testing.T) {
 	waitEnd := make(chan struct{})
 	var receivedMsg string
 
-	host := startServer(t, nothingOnConnect, func(message string) {
-		if strings.HasPrefix(message, "PART") {
-			receivedMsg = message
-			close(waitEnd)
-		}
+	host := startServer(t, nothingOnConnect, func(message string) {
+		if strings.HasPrefix(message, "PART") {
+			receivedMsg = message
+			close(waitEnd)
+		}
+	})
+
+	client := newTestClient(host)
+	go client.Connect()
+
+	// wait for the connection to go active
+	for !client.connActive.get() {
+		time.Sleep(time.Millisecond * 2)
+	}
+	client.Depart("gempir")
+
+	// wait for server to receive message
+	select {
+	case <-waitEnd:
+	case <-time.After(time.Second * 3):
+		t.Fatal("no depart message received")
+	}
+
+	assertStringsEqual(t, "PART #gempir", receivedMsg)
+}
+
+func TestCanGetUserlist(t *testing.T) {
+	t.Parallel()
+	expectedNames := []string{"username1", "username2"}
+	testMessages := []string{
+		`:justinfan123123.tmi.twitch.tv 353 justinfan123123 = #channel123 :username1 username2`,
+		`:justinfan123123.tmi.twitch.tv 366 justinfan123123 #channel123 :End of /NAMES list`,
+		`@badges=subscriber/6,premium/1;color=#FF0000;display-name=Redflamingo13;emotes=;id=2a31a9df-d6ff-4840-b211-a2547c7e656e;mod=0;room-id=11148817;subscriber=1;tmi-sent-ts=1490382457309;turbo=0;user-id=78424343;user-type= :redflamingo13!redflamingo13@redflamingo13.tmi.twitch.tv PRIVMSG #anythingbutchannel123 :ok go now`,
+	}
+	waitEnd := make(chan struct{})
+
+	host := startServer(t, postMessagesOnConnect(testMessages), nothingOnMessage)
+
+	client := newTestClient(host)
+
+	var received NamesMessage
+
+	client.OnNamesMessage(func(message NamesMessage) {
+		received = message
+	})
+
+	client.Join("channel123")
+
+	client.OnPrivateMessage(func(message PrivateMessage) {
+		if message.Message == "ok go now" {
+			// test a valid channel
+			got, err := client.Userlist("channel123")
+			if err != nil {
+				t.Fatal("error not nil for client.Userlist")
+			}
+
+			sort.Strings(got)
+
+			assertStringSlicesEqual(t, expectedNames, got)
+
+			// test an unknown channel
+			got, err = client.Userlist("random_channel123")
+			if err == nil || got != nil {
+				t.Fatal("error expected on unknown channel for client.Userlist")
+			}
+
+			close(waitEnd)
+		}
+	})
+
+	go client.Connect()
+
+	// wait for the connection to go active
+	for !client.connActive.get() {
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	// wait for server to receive message
+	select {
+	case <-waitEnd:
+	case <-time.After(time.Second * 3):
+		t.Fatal("no userlist received")
+	}
+
+	assertStringsEqual(t, "channel123", received.Channel)
+	assertStringSlicesEqual(t, expectedNames, received.Users)
+	assertMessageTypesEqual(t, NAMES, received.GetType())
+}
+
+func TestMergesNamesMessagesUntilEndOfNames(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123123")
+
+	var received []NamesMessage
+	client.OnNamesMessage(func(message NamesMessage) {
+		received = append(received, message)
+	})
+
+	session := ":tmi.twitch.tv 001 justinfan123123 :Welcome, GLHF!\r\n" +
+		":justinfan123123.tmi.twitch.tv 353 justinfan123123 = #pajlada :pajlada gempir\r\n" +
+		":justinfan123123.tmi.twitch.tv 353 justinfan123123 = #forsen :forsen\r\n" +
+		":justinfan123123.tmi.twitch.tv 353 justinfan123123 = #pajlada :nymn gempir \r\n" +
+		":justinfan123123.tmi.twitch.tv 366 justinfan123123 #pajlada :End of /NAMES list\r\n" +
+		":justinfan123123.tmi.twitch.tv 366 justinfan123123 #gempir :End of /NAMES list"
+	assertErrorsEqual(t, nil, client.Replay(strings.NewReader(session)))
+
+	// #forsen didn't end yet and #gempir has no names, only the names of #pajlada are complete
+	assertIntsEqual(t, 1, len(received))
+	assertStringsEqual(t, "pajlada", received[0].Channel)
+	assertMessageTypesEqual(t, NAMES, received[0].GetType())
+	assertStringSlicesEqual(t, []string{"pajlada", "gempir", "nymn"}, received[0].Users)
+	assertIntsEqual(t, 2, len(strings.Split(received[0].Raw, "\r\n")))
+}
+
+func TestForgetsPendingNamesMessagesOnPart(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123123")
+
+	var received []NamesMessage
+	client.OnNamesMessage(func(message NamesMessage) {
+		received = append(received, message)
+	})
+
+	session := ":tmi.twitch.tv 001 justinfan123123 :Welcome, GLHF!\r\n" +
+		":justinfan123123.tmi.twitch.tv 353 justinfan123123 = #pajlada :pajlada gempir\r\n" +
+		":justinfan123123!justinfan123123@justinfan123123.tmi.twitch.tv PART #pajlada\r\n" +
+		":justinfan123123!justinfan123123@justinfan123123.tmi.twitch.tv JOIN #pajlada\r\n" +
+		":justinfan123123.tmi.twitch.tv 353 justinfan123123 = #pajlada :nymn\r\n" +
+		":justinfan123123.tmi.twitch.tv 366 justinfan123123 #pajlada :End of /NAMES list"
+	assertErrorsEqual(t, nil, client.Replay(strings.NewReader(session)))
+
+	assertIntsEqual(t, 1, len(received))
+	assertStringSlicesEqual(t, []string{"nymn"}, received[0].Users)
+	assertIntsEqual(t, 1, len(strings.Split(received[0].Raw, "\r\n")))
+}
+
+func TestCanTrackUserlistChanges(t *testing.T) {
+	t.Parallel()
+	testMessages := []string{
+		`:justinfan123123.tmi.twitch.tv 353 justinfan123123 = #channel123 :username1 username2`,
+		`:justinfan123123.tmi.twitch.tv 366 justinfan123123 #channel123 :End of /NAMES list`,
+		`:username3!username3@username3.tmi.twitch.tv JOIN #channel123`,
+		`:username2!username2@username2.tmi.twitch.tv JOIN #channel123`,
+		`:username1!username1@username1.tmi.twitch.tv PART #channel123`,
+		`:username4!username4@username4.tmi.twitch.tv PART #channel123`,
+		`:redflamingo13!redflamingo13@redflamingo13.tmi.twitch.tv PRIVMSG #channel123 :ok go now`,
+	}
+	waitEnd := make(chan struct{})
+
+	host := startServer(t, postMessagesOnConnect(testMessages), nothingOnMessage)
+	client := newTestClient(host)
+	client.Join("channel123")
+
+	var changes []string
+	client.OnUserlistChange(func(channel string, joined, parted []string) {
+		changes = append(changes, channel+" +"+strings.Join(joined, ",")+" -"+strings.Join(parted, ","))
 	})
 
-	client := newTestClient(host)
-	go client.Connect()
+	var userlist []string
+	client.OnPrivateMessage(func(message PrivateMessage) {
+		userlist, _ = client.Userlist("channel123")
+		close(waitEnd)
+	})
 
-	// wait for the connection to go active
-	for !client.connActive.get() {
-		time.Sleep(time.Millisecond * 2)
-	}
-	client.Depart("gempir")
+	go client.Connect()
 
-	// wait for server to receive message
 	select {
 	case <-waitEnd:
 	case <-time.After(time.Second * 3):
-		t.Fatal("no depart message received")
+		t.Fatal("no message received")
 	}
 
-	assertStringsEqual(t, "PART #gempir", receivedMsg)
+	assertStringSlicesEqual(t, []string{
+		"channel123 +username1,username2 -",
+		"channel123 +username3 -",
+		"channel123 + -username1",
+	}, changes)
+
+	sort.Strings(userlist)
+	assertStringSlicesEqual(t, []string{"username2", "username3"}, userlist)
+
+	client.Depart("channel123")
+	_, err := client.Userlist("channel123")
+	assertTrue(t, err != nil, "userlist was not removed on depart")
 }
 
-func TestCanGetUserlist(t *testing.T) {
+func TestCanDisableUserTracking(t *testing.T) {
 	t.Parallel()
-	expectedNames := []string{"username1", "username2"}
 	testMessages := []string{
 		`:justinfan123123.tmi.twitch.tv 353 justinfan123123 = #channel123 :username1 username2`,
-		`@badges=subscriber/6,premium/1;color=#FF0000;display-name=Redflamingo13;emotes=;id=2a31a9df-d6ff-4840-b211-a2547c7e656e;mod=0;room-id=11148817;subscriber=1;tmi-sent-ts=1490382457309;turbo=0;user-id=78424343;user-type= :redflamingo13!redflamingo13@redflamingo13.tmi.twitch.tv PRIVMSG #anythingbutchannel123 :ok go now`,
+		`:justinfan123123.tmi.twitch.tv 366 justinfan123123 #channel123 :End of /NAMES list`,
+		`:username3!username3@username3.tmi.twitch.tv JOIN #channel123`,
+		`:redflamingo13!redflamingo13@redflamingo13.tmi.twitch.tv PRIVMSG #channel123 :ok go now`,
 	}
 	waitEnd := make(chan struct{})
 
 	host := startServer(t, postMessagesOnConnect(testMessages), nothingOnMessage)
-
 	client := newTestClient(host)
+	client.Join("channel123")
+	client.SetTrackUsers(false)
 
-	var received NamesMessage
-
-	client.OnNamesMessage(func(message NamesMessage) {
-		received = message
+	client.OnUserlistChange(func(channel string, joined, parted []string) {
+		t.Error("userlist changed while tracking users is disabled")
 	})
 
-	client.Join("channel123")
-
+	var err error
 	client.OnPrivateMessage(func(message PrivateMessage) {
-		if message.Message == "ok go now" {
-			// test a valid channel
-			got, err := client.Userlist("channel123")
-			if err != nil {
-				t.Fatal("error not nil for client.Userlist")
-			}
-
-			sort.Strings(got)
-
-			assertStringSlicesEqual(t, expectedNames, got)
-
-			// test an unknown channel
-			got, err = client.Userlist("random_channel123")
-			if err == nil || got != nil {
-				t.Fatal("error expected on unknown channel for client.Userlist")
-			}
-
-			close(waitEnd)
-		}
+		_, err = client.Userlist("channel123")
+		close(waitEnd)
 	})
 
 	go client.Connect()
 
-	// wait for the connection to go active
-	for !client.connActive.get() {
-		time.Sleep(time.Millisecond * 5)
-	}
-
-	// wait for server to receive message
 	select {
 	case <-waitEnd:
 	case <-time.After(time.Second * 3):
-		t.Fatal("no userlist received")
+		t.Fatal("no message received")
 	}
 
-	assertStringsEqual(t, "channel123", received.Channel)
-	assertStringSlicesEqual(t, expectedNames, received.Users)
-	assertMessageTypesEqual(t, NAMES, received.GetType())
+	assertTrue(t, err != nil, "userlist is available while tracking users is disabled")
+
+	client.SetTrackUsers(true)
+	userlist, err := client.Userlist("channel123")
+	assertErrorsEqual(t, nil, err)
+	assertIntsEqual(t, 0, len(userlist))
 }
 
 func TestDepartNegatesJoinIfNotConnected(t *testing.T) {
@@ -1586,10 +2667,115 @@ func TestCanNotDialInvalidAddress(t *testing.T) {
 	}
 }
 
+func TestCanNotDialAddressWithScheme(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123132")
+	client.IrcAddress = "ws://irc-ws.chat.twitch.tv:80"
+
+	err := client.Connect()
+	if !errors.Is(err, ErrInvalidIrcAddress) {
+		t.Fatalf("wrong Connect() error: %v", err)
+	}
+}
+
+func TestCanNormalizeIrcAddress(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		address  string
+		tls      bool
+		expected string
+		valid    bool
+	}{
+		{"irc.chat.twitch.tv", true, "irc.chat.twitch.tv:6697", true},
+		{"irc.chat.twitch.tv", false, "irc.chat.twitch.tv:6667", true},
+		{" irc.chat.twitch.tv:6667 ", true, "irc.chat.twitch.tv:6667", true},
+		{":4321", true, ":4321", true},
+		{"127.0.0.1:4321", false, "127.0.0.1:4321", true},
+		{"::1", true, "[::1]:6697", true},
+		{"[::1]:4321", true, "[::1]:4321", true},
+		{"ws://irc-ws.chat.twitch.tv", true, "", false},
+		{"irc.chat.twitch.tv:abc", true, "", false},
+		{"irc.chat.twitch.tv:0", true, "", false},
+		{"irc.chat.twitch.tv/chat", true, "", false},
+		{"irc.chat.twitch.tv:6667:6667", true, "", false},
+	}
+
+	for _, test := range tests {
+		actual, err := normalizeIrcAddress(test.address, test.tls)
+		if test.valid && err != nil {
+			t.Errorf("address %q returned unexpected error: %s", test.address, err)
+		}
+		if !test.valid && !errors.Is(err, ErrInvalidIrcAddress) {
+			t.Errorf("address %q returned wrong error: %v", test.address, err)
+		}
+		assertStringsEqual(t, test.expected, actual)
+	}
+}
+
+func TestCanSetIrcAddress(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		address  string
+		expected string
+		tls      bool
+		valid    bool
+	}{
+		{"irc.chat.twitch.tv", DefaultIrcAddressTLS, true, true},
+		{"irc://irc.chat.twitch.tv", DefaultIrcAddress, false, true},
+		{"ircs://irc.chat.twitch.tv", DefaultIrcAddressTLS, true, true},
+		{"IRC://127.0.0.1:3030", "127.0.0.1:3030", false, true},
+		{"irc.chat.twitch.tv:99999", "", true, false},
+		{"ircs://irc.chat.twitch.tv:abc", "", true, false},
+		{"wss://irc-ws.chat.twitch.tv:443", "", true, false},
+	}
+
+	for _, test := range tests {
+		client := NewClient("justinfan123123", "oauth:123123123")
+		err := client.SetIrcAddress(test.address)
+		if test.valid && err != nil {
+			t.Errorf("address %q returned unexpected error: %s", test.address, err)
+		}
+		if !test.valid {
+			assertTrue(t, errors.Is(err, ErrInvalidIrcAddress), fmt.Sprintf("address %q returned wrong error: %v", test.address, err))
+			assertStringsEqual(t, "", client.IrcAddress)
+		}
+
+		assertStringsEqual(t, test.expected, client.IrcAddress)
+		assertBoolEqual(t, test.tls, client.TLS)
+	}
+}
+
+func TestCanNotSetIrcAddressWhileConnected(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123123")
+
+	reader, writer := io.Pipe()
+	go func() {
+		_, _ = writer.Write([]byte(":tmi.twitch.tv 001 justinfan123123 :Welcome, GLHF!\r\n"))
+	}()
+
+	replayed := make(chan error)
+	go func() {
+		replayed <- client.Replay(reader)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	assertErrorsEqual(t, nil, client.WaitConnected(ctx))
+
+	assertErrorsEqual(t, ErrConnectionIsOpen, client.SetIrcAddress("127.0.0.1:3030"))
+	assertStringsEqual(t, "", client.IrcAddress)
+
+	assertErrorsEqual(t, nil, client.Disconnect())
+	assertErrorsEqual(t, ErrClientDisconnected, <-replayed)
+	assertErrorsEqual(t, nil, client.SetIrcAddress("127.0.0.1:3030"))
+}
+
 func TestCanNotUseImproperlyFormattedOauthPENIS(t *testing.T) {
 	t.Parallel()
 	host := startServer(t, nothingOnConnect, nothingOnMessage)
-	client := NewClient("justinfan123123", "imrpproperlyformattedoauth")
+	// A token without the "oauth:" prefix is prefixed by the client, an empty token stays malformed
+	client := NewClient("justinfan123123", "oauth:")
 	client.IrcAddress = host
 
 	err := client.Connect()
@@ -1674,9 +2860,9 @@ func TestLocalSendingPingsReceivedPong(t *testing.T) {
 
 	wait := make(chan bool)
 
-	var conn net.Conn
+	var conn *twitchtest.Conn
 
-	host := startServer(t, func(c net.Conn) {
+	host := startServer(t, func(c *twitchtest.Conn) {
 		conn = c
 	}, func(message string) {
 		if message == pingMessage {
@@ -1708,7 +2894,7 @@ func TestLocalCanReconnectAfterNoPongResponse(t *testing.T) {
 
 	var connCount int32
 
-	host := startServerMultiConns(t, 3, func(conn net.Conn) {
+	host := startServerMultiConns(t, 3, func(conn *twitchtest.Conn) {
 		atomic.AddInt32(&connCount, 1)
 		wait <- true
 	}, nothingOnMessage)
@@ -1751,9 +2937,9 @@ func TestLocalSendingPingsReceivedPongAlsoDisconnect(t *testing.T) {
 
 	wait := make(chan bool)
 
-	var conn net.Conn
+	var conn *twitchtest.Conn
 
-	host := startServer(t, func(c net.Conn) {
+	host := startServer(t, func(c *twitchtest.Conn) {
 		conn = c
 	}, func(message string) {
 		if message == pingMessage {
@@ -1783,13 +2969,13 @@ func TestPinger(t *testing.T) {
 
 	wait := make(chan bool)
 
-	var conn net.Conn
+	var conn *twitchtest.Conn
 
 	var pingpongMutex sync.Mutex
 	var pingsSent int
 	var pongsReceived int
 
-	host := startServer(t, func(c net.Conn) {
+	host := startServer(t, func(c *twitchtest.Conn) {
 		conn = c
 	}, func(message string) {
 		if message == pingMessage {
@@ -2058,6 +3244,32 @@ func TestRejoinOnReconnect(t *testing.T) {
 	assertStringsEqual(t, "JOIN #gempir", receivedMsg)
 }
 
+func TestRejoinOnRECONNECTMessage(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+
+	reconnectNotified := make(chan struct{})
+	client := newTestClient(server.Addr)
+	client.OnReconnectMessage(func(message ReconnectMessage) {
+		close(reconnectNotified)
+	})
+	client.Join("gempir")
+	go client.Connect()
+
+	assertStringsEqual(t, "JOIN #gempir", waitForLine(t, server, "JOIN"))
+	send(t, server, ":tmi.twitch.tv RECONNECT")
+
+	// The channel is joined again on the new connection, after authenticating
+	waitForLine(t, server, "NICK")
+	assertStringsEqual(t, "JOIN #gempir", waitForLine(t, server, "JOIN"))
+
+	select {
+	case <-reconnectNotified:
+	case <-time.After(time.Second * 3):
+		t.Fatal("OnReconnectMessage not called")
+	}
+}
+
 func TestCapabilities(t *testing.T) {
 	type testTable struct {
 		name     string
@@ -2199,3 +3411,400 @@ func TestEmptyCapabilities(t *testing.T) {
 		}(tt)
 	}
 }
+
+func TestReconnectOnWriteTimeout(t *testing.T) {
+	t.Parallel()
+	client := newTestClient("")
+	client.SetWriteTimeout(50 * time.Millisecond)
+	client.clientReconnect.Reset()
+
+	// Nothing reads from the other end of the pipe, so the write blocks like on a full send buffer
+	conn, other := net.Pipe()
+	defer other.Close()
+
+	written := make(chan struct{})
+	go func() {
+		client.writeMessage(conn, "PRIVMSG #gempir :hello")
+		close(written)
+	}()
+
+	select {
+	case <-written:
+	case <-time.After(time.Second * 3):
+		t.Fatal("write did not time out")
+	}
+
+	select {
+	case <-client.clientReconnect.channel:
+	default:
+		t.Fatal("client did not reconnect after the write timed out")
+	}
+
+	select {
+	case msg := <-client.write:
+		assertStringsEqual(t, "PRIVMSG #gempir :hello", msg)
+	default:
+		t.Fatal("timed out message was not queued to be sent again")
+	}
+}
+
+func TestConnectTimesOut(t *testing.T) {
+	t.Parallel()
+
+	// The listener accepts the TCP connection but never answers the TLS handshake, like an unreachable server
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	client := newTestClient(listener.Addr().String())
+	client.SetConnectTimeout(100 * time.Millisecond)
+
+	connected := make(chan error)
+	go func() {
+		connected <- client.Connect()
+	}()
+
+	select {
+	case err := <-connected:
+		var netErr net.Error
+		assertTrue(t, errors.As(err, &netErr) && netErr.Timeout(), "Connect didn't return a timeout error")
+	case <-time.After(time.Second * 3):
+		t.Fatal("Connect didn't time out")
+	}
+}
+
+func TestWritesLinesByPriority(t *testing.T) {
+	t.Parallel()
+	client := newTestClient("")
+
+	assertErrorsEqual(t, nil, client.Say("gempir", "hello"))
+	assertErrorsEqual(t, nil, client.Join("gempir"))
+	client.send("JOIN #pajlada")
+	client.send("PONG :tmi.twitch.tv")
+	assertErrorsEqual(t, nil, client.SayWithNonce("gempir", "bye", "1"))
+
+	var written []string
+	for line, ok := client.queuedWrite(); ok; line, ok = client.queuedWrite() {
+		written = append(written, line)
+	}
+
+	assertStringSlicesEqual(t, []string{
+		"PONG :tmi.twitch.tv",
+		"JOIN #pajlada",
+		"PRIVMSG #gempir :hello",
+		"@client-nonce=1 PRIVMSG #gempir :bye",
+	}, written)
+}
+
+func TestSayReturnsErrQueueFull(t *testing.T) {
+	t.Parallel()
+	client := newTestClient("")
+	client.write = make(chan string, 1)
+	client.OnMessageSent(func(confirmation SentMessageConfirmation) {})
+
+	assertErrorsEqual(t, nil, client.Say("gempir", "hello"))
+	assertErrorsEqual(t, ErrQueueFull, client.Say("gempir", "hello again"))
+	assertErrorsEqual(t, ErrQueueFull, client.EnableEmoteOnly("gempir"))
+	// Messages that weren't queued aren't waiting for their confirmation
+	assertIntsEqual(t, 1, client.sendTracker.len())
+
+	// Protocol lines are queued separately, and still written when the chat messages queue is full
+	client.send("PONG :tmi.twitch.tv")
+	line, _ := client.queuedWrite()
+	assertStringsEqual(t, "PONG :tmi.twitch.tv", line)
+}
+
+func TestCanReportSendQueueFull(t *testing.T) {
+	t.Parallel()
+	client := newTestClient("")
+	client.SetSendQueueHighWaterMark(2)
+
+	full := 0
+	client.OnSendQueueFull(func() {
+		full++
+	})
+
+	assertErrorsEqual(t, nil, client.Say("gempir", "first"))
+	assertIntsEqual(t, 1, client.PendingSends())
+	assertIntsEqual(t, 0, full)
+
+	assertErrorsEqual(t, nil, client.Say("gempir", "second"))
+	assertErrorsEqual(t, nil, client.Say("gempir", "third"))
+	assertIntsEqual(t, 3, client.PendingSends())
+	assertIntsEqual(t, 1, full)
+
+	// Once the queue drained below the mark, reaching it again is reported again
+	for i := 0; i < 2; i++ {
+		_, _ = client.queuedWrite()
+		client.updateWriteQueueLength()
+	}
+	assertIntsEqual(t, 1, client.PendingSends())
+
+	assertErrorsEqual(t, nil, client.Say("gempir", "fourth"))
+	assertIntsEqual(t, 2, full)
+}
+
+// Run with -race to check the client is safe to use from callbacks and other go-routines while receiving messages
+func TestCanSendWhileReceivingMessages(t *testing.T) {
+	t.Parallel()
+	testCanSendWhileReceivingMessages(t, DispatchSync)
+}
+
+func TestCanSendWhileReceivingMessagesAsync(t *testing.T) {
+	t.Parallel()
+	testCanSendWhileReceivingMessages(t, DispatchAsync)
+}
+
+func testCanSendWhileReceivingMessages(t *testing.T, mode DispatchMode) {
+	server := newTestServer(t)
+
+	const senders = 4
+	const messagesPerSender = 50
+
+	var received int32
+	allReceived := make(chan struct{})
+	client := newTestClient(server.Addr)
+	client.SetDispatchMode(mode, 4, 64)
+	client.SetTrackUsers(true)
+	client.OnMessageSent(func(confirmation SentMessageConfirmation) {})
+	client.OnPrivateMessage(func(message PrivateMessage) {
+		if atomic.AddInt32(&received, 1) == senders*messagesPerSender {
+			close(allReceived)
+		}
+	})
+	client.OnConnect(func() {
+		for i := 0; i < senders; i++ {
+			go func(i int) {
+				for j := 0; j < messagesPerSender; j++ {
+					client.Say("gempir", fmt.Sprintf("message %d %d", i, j))
+					_, _ = client.Userlist("gempir")
+					client.RoomState("gempir")
+				}
+			}(i)
+		}
+	})
+	client.Join("gempir")
+	disconnected := connectAndEnsureGoodDisconnect(t, client)
+
+	// The server sends messages while the senders are still sending
+	waitForLine(t, server, "JOIN")
+	go func() {
+		for i := 0; i < senders*messagesPerSender; i++ {
+			send(t, server, fmt.Sprintf("@room-id=11148817;user-id=77829817 :user%d!user%d@user%d.tmi.twitch.tv PRIVMSG #gempir :hello", i, i, i))
+			if i%10 == 0 {
+				send(t, server, fmt.Sprintf(":user%d!user%d@user%d.tmi.twitch.tv JOIN #gempir", i, i, i))
+				send(t, server, "@emote-only=0;room-id=11148817;slow=0 :tmi.twitch.tv ROOMSTATE #gempir")
+			}
+		}
+	}()
+
+	select {
+	case <-allReceived:
+	case <-time.After(time.Second * 5):
+		t.Fatal("not all messages received")
+	}
+
+	// Messages are sent with a client-nonce to be tracked for OnMessageSent
+	for i := 0; i < senders*messagesPerSender; i++ {
+		waitForLine(t, server, "@client-nonce=")
+	}
+	client.Disconnect()
+	<-disconnected
+}
+
+func TestCallbacksAreCalledOneAtATime(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+	// The welcome follows lines whose callbacks are still running when it's read
+	server.Handle("NICK", func(conn *twitchtest.Conn, line string) {
+		for i := 0; i < 5; i++ {
+			_ = conn.Send(":tmi.twitch.tv NOTICE * :notice before the welcome")
+		}
+		_ = conn.Send(":tmi.twitch.tv 001 justinfan123123 :Welcome, GLHF!")
+		for i := 0; i < 5; i++ {
+			_ = conn.Send(":gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :message after the welcome")
+		}
+	})
+
+	running := int32(0)
+	overlapped := tAtomBool{}
+	callback := func() {
+		if atomic.AddInt32(&running, 1) > 1 {
+			overlapped.set(true)
+		}
+		time.Sleep(time.Millisecond * 5)
+		atomic.AddInt32(&running, -1)
+	}
+
+	messages := 0
+	done := make(chan struct{})
+
+	client := newTestClient(server.Addr)
+	client.OnConnect(callback)
+	client.OnNoticeMessage(func(message NoticeMessage) {
+		callback()
+	})
+	client.OnPrivateMessage(func(message PrivateMessage) {
+		callback()
+		if messages++; messages == 5 {
+			close(done)
+		}
+	})
+	go client.Connect()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 3):
+		t.Fatal("messages weren't handled")
+	}
+
+	assertFalse(t, overlapped.get(), "callbacks were called at the same time")
+}
+
+func TestCanTrackViewers(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123123")
+	client.EnablePresenceTracking()
+	client.Join("pajlada")
+
+	assertStringSlicesEqual(t, []string{TagsCapability, CommandsCapability, MembershipCapability}, client.Capabilities)
+	assertStringSlicesEqual(t, []string{TagsCapability, CommandsCapability}, DefaultCapabilities)
+
+	session := ":tmi.twitch.tv 001 justinfan123123 :Welcome, GLHF!\r\n" +
+		":justinfan123123!justinfan123123@justinfan123123.tmi.twitch.tv JOIN #pajlada\r\n" +
+		":justinfan123123.tmi.twitch.tv 353 justinfan123123 = #pajlada :pajlada gempir\r\n" +
+		":justinfan123123.tmi.twitch.tv 366 justinfan123123 #pajlada :End of /NAMES list\r\n" +
+		":nymn!nymn@nymn.tmi.twitch.tv JOIN #pajlada\r\n" +
+		":gempir!gempir@gempir.tmi.twitch.tv PART #pajlada"
+	assertErrorsEqual(t, nil, client.Replay(strings.NewReader(session)))
+
+	assertStringSlicesEqual(t, []string{"nymn", "pajlada"}, client.Viewers("#Pajlada"))
+	assertStringSlicesEqual(t, nil, client.Viewers("forsen"))
+}
+
+func TestCanCountUnknownMessages(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123123")
+
+	var unknown, unset []string
+	client.OnUnknownMessage(func(message RawMessage) {
+		unknown = append(unknown, message.RawType)
+	})
+	client.OnUnsetMessage(func(message RawMessage) {
+		unset = append(unset, message.RawType)
+	})
+
+	session := ":tmi.twitch.tv 001 justinfan123123 :Welcome, GLHF!\r\n" +
+		":tmi.twitch.tv 376 justinfan123123 :>\r\n" +
+		":tmi.twitch.tv CAP * ACK :twitch.tv/tags twitch.tv/commands\r\n" +
+		"@room-id=11148817 :tmi.twitch.tv SHOUTOUT #pajlada :gempir"
+	assertErrorsEqual(t, nil, client.Replay(strings.NewReader(session)))
+
+	assertStringSlicesEqual(t, []string{"SHOUTOUT"}, unknown)
+	assertStringSlicesEqual(t, []string{"001", "376", "CAP", "SHOUTOUT"}, unset)
+	assertTrue(t, client.UnknownMessageCount() == 1, "unknown message was not counted")
+}
+
+func TestCanNormalizeChannelNames(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123123")
+	assertErrorsEqual(t, nil, client.Join("#Pajlada", "pajlada", "PAJLADA"))
+
+	client.OnSelfJoinMessage(func(message UserJoinMessage) {
+		assertErrorsEqual(t, nil, client.Say("#PajLada", "hello"))
+	})
+
+	written := &bytes.Buffer{}
+	conn := struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader(":tmi.twitch.tv 001 justinfan123123 :Welcome, GLHF!\r\n" +
+		":justinfan123123!justinfan123123@justinfan123123.tmi.twitch.tv JOIN #pajlada\r\n" +
+		"@emote-only=1;room-id=11148817 :tmi.twitch.tv ROOMSTATE #Pajlada"), written}
+	assertErrorsEqual(t, nil, client.ConnectWithConn(conn))
+
+	lines := strings.Split(strings.TrimSuffix(written.String(), "\r\n"), "\r\n")
+	assertStringSlicesEqual(t, []string{"JOIN #pajlada", "PRIVMSG #pajlada :hello"}, lines[3:])
+
+	roomState, ok := client.GetRoomState("#PAJLADA")
+	assertTrue(t, ok, "room state of a channel with a different case was not found")
+	assertStringsEqual(t, "pajlada", roomState.Channel)
+}
+
+func TestRejectsInvalidChannelNames(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123123")
+
+	for _, channel := range []string{"", "#", "pajlada gempir", "pajlada,gempir"} {
+		assertTrue(t, errors.Is(client.Join("gempir", channel), ErrInvalidChannel), "Join accepted "+channel)
+		assertTrue(t, errors.Is(client.Depart(channel), ErrInvalidChannel), "Depart accepted "+channel)
+		assertTrue(t, errors.Is(client.Say(channel, "hello"), ErrInvalidChannel), "Say accepted "+channel)
+		assertTrue(t, errors.Is(client.Reply(channel, "b34ccfc7-4977-403a-8a94-33c6bac34fb8", "hello"), ErrInvalidChannel), "Reply accepted "+channel)
+	}
+
+	// Join doesn't join any of the channels if one of them is invalid
+	assertIntsEqual(t, 0, len(client.channels))
+}
+
+func TestRejectsLineInjection(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123123")
+
+	injection := "hello\r\nPRIVMSG #other :pwned"
+	assertTrue(t, errors.Is(client.Say("pajlada", injection), ErrInvalidText), "Say accepted a line break in the text")
+	assertTrue(t, errors.Is(client.Say("pajlada", "hello\npwned"), ErrInvalidText), "Say accepted a newline in the text")
+	assertTrue(t, errors.Is(client.Say("pajlada", "hello\x00pwned"), ErrInvalidText), "Say accepted a NUL in the text")
+	assertTrue(t, errors.Is(client.SendMe("pajlada", injection), ErrInvalidText), "SendMe accepted a line break in the text")
+	assertTrue(t, errors.Is(client.Reply("pajlada", "b34ccfc7-4977-403a-8a94-33c6bac34fb8", injection), ErrInvalidText), "Reply accepted a line break in the text")
+	assertTrue(t, errors.Is(client.Reply("pajlada", "b34ccfc7\r\nPRIVMSG #other :pwned", "hello"), ErrInvalidText), "Reply accepted a line break in the parent id")
+	assertTrue(t, errors.Is(client.Say("pajlada\r\nPRIVMSG #other", "pwned"), ErrInvalidChannel), "Say accepted a line break in the channel")
+	assertTrue(t, errors.Is(client.Say("pajlada\x07", "pwned"), ErrInvalidChannel), "Say accepted a control character in the channel")
+	assertTrue(t, errors.Is(client.Join("pajlada\r\nPRIVMSG #other :pwned"), ErrInvalidChannel), "Join accepted a line break in the channel")
+	assertTrue(t, errors.Is(client.SendRaw("PRIVMSG #pajlada :hello\r\nPRIVMSG #other :pwned"), ErrInvalidText), "SendRaw accepted a line break mid-line")
+
+	// Tabs and the CTCP ACTION framing are allowed
+	assertErrorsEqual(t, nil, client.SendMe("pajlada", "waves\tback"))
+	assertErrorsEqual(t, nil, client.SendRaw("PRIVMSG #pajlada :raw\r\n"))
+
+	written := &bytes.Buffer{}
+	conn := struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader(":tmi.twitch.tv 001 justinfan123123 :Welcome, GLHF!"), written}
+	assertErrorsEqual(t, nil, client.ConnectWithConn(conn))
+
+	lines := strings.Split(strings.TrimSuffix(written.String(), "\r\n"), "\r\n")
+	assertStringSlicesEqual(t, []string{
+		"CAP REQ :" + strings.Join(DefaultCapabilities, " "),
+		"PASS oauth:123123123",
+		"NICK justinfan123123",
+		"PRIVMSG #pajlada :\x01ACTION waves\tback\x01",
+		"PRIVMSG #pajlada :raw",
+	}, lines)
+}
+
+func TestAnonymousClientCannotSend(t *testing.T) {
+	t.Parallel()
+	client := NewAnonymousClient()
+
+	assertTrue(t, strings.HasPrefix(client.ircUser, "justinfan"), "anonymous username is not a justinfan user: "+client.ircUser)
+	_, err := strconv.Atoi(strings.TrimPrefix(client.ircUser, "justinfan"))
+	assertErrorsEqual(t, nil, err)
+
+	assertErrorsEqual(t, ErrAnonymousClient, client.Say("pajlada", "hello"))
+	assertErrorsEqual(t, ErrAnonymousClient, client.SendMe("pajlada", "hello"))
+	assertErrorsEqual(t, ErrAnonymousClient, client.Reply("pajlada", "b34ccfc7-4977-403a-8a94-33c6bac34fb8", "hello"))
+	assertErrorsEqual(t, ErrAnonymousClient, client.EnableEmoteOnly("pajlada"))
+
+	written := &bytes.Buffer{}
+	conn := struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader(":tmi.twitch.tv 001 " + client.ircUser + " :Welcome, GLHF!"), written}
+	assertErrorsEqual(t, nil, client.ConnectWithConn(conn))
+
+	lines := strings.Split(strings.TrimSuffix(written.String(), "\r\n"), "\r\n")
+	assertStringSlicesEqual(t, []string{"CAP REQ :" + strings.Join(DefaultCapabilities, " "), "NICK " + client.ircUser}, lines)
+}
@@ -0,0 +1,115 @@
+package twitch
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidCommandArgument returned from the chat command helpers when an argument is out of the range Twitch accepts
+var ErrInvalidCommandArgument = errors.New("invalid command argument")
+
+const (
+	// maxSlowModeSeconds is the longest slow mode Twitch accepts, 30 minutes
+	maxSlowModeSeconds = 1800
+	// maxFollowersModeMinutes is the longest follow age Twitch accepts for followers-only mode, 3 months
+	maxFollowersModeMinutes = 129600
+)
+
+// SetColor changes the username color of the client's user, either to a named color like "Blue" or a hex color like "#1E90FF".
+// The command is sent to the given channel, the color applies to all channels
+func (c *Client) SetColor(channel, color string) error {
+	if color == "" || strings.ContainsAny(color, " \r\n") {
+		return fmt.Errorf("%w: color %q", ErrInvalidCommandArgument, color)
+	}
+
+	return c.sendCommand(channel, "/color "+color)
+}
+
+// EnableEmoteOnly only allows messages made of emotes in the channel
+func (c *Client) EnableEmoteOnly(channel string) error {
+	return c.sendCommand(channel, "/emoteonly")
+}
+
+// DisableEmoteOnly allows messages with text in the channel again
+func (c *Client) DisableEmoteOnly(channel string) error {
+	return c.sendCommand(channel, "/emoteonlyoff")
+}
+
+// SetSlowMode makes users wait the given number of seconds between their messages in the channel, from 1 to 1800
+func (c *Client) SetSlowMode(channel string, seconds int) error {
+	if seconds < 1 || seconds > maxSlowModeSeconds {
+		return fmt.Errorf("%w: slow mode of %d seconds, must be between 1 and %d", ErrInvalidCommandArgument, seconds, maxSlowModeSeconds)
+	}
+
+	return c.sendCommand(channel, fmt.Sprintf("/slow %d", seconds))
+}
+
+// DisableSlowMode lets users send messages without waiting in the channel again
+func (c *Client) DisableSlowMode(channel string) error {
+	return c.sendCommand(channel, "/slowoff")
+}
+
+// SetFollowersMode only allows users following the channel for at least the given number of minutes to chat, from 0 to 129600 (3 months).
+// 0 allows all followers to chat
+func (c *Client) SetFollowersMode(channel string, minutes int) error {
+	if minutes < 0 || minutes > maxFollowersModeMinutes {
+		return fmt.Errorf("%w: followers-only mode of %d minutes, must be between 0 and %d", ErrInvalidCommandArgument, minutes, maxFollowersModeMinutes)
+	}
+
+	return c.sendCommand(channel, fmt.Sprintf("/followers %dm", minutes))
+}
+
+// DisableFollowersMode allows users not following the channel to chat again
+func (c *Client) DisableFollowersMode(channel string) error {
+	return c.sendCommand(channel, "/followersoff")
+}
+
+// EnableSubscribersMode only allows subscribers to chat in the channel
+func (c *Client) EnableSubscribersMode(channel string) error {
+	return c.sendCommand(channel, "/subscribers")
+}
+
+// DisableSubscribersMode allows users not subscribed to the channel to chat again
+func (c *Client) DisableSubscribersMode(channel string) error {
+	return c.sendCommand(channel, "/subscribersoff")
+}
+
+// EnableUniqueChat only allows messages that weren't sent in the channel before, also called r9k mode
+func (c *Client) EnableUniqueChat(channel string) error {
+	return c.sendCommand(channel, "/uniquechat")
+}
+
+// DisableUniqueChat allows repeated messages in the channel again
+func (c *Client) DisableUniqueChat(channel string) error {
+	return c.sendCommand(channel, "/uniquechatoff")
+}
+
+// sendCommand sends a chat command. Unlike Say no client-nonce is added, Twitch doesn't acknowledge commands like messages.
+// Returns ErrInvalidChannel for an invalid channel name, or ErrChannelNotAllowed if the channel isn't in the allowlist of SetSendAllowlist.
+// Returns ErrInvalidText if the command contains line breaks or other control characters.
+// Anonymous clients return ErrAnonymousClient. The message is only queued to be written, if the queue is full ErrQueueFull is returned
+func (c *Client) sendCommand(channel, command string) error {
+	if c.anonymous {
+		return ErrAnonymousClient
+	}
+
+	if err := c.checkEarlySend(); err != nil {
+		return err
+	}
+
+	channel, err := normalizeChannel(channel)
+	if err != nil {
+		return err
+	}
+
+	if err := c.checkSendAllowed(channel); err != nil {
+		return err
+	}
+
+	if err := checkText(command); err != nil {
+		return err
+	}
+
+	return c.sendMessage(fmt.Sprintf("PRIVMSG #%s :%s", channel, command))
+}
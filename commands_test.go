@@ -0,0 +1,90 @@
+package twitch
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCanSendChatCommands(t *testing.T) {
+	t.Parallel()
+	expected := []string{
+		"PRIVMSG #gempir :/color #1E90FF",
+		"PRIVMSG #gempir :/emoteonly",
+		"PRIVMSG #gempir :/emoteonlyoff",
+		"PRIVMSG #gempir :/slow 30",
+		"PRIVMSG #gempir :/slowoff",
+		"PRIVMSG #gempir :/followers 10m",
+		"PRIVMSG #gempir :/followers 0m",
+		"PRIVMSG #gempir :/followersoff",
+		"PRIVMSG #gempir :/subscribers",
+		"PRIVMSG #gempir :/subscribersoff",
+		"PRIVMSG #gempir :/uniquechat",
+		"PRIVMSG #gempir :/uniquechatoff",
+	}
+
+	waitEnd := make(chan struct{})
+	var received []string
+
+	host := startServer(t, nothingOnConnect, func(message string) {
+		if strings.HasPrefix(message, "PRIVMSG") {
+			received = append(received, message)
+			if len(received) == len(expected) {
+				close(waitEnd)
+			}
+		}
+	})
+
+	client := newTestClient(host)
+	client.SendClientNonce = true
+
+	client.OnConnect(func() {
+		assertErrorsEqual(t, nil, client.SetColor("Gempir", "#1E90FF"))
+		client.EnableEmoteOnly("gempir")
+		client.DisableEmoteOnly("gempir")
+		assertErrorsEqual(t, nil, client.SetSlowMode("gempir", 30))
+		client.DisableSlowMode("gempir")
+		assertErrorsEqual(t, nil, client.SetFollowersMode("gempir", 10))
+		assertErrorsEqual(t, nil, client.SetFollowersMode("gempir", 0))
+		client.DisableFollowersMode("gempir")
+		client.EnableSubscribersMode("gempir")
+		client.DisableSubscribersMode("gempir")
+		client.EnableUniqueChat("gempir")
+		client.DisableUniqueChat("gempir")
+	})
+
+	go client.Connect()
+
+	select {
+	case <-waitEnd:
+	case <-time.After(time.Second * 3):
+		t.Fatal("not all commands received")
+	}
+
+	assertStringSlicesEqual(t, expected, received)
+}
+
+func TestChatCommandsValidateArguments(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123132")
+
+	errs := []error{
+		client.SetColor("gempir", ""),
+		client.SetColor("gempir", "#1E90FF\r\nPRIVMSG #forsen :hi"),
+		client.SetSlowMode("gempir", 0),
+		client.SetSlowMode("gempir", 1801),
+		client.SetFollowersMode("gempir", -1),
+		client.SetFollowersMode("gempir", 129601),
+	}
+
+	for _, err := range errs {
+		assertTrue(t, errors.Is(err, ErrInvalidCommandArgument), "invalid argument was accepted")
+	}
+
+	select {
+	case line := <-client.write:
+		t.Fatalf("command with invalid argument was sent: %s", line)
+	default:
+	}
+}
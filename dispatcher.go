@@ -0,0 +1,177 @@
+package twitch
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// DispatchMode decides which go-routine calls the attached callbacks
+type DispatchMode int
+
+const (
+	// DispatchSync calls the callbacks on the go-routine reading from the connection.
+	// A slow callback delays reading of the next messages. This is the default
+	DispatchSync DispatchMode = iota
+	// DispatchAsync queues the callbacks for a pool of worker go-routines, so a slow callback doesn't stall the connection.
+	// Messages of the same channel are always handled by the same worker, in the order they were received.
+	// Messages of different channels can be handled in any order
+	DispatchAsync
+)
+
+// OverflowPolicy decides what happens to a message when the queue of a worker is full in DispatchAsync mode
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits until the worker has room in its queue, which stalls reading from the connection. This is the default
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest message in the queue of the worker to make room for the new message
+	OverflowDropOldest
+	// OverflowDropNewest drops the new message
+	OverflowDropNewest
+)
+
+// dispatchJob is a queued call of all handlers of an event
+type dispatchJob struct {
+	event   handlerEvent
+	payload interface{}
+}
+
+type dispatchPool struct {
+	client *Client
+	policy OverflowPolicy
+	queues []chan dispatchJob
+	wg     sync.WaitGroup
+}
+
+func newDispatchPool(client *Client, workers, queueSize int, policy OverflowPolicy) *dispatchPool {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	pool := &dispatchPool{
+		client: client,
+		policy: policy,
+		queues: make([]chan dispatchJob, workers),
+	}
+
+	for i := range pool.queues {
+		pool.queues[i] = make(chan dispatchJob, queueSize)
+	}
+
+	return pool
+}
+
+func (p *dispatchPool) start() {
+	p.wg.Add(len(p.queues))
+	for _, queue := range p.queues {
+		go p.work(queue)
+	}
+}
+
+func (p *dispatchPool) work(queue chan dispatchJob) {
+	defer p.wg.Done()
+
+	for job := range queue {
+		p.client.callHandlers(job.event, job.payload)
+	}
+}
+
+// stop waits for the workers to handle all queued jobs. No jobs may be submitted after stop was called
+func (p *dispatchPool) stop() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+
+	p.wg.Wait()
+}
+
+func (p *dispatchPool) submit(job dispatchJob) {
+	queue := p.queues[p.worker(job.payload)]
+
+	switch p.policy {
+	case OverflowDropNewest:
+		select {
+		case queue <- job:
+		default:
+			p.drop(job)
+		}
+
+	case OverflowDropOldest:
+		for {
+			select {
+			case queue <- job:
+				return
+			default:
+			}
+
+			select {
+			case oldest := <-queue:
+				p.drop(oldest)
+			default:
+			}
+		}
+
+	default:
+		queue <- job
+	}
+}
+
+func (p *dispatchPool) drop(job dispatchJob) {
+	p.client.logger.Warnf("dispatch queue is full, dropping message")
+
+	message, _ := job.payload.(Message)
+	p.client.callHandlers(messageDroppedEvent, message)
+}
+
+// worker picks the worker for a payload based on its channel, so messages of one channel keep their order
+func (p *dispatchPool) worker(payload interface{}) int {
+	if len(p.queues) == 1 {
+		return 0
+	}
+
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(messageChannel(payload)))
+
+	return int(hash.Sum32() % uint32(len(p.queues)))
+}
+
+// messageChannel returns the channel a message was sent in, or an empty string for messages without a channel
+func messageChannel(payload interface{}) string {
+	switch msg := payload.(type) {
+	case *PrivateMessage:
+		return msg.Channel
+	case *ClearChatMessage:
+		return msg.Channel
+	case *ClearMessage:
+		return msg.Channel
+	case *RoomStateMessage:
+		return msg.Channel
+	case *UserNoticeMessage:
+		return msg.Channel
+	case *UserStateMessage:
+		return msg.Channel
+	case *NoticeMessage:
+		return msg.Channel
+	case *UserJoinMessage:
+		return msg.Channel
+	case *UserPartMessage:
+		return msg.Channel
+	case *NamesMessage:
+		return msg.Channel
+	case sendError:
+		return msg.notice.Channel
+	case userlistChange:
+		return msg.channel
+	case hostChange:
+		return msg.channel
+	case roomModeChange:
+		return msg.channel
+	case roomStateChanges:
+		return msg.channel
+	}
+
+	return ""
+}
@@ -0,0 +1,89 @@
+package twitch
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDispatchPoolKeepsChannelOrder(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123132")
+
+	var mutex sync.Mutex
+	received := map[string][]string{}
+	client.OnPrivateMessage(func(message PrivateMessage) {
+		if message.Channel == "slow" {
+			time.Sleep(time.Millisecond)
+		}
+
+		mutex.Lock()
+		received[message.Channel] = append(received[message.Channel], message.Message)
+		mutex.Unlock()
+	})
+
+	pool := newDispatchPool(client, 4, 8, OverflowBlock)
+	pool.start()
+
+	expected := map[string][]string{}
+	for i := 0; i < 50; i++ {
+		for _, channel := range []string{"slow", "pajlada", "gempir"} {
+			text := fmt.Sprintf("message %d", i)
+			expected[channel] = append(expected[channel], text)
+			pool.submit(dispatchJob{event: privateMessageEvent, payload: &PrivateMessage{Channel: channel, Message: text}})
+		}
+	}
+
+	pool.stop()
+
+	for channel, messages := range expected {
+		assertStringSlicesEqual(t, messages, received[channel])
+	}
+}
+
+func testDispatchPoolOverflow(t *testing.T, policy OverflowPolicy) (handled, dropped []string) {
+	client := NewClient("justinfan123123", "oauth:123123132")
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	client.OnPrivateMessage(func(message PrivateMessage) {
+		if message.Message == "first" {
+			close(started)
+			<-unblock
+		}
+		handled = append(handled, message.Message)
+	})
+	client.OnMessageDropped(func(message Message) {
+		dropped = append(dropped, message.(*PrivateMessage).Message)
+	})
+
+	pool := newDispatchPool(client, 1, 1, policy)
+	pool.start()
+
+	pool.submit(dispatchJob{event: privateMessageEvent, payload: &PrivateMessage{Message: "first"}})
+	<-started
+	pool.submit(dispatchJob{event: privateMessageEvent, payload: &PrivateMessage{Message: "second"}})
+	pool.submit(dispatchJob{event: privateMessageEvent, payload: &PrivateMessage{Message: "third"}})
+	close(unblock)
+
+	pool.stop()
+
+	return handled, dropped
+}
+
+func TestDispatchPoolCanDropNewest(t *testing.T) {
+	t.Parallel()
+	handled, dropped := testDispatchPoolOverflow(t, OverflowDropNewest)
+
+	assertStringSlicesEqual(t, []string{"first", "second"}, handled)
+	assertStringSlicesEqual(t, []string{"third"}, dropped)
+}
+
+func TestDispatchPoolCanDropOldest(t *testing.T) {
+	t.Parallel()
+	handled, dropped := testDispatchPoolOverflow(t, OverflowDropOldest)
+
+	assertStringSlicesEqual(t, []string{"first", "third"}, handled)
+	assertStringSlicesEqual(t, []string{"second"}, dropped)
+}
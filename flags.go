@@ -0,0 +1,98 @@
+package twitch
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MessageFlag is a span of a message that AutoMod flagged, parsed from the flags tag like "0-6:S.7".
+// Start and End are the positions of the first and last character of the span in the message, inclusive
+type MessageFlag struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+	// Categories maps the flagged categories to their score from 1 to 7: "A" aggressive, "I" identity,
+	// "P" profanity and "S" sexual content
+	Categories map[string]int `json:"categories"`
+}
+
+// parseFlags parses the comma-separated spans of the flags tag, like "0-6:S.7,12-20:A.3/P.6".
+// Malformed spans are skipped
+func parseFlags(rawFlags string) []MessageFlag {
+	if rawFlags == "" {
+		return nil
+	}
+
+	var flags []MessageFlag
+	for rest, hasNext := rawFlags, true; hasNext; {
+		var rawFlag string
+		rawFlag, rest, hasNext = cutByte(rest, ',')
+
+		if flag, ok := parseFlag(rawFlag); ok {
+			flags = append(flags, flag)
+		}
+	}
+
+	return flags
+}
+
+func parseFlag(rawFlag string) (MessageFlag, bool) {
+	rawSpan, rawCategories, ok := cutByte(rawFlag, ':')
+	if !ok || rawCategories == "" {
+		return MessageFlag{}, false
+	}
+
+	rawStart, rawEnd, ok := cutByte(rawSpan, '-')
+	if !ok {
+		return MessageFlag{}, false
+	}
+
+	start, err := strconv.Atoi(rawStart)
+	if err != nil || start < 0 {
+		return MessageFlag{}, false
+	}
+	end, err := strconv.Atoi(rawEnd)
+	if err != nil || end < start {
+		return MessageFlag{}, false
+	}
+
+	flag := MessageFlag{
+		Start:      start,
+		End:        end,
+		Categories: map[string]int{},
+	}
+
+	for rest, hasNext := rawCategories, true; hasNext; {
+		var rawCategory string
+		rawCategory, rest, hasNext = cutByte(rest, '/')
+
+		category, rawScore, ok := cutByte(rawCategory, '.')
+		if !ok || category == "" {
+			return MessageFlag{}, false
+		}
+
+		score, err := strconv.Atoi(rawScore)
+		if err != nil {
+			return MessageFlag{}, false
+		}
+
+		flag.Categories[category] = score
+	}
+
+	return flag, true
+}
+
+func formatFlags(flags []MessageFlag) string {
+	formatted := make([]string, 0, len(flags))
+	for _, flag := range flags {
+		categories := make([]string, 0, len(flag.Categories))
+		for category, score := range flag.Categories {
+			categories = append(categories, category+"."+strconv.Itoa(score))
+		}
+		sort.Strings(categories)
+
+		formatted = append(formatted, strconv.Itoa(flag.Start)+"-"+strconv.Itoa(flag.End)+":"+strings.Join(categories, "/"))
+	}
+
+	return strings.Join(formatted, ",")
+}
@@ -0,0 +1,64 @@
+package twitch
+
+import "testing"
+
+func TestCanParseFlags(t *testing.T) {
+	t.Parallel()
+	testMessage := "@badges=;color=;display-name=gempir;emotes=;flags=0-6:S.7,12-20:A.3/P.6;id=1;room-id=11148817;user-id=77829817 :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :flagged words and more words"
+
+	message := ParseMessage(testMessage).(*PrivateMessage)
+
+	assertIntsEqual(t, 2, len(message.Flags))
+	assertIntsEqual(t, 0, message.Flags[0].Start)
+	assertIntsEqual(t, 6, message.Flags[0].End)
+	assertIntsEqual(t, 1, len(message.Flags[0].Categories))
+	assertIntsEqual(t, 7, message.Flags[0].Categories["S"])
+
+	assertIntsEqual(t, 12, message.Flags[1].Start)
+	assertIntsEqual(t, 20, message.Flags[1].End)
+	assertIntsEqual(t, 3, message.Flags[1].Categories["A"])
+	assertIntsEqual(t, 6, message.Flags[1].Categories["P"])
+
+	line, err := SerializeMessage(message)
+	assertErrorsEqual(t, nil, err)
+	assertStringsEqual(t, testMessage, line)
+}
+
+func TestFlagsAreEmptyWithoutTag(t *testing.T) {
+	t.Parallel()
+
+	for _, testMessage := range []string{
+		"@badges=;flags=;id=1 :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :hi",
+		":gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :hi",
+	} {
+		message := ParseMessage(testMessage).(*PrivateMessage)
+		assertIntsEqual(t, 0, len(message.Flags))
+	}
+}
+
+func TestMalformedFlagsAreSkipped(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		rawFlags string
+		expected int
+	}{
+		{"0-4:", 0},
+		{"0-4", 0},
+		{"a-4:S.7", 0},
+		{"4-0:S.7", 0},
+		{"-1-4:S.7", 0},
+		{"0-4:S", 0},
+		{"0-4:S.x", 0},
+		{"0-4:.7", 0},
+		{",,", 0},
+		{"0-4:S.7,garbage,5-9:P.5/", 1},
+		{"0-4:S.7,5-9:P.5", 2},
+	}
+
+	for _, test := range tests {
+		flags := parseFlags(test.rawFlags)
+		if len(flags) != test.expected {
+			t.Errorf("flags %q were parsed as %d flags, expected %d", test.rawFlags, len(flags), test.expected)
+		}
+	}
+}
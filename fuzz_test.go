@@ -0,0 +1,104 @@
+//go:build go1.18
+// +build go1.18
+
+package twitch
+
+import "testing"
+
+func FuzzParseIRCLine(f *testing.F) {
+	seeds := []string{
+		"",
+		"@",
+		"@;",
+		"@;;",
+		"@a=1;;b=2 :tmi.twitch.tv PING",
+		"@a=b=c :tmi.twitch.tv PING",
+		"@badges=;color=;display-name=ZZZi;turbo",
+		"@badges=;color= :danielps1!danielps1@danielps1.tmi.twitch.tv",
+		":",
+		": PING",
+		":nick PING",
+		":nick! PING",
+		":nick@host PING",
+		":!@ PING",
+		"PING :",
+		"PING ::",
+		"PING  a  b",
+		"@a=\\ :tmi.twitch.tv PING",
+	}
+	for i := 0; i < len(messages) && i < 100; i++ {
+		seeds = append(seeds, messages[i])
+	}
+
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, line string) {
+		message, _ := ParseIRCLine(line)
+		if message == nil {
+			t.Fatalf("%q was parsed as nil", line)
+		}
+
+		if _, ok := message.Tags[""]; ok {
+			t.Fatalf("%q was parsed with an empty tag key", line)
+		}
+	})
+}
+
+func FuzzParseMessage(f *testing.F) {
+	seeds := []string{
+		"PRIVMSG",
+		"WHISPER",
+		"CLEARCHAT",
+		"CLEARMSG",
+		"ROOMSTATE",
+		"USERNOTICE",
+		"USERSTATE",
+		"NOTICE",
+		"JOIN",
+		"PART",
+		"353",
+		"PING",
+		"PONG",
+		"@badges=;color= :tmi.twitch.tv PRIVMSG",
+		":tmi.twitch.tv CLEARCHAT",
+		"@msg-id=host_on :tmi.twitch.tv NOTICE",
+		":tmi.twitch.tv ROOMSTATE",
+		"@emotes=25:0-4 :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #gempir :Kappa",
+		"@badges=vip,,moderator/ :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #gempir :hi",
+		"@emotes=25:4-0,-1-2/:/1:0- :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #gempir :Kappa",
+		"@bits=100 :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #gempir :Cheer Cheer100 100Cheer",
+		"@ban-duration=x :tmi.twitch.tv CLEARCHAT #gempir :",
+		":tmi.twitch.tv 353 justinfan123123 =",
+		":tmi.twitch.tv 353 justinfan123123 = #gempir :",
+		"@msg-id=subgift;msg-param-months=x;msg-param-sub-plan=Prime :tmi.twitch.tv USERNOTICE #gempir",
+		":tmi.twitch.tv HOSTTARGET #gempir :",
+	}
+	for i := 0; i < len(messages) && i < 100; i++ {
+		seeds = append(seeds, messages[i])
+	}
+
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, line string) {
+		message := ParseMessage(line)
+		if message == nil {
+			t.Fatalf("%q was parsed as nil", line)
+		}
+
+		// The accessors of parsed messages must not panic either
+		if userNotice, ok := message.(*UserNoticeMessage); ok {
+			userNotice.Announcement()
+			userNotice.Raid()
+			userNotice.Sub()
+			userNotice.SubGift()
+			userNotice.MysteryGift()
+			userNotice.SubPlan()
+		}
+
+		_, _ = SerializeMessage(message)
+	})
+}
@@ -1,3 +1,3 @@
 module github.com/gempir/go-twitch-irc/v4
 
-go 1.12
+go 1.18
@@ -0,0 +1,141 @@
+package twitch
+
+import "sync"
+
+// HandlerID identifies a callback attached to the client.
+// It is returned by every On... method and can be passed to RemoveHandler to detach the callback again
+type HandlerID uint64
+
+// handlerEvent is the internal key handlers are grouped by
+type handlerEvent int
+
+const (
+	connectEvent handlerEvent = iota
+	whisperMessageEvent
+	privateMessageEvent
+	clearChatMessageEvent
+	clearMessageEvent
+	roomStateMessageEvent
+	userNoticeMessageEvent
+	userStateMessageEvent
+	globalUserStateMessageEvent
+	noticeMessageEvent
+	userJoinMessageEvent
+	userPartMessageEvent
+	selfJoinMessageEvent
+	selfPartMessageEvent
+	reconnectMessageEvent
+	namesMessageEvent
+	pingMessageEvent
+	pongMessageEvent
+	unsetMessageEvent
+	pingSentEvent
+	handlerPanicEvent
+	messageDroppedEvent
+	emoteSetsChangedEvent
+	messageSentEvent
+	sendErrorEvent
+	userlistChangeEvent
+	rawLineEvent
+	hostEvent
+	emoteOnlyEvent
+	subModeEvent
+	slowModeEvent
+	followersModeEvent
+	unknownMessageEvent
+	channelIdleEvent
+	stateChangeEvent
+	sendQueueFullEvent
+	roomStateChangeEvent
+)
+
+type handler struct {
+	id       HandlerID
+	callback func(payload interface{})
+}
+
+// handlerPanic is the payload of the handlerPanicEvent
+type handlerPanic struct {
+	message   Message
+	recovered interface{}
+	stack     []byte
+}
+
+// emoteSetsChange is the payload of the emoteSetsChangedEvent
+type emoteSetsChange struct {
+	added   []string
+	removed []string
+}
+
+// sendError is the payload of the sendErrorEvent
+type sendError struct {
+	reason NoticeID
+	notice *NoticeMessage
+}
+
+// userlistChange is the payload of the userlistChangeEvent
+type userlistChange struct {
+	channel string
+	joined  []string
+	parted  []string
+}
+
+// handlerRegistry keeps an ordered list of handlers per event.
+// The lists are copy-on-write, so a list returned by get can be iterated without holding the lock,
+// and handlers are free to register or remove handlers from within a callback
+type handlerRegistry struct {
+	mutex    sync.RWMutex
+	lastID   HandlerID
+	handlers map[handlerEvent][]handler
+}
+
+func newHandlerRegistry() *handlerRegistry {
+	return &handlerRegistry{
+		handlers: map[handlerEvent][]handler{},
+	}
+}
+
+func (r *handlerRegistry) add(event handlerEvent, callback func(payload interface{})) HandlerID {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.lastID++
+
+	current := r.handlers[event]
+	handlers := make([]handler, len(current), len(current)+1)
+	copy(handlers, current)
+	r.handlers[event] = append(handlers, handler{
+		id:       r.lastID,
+		callback: callback,
+	})
+
+	return r.lastID
+}
+
+func (r *handlerRegistry) remove(id HandlerID) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for event, current := range r.handlers {
+		for i, h := range current {
+			if h.id != id {
+				continue
+			}
+
+			handlers := make([]handler, 0, len(current)-1)
+			handlers = append(handlers, current[:i]...)
+			r.handlers[event] = append(handlers, current[i+1:]...)
+
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *handlerRegistry) get(event handlerEvent) []handler {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.handlers[event]
+}
@@ -119,7 +119,7 @@ func assertErrorsEqual(t *testing.T, expected, actual error) {
 
 func assertMessageTypesEqual(t *testing.T, expected, actual MessageType) {
 	if expected != actual {
-		t.Errorf("failed asserting that MessageType \"%d\" is expected \"%d\"", actual, expected)
+		t.Errorf("failed asserting that MessageType \"%s\" is expected \"%s\"", actual, expected)
 	}
 }
 
@@ -0,0 +1,56 @@
+package twitch
+
+import (
+	"strconv"
+	"strings"
+)
+
+// hostChange is the payload of the hostEvent. target is empty when the channel stopped hosting
+type hostChange struct {
+	channel string
+	target  string
+	viewers int
+}
+
+// parseHostTarget returns the host change of a HOSTTARGET message, which looks like
+// ":tmi.twitch.tv HOSTTARGET #channel :target 42" or ":tmi.twitch.tv HOSTTARGET #channel :- 0" when hosting stopped
+func parseHostTarget(message *RawMessage) (hostChange, bool) {
+	if message.RawType != "HOSTTARGET" || message.Channel == "" {
+		return hostChange{}, false
+	}
+
+	fields := strings.Fields(message.Message)
+	if len(fields) == 0 {
+		return hostChange{}, false
+	}
+
+	change := hostChange{channel: message.Channel}
+	if fields[0] != "-" {
+		change.target = strings.ToLower(strings.TrimPrefix(fields[0], "#"))
+	}
+	if len(fields) > 1 {
+		// The viewer count is "-" when it's unknown
+		change.viewers, _ = strconv.Atoi(fields[1])
+	}
+
+	return change, true
+}
+
+// parseHostNotice returns the host change of a host_on or host_off NOTICE. The text of a host_on NOTICE
+// is "Now hosting <target>.", host_off NOTICEs don't name the target. NOTICEs don't contain the viewer count
+func parseHostNotice(message *NoticeMessage) (hostChange, bool) {
+	switch message.MsgID {
+	case "host_on":
+		if !strings.HasPrefix(message.Message, "Now hosting ") {
+			return hostChange{}, false
+		}
+
+		target := strings.TrimSuffix(strings.TrimPrefix(message.Message, "Now hosting "), ".")
+		return hostChange{channel: message.Channel, target: strings.ToLower(target)}, true
+
+	case "host_off":
+		return hostChange{channel: message.Channel}, true
+	}
+
+	return hostChange{}, false
+}
@@ -0,0 +1,89 @@
+package twitch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCanParseHostTargets(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		message string
+		change  hostChange
+		ok      bool
+	}{
+		{":tmi.twitch.tv HOSTTARGET #pajlada :nymn 42", hostChange{"pajlada", "nymn", 42}, true},
+		{":tmi.twitch.tv HOSTTARGET #pajlada :NymN -", hostChange{"pajlada", "nymn", 0}, true},
+		{":tmi.twitch.tv HOSTTARGET #pajlada :- 0", hostChange{"pajlada", "", 0}, true},
+		{":tmi.twitch.tv HOSTTARGET #pajlada :-", hostChange{"pajlada", "", 0}, true},
+		{":tmi.twitch.tv HOSTTARGET #pajlada :", hostChange{}, false},
+		{":tmi.twitch.tv HOSTTARGET", hostChange{}, false},
+		{":tmi.twitch.tv CAP * ACK :twitch.tv/tags", hostChange{}, false},
+	}
+
+	for _, test := range tests {
+		change, ok := parseHostTarget(ParseMessage(test.message).(*RawMessage))
+
+		assertTrue(t, test.ok == ok, "wrong result of "+test.message)
+		assertStringsEqual(t, test.change.channel, change.channel)
+		assertStringsEqual(t, test.change.target, change.target)
+		assertIntsEqual(t, test.change.viewers, change.viewers)
+	}
+}
+
+func TestCanParseHostNotices(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		message string
+		change  hostChange
+		ok      bool
+	}{
+		{"@msg-id=host_on :tmi.twitch.tv NOTICE #pajlada :Now hosting KKona.", hostChange{"pajlada", "kkona", 0}, true},
+		{"@msg-id=host_off :tmi.twitch.tv NOTICE #pajlada :Exited host mode.", hostChange{"pajlada", "", 0}, true},
+		{"@msg-id=host_on :tmi.twitch.tv NOTICE #pajlada :Something else.", hostChange{}, false},
+		{"@msg-id=msg_banned :tmi.twitch.tv NOTICE #pajlada :You are permanently banned from talking in pajlada.", hostChange{}, false},
+	}
+
+	for _, test := range tests {
+		change, ok := parseHostNotice(ParseMessage(test.message).(*NoticeMessage))
+
+		assertTrue(t, test.ok == ok, "wrong result of "+test.message)
+		assertStringsEqual(t, test.change.channel, change.channel)
+		assertStringsEqual(t, test.change.target, change.target)
+		assertIntsEqual(t, test.change.viewers, change.viewers)
+	}
+}
+
+func TestOnHostIsCalledForHostTargetsAndNotices(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+
+	changes := make(chan hostChange, 3)
+	client := newTestClient(server.Addr)
+	client.OnHost(func(channel, target string, viewers int) {
+		changes <- hostChange{channel, target, viewers}
+	})
+	disconnected := connectAndEnsureGoodDisconnect(t, client)
+	waitForLine(t, server, "NICK")
+
+	send(t, server, ":tmi.twitch.tv HOSTTARGET #pajlada :nymn 42")
+	send(t, server, "@msg-id=host_on :tmi.twitch.tv NOTICE #pajlada :Now hosting NymN.")
+	send(t, server, "@msg-id=host_off :tmi.twitch.tv NOTICE #pajlada :Exited host mode.")
+
+	expected := []hostChange{{"pajlada", "nymn", 42}, {"pajlada", "nymn", 0}, {"pajlada", "", 0}}
+	for _, expectedChange := range expected {
+		select {
+		case change := <-changes:
+			assertStringsEqual(t, expectedChange.channel, change.channel)
+			assertStringsEqual(t, expectedChange.target, change.target)
+			assertIntsEqual(t, expectedChange.viewers, change.viewers)
+		case <-time.After(time.Second * 3):
+			t.Fatal("OnHost not called")
+		}
+	}
+
+	client.Disconnect()
+	<-disconnected
+}
@@ -0,0 +1,129 @@
+package twitch
+
+import (
+	"sync"
+	"time"
+)
+
+// channelIdle is the payload of the channelIdleEvent, id is the HandlerID of the watch that fired
+type channelIdle struct {
+	id      HandlerID
+	channel string
+}
+
+// idleWatch is a timer of OnChannelIdle, it's armed while the channel is joined and no message was seen for after
+type idleWatch struct {
+	channel string
+	after   time.Duration
+	fire    func()
+	timer   *time.Timer
+}
+
+// idleTimers keeps the watches of OnChannelIdle. Shards of a ShardedClient share the timers like their handlers,
+// so a message read by any shard resets the timers of its channel
+type idleTimers struct {
+	mutex   sync.Mutex
+	watches map[HandlerID]*idleWatch
+}
+
+func newIdleTimers() *idleTimers {
+	return &idleTimers{
+		watches: map[HandlerID]*idleWatch{},
+	}
+}
+
+// add adds a watch, its timer is armed right away if armed is true and otherwise by the next touch of the channel
+func (t *idleTimers) add(id HandlerID, channel string, after time.Duration, fire func(), armed bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	watch := &idleWatch{
+		channel: channel,
+		after:   after,
+		fire:    fire,
+	}
+	t.watches[id] = watch
+
+	if armed {
+		t.arm(watch)
+	}
+}
+
+// remove stops and removes the watch of a handler. Returns false if id isn't a watch
+func (t *idleTimers) remove(id HandlerID) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	watch, ok := t.watches[id]
+	if !ok {
+		return false
+	}
+
+	t.disarm(watch)
+	delete(t.watches, id)
+
+	return true
+}
+
+// touch restarts the timers of the channel, after a message was seen in it or the channel was joined
+func (t *idleTimers) touch(channel string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, watch := range t.watches {
+		if watch.channel == channel {
+			t.arm(watch)
+		}
+	}
+}
+
+// stop stops the timers of the channel until it's touched again, e.g. after the channel was departed
+func (t *idleTimers) stop(channel string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, watch := range t.watches {
+		if watch.channel == channel {
+			t.disarm(watch)
+		}
+	}
+}
+
+// stopAll stops the timers of all channels until they're touched again
+func (t *idleTimers) stopAll() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, watch := range t.watches {
+		t.disarm(watch)
+	}
+}
+
+// arm must be called with the mutex held. A timer fires once, the next touch arms it again
+func (t *idleTimers) arm(watch *idleWatch) {
+	t.disarm(watch)
+
+	var timer *time.Timer
+	timer = time.AfterFunc(watch.after, func() {
+		t.mutex.Lock()
+		// The timer may have fired while it was stopped or replaced
+		current := watch.timer == timer
+		if current {
+			watch.timer = nil
+		}
+		t.mutex.Unlock()
+
+		if current {
+			watch.fire()
+		}
+	})
+	watch.timer = timer
+}
+
+// disarm must be called with the mutex held
+func (t *idleTimers) disarm(watch *idleWatch) {
+	if watch.timer != nil {
+		watch.timer.Stop()
+		watch.timer = nil
+	}
+}
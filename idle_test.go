@@ -0,0 +1,94 @@
+package twitch
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+// replayPipe replays the lines written to the returned writer, Replay returns once the writer is closed
+func replayPipe(t *testing.T, client *Client) *io.PipeWriter {
+	reader, writer := io.Pipe()
+
+	replayed := make(chan error)
+	go func() {
+		replayed <- client.Replay(reader)
+	}()
+
+	t.Cleanup(func() {
+		writer.Close()
+		<-replayed
+	})
+
+	return writer
+}
+
+func TestCanNotifyChannelIdle(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123123")
+
+	idle := make(chan string, 10)
+	client.OnChannelIdle("#Pajlada", time.Millisecond*50, func(channel string) {
+		idle <- channel
+	})
+
+	writer := replayPipe(t, client)
+	_, _ = io.WriteString(writer, ":tmi.twitch.tv 001 justinfan123123 :Welcome, GLHF!\r\n"+
+		":justinfan123123!justinfan123123@justinfan123123.tmi.twitch.tv JOIN #pajlada\r\n")
+
+	select {
+	case channel := <-idle:
+		assertStringsEqual(t, "pajlada", channel)
+	case <-time.After(time.Second * 3):
+		t.Fatal("no idle callback after joining a quiet channel")
+	}
+
+	// The callback is called once per quiet period, a message starts the timer again
+	_, _ = io.WriteString(writer, ":gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :hello\r\n")
+
+	select {
+	case channel := <-idle:
+		assertStringsEqual(t, "pajlada", channel)
+	case <-time.After(time.Second * 3):
+		t.Fatal("no idle callback after the channel went quiet again")
+	}
+}
+
+func TestDepartStopsChannelIdleTimer(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123123")
+
+	idle := make(chan string, 10)
+	client.OnChannelIdle("pajlada", time.Millisecond*100, func(channel string) {
+		idle <- channel
+	})
+	removed := client.OnChannelIdle("gempir", time.Millisecond*100, func(channel string) {
+		idle <- channel
+	})
+	assertTrue(t, client.RemoveHandler(removed), "idle handler wasn't removed")
+
+	joined := make(chan struct{}, 2)
+	client.OnSelfJoinMessage(func(message UserJoinMessage) {
+		joined <- struct{}{}
+	})
+
+	writer := replayPipe(t, client)
+	_, _ = io.WriteString(writer, ":tmi.twitch.tv 001 justinfan123123 :Welcome, GLHF!\r\n"+
+		":justinfan123123!justinfan123123@justinfan123123.tmi.twitch.tv JOIN #pajlada\r\n"+
+		":justinfan123123!justinfan123123@justinfan123123.tmi.twitch.tv JOIN #gempir\r\n")
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-joined:
+		case <-time.After(time.Second * 3):
+			t.Fatal("channels weren't joined")
+		}
+	}
+	assertErrorsEqual(t, nil, client.Depart("pajlada"))
+
+	select {
+	case channel := <-idle:
+		t.Fatal("idle callback called for " + channel)
+	case <-time.After(time.Millisecond * 300):
+	}
+}
@@ -2,72 +2,108 @@ package twitch
 
 import (
 	"fmt"
-	"regexp"
+	"sort"
 	"strings"
 )
 
 // Maximum supported length of an irc message
 const maxMessageLength = 510
 
-type ircMessage struct {
-	Raw     string
+// IRCMessage is a generic IRC line split into its parts, without any Twitch specific parsing.
+// Use it to parse commands this library doesn't know
+type IRCMessage struct {
+	Raw string
+	// Tags are the IRCv3 message tags, with their values unescaped. Tags without a value are empty strings
 	Tags    map[string]string
-	Source  ircMessageSource
+	Source  IRCMessageSource
 	Command string
-	Params  []string
+	// Params include the trailing param as the last element, without its leading ":"
+	Params []string
+	// HasTrailing reports whether the last param was a trailing param, which may be empty or contain spaces
+	HasTrailing bool
+
+	// options are the ParseOptions of the message parsers
+	options ParseOptions
+}
+
+// param returns the parameter at the given index, or an empty string if the line has fewer parameters
+func (m *IRCMessage) param(index int) string {
+	if index < len(m.Params) {
+		return m.Params[index]
+	}
+
+	return ""
 }
 
-type ircMessageSource struct {
-	Nickname string
-	Username string
-	Host     string
+// IRCMessageSource is the prefix of an IRC line, nickname!username@host.
+// A source without ! and @, like a server name, is stored in Host
+type IRCMessageSource struct {
+	Nickname string `json:"nickname,omitempty"`
+	Username string `json:"username,omitempty"`
+	Host     string `json:"host,omitempty"`
 }
 
-func parseIRCMessage(line string) (*ircMessage, error) {
-	message := ircMessage{
+// ParseIRCLine splits a raw IRC line into its tags, source, command and params.
+// On error the returned message is not nil, it holds the parts parsed before the line ended
+func ParseIRCLine(line string) (*IRCMessage, error) {
+	message := IRCMessage{
 		Raw:    line,
-		Tags:   make(map[string]string),
 		Params: []string{},
 	}
 
-	split := strings.Split(line, " ")
-	index := 0
+	// The line is consumed token by token, tokens are separated by a single space.
+	// This avoids splitting the (potentially long) trailing parameter into words
+	rest := line
+	hasNext := true
+	nextToken := func() string {
+		index := strings.IndexByte(rest, ' ')
+		if index < 0 {
+			token := rest
+			rest = ""
+			hasNext = false
+			return token
+		}
 
-	if strings.HasPrefix(split[index], "@") {
-		message.Tags = parseIRCTags(split[index])
-		index++
+		token := rest[:index]
+		rest = rest[index+1:]
+		return token
 	}
 
-	if index >= len(split) {
-		return &message, fmt.Errorf("parseIRCMessage: partial message")
-	}
+	token := nextToken()
 
-	if strings.HasPrefix(split[index], ":") {
-		message.Source = *parseIRCMessageSource(split[index])
-		index++
+	if strings.HasPrefix(token, "@") {
+		message.Tags = parseIRCTags(token)
+		if !hasNext {
+			return &message, fmt.Errorf("ParseIRCLine: partial message")
+		}
+		token = nextToken()
+	} else {
+		message.Tags = make(map[string]string)
 	}
 
-	if index >= len(split) {
-		return &message, fmt.Errorf("parseIRCMessage: no command")
+	if strings.HasPrefix(token, ":") {
+		message.Source = parseIRCMessageSource(token)
+		if !hasNext {
+			return &message, fmt.Errorf("ParseIRCLine: no command")
+		}
+		token = nextToken()
 	}
 
-	message.Command = split[index]
-	index++
+	message.Command = token
 
-	if index >= len(split) {
+	if !hasNext {
 		return &message, nil
 	}
 
-	var params []string
-	for i, v := range split[index:] {
-		if strings.HasPrefix(v, ":") {
-			v = strings.Join(split[index+i:], " ")
-			v = strings.TrimPrefix(v, ":")
-			params = append(params, v)
+	params := make([]string, 0, 2)
+	for hasNext {
+		if strings.HasPrefix(rest, ":") {
+			params = append(params, rest[1:])
+			message.HasTrailing = true
 			break
 		}
 
-		params = append(params, v)
+		params = append(params, nextToken())
 	}
 
 	message.Params = params
@@ -76,43 +112,42 @@ func parseIRCMessage(line string) (*ircMessage, error) {
 }
 
 func parseIRCTags(rawTags string) map[string]string {
-	tags := make(map[string]string)
-
 	rawTags = strings.TrimPrefix(rawTags, "@")
 
-	for _, tag := range strings.Split(rawTags, ";") {
-		pair := strings.SplitN(tag, "=", 2)
-		key := pair[0]
+	tags := make(map[string]string, strings.Count(rawTags, ";")+1)
+
+	for {
+		tag := rawTags
+		next := strings.IndexByte(rawTags, ';')
+		if next >= 0 {
+			tag = rawTags[:next]
+		}
 
-		var value string
-		if len(pair) == 2 {
-			value = parseIRCTagValue(pair[1])
+		// Only the first = separates the key, the value may contain more
+		key, rawValue := tag, ""
+		if index := strings.IndexByte(tag, '='); index >= 0 {
+			key, rawValue = tag[:index], tag[index+1:]
 		}
 
-		tags[key] = value
+		// Empty tags, e.g. from "@;" or "@a=1;;b=2", are skipped
+		if key != "" {
+			tags[key] = parseIRCTagValue(rawValue)
+		}
+
+		if next < 0 {
+			break
+		}
+		rawTags = rawTags[next+1:]
 	}
 
 	return tags
 }
 
-var tagEscapeCharacters = []struct {
-	from string
-	to   string
-}{
-	{`\s`, ` `},
-	{`\n`, ``},
-	{`\r`, ``},
-	{`\:`, `;`},
-	{`\\`, `\`},
-}
-
 func parseIRCTagValue(rawValue string) string {
-	for _, escape := range tagEscapeCharacters {
-		rawValue = strings.ReplaceAll(rawValue, escape.from, escape.to)
+	if strings.IndexByte(rawValue, '\\') >= 0 {
+		rawValue = unescapeIRCTagValue(rawValue)
 	}
 
-	rawValue = strings.TrimSuffix(rawValue, "\\")
-
 	// Some Twitch values can end with a trailing \s
 	// Example: "system-msg=An\sanonymous\suser\sgifted\sa\sTier\s1\ssub\sto\sTenureCalculator!\s"
 	rawValue = strings.TrimSpace(rawValue)
@@ -120,19 +155,104 @@ func parseIRCTagValue(rawValue string) string {
 	return rawValue
 }
 
-func parseIRCMessageSource(rawSource string) *ircMessageSource {
-	var source ircMessageSource
+// unescapeIRCTagValue replaces the escape sequences of a tag value in a single pass, so an escaped backslash
+// doesn't start the next sequence. Escaped line breaks and a trailing backslash are dropped, unknown sequences are kept
+func unescapeIRCTagValue(rawValue string) string {
+	var value strings.Builder
+	value.Grow(len(rawValue))
+
+	for i := 0; i < len(rawValue); i++ {
+		if rawValue[i] != '\\' {
+			value.WriteByte(rawValue[i])
+			continue
+		}
+
+		i++
+		if i == len(rawValue) {
+			break
+		}
+
+		switch rawValue[i] {
+		case 's':
+			value.WriteByte(' ')
+		case ':':
+			value.WriteByte(';')
+		case '\\':
+			value.WriteByte('\\')
+		case 'n', 'r':
+		default:
+			value.WriteByte('\\')
+			value.WriteByte(rawValue[i])
+		}
+	}
+
+	return value.String()
+}
+
+var tagValueEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`;`, `\:`,
+	` `, `\s`,
+	"\r", `\r`,
+	"\n", `\n`,
+)
+
+// escapeIRCTagValue is the inverse of parseIRCTagValue for values without line breaks and leading or trailing spaces,
+// parseIRCTagValue drops line breaks and trims the spaces Twitch adds to some values
+func escapeIRCTagValue(value string) string {
+	return tagValueEscaper.Replace(value)
+}
+
+// EscapeTagValue escapes a value for the tags of a raw IRC line, useful when building lines with your own tags.
+// Spaces, semicolons, backslashes and line breaks are replaced by their IRCv3 escape sequences
+func EscapeTagValue(value string) string {
+	return escapeIRCTagValue(value)
+}
+
+// formatIRCTags formats tags sorted by key, including the leading @
+func formatIRCTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var formatted strings.Builder
+	formatted.WriteByte('@')
+	for i, key := range keys {
+		if i > 0 {
+			formatted.WriteByte(';')
+		}
+		formatted.WriteString(key)
+		formatted.WriteByte('=')
+		formatted.WriteString(escapeIRCTagValue(tags[key]))
+	}
+
+	return formatted.String()
+}
+
+func parseIRCMessageSource(rawSource string) IRCMessageSource {
+	var source IRCMessageSource
 
 	rawSource = strings.TrimPrefix(rawSource, ":")
 
-	regex := regexp.MustCompile(`!|@`)
-	split := regex.Split(rawSource, -1)
+	// Split the source at every ! and @, only the first three parts are used
+	var split [3]string
+	parts := 0
+	for parts < len(split) {
+		index := strings.IndexAny(rawSource, "!@")
+		if index < 0 {
+			split[parts] = rawSource
+			parts++
+			break
+		}
 
-	if len(split) == 0 {
-		return &source
+		split[parts] = rawSource[:index]
+		rawSource = rawSource[index+1:]
+		parts++
 	}
 
-	switch len(split) {
+	switch parts {
 	case 1:
 		source.Host = split[0]
 	case 2:
@@ -146,5 +266,5 @@ func parseIRCMessageSource(rawSource string) *ircMessageSource {
 		source.Host = split[2]
 	}
 
-	return &source
+	return source
 }
@@ -4,12 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"strings"
 	"testing"
 )
 
 type ircTest struct {
 	Input    string
-	Expected ircMessage
+	Expected IRCMessage
 }
 
 func ircTests() ([]*ircTest, error) {
@@ -37,7 +38,7 @@ func TestCanParseIRCMessage(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		actual, err := parseIRCMessage(test.Input)
+		actual, err := ParseIRCLine(test.Input)
 		if err != nil {
 			t.Error(err)
 			continue
@@ -55,7 +56,7 @@ func TestCanParseIRCMessage(t *testing.T) {
 func TestCantParsePartialIRCMessage(t *testing.T) {
 	testMessage := "@badges=;color=;display-name=ZZZi;emotes=;flags=;id=75bb6b6b-e36c-49af-a293-16024738ab92;mod=0;room-id=36029255;subscriber=0;tmi-sent-ts=1551476573570;turbo"
 
-	actual, err := parseIRCMessage(testMessage)
+	actual, err := ParseIRCLine(testMessage)
 
 	expectedTags := map[string]string{
 		"badges":       "",
@@ -78,13 +79,13 @@ func TestCantParsePartialIRCMessage(t *testing.T) {
 	assertStringsEqual(t, "", actual.Command)
 	assertStringSlicesEqual(t, nil, actual.Params)
 
-	assertStringsEqual(t, "parseIRCMessage: partial message", err.Error())
+	assertStringsEqual(t, "ParseIRCLine: partial message", err.Error())
 }
 
 func TestCantParseNoCommandIRCMessage(t *testing.T) {
 	testMessage := "@badges=;color=#00FF7F;display-name=Danielps1;emotes=;message-id=20;thread-id=32591953_77829817;turbo=0;user-id=32591953;user-type= :danielps1!danielps1@danielps1.tmi.twitch.tv"
 
-	actual, err := parseIRCMessage(testMessage)
+	actual, err := ParseIRCLine(testMessage)
 
 	expectedTags := map[string]string{
 		"badges":       "",
@@ -105,5 +106,136 @@ func TestCantParseNoCommandIRCMessage(t *testing.T) {
 	assertStringsEqual(t, "", actual.Command)
 	assertStringSlicesEqual(t, nil, actual.Params)
 
-	assertStringsEqual(t, "parseIRCMessage: no command", err.Error())
+	assertStringsEqual(t, "ParseIRCLine: no command", err.Error())
+}
+
+func TestCanParseIRCLineTrailingParams(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in          string
+		params      []string
+		hasTrailing bool
+	}{
+		{"foo bar baz", []string{"bar", "baz"}, false},
+		{"foo bar baz :", []string{"bar", "baz", ""}, true},
+		{"foo bar baz ::asdf", []string{"bar", "baz", ":asdf"}, true},
+		{"foo :asdf quux", []string{"asdf quux"}, true},
+		{"foo", []string{}, false},
+	}
+
+	for _, test := range tests {
+		actual, err := ParseIRCLine(test.in)
+		assertErrorsEqual(t, nil, err)
+
+		assertStringSlicesEqual(t, test.params, actual.Params)
+		if actual.HasTrailing != test.hasTrailing {
+			t.Errorf("%q was parsed with HasTrailing %t, expected %t", test.in, actual.HasTrailing, test.hasTrailing)
+		}
+	}
+}
+
+func TestCanParseIRCLineWithEmptyTagValues(t *testing.T) {
+	t.Parallel()
+
+	actual, err := ParseIRCLine(`@a=;b;c=x\sy :nick!user@host.example.com PRIVMSG #channel :hi there`)
+	assertErrorsEqual(t, nil, err)
+
+	assertStringMapsEqual(t, map[string]string{"a": "", "b": "", "c": "x y"}, actual.Tags)
+	assertStringsEqual(t, "nick", actual.Source.Nickname)
+	assertStringsEqual(t, "user", actual.Source.Username)
+	assertStringsEqual(t, "host.example.com", actual.Source.Host)
+	assertStringsEqual(t, "PRIVMSG", actual.Command)
+	assertStringSlicesEqual(t, []string{"#channel", "hi there"}, actual.Params)
+	assertTrue(t, actual.HasTrailing, "trailing param was not detected")
+}
+
+func TestCanParsePathologicalIRCLines(t *testing.T) {
+	t.Parallel()
+
+	actual, err := ParseIRCLine("@;a=1;;=x;b=c=d :tmi.twitch.tv PING")
+	assertErrorsEqual(t, nil, err)
+	assertStringMapsEqual(t, map[string]string{"a": "1", "b": "c=d"}, actual.Tags)
+	assertStringsEqual(t, "PING", actual.Command)
+
+	actual, err = ParseIRCLine(":tmi.twitch.tv PING")
+	assertErrorsEqual(t, nil, err)
+	assertStringsEqual(t, "", actual.Source.Nickname)
+	assertStringsEqual(t, "", actual.Source.Username)
+	assertStringsEqual(t, "tmi.twitch.tv", actual.Source.Host)
+
+	for _, line := range []string{"@;", "@a=1;b=2", ":tmi.twitch.tv", "@a=1 :tmi.twitch.tv"} {
+		actual, err = ParseIRCLine(line)
+		assertTrue(t, err != nil, fmt.Sprintf("%q did not return an error", line))
+		assertTrue(t, actual != nil, fmt.Sprintf("%q was parsed as nil", line))
+	}
+}
+
+func TestCanEscapeTagValues(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"", ""},
+		{"plain", "plain"},
+		{"hello there", `hello\sthere`},
+		{"a;b", `a\:b`},
+		{`a\b`, `a\\b`},
+		{"a\r\nb", `a\r\nb`},
+		{`look at this; C:\drive`, `look\sat\sthis\:\sC:\\drive`},
+	}
+
+	for _, test := range tests {
+		escaped := EscapeTagValue(test.in)
+		assertStringsEqual(t, test.expected, escaped)
+
+		if !strings.ContainsAny(test.in, "\r\n") {
+			assertStringsEqual(t, test.in, parseIRCTagValue(escaped))
+		}
+	}
+}
+
+func TestEscapedTagValuesRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	values := []string{
+		"",
+		"plain",
+		"hello there",
+		"a;b",
+		`a\b`,
+		// Backslashes followed by the characters of escape sequences aren't unescaped twice
+		`\s`,
+		`\:`,
+		`\\`,
+		`a\ b`,
+		`look at this; C:\drive`,
+	}
+
+	for _, value := range values {
+		assertStringsEqual(t, value, parseIRCTagValue(escapeIRCTagValue(value)))
+	}
+}
+
+func TestCanUnescapeTagValues(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{`hello\sthere`, "hello there"},
+		{`a\:b`, "a;b"},
+		{`a\\sb`, `a\sb`},
+		{`line\r\nbreak`, "linebreak"},
+		{`unknown\a`, `unknown\a`},
+		{`trailing\`, "trailing"},
+		{`trailing\sspace\s`, "trailing space"},
+	}
+
+	for _, test := range tests {
+		assertStringsEqual(t, test.expected, parseIRCTagValue(test.in))
+	}
 }
@@ -0,0 +1,117 @@
+package twitch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MarshalJSON encodes the MessageType as its name like String, e.g. "PRIVMSG" or "UNSET(42)" for unknown values
+func (t MessageType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+// UnmarshalJSON decodes a MessageType from its name or the "UNSET(<n>)" form of String,
+// or from its number for backwards compatibility
+func (t *MessageType) UnmarshalJSON(data []byte) error {
+	var number int
+	if err := json.Unmarshal(data, &number); err == nil {
+		*t = MessageType(number)
+		return nil
+	}
+
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+
+	messageType, ok := messageTypesByName[name]
+	if !ok {
+		number, err := parseUnsetMessageType(name)
+		if err != nil {
+			return err
+		}
+		messageType = number
+	}
+
+	*t = messageType
+	return nil
+}
+
+// parseUnsetMessageType parses the "UNSET(<n>)" name String returns for unknown values
+func parseUnsetMessageType(name string) (MessageType, error) {
+	if !strings.HasPrefix(name, "UNSET(") || !strings.HasSuffix(name, ")") {
+		return UNSET, fmt.Errorf("unknown MessageType %q", name)
+	}
+
+	number, err := strconv.Atoi(name[len("UNSET(") : len(name)-1])
+	if err != nil {
+		return UNSET, fmt.Errorf("unknown MessageType %q", name)
+	}
+
+	return MessageType(number), nil
+}
+
+// MarshalJSON omits the Time of the message when it's not set
+func (msg PrivateMessage) MarshalJSON() ([]byte, error) {
+	type privateMessage PrivateMessage
+
+	return json.Marshal(struct {
+		privateMessage
+		Time *time.Time `json:"time,omitempty"`
+	}{privateMessage(msg), jsonTime(msg.Time)})
+}
+
+// MarshalJSON omits the Time of the message when it's not set
+func (msg ClearChatMessage) MarshalJSON() ([]byte, error) {
+	type clearChatMessage ClearChatMessage
+
+	return json.Marshal(struct {
+		clearChatMessage
+		Time *time.Time `json:"time,omitempty"`
+	}{clearChatMessage(msg), jsonTime(msg.Time)})
+}
+
+// MarshalJSON omits the Time of the message when it's not set
+func (msg UserNoticeMessage) MarshalJSON() ([]byte, error) {
+	type userNoticeMessage UserNoticeMessage
+
+	return json.Marshal(struct {
+		userNoticeMessage
+		Time *time.Time `json:"time,omitempty"`
+	}{userNoticeMessage(msg), jsonTime(msg.Time)})
+}
+
+// jsonTime returns nil for the zero time, and the time in UTC otherwise
+func jsonTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	utc := t.UTC()
+	return &utc
+}
+
+// MarshalCompactJSON encodes a message like json.Marshal, but without the Raw and Tags fields.
+// The typed fields of a message already contain the data of the tags
+func MarshalCompactJSON(message Message) ([]byte, error) {
+	value := reflect.ValueOf(message)
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+
+	compact := reflect.New(value.Type()).Elem()
+	compact.Set(value)
+
+	for _, name := range []string{"Raw", "Tags"} {
+		field := compact.FieldByName(name)
+		if field.IsValid() && field.CanSet() {
+			field.Set(reflect.Zero(field.Type()))
+		}
+	}
+
+	return json.Marshal(compact.Interface())
+}
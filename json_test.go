@@ -0,0 +1,138 @@
+package twitch
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update-golden", false, "update the golden files in test_resources/golden")
+
+func assertGolden(t *testing.T, name string, actual []byte) {
+	path := "test_resources/golden/" + name
+
+	if *updateGolden {
+		if err := os.WriteFile(path, actual, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertStringsEqual(t, string(expected), string(actual))
+}
+
+func indentJSON(t *testing.T, data []byte) []byte {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	indented.WriteByte('\n')
+
+	return indented.Bytes()
+}
+
+func TestCanMarshalPRIVMSGMessageToJSON(t *testing.T) {
+	t.Parallel()
+	testMessage := "@badge-info=subscriber/6;badges=subscriber/6,premium/1;color=#FF0000;display-name=Redflamingo13;emotes=25:0-4,44-48;first-msg=0;id=2a31a9df-d6ff-4840-b211-a2547c7e656e;mod=0;room-id=11148817;subscriber=1;tmi-sent-ts=1490382457309;turbo=0;user-id=78424343;user-type= :redflamingo13!redflamingo13@redflamingo13.tmi.twitch.tv PRIVMSG #pajlada :Kappa Thrashh5, FeelsWayTooAmazingMan kinda Kappa"
+
+	message := ParseMessage(testMessage)
+
+	data, err := json.Marshal(message)
+	assertErrorsEqual(t, nil, err)
+	assertGolden(t, "privmsg.json", indentJSON(t, data))
+
+	compact, err := MarshalCompactJSON(message)
+	assertErrorsEqual(t, nil, err)
+	assertGolden(t, "privmsg_compact.json", indentJSON(t, compact))
+}
+
+func TestCanMarshalUSERNOTICEMessageToJSON(t *testing.T) {
+	t.Parallel()
+	testMessage := `@badge-info=subscriber/34;badges=subscriber/24,premium/1;color=#1FD2FF;display-name=Karl_Kons;emotes=28087:0-6;flags=;id=7c95beea-a7ac-4c10-9e0a-d7dbf163c038;login=karl_kons;mod=0;msg-id=resub;msg-param-cumulative-months=34;msg-param-months=0;msg-param-should-share-streak=0;msg-param-sub-plan-name=look\sat\sthose\sshitty\semotes,\srip\s$5\sLUL;msg-param-sub-plan=1000;room-id=11148817;subscriber=1;system-msg=Karl_Kons\ssubscribed\sat\sTier\s1.\sThey've\ssubscribed\sfor\s34\smonths!;tmi-sent-ts=1540140252828;turbo=0;user-id=68706331;user-type= :tmi.twitch.tv USERNOTICE #pajlada :WutFace WutFace`
+
+	message := ParseMessage(testMessage)
+
+	data, err := json.Marshal(message)
+	assertErrorsEqual(t, nil, err)
+	assertGolden(t, "usernotice.json", indentJSON(t, data))
+
+	compact, err := MarshalCompactJSON(message)
+	assertErrorsEqual(t, nil, err)
+	assertGolden(t, "usernotice_compact.json", indentJSON(t, compact))
+}
+
+func TestCanUnmarshalMessagesFromJSON(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		file    string
+		message interface{}
+	}{
+		{"privmsg.json", &PrivateMessage{}},
+		{"usernotice.json", &UserNoticeMessage{}},
+	}
+
+	for _, test := range tests {
+		data, err := os.ReadFile("test_resources/golden/" + test.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertErrorsEqual(t, nil, json.Unmarshal(data, test.message))
+
+		remarshaled, err := json.Marshal(test.message)
+		assertErrorsEqual(t, nil, err)
+		assertStringsEqual(t, string(data), string(indentJSON(t, remarshaled)))
+	}
+}
+
+func TestJSONOmitsUnsetTime(t *testing.T) {
+	t.Parallel()
+
+	data, err := json.Marshal(&PrivateMessage{Type: PRIVMSG, Message: "hello"})
+	assertErrorsEqual(t, nil, err)
+	assertFalse(t, strings.Contains(string(data), `"time"`), "unset time was marshaled")
+}
+
+func TestCanMarshalMessageTypeToJSON(t *testing.T) {
+	t.Parallel()
+
+	data, err := json.Marshal(NAMES)
+	assertErrorsEqual(t, nil, err)
+	assertStringsEqual(t, `"NAMES"`, string(data))
+
+	var messageType MessageType
+	assertErrorsEqual(t, nil, json.Unmarshal([]byte(`"CLEARMSG"`), &messageType))
+	assertMessageTypesEqual(t, CLEARMSG, messageType)
+
+	assertErrorsEqual(t, nil, json.Unmarshal([]byte(`1`), &messageType))
+	assertMessageTypesEqual(t, PRIVMSG, messageType)
+
+	assertTrue(t, json.Unmarshal([]byte(`"NOPE"`), &messageType) != nil, "unknown MessageType was unmarshaled")
+	assertTrue(t, json.Unmarshal([]byte(`"UNSET(x)"`), &messageType) != nil, "invalid UNSET MessageType was unmarshaled")
+}
+
+func TestCanMarshalUnknownMessageTypeToJSON(t *testing.T) {
+	t.Parallel()
+
+	unknown := MessageType(42)
+
+	data, err := json.Marshal(unknown)
+	assertErrorsEqual(t, nil, err)
+	assertStringsEqual(t, `"`+unknown.String()+`"`, string(data))
+
+	var messageType MessageType
+	assertErrorsEqual(t, nil, json.Unmarshal(data, &messageType))
+	assertMessageTypesEqual(t, unknown, messageType)
+
+	data, err = json.Marshal(&PrivateMessage{Type: unknown, Message: "hello"})
+	assertErrorsEqual(t, nil, err)
+	assertTrue(t, strings.Contains(string(data), `"UNSET(42)"`), "unknown MessageType of a message wasn't marshaled")
+}
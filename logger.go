@@ -0,0 +1,96 @@
+package twitch
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Logger receives the log messages of the client about its internal events, like reconnects and dropped messages, see SetLogger.
+// The methods are called from the go-routines of the client, so they must be safe for concurrent use
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// LogLevel is the severity of a log message. The values match the levels of log/slog
+type LogLevel int
+
+const (
+	// LogLevelDebug is used for every line sent, and other details only useful while debugging
+	LogLevelDebug LogLevel = -4
+	// LogLevelInfo is used for connecting and reconnecting
+	LogLevelInfo LogLevel = 0
+	// LogLevelWarn is used for problems the client recovers from, like dropped messages and lines it can't parse
+	LogLevelWarn LogLevel = 4
+	// LogLevelError is used for problems the client doesn't recover from, like a failed login, and panics in callbacks
+	LogLevelError LogLevel = 8
+)
+
+// String returns the name of the level, e.g. "WARN"
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelDebug:
+		return "DEBUG"
+	case LogLevelInfo:
+		return "INFO"
+	case LogLevelWarn:
+		return "WARN"
+	case LogLevelError:
+		return "ERROR"
+	}
+
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// LoggerFunc is a Logger that passes every formatted log message to the function, which makes adapting other loggers short:
+//
+//	client.SetLogger(twitch.LoggerFunc(func(level twitch.LogLevel, message string) {
+//		slog.Log(context.Background(), slog.Level(level), message)
+//	}))
+type LoggerFunc func(level LogLevel, message string)
+
+// Debugf implements the Logger interface
+func (f LoggerFunc) Debugf(format string, args ...interface{}) {
+	f(LogLevelDebug, fmt.Sprintf(format, args...))
+}
+
+// Infof implements the Logger interface
+func (f LoggerFunc) Infof(format string, args ...interface{}) {
+	f(LogLevelInfo, fmt.Sprintf(format, args...))
+}
+
+// Warnf implements the Logger interface
+func (f LoggerFunc) Warnf(format string, args ...interface{}) {
+	f(LogLevelWarn, fmt.Sprintf(format, args...))
+}
+
+// Errorf implements the Logger interface
+func (f LoggerFunc) Errorf(format string, args ...interface{}) {
+	f(LogLevelError, fmt.Sprintf(format, args...))
+}
+
+// NoopLogger is a Logger that discards all log messages, the default of every client
+type NoopLogger struct{}
+
+// Debugf implements the Logger interface
+func (NoopLogger) Debugf(format string, args ...interface{}) {}
+
+// Infof implements the Logger interface
+func (NoopLogger) Infof(format string, args ...interface{}) {}
+
+// Warnf implements the Logger interface
+func (NoopLogger) Warnf(format string, args ...interface{}) {}
+
+// Errorf implements the Logger interface
+func (NoopLogger) Errorf(format string, args ...interface{}) {}
+
+// redactLine hides the oauth token of a PASS line, so it doesn't end up in logs
+func redactLine(line string) string {
+	if strings.HasPrefix(line, "PASS ") {
+		return "PASS <redacted>"
+	}
+
+	return line
+}
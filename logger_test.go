@@ -0,0 +1,112 @@
+package twitch
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingLogger keeps every log message, formatted as "LEVEL message"
+type recordingLogger struct {
+	mutex    sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) log(level LogLevel, message string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.messages = append(l.messages, level.String()+" "+message)
+}
+
+func (l *recordingLogger) contains(message string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, logged := range l.messages {
+		if logged == message {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (l *recordingLogger) containsSubstring(substring string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, logged := range l.messages {
+		if strings.Contains(logged, substring) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestLoggerFuncFormatsMessages(t *testing.T) {
+	t.Parallel()
+
+	logger := &recordingLogger{}
+	var l Logger = LoggerFunc(logger.log)
+	l.Debugf("a %d", 1)
+	l.Infof("b %s", "x")
+	l.Warnf("c")
+	l.Errorf("d %v", true)
+
+	assertStringSlicesEqual(t, []string{"DEBUG a 1", "INFO b x", "WARN c", "ERROR d true"}, logger.messages)
+	assertStringsEqual(t, "LogLevel(2)", LogLevel(2).String())
+}
+
+func TestRedactsOauthToken(t *testing.T) {
+	t.Parallel()
+
+	assertStringsEqual(t, "PASS <redacted>", redactLine("PASS oauth:123123132"))
+	assertStringsEqual(t, "NICK justinfan123123", redactLine("NICK justinfan123123"))
+}
+
+func TestClientLogsInternalEvents(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+
+	logger := &recordingLogger{}
+	panicked := make(chan struct{})
+	client := newTestClient(server.Addr)
+	client.SetLogger(LoggerFunc(logger.log))
+	client.OnHandlerPanic(func(message Message, recovered interface{}, stack []byte) {
+		close(panicked)
+	})
+	client.OnPrivateMessage(func(message PrivateMessage) {
+		panic("oops")
+	})
+	disconnected := connectAndEnsureGoodDisconnect(t, client)
+
+	waitForLine(t, server, "NICK")
+	send(t, server, "@badges= :tmi.twitch.tv")
+	send(t, server, ":gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #gempir :hello")
+
+	select {
+	case <-panicked:
+	case <-time.After(time.Second * 3):
+		t.Fatal("callback did not panic")
+	}
+	client.Disconnect()
+	<-disconnected
+
+	for _, expected := range []string{
+		"INFO connecting to " + server.Addr,
+		"DEBUG sending PASS <redacted>",
+		"DEBUG sending NICK justinfan123123",
+		"INFO logged in to " + server.Addr + " as justinfan123123",
+		"INFO capabilities acknowledged: twitch.tv/tags twitch.tv/commands",
+		fmt.Sprintf("WARN failed to parse line %q: ParseIRCLine: no command", "@badges= :tmi.twitch.tv"),
+		"INFO disconnected from " + server.Addr,
+	} {
+		assertTrue(t, logger.contains(expected), "not logged: "+expected)
+	}
+	assertTrue(t, logger.containsSubstring("ERROR recovered panic in callback: oops"), "panic was not logged")
+	assertFalse(t, logger.containsSubstring("oauth:123123132"), "oauth token was logged")
+}
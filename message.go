@@ -1,15 +1,21 @@
 package twitch
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf16"
+	"unicode/utf8"
 )
 
 // ADDING A NEW MESSAGE TYPE:
 // 1. Add the message type at the bottom of the MessageType "const enum", with a unique index
 // 2. Add a function at the bottom of file in the "parseXXXMessage" format, that parses your message type and returns a Message
-// 3. Register the message into the map in the init function, specifying the message type value and the parser you just made
+// 3. Register the message into the map in the init function, specifying the message type value, its name and the parser you just made
 
 // MessageType different message types possible to receive via IRC
 type MessageType int
@@ -49,47 +55,85 @@ const (
 	CLEARMSG MessageType = 13
 	// GLOBALUSERSTATE On successful login, provides data about the current logged-in user through IRC tags
 	GLOBALUSERSTATE MessageType = 14
+	// END_OF_NAMES (or 366 https://www.alien.net.au/irc/irc2numerics.html#366) is sent after the NAMES messages of a channel.
+	// The client merges the NAMES messages of a channel and passes them to OnNamesMessage once the END_OF_NAMES message arrives
+	END_OF_NAMES MessageType = 15
 )
 
 type messageTypeDescription struct {
-	Type   MessageType
-	Parser func(*ircMessage) Message
+	Type MessageType
+	// Name is the name of the MessageType, which is the command of the message except for NAMES and END_OF_NAMES
+	Name   string
+	Parser func(*IRCMessage) Message
 }
 
 var messageTypeMap map[string]messageTypeDescription
 
+// messageTypeNames and messageTypesByName map the message types to their names, built from messageTypeMap
+var (
+	messageTypeNames   map[MessageType]string
+	messageTypesByName map[string]MessageType
+)
+
 func init() {
 	messageTypeMap = map[string]messageTypeDescription{
-		"WHISPER":         {WHISPER, parseWhisperMessage},
-		"PRIVMSG":         {PRIVMSG, parsePrivateMessage},
-		"CLEARCHAT":       {CLEARCHAT, parseClearChatMessage},
-		"ROOMSTATE":       {ROOMSTATE, parseRoomStateMessage},
-		"USERNOTICE":      {USERNOTICE, parseUserNoticeMessage},
-		"USERSTATE":       {USERSTATE, parseUserStateMessage},
-		"NOTICE":          {NOTICE, parseNoticeMessage},
-		"JOIN":            {JOIN, parseUserJoinMessage},
-		"PART":            {PART, parseUserPartMessage},
-		"RECONNECT":       {RECONNECT, parseReconnectMessage},
-		"353":             {NAMES, parseNamesMessage},
-		"PING":            {PING, parsePingMessage},
-		"PONG":            {PONG, parsePongMessage},
-		"CLEARMSG":        {CLEARMSG, parseClearMessage},
-		"GLOBALUSERSTATE": {GLOBALUSERSTATE, parseGlobalUserStateMessage},
+		"WHISPER":         {WHISPER, "WHISPER", parseWhisperMessage},
+		"PRIVMSG":         {PRIVMSG, "PRIVMSG", parsePrivateMessage},
+		"CLEARCHAT":       {CLEARCHAT, "CLEARCHAT", parseClearChatMessage},
+		"ROOMSTATE":       {ROOMSTATE, "ROOMSTATE", parseRoomStateMessage},
+		"USERNOTICE":      {USERNOTICE, "USERNOTICE", parseUserNoticeMessage},
+		"USERSTATE":       {USERSTATE, "USERSTATE", parseUserStateMessage},
+		"NOTICE":          {NOTICE, "NOTICE", parseNoticeMessage},
+		"JOIN":            {JOIN, "JOIN", parseUserJoinMessage},
+		"PART":            {PART, "PART", parseUserPartMessage},
+		"RECONNECT":       {RECONNECT, "RECONNECT", parseReconnectMessage},
+		"353":             {NAMES, "NAMES", parseNamesMessage},
+		"366":             {END_OF_NAMES, "END_OF_NAMES", parseEndOfNamesMessage},
+		"PING":            {PING, "PING", parsePingMessage},
+		"PONG":            {PONG, "PONG", parsePongMessage},
+		"CLEARMSG":        {CLEARMSG, "CLEARMSG", parseClearMessage},
+		"GLOBALUSERSTATE": {GLOBALUSERSTATE, "GLOBALUSERSTATE", parseGlobalUserStateMessage},
+	}
+
+	messageTypeNames = map[MessageType]string{UNSET: "UNSET"}
+	messageTypesByName = map[string]MessageType{"UNSET": UNSET}
+	for _, description := range messageTypeMap {
+		messageTypeNames[description.Type] = description.Name
+		messageTypesByName[description.Name] = description.Type
+	}
+}
+
+// String returns the name of the MessageType, e.g. "PRIVMSG", or "UNSET(<n>)" for unknown values
+func (t MessageType) String() string {
+	if name, ok := messageTypeNames[t]; ok {
+		return name
 	}
+
+	return fmt.Sprintf("UNSET(%d)", int(t))
+}
+
+// MessageTypeFromString returns the MessageType of a name returned by MessageType.String, e.g. "PRIVMSG".
+// The IRC command of a message type is accepted as well, e.g. "353" for NAMES. Returns UNSET for unknown names
+func MessageTypeFromString(name string) MessageType {
+	if messageType, ok := messageTypesByName[name]; ok {
+		return messageType
+	}
+
+	return parseMessageType(name)
 }
 
 // EmotePosition is a single position of an emote to be used for text replacement.
 type EmotePosition struct {
-	Start int
-	End   int
+	Start int `json:"start"`
+	End   int `json:"end"`
 }
 
 // Emote twitch emotes
 type Emote struct {
-	Name      string
-	ID        string
-	Count     int
-	Positions []EmotePosition
+	Name      string          `json:"name"`
+	ID        string          `json:"id"`
+	Count     int             `json:"count,omitempty"`
+	Positions []EmotePosition `json:"positions,omitempty"`
 }
 
 // ParseMessage parse a raw Twitch IRC message
@@ -97,18 +141,96 @@ func ParseMessage(line string) Message {
 	// Uncomment this and recoverMessage if debugging a message that crashes the parser
 	// defer recoverMessage(line)
 
-	ircMessage, err := parseIRCMessage(line)
+	message, _ := parseMessage(line, 0)
+	return message
+}
+
+// ParseMessageErr parse a raw Twitch IRC message like ParseMessage, and also return the error of lines that aren't valid IRC.
+// The message is a best-effort RawMessage for those lines, while a valid line with an unknown command is a RawMessage without an error
+func ParseMessageErr(line string) (Message, error) {
+	return parseMessage(line, 0)
+}
+
+// ParseOptions turn off parsing fields that are expensive to parse, for programs that don't use them.
+// The raw values of skipped fields stay available in the Tags of the message
+type ParseOptions int
+
+const (
+	// SkipEmotes leaves the Emotes of messages empty, the raw value is in the "emotes" tag
+	SkipEmotes ParseOptions = 1 << iota
+	// SkipBadges leaves the Badges of users and the SourceBadges of messages empty, the raw values are in the "badges" and "source-badges" tags
+	SkipBadges
+)
+
+// ParseMessageWithOptions parse a raw Twitch IRC message, without parsing the fields turned off by the options
+func ParseMessageWithOptions(line string, options ParseOptions) Message {
+	message, _ := parseMessage(line, options)
+	return message
+}
+
+// parseMessage returns the error of lines that aren't valid IRC, next to their RawMessage
+func parseMessage(line string, options ParseOptions) (Message, error) {
+	message, err := ParseIRCLine(line)
 	if err != nil {
-		return parseRawMessage(ircMessage)
+		return parseRawMessage(message), err
 	}
 
-	if mt, ok := messageTypeMap[ircMessage.Command]; ok {
-		return mt.Parser(ircMessage)
+	message.options = options
+
+	if mt, ok := messageTypeMap[message.Command]; ok {
+		return mt.Parser(message), nil
 	}
 
-	return parseRawMessage(ircMessage)
+	return parseRawMessage(message), nil
+}
+
+// ParseMessageTyped parse a raw Twitch IRC message, and return its type next to the message.
+// Useful for routing messages with a switch on the MessageType instead of the concrete message struct
+func ParseMessageTyped(line string) (MessageType, Message) {
+	message := ParseMessage(line)
+
+	return message.GetType(), message
+}
+
+// ParseMessages parses every line read from the reader, e.g. a chat log, and calls fn with each message.
+// Lines may end with \n or \r\n, empty lines are skipped and lines of any length are supported.
+// Lines that aren't valid IRC are passed as a RawMessage together with their error, and parsing continues.
+// Return false from fn to stop parsing. The returned error is the read error of the reader, if any
+func ParseMessages(r io.Reader, fn func(message Message, err error) bool) error {
+	reader := bufio.NewReaderSize(r, parseMessagesBufferSize)
+	var line []byte
+
+	for {
+		fragment, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		// Lines longer than the buffer are read in fragments, which are joined in the reused line buffer
+		if isPrefix || len(line) > 0 {
+			line = append(line, fragment...)
+			if isPrefix {
+				continue
+			}
+			fragment = line
+		}
+
+		if len(fragment) > 0 {
+			if !fn(parseMessage(string(fragment), 0)) {
+				return nil
+			}
+		}
+
+		line = line[:0]
+	}
 }
 
+// parseMessagesBufferSize is the size of the read buffer of ParseMessages, most lines fit into it
+const parseMessagesBufferSize = 64 * 1024
+
 // func recoverMessage(line string) {
 // 	if err := recover(); err != nil {
 // 		log.Println(line)
@@ -118,6 +240,26 @@ func ParseMessage(line string) Message {
 // }
 
 // parseMessageType parses a message type from an irc COMMAND string
+// rawCommands are the commands Twitch is known to send that are parsed into a RawMessage on purpose,
+// like the welcome numerics and the answer to CAP REQ
+var rawCommands = map[string]bool{
+	"001":        true,
+	"002":        true,
+	"003":        true,
+	"004":        true,
+	"372":        true,
+	"375":        true,
+	"376":        true,
+	"421":        true,
+	"CAP":        true,
+	"HOSTTARGET": true,
+}
+
+// isUnknownCommand returns whether a RawMessage is of a command the library doesn't know about
+func isUnknownCommand(rawType string) bool {
+	return !rawCommands[rawType]
+}
+
 func parseMessageType(messageType string) MessageType {
 	if mt, ok := messageTypeMap[messageType]; ok {
 		return mt.Type
@@ -126,58 +268,130 @@ func parseMessageType(messageType string) MessageType {
 	return UNSET
 }
 
-func parseUser(message *ircMessage) User {
+func parseUser(message *IRCMessage) User {
 	user := User{
 		ID:          message.Tags["user-id"],
-		Name:        message.Source.Username,
+		Name:        parseLogin(message),
 		DisplayName: message.Tags["display-name"],
 		Color:       message.Tags["color"],
-		Badges:      make(map[string]int),
+		// Twitch sometimes sends the tag with a trailing space
+		UserType: UserType(strings.TrimSpace(message.Tags["user-type"])),
+		Turbo:    message.Tags["turbo"] == "1",
 	}
 
-	if rawBadges := message.Tags["badges"]; rawBadges != "" {
-		user.Badges = parseBadges(rawBadges)
+	if message.options&SkipBadges == 0 {
+		if rawBadges := message.Tags["badges"]; rawBadges != "" {
+			user.Badges = parseBadges(rawBadges)
+		} else {
+			user.Badges = make(map[string]int)
+		}
 	}
 
-	// USERSTATE doesn't contain a Username, but it does have a display-name tag
+	// USERSTATE doesn't contain a login, but it does have a display-name tag. This is the last resort,
+	// localized display names, e.g. in Japanese, have nothing in common with the login, so Name is left empty for them
 	if user.Name == "" && user.DisplayName != "" {
-		user.Name = strings.ToLower(user.DisplayName)
-		user.Name = strings.Replace(user.Name, " ", "", 1)
+		name := strings.ToLower(strings.Join(strings.Fields(user.DisplayName), ""))
+		if isLogin(name) {
+			user.Name = name
+		}
 	}
 
 	return user
 }
 
+// parseLogin returns the login of the user that sent the message. USERNOTICE messages are sent by tmi.twitch.tv and
+// carry the login in the login tag, servers with the IRCv3 account-tag capability send it in the account tag
+func parseLogin(message *IRCMessage) string {
+	if login := message.Tags["login"]; login != "" {
+		return login
+	}
+	if account := message.Tags["account"]; account != "" {
+		return account
+	}
+
+	return message.Source.Username
+}
+
+// isLogin reports whether name only contains the characters allowed in a Twitch login, a-z, 0-9 and _
+func isLogin(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for i := 0; i < len(name); i++ {
+		char := name[i]
+		if (char < 'a' || char > 'z') && (char < '0' || char > '9') && char != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
 func parseBadges(rawBadges string) map[string]int {
-	badges := make(map[string]int)
+	badges := make(map[string]int, strings.Count(rawBadges, ",")+1)
+
+	for {
+		badge := rawBadges
+		next := strings.IndexByte(rawBadges, ',')
+		if next >= 0 {
+			badge = rawBadges[:next]
+		}
+
+		// A badge without a version, which Twitch doesn't send, is kept with version 1 like the badges that are only set or unset
+		if index := strings.IndexByte(badge, '/'); index >= 0 {
+			badges[badge[:index]], _ = strconv.Atoi(badge[index+1:])
+		} else if badge != "" {
+			badges[badge] = 1
+		}
 
-	for _, badge := range strings.Split(rawBadges, ",") {
-		pair := strings.SplitN(badge, "/", 2)
-		badges[pair[0]], _ = strconv.Atoi(pair[1])
+		if next < 0 {
+			break
+		}
+		rawBadges = rawBadges[next+1:]
 	}
 
 	return badges
 }
 
-func parseRawMessage(message *ircMessage) *RawMessage {
+// parseChannel returns the channel of a channel param, lowercase and without the leading #
+func parseChannel(param string) string {
+	return strings.ToLower(strings.TrimPrefix(param, "#"))
+}
+
+func parseRawMessage(message *IRCMessage) *RawMessage {
 	rawMessage := RawMessage{
 		Raw:     message.Raw,
 		Type:    parseMessageType(message.Command),
 		RawType: message.Command,
 		Tags:    message.Tags,
+		Params:  message.Params,
+		Source:  parseSource(message),
 	}
 
-	for i, v := range message.Params {
-		if !strings.Contains(v, "#") {
-			rawMessage.Message = strings.Join(message.Params[i:], " ")
-			break
-		}
+	if channel := message.param(0); strings.HasPrefix(channel, "#") {
+		rawMessage.Channel = parseChannel(channel)
+	}
+
+	if message.HasTrailing {
+		rawMessage.Message = message.Params[len(message.Params)-1]
 	}
 
 	return &rawMessage
 }
 
-func parseWhisperMessage(message *ircMessage) Message {
+// parseSource returns a copy of the prefix of the line, nil if the line has none
+func parseSource(message *IRCMessage) *IRCMessageSource {
+	if message.Source == (IRCMessageSource{}) {
+		return nil
+	}
+
+	source := message.Source
+
+	return &source
+}
+
+func parseWhisperMessage(message *IRCMessage) Message {
 	whisperMessage := WhisperMessage{
 		User: parseUser(message),
 
@@ -187,25 +401,29 @@ func parseWhisperMessage(message *ircMessage) Message {
 		Tags:      message.Tags,
 		MessageID: message.Tags["message-id"],
 		ThreadID:  message.Tags["thread-id"],
+		Source:    parseSource(message),
 	}
 
 	if len(message.Params) == 2 {
 		whisperMessage.Message = message.Params[1]
 	}
 
-	whisperMessage.Target = message.Params[0]
+	whisperMessage.Target = message.param(0)
 
-	if strings.Contains(whisperMessage.Message, "/me") {
-		whisperMessage.Message = strings.TrimPrefix(whisperMessage.Message, "/me")
+	whisperMessage.Message, whisperMessage.Action = parseAction(whisperMessage.Message)
+
+	// Whispers sent as an action can also arrive with a leading "/me " instead of the CTCP framing
+	if !whisperMessage.Action && strings.HasPrefix(whisperMessage.Message, "/me ") {
+		whisperMessage.Message = whisperMessage.Message[4:]
 		whisperMessage.Action = true
 	}
 
-	whisperMessage.Emotes = parseEmotes(message.Tags["emotes"], whisperMessage.Message)
+	whisperMessage.Emotes = parseMessageEmotes(message, whisperMessage.Message)
 
 	return &whisperMessage
 }
 
-func parsePrivateMessage(message *ircMessage) Message {
+func parsePrivateMessage(message *IRCMessage) Message {
 	var reply *Reply
 	if _, ok := message.Tags["reply-parent-msg-id"]; ok {
 		reply = &Reply{
@@ -229,13 +447,24 @@ func parsePrivateMessage(message *ircMessage) Message {
 		Time:           parseTime(message.Tags["tmi-sent-ts"]),
 		Reply:          reply,
 		CustomRewardID: message.Tags["custom-reward-id"],
+		ClientNonce:    message.Tags["client-nonce"],
+		EmoteOnly:      message.Tags["emote-only"] == "1",
+		MsgID:          message.Tags["msg-id"],
+		Flags:          parseFlags(message.Tags["flags"]),
+		Source:         parseSource(message),
+		SourceRoomID:   message.Tags["source-room-id"],
+		SourceID:       message.Tags["source-id"],
+	}
+
+	if rawSourceBadges := message.Tags["source-badges"]; rawSourceBadges != "" && message.options&SkipBadges == 0 {
+		privateMessage.SourceBadges = parseBadges(rawSourceBadges)
 	}
 
 	if len(message.Params) == 2 {
 		privateMessage.Message = message.Params[1]
 	}
 
-	privateMessage.Channel = strings.TrimPrefix(message.Params[0], "#")
+	privateMessage.Channel = parseChannel(message.param(0))
 
 	rawBits, ok := message.Tags["bits"]
 	if ok {
@@ -243,17 +472,13 @@ func parsePrivateMessage(message *ircMessage) Message {
 		privateMessage.Bits = bits
 	}
 
-	text := privateMessage.Message
-	if strings.HasPrefix(text, "\u0001ACTION") && strings.HasSuffix(text, "\u0001") {
-		privateMessage.Action = true
-		if len(text) == 8 {
-			privateMessage.Message = ""
-		} else {
-			privateMessage.Message = text[8 : len(text)-1]
-		}
-	}
+	privateMessage.Message, privateMessage.Action = parseAction(privateMessage.Message)
 
-	privateMessage.Emotes = parseEmotes(message.Tags["emotes"], privateMessage.Message)
+	privateMessage.Emotes = parseMessageEmotes(message, privateMessage.Message)
+
+	if privateMessage.Bits > 0 {
+		privateMessage.Cheermotes = parseCheermotes(privateMessage.Message)
+	}
 
 	firstMessage, ok := message.Tags["first-msg"]
 
@@ -264,7 +489,20 @@ func parsePrivateMessage(message *ircMessage) Message {
 	return &privateMessage
 }
 
-func parseClearChatMessage(message *ircMessage) Message {
+// parseAction strips the CTCP ACTION framing (\u0001ACTION text\u0001) of /me messages, and reports whether the text was an action
+func parseAction(text string) (string, bool) {
+	if strings.HasPrefix(text, "\u0001ACTION") && strings.HasSuffix(text, "\u0001") {
+		if len(text) == 8 {
+			return "", true
+		}
+
+		return text[8 : len(text)-1], true
+	}
+
+	return text, false
+}
+
+func parseClearChatMessage(message *IRCMessage) Message {
 	clearChatMessage := ClearChatMessage{
 		Raw:          message.Raw,
 		Type:         parseMessageType(message.Command),
@@ -273,14 +511,15 @@ func parseClearChatMessage(message *ircMessage) Message {
 		RoomID:       message.Tags["room-id"],
 		Time:         parseTime(message.Tags["tmi-sent-ts"]),
 		TargetUserID: message.Tags["target-user-id"],
+		BanReason:    message.Tags["ban-reason"],
 	}
 
-	clearChatMessage.Channel = strings.TrimPrefix(message.Params[0], "#")
+	clearChatMessage.Channel = parseChannel(message.param(0))
 
 	rawBanDuration, ok := message.Tags["ban-duration"]
 	if ok {
-		duration, _ := strconv.Atoi(rawBanDuration)
-		clearChatMessage.BanDuration = duration
+		seconds, _ := strconv.Atoi(rawBanDuration)
+		clearChatMessage.BanDuration = time.Duration(seconds) * time.Second
 	}
 
 	if len(message.Params) == 2 {
@@ -290,7 +529,7 @@ func parseClearChatMessage(message *ircMessage) Message {
 	return &clearChatMessage
 }
 
-func parseClearMessage(message *ircMessage) Message {
+func parseClearMessage(message *IRCMessage) Message {
 	clearMessage := ClearMessage{
 		Raw:         message.Raw,
 		Type:        parseMessageType(message.Command),
@@ -304,12 +543,12 @@ func parseClearMessage(message *ircMessage) Message {
 		clearMessage.Message = message.Params[1]
 	}
 
-	clearMessage.Channel = strings.TrimPrefix(message.Params[0], "#")
+	clearMessage.Channel = parseChannel(message.param(0))
 
 	return &clearMessage
 }
 
-func parseRoomStateMessage(message *ircMessage) Message {
+func parseRoomStateMessage(message *IRCMessage) Message {
 	roomStateMessage := RoomStateMessage{
 		Raw:     message.Raw,
 		Type:    parseMessageType(message.Command),
@@ -319,7 +558,7 @@ func parseRoomStateMessage(message *ircMessage) Message {
 		State:   make(map[string]int),
 	}
 
-	roomStateMessage.Channel = strings.TrimPrefix(message.Params[0], "#")
+	roomStateMessage.Channel = parseChannel(message.param(0))
 
 	stateTags := []string{"emote-only", "followers-only", "r9k", "rituals", "slow", "subs-only"}
 	for _, tag := range stateTags {
@@ -335,7 +574,7 @@ func parseRoomStateMessage(message *ircMessage) Message {
 	return &roomStateMessage
 }
 
-func parseGlobalUserStateMessage(message *ircMessage) Message {
+func parseGlobalUserStateMessage(message *IRCMessage) Message {
 	globalUserStateMessage := GlobalUserStateMessage{
 		Raw:       message.Raw,
 		Type:      parseMessageType(message.Command),
@@ -348,7 +587,7 @@ func parseGlobalUserStateMessage(message *ircMessage) Message {
 	return &globalUserStateMessage
 }
 
-func parseUserNoticeMessage(message *ircMessage) Message {
+func parseUserNoticeMessage(message *IRCMessage) Message {
 	userNoticeMessage := UserNoticeMessage{
 		User: parseUser(message),
 
@@ -368,8 +607,8 @@ func parseUserNoticeMessage(message *ircMessage) Message {
 		userNoticeMessage.Message = message.Params[1]
 	}
 
-	userNoticeMessage.Channel = strings.TrimPrefix(message.Params[0], "#")
-	userNoticeMessage.Emotes = parseEmotes(message.Tags["emotes"], userNoticeMessage.Message)
+	userNoticeMessage.Channel = parseChannel(message.param(0))
+	userNoticeMessage.Emotes = parseMessageEmotes(message, userNoticeMessage.Message)
 
 	for tag, value := range message.Tags {
 		if strings.Contains(tag, "msg-param") {
@@ -380,7 +619,7 @@ func parseUserNoticeMessage(message *ircMessage) Message {
 	return &userNoticeMessage
 }
 
-func parseUserStateMessage(message *ircMessage) Message {
+func parseUserStateMessage(message *IRCMessage) Message {
 	userStateMessage := UserStateMessage{
 		User: parseUser(message),
 
@@ -388,32 +627,33 @@ func parseUserStateMessage(message *ircMessage) Message {
 		Type:      parseMessageType(message.Command),
 		RawType:   message.Command,
 		Tags:      message.Tags,
-		Channel:   strings.TrimPrefix(message.Params[0], "#"),
+		Channel:   parseChannel(message.param(0)),
 		EmoteSets: parseEmoteSets(message),
 	}
 
 	return &userStateMessage
 }
 
-func parseNoticeMessage(message *ircMessage) Message {
+func parseNoticeMessage(message *IRCMessage) Message {
 	noticeMessage := NoticeMessage{
 		Raw:     message.Raw,
 		Type:    parseMessageType(message.Command),
 		RawType: message.Command,
 		Tags:    message.Tags,
 		MsgID:   message.Tags["msg-id"],
+		Source:  parseSource(message),
 	}
 
 	if len(message.Params) == 2 {
 		noticeMessage.Message = message.Params[1]
 	}
 
-	noticeMessage.Channel = strings.TrimPrefix(message.Params[0], "#")
+	noticeMessage.Channel = parseChannel(message.param(0))
 
 	return &noticeMessage
 }
 
-func parseUserJoinMessage(message *ircMessage) Message {
+func parseUserJoinMessage(message *IRCMessage) Message {
 	parsedMessage := UserJoinMessage{
 		Raw:     message.Raw,
 		Type:    parseMessageType(message.Command),
@@ -423,13 +663,13 @@ func parseUserJoinMessage(message *ircMessage) Message {
 	}
 
 	if len(message.Params) == 1 {
-		parsedMessage.Channel = strings.TrimPrefix(message.Params[0], "#")
+		parsedMessage.Channel = parseChannel(message.param(0))
 	}
 
 	return &parsedMessage
 }
 
-func parseUserPartMessage(message *ircMessage) Message {
+func parseUserPartMessage(message *IRCMessage) Message {
 	parsedMessage := UserPartMessage{
 		Raw:     message.Raw,
 		Type:    parseMessageType(message.Command),
@@ -439,13 +679,13 @@ func parseUserPartMessage(message *ircMessage) Message {
 	}
 
 	if len(message.Params) == 1 {
-		parsedMessage.Channel = strings.TrimPrefix(message.Params[0], "#")
+		parsedMessage.Channel = parseChannel(message.param(0))
 	}
 
 	return &parsedMessage
 }
 
-func parseReconnectMessage(message *ircMessage) Message {
+func parseReconnectMessage(message *IRCMessage) Message {
 	return &ReconnectMessage{
 		Raw:     message.Raw,
 		Type:    parseMessageType(message.Command),
@@ -453,22 +693,39 @@ func parseReconnectMessage(message *ircMessage) Message {
 	}
 }
 
-func parseNamesMessage(message *ircMessage) Message {
+func parseNamesMessage(message *IRCMessage) Message {
 	parsedMessage := NamesMessage{
 		Raw:     message.Raw,
 		Type:    parseMessageType(message.Command),
 		RawType: message.Command,
 	}
 
-	if len(message.Params) == 4 {
-		parsedMessage.Channel = strings.TrimPrefix(message.Params[2], "#")
-		parsedMessage.Users = strings.Split(message.Params[3], " ")
+	// The params are the user, "=", "*" or "@" for the channel type, the channel and the names, some servers leave out the channel type
+	if len(message.Params) >= 3 {
+		parsedMessage.Channel = parseChannel(message.Params[len(message.Params)-2])
+		parsedMessage.Users = strings.Fields(message.Params[len(message.Params)-1])
 	}
 
 	return &parsedMessage
 }
 
-func parsePingMessage(message *ircMessage) Message {
+// parseEndOfNamesMessage parses the 366 message into a NamesMessage without users
+func parseEndOfNamesMessage(message *IRCMessage) Message {
+	parsedMessage := NamesMessage{
+		Raw:     message.Raw,
+		Type:    parseMessageType(message.Command),
+		RawType: message.Command,
+	}
+
+	// The params are the user, the channel and "End of /NAMES list"
+	if len(message.Params) >= 2 {
+		parsedMessage.Channel = parseChannel(message.Params[1])
+	}
+
+	return &parsedMessage
+}
+
+func parsePingMessage(message *IRCMessage) Message {
 	parsedMessage := PingMessage{
 		Raw:     message.Raw,
 		Type:    parseMessageType(message.Command),
@@ -482,7 +739,7 @@ func parsePingMessage(message *ircMessage) Message {
 	return &parsedMessage
 }
 
-func parsePongMessage(message *ircMessage) Message {
+func parsePongMessage(message *IRCMessage) Message {
 	parsedMessage := PongMessage{
 		Raw:     message.Raw,
 		Type:    parseMessageType(message.Command),
@@ -496,13 +753,48 @@ func parsePongMessage(message *ircMessage) Message {
 	return &parsedMessage
 }
 
-func parseTime(rawTime string) time.Time {
+// ErrInvalidTimestamp returned from ParseTMITimestamp when the timestamp is empty or not a number
+var ErrInvalidTimestamp = errors.New("invalid timestamp")
+
+// ParseTMITimestamp parses a unix timestamp like the value of the tmi-sent-ts tag, and returns it in UTC.
+// Twitch sends milliseconds, timestamps in seconds, microseconds and nanoseconds are detected by their magnitude
+func ParseTMITimestamp(rawTime string) (time.Time, error) {
 	if rawTime == "" {
-		return time.Time{}
+		return time.Time{}, fmt.Errorf("%w: empty", ErrInvalidTimestamp)
 	}
 
-	time64, _ := strconv.ParseInt(rawTime, 10, 64)
-	return time.Unix(0, time64*1e6)
+	value, err := strconv.ParseInt(rawTime, 10, 64)
+	if err != nil || value < 0 {
+		return time.Time{}, fmt.Errorf("%w: %q", ErrInvalidTimestamp, rawTime)
+	}
+
+	// Timestamps with up to 10 digits are seconds, which covers dates until the year 2286.
+	// Every 3 more digits are the next smaller unit, 11 to 13 digits are milliseconds
+	switch {
+	case value < 1e10:
+		return time.Unix(value, 0).UTC(), nil
+	case value < 1e13:
+		return time.Unix(value/1e3, value%1e3*1e6).UTC(), nil
+	case value < 1e16:
+		return time.Unix(value/1e6, value%1e6*1e3).UTC(), nil
+	default:
+		return time.Unix(0, value).UTC(), nil
+	}
+}
+
+// parseTime returns the zero time.Time for missing or invalid timestamps
+func parseTime(rawTime string) time.Time {
+	parsed, _ := ParseTMITimestamp(rawTime)
+	return parsed
+}
+
+// parseMessageEmotes parses the emotes tag, unless emotes are skipped
+func parseMessageEmotes(message *IRCMessage, text string) []*Emote {
+	if message.options&SkipEmotes != 0 {
+		return nil
+	}
+
+	return parseEmotes(message.Tags["emotes"], text)
 }
 
 func parseEmotes(rawEmotes, message string) []*Emote {
@@ -512,76 +804,150 @@ func parseEmotes(rawEmotes, message string) []*Emote {
 		return emotes
 	}
 
-	runes := []rune(message)
+	// The emotes and their positions point into slices allocated once for all emotes of the message
+	count := strings.Count(rawEmotes, "/") + 1
+	emotes = make([]*Emote, 0, count)
+	values := make([]Emote, 0, count)
+	positions := make([]EmotePosition, 0, count+strings.Count(rawEmotes, ","))
+	text := emoteText{message: message}
 
-L:
-	for _, v := range strings.Split(rawEmotes, "/") {
-		split := strings.SplitN(v, ":", 2)
-		if len(split) != 2 {
+	for rest, hasNext := rawEmotes, true; hasNext; {
+		var rawEmote string
+		rawEmote, rest, hasNext = cutByte(rest, '/')
+
+		id, rawPositions, ok := cutByte(rawEmote, ':')
+		if !ok {
 			// We have received bad emote data :(
 			continue
 		}
-		pairs := strings.Split(split[1], ",")
-		if len(pairs) < 1 {
+
+		firstPair, _, _ := cutByte(rawPositions, ',')
+		rawFirstIndex, rawLastIndex, ok := cutByte(firstPair, '-')
+		if !ok {
 			// We have received bad emote data :(
 			continue
 		}
-		pair := strings.SplitN(pairs[0], "-", 2)
-		if len(pair) != 2 {
-			// We have received bad emote data :(
-			continue
+
+		firstIndex, _ := strconv.Atoi(rawFirstIndex)
+		lastIndex, _ := strconv.Atoi(rawLastIndex)
+
+		length := text.length()
+		if lastIndex+1 > length {
+			lastIndex = length - 1
 		}
 
-		firstIndex, _ := strconv.Atoi(pair[0])
-		lastIndex, _ := strconv.Atoi(pair[1])
+		if firstIndex+1 > length {
+			firstIndex = length - 1
+		}
 
-		if lastIndex+1 > len(runes) {
-			lastIndex = len(runes) - 1
+		if firstIndex < 0 || firstIndex > lastIndex {
+			// The positions don't fit the message, e.g. because the message is missing
+			continue
 		}
 
-		if firstIndex+1 > len(runes) {
-			firstIndex = len(runes) - 1
+		var emotePositions []EmotePosition
+		positions, emotePositions, ok = parseEmotePositions(rawPositions, positions)
+		if !ok {
+			continue
 		}
 
-		var positions []EmotePosition
-		for _, p := range pairs {
-			pos := strings.SplitN(p, "-", 2)
-			if len(pos) != 2 {
-				// Position is not valid, continue on the outer loop and skip this emote.
-				continue L
-			}
+		values = append(values, Emote{
+			Name:      text.slice(firstIndex, lastIndex+1),
+			ID:        id,
+			Count:     strings.Count(rawPositions, ",") + 1,
+			Positions: emotePositions,
+		})
+		emotes = append(emotes, &values[len(values)-1])
+	}
 
-			// Convert the start and end positions from strings, and bail if it fails.
-			start, err := strconv.Atoi(pos[0])
-			if err != nil {
-				continue L
-			}
+	return emotes
+}
 
-			end, err := strconv.Atoi(pos[1])
-			if err != nil {
-				continue L
-			}
+// parseEmotePositions appends the comma separated start-end pairs of an emote to positions, and returns them as emotePositions.
+// Returns false and positions unchanged if any of the pairs is invalid
+func parseEmotePositions(rawPositions string, positions []EmotePosition) ([]EmotePosition, []EmotePosition, bool) {
+	start := len(positions)
+
+	for rest, hasNext := rawPositions, true; hasNext; {
+		var rawPosition string
+		rawPosition, rest, hasNext = cutByte(rest, ',')
 
-			positions = append(positions, EmotePosition{
-				Start: start,
-				End:   end,
-			})
+		rawStart, rawEnd, ok := cutByte(rawPosition, '-')
+		if !ok {
+			return positions[:start], nil, false
+		}
+
+		positionStart, err := strconv.Atoi(rawStart)
+		if err != nil {
+			return positions[:start], nil, false
 		}
 
-		emote := &Emote{
-			Name:      string(runes[firstIndex : lastIndex+1]),
-			ID:        split[0],
-			Count:     strings.Count(split[1], ",") + 1,
-			Positions: positions,
+		positionEnd, err := strconv.Atoi(rawEnd)
+		if err != nil {
+			return positions[:start], nil, false
 		}
 
-		emotes = append(emotes, emote)
+		positions = append(positions, EmotePosition{
+			Start: positionStart,
+			End:   positionEnd,
+		})
 	}
 
-	return emotes
+	// Limit the capacity, appending to the positions of one emote must not overwrite the next emote's
+	return positions, positions[start:len(positions):len(positions)], true
+}
+
+// emoteText gets the names of emotes from the message. Twitch counts emote positions in UTF-16 code units, like JavaScript string indices,
+// so an emoji outside of the Basic Multilingual Plane counts as 2 positions.
+// The message is only converted if it isn't plain ASCII, otherwise the names are substrings of the message
+type emoteText struct {
+	message   string
+	units     []uint16
+	converted bool
+}
+
+func (t *emoteText) convert() {
+	if t.converted {
+		return
+	}
+	t.converted = true
+
+	for i := 0; i < len(t.message); i++ {
+		if t.message[i] >= utf8.RuneSelf {
+			t.units = utf16.Encode([]rune(t.message))
+			return
+		}
+	}
+}
+
+func (t *emoteText) length() int {
+	t.convert()
+	if t.units == nil {
+		return len(t.message)
+	}
+
+	return len(t.units)
+}
+
+func (t *emoteText) slice(start, end int) string {
+	t.convert()
+	if t.units == nil {
+		return t.message[start:end]
+	}
+
+	return string(utf16.Decode(t.units[start:end]))
+}
+
+// cutByte slices s around the first instance of sep. found is false if s doesn't contain sep, then before is s
+func cutByte(s string, sep byte) (before, after string, found bool) {
+	if index := strings.IndexByte(s, sep); index >= 0 {
+		return s[:index], s[index+1:], true
+	}
+
+	return s, "", false
 }
 
-func parseEmoteSets(message *ircMessage) []string {
+func parseEmoteSets(message *IRCMessage) []string {
 	_, ok := message.Tags["emote-sets"]
 	if !ok {
 		return []string{}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -24,6 +25,35 @@ func BenchmarkParseBigLog(b *testing.B) {
 	}
 }
 
+func BenchmarkParseMessagesFromReader(b *testing.B) {
+	log := strings.Join(messages, "\r\n")
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		ParseMessages(strings.NewReader(log), func(message Message, err error) bool {
+			return true
+		})
+	}
+}
+
+func BenchmarkParseLinesFromReader(b *testing.B) {
+	log := strings.Join(messages, "\r\n")
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		reader := bufio.NewReader(strings.NewReader(log))
+		for {
+			line, err := reader.ReadString('\n')
+			if line = strings.TrimRight(line, "\r\n"); line != "" {
+				ParseMessage(line)
+			}
+			if err != nil {
+				break
+			}
+		}
+	}
+}
+
 func BenchmarkParseWHISPERMessage(b *testing.B) {
 	testMessage := "@badges=;color=#00FF7F;display-name=Danielps1;emotes=;message-id=20;thread-id=32591953_77829817;turbo=0;user-id=32591953;user-type= :danielps1!danielps1@danielps1.tmi.twitch.tv WHISPER gempir :i like memes"
 	for n := 0; n < b.N; n++ {
@@ -31,6 +61,60 @@ func BenchmarkParseWHISPERMessage(b *testing.B) {
 	}
 }
 
+func BenchmarkParsePRIVMSGMessage(b *testing.B) {
+	testMessage := "@badge-info=subscriber/52;badges=moderator/1,subscriber/48;color=#2E8B57;display-name=pajbot;emotes=80481_BW:28-34,36-42/301683486:44-53;flags=;id=1ad5dc5b-8e2e-4c60-a9bd-7d9b3ab2e4e1;mod=1;room-id=11148817;subscriber=1;tmi-sent-ts=1594474290185;turbo=0;user-id=82008718;user-type=mod :pajbot!pajbot@pajbot.tmi.twitch.tv PRIVMSG #pajlada :pajaCheese pajaCheese pajaCheese _pajaW _pajaW LUL LUL pajaCheese"
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		ParseMessage(testMessage)
+	}
+}
+
+func BenchmarkParsePRIVMSGMessageWithoutEmotesAndBadges(b *testing.B) {
+	testMessage := "@badge-info=;badges=;color=#2E8B57;display-name=pajbot;emotes=;flags=;id=1ad5dc5b-8e2e-4c60-a9bd-7d9b3ab2e4e1;mod=0;room-id=11148817;subscriber=0;tmi-sent-ts=1594474290185;turbo=0;user-id=82008718;user-type= :pajbot!pajbot@pajbot.tmi.twitch.tv PRIVMSG #pajlada :hello there, how is everyone doing today?"
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		ParseMessage(testMessage)
+	}
+}
+
+func BenchmarkParseEmoteHeavyPRIVMSGMessage(b *testing.B) {
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		ParseMessage(emoteHeavyPRIVMSG)
+	}
+}
+
+func BenchmarkParseEmoteHeavyPRIVMSGMessageSkippingEmotesAndBadges(b *testing.B) {
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		ParseMessageWithOptions(emoteHeavyPRIVMSG, SkipEmotes|SkipBadges)
+	}
+}
+
+const emoteHeavyPRIVMSG = "@badge-info=subscriber/52;badges=moderator/1,subscriber/48,glhf-pledge/1;color=#2E8B57;display-name=pajbot;emotes=25:0-4,12-16,24-28,36-40/1902:6-10,18-22,30-34/354:42-45,47-50/86:52-61;flags=;id=1ad5dc5b-8e2e-4c60-a9bd-7d9b3ab2e4e1;mod=1;room-id=11148817;subscriber=1;tmi-sent-ts=1594474290185;turbo=0;user-id=82008718;user-type=mod :pajbot!pajbot@pajbot.tmi.twitch.tv PRIVMSG #pajlada :Kappa Keepo Kappa Keepo Kappa Keepo Kappa 4Head 4Head BibleThump ♥"
+
+func BenchmarkParsePRIVMSGMessageWithUnicodeEmotes(b *testing.B) {
+	testMessage := "@badge-info=subscriber/52;badges=moderator/1,subscriber/48;color=#2E8B57;display-name=pajbot;emotes=25:2-6,8-12;flags=;id=1ad5dc5b-8e2e-4c60-a9bd-7d9b3ab2e4e1;mod=1;room-id=11148817;subscriber=1;tmi-sent-ts=1594474290185;turbo=0;user-id=82008718;user-type=mod :pajbot!pajbot@pajbot.tmi.twitch.tv PRIVMSG #pajlada :ä Kappa Kappa"
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		ParseMessage(testMessage)
+	}
+}
+
+func BenchmarkParseUSERNOTICEMessage(b *testing.B) {
+	testMessage := `@badge-info=subscriber/34;badges=subscriber/24,premium/1;color=#1FD2FF;display-name=Karl_Kons;emotes=28087:0-6;flags=;id=7c95beea-a7ac-4c10-9e0a-d7dbf163c038;login=karl_kons;mod=0;msg-id=resub;msg-param-cumulative-months=34;msg-param-months=0;msg-param-should-share-streak=0;msg-param-sub-plan-name=look\sat\sthose\sshitty\semotes,\srip\s$5\sLUL;msg-param-sub-plan=1000;room-id=11148817;subscriber=1;system-msg=Karl_Kons\ssubscribed\sat\sTier\s1.\sThey've\ssubscribed\sfor\s34\smonths!;tmi-sent-ts=1540140252828;turbo=0;user-id=68706331;user-type= :tmi.twitch.tv USERNOTICE #pajlada :WutFace WutFace`
+	for n := 0; n < b.N; n++ {
+		ParseMessage(testMessage)
+	}
+}
+
+func BenchmarkParseCLEARCHATMessage(b *testing.B) {
+	testMessage := "@ban-duration=600;room-id=11148817;target-user-id=40910607;tmi-sent-ts=1594474290185 :tmi.twitch.tv CLEARCHAT #pajlada :ampzyh"
+	for n := 0; n < b.N; n++ {
+		ParseMessage(testMessage)
+	}
+}
+
 func BenchmarkParseMessageType(b *testing.B) {
 	testCommand := "RECONNECT"
 	for n := 0; n < b.N; n++ {
@@ -1,7 +1,11 @@
 package twitch
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCanPraseBadActionMessageWithoutPanic(t *testing.T) {
@@ -26,7 +30,31 @@ func TestCantParseNoTagsMessage(t *testing.T) {
 
 	assertStringsEqual(t, "my", rawMessage.RawType)
 	assertStringMapsEqual(t, nil, rawMessage.Tags)
-	assertStringsEqual(t, "test message", rawMessage.Message)
+	assertStringsEqual(t, "", rawMessage.Message)
+	assertStringSlicesEqual(t, []string{"test", "message"}, rawMessage.Params)
+}
+
+func TestCanParseUnknownMessageWithChannel(t *testing.T) {
+	testMessage := "@room-id=11148817 :tmi.twitch.tv HOSTTARGET #pajlada :#nymn is #1 -"
+
+	rawMessage := ParseMessage(testMessage).(*RawMessage)
+
+	assertMessageTypesEqual(t, UNSET, rawMessage.Type)
+	assertStringsEqual(t, "HOSTTARGET", rawMessage.RawType)
+	assertStringsEqual(t, "pajlada", rawMessage.Channel)
+	assertStringsEqual(t, "#nymn is #1 -", rawMessage.Message)
+	assertStringSlicesEqual(t, []string{"#pajlada", "#nymn is #1 -"}, rawMessage.Params)
+}
+
+func TestCanParseUnknownMessageWithoutChannel(t *testing.T) {
+	testMessage := ":tmi.twitch.tv 001 justinfan123123 :Welcome, GLHF!"
+
+	rawMessage := ParseMessage(testMessage).(*RawMessage)
+
+	assertStringsEqual(t, "001", rawMessage.RawType)
+	assertStringsEqual(t, "", rawMessage.Channel)
+	assertStringsEqual(t, "Welcome, GLHF!", rawMessage.Message)
+	assertStringSlicesEqual(t, []string{"justinfan123123", "Welcome, GLHF!"}, rawMessage.Params)
 }
 
 func TestCantParseInvalidMessage(t *testing.T) {
@@ -122,6 +150,27 @@ func TestCanParseWHISPERActionMessage(t *testing.T) {
 	whisperMessage := message.(*WhisperMessage)
 
 	assertTrue(t, whisperMessage.Action, "parsing Action failed")
+	assertStringsEqual(t, "tests whisper action", whisperMessage.Message)
+}
+
+func TestCanParseWHISPERCTCPActionMessage(t *testing.T) {
+	testMessage := "@badges=;color=#1E90FF;display-name=FletcherCodes;emotes=;message-id=50;thread-id=269899575_408892348;turbo=0;user-id=269899575;user-type= :fletchercodes!fletchercodes@fletchercodes.tmi.twitch.tv WHISPER clippyassistant :\u0001ACTION tests whisper action\u0001"
+
+	message := ParseMessage(testMessage)
+	whisperMessage := message.(*WhisperMessage)
+
+	assertTrue(t, whisperMessage.Action, "parsing Action failed")
+	assertStringsEqual(t, "tests whisper action", whisperMessage.Message)
+}
+
+func TestCanParseWHISPERMessageContainingMe(t *testing.T) {
+	testMessage := "@badges=;color=#1E90FF;display-name=FletcherCodes;emotes=;message-id=50;thread-id=269899575_408892348;turbo=0;user-id=269899575;user-type= :fletchercodes!fletchercodes@fletchercodes.tmi.twitch.tv WHISPER clippyassistant :can you help me with my homework /me"
+
+	message := ParseMessage(testMessage)
+	whisperMessage := message.(*WhisperMessage)
+
+	assertFalse(t, whisperMessage.Action, "whisper containing /me was parsed as action")
+	assertStringsEqual(t, "can you help me with my homework /me", whisperMessage.Message)
 }
 
 func TestCanParsePRIVMSGMessage(t *testing.T) {
@@ -301,6 +350,49 @@ func TestCanParsePRIVMSGActionMessage(t *testing.T) {
 	assertTrue(t, privateMessage.Action, "parsing Action failed")
 }
 
+func TestCanParseClientNonce(t *testing.T) {
+	testMessage := "@badges=;client-nonce=c5fbf6b9f6b249353811c21dfffe0321;color=;display-name=gempir;emotes=;id=b34ccfc7-4977-403a-8a94-33c6bac34fb8;room-id=11148817;tmi-sent-ts=1594474290185;user-id=77829817 :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :hello"
+
+	message := ParseMessage(testMessage)
+	privateMessage := message.(*PrivateMessage)
+
+	assertStringsEqual(t, "c5fbf6b9f6b249353811c21dfffe0321", privateMessage.ClientNonce)
+
+	serialized, err := SerializeMessage(privateMessage)
+	assertErrorsEqual(t, nil, err)
+	assertStringsEqual(t, privateMessage.ClientNonce, ParseMessage(serialized).(*PrivateMessage).ClientNonce)
+}
+
+func TestClientNonceIsEmptyWithoutTag(t *testing.T) {
+	testMessage := "@badges=;color=;display-name=gempir;emotes=;id=1;room-id=11148817;user-id=77829817 :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :hello"
+
+	message := ParseMessage(testMessage)
+	privateMessage := message.(*PrivateMessage)
+
+	assertStringsEqual(t, "", privateMessage.ClientNonce)
+}
+
+func TestCanParseSharedChatPRIVMSGMessage(t *testing.T) {
+	testMessage := `@badge-info=;badges=glitchcon2020/1;color=#0000FF;display-name=pajbot;emotes=;flags=;id=2f0a8e7a-1bcd-4a4a-b1f5-c0ee1c4f6a4c;mod=0;room-id=11148817;source-badge-info=subscriber/3;source-badges=moderator/1,subscriber/3;source-id=7b7c2d0b-8d3b-4ab2-a77a-35a2b6a5bdaa;source-room-id=22484632;subscriber=0;tmi-sent-ts=1726846100230;turbo=0;user-id=82008718;user-type= :pajbot!pajbot@pajbot.tmi.twitch.tv PRIVMSG #pajlada :hello from forsen`
+
+	privateMessage := ParseMessage(testMessage).(*PrivateMessage)
+
+	assertStringsEqual(t, "22484632", privateMessage.SourceRoomID)
+	assertStringsEqual(t, "7b7c2d0b-8d3b-4ab2-a77a-35a2b6a5bdaa", privateMessage.SourceID)
+	assertStringIntMapsEqual(t, map[string]int{"moderator": 1, "subscriber": 3}, privateMessage.SourceBadges)
+	assertStringsEqual(t, "11148817", privateMessage.RoomID)
+}
+
+func TestCanParseNonSharedChatPRIVMSGMessage(t *testing.T) {
+	testMessage := "@badges=premium/1;color=#DAA520;display-name=FletcherCodes;emotes=;flags=;id=6efffc70-27a1-4637-9111-44e5104bb7da;mod=0;room-id=408892348;subscriber=0;tmi-sent-ts=1551473087761;turbo=0;user-id=269899575;user-type= :fletchercodes!fletchercodes@fletchercodes.tmi.twitch.tv PRIVMSG #clippyassistant :hello"
+
+	privateMessage := ParseMessage(testMessage).(*PrivateMessage)
+
+	assertStringsEqual(t, "", privateMessage.SourceRoomID)
+	assertStringsEqual(t, "", privateMessage.SourceID)
+	assertIntsEqual(t, 0, len(privateMessage.SourceBadges))
+}
+
 func TestCanParseEmoteMessage(t *testing.T) {
 	testMessage := "@badges=;color=#008000;display-name=Zugren;emotes=120232:0-6,13-19,26-32,39-45,52-58;id=51c290e9-1b50-497c-bb03-1667e1afe6e4;mod=0;room-id=11148817;sent-ts=1490382458685;subscriber=0;tmi-sent-ts=1490382456776;turbo=0;user-id=65897106;user-type= :zugren!zugren@zugren.tmi.twitch.tv PRIVMSG #pajlada :TriHard Clap TriHard Clap TriHard Clap TriHard Clap TriHard Clap"
 
@@ -362,6 +454,19 @@ func TestCanHandleBadEmoteMessage(t *testing.T) {
 	}
 }
 
+func TestCanParseEmotesAfterEmoji(t *testing.T) {
+	// Twitch counts emote positions in UTF-16 code units, every 👉 counts as 2 positions
+	testMessage := "@badges=;color=;display-name=gempir;emotes=25:3-7,11-15/1902:17-21;id=1;room-id=11148817;user-id=77829817 :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :👉 Kappa 👉Kappa Keepo ä"
+
+	privateMessage := ParseMessage(testMessage).(*PrivateMessage)
+
+	assertIntsEqual(t, 2, len(privateMessage.Emotes))
+	assertStringsEqual(t, "Kappa", privateMessage.Emotes[0].Name)
+	assertIntsEqual(t, 2, privateMessage.Emotes[0].Count)
+	assertIntsEqual(t, 11, privateMessage.Emotes[0].Positions[1].Start)
+	assertStringsEqual(t, "Keepo", privateMessage.Emotes[1].Name)
+}
+
 func TestCanParseBitsMessage(t *testing.T) {
 	testMessage := "@badges=bits/5000;bits=5000;color=#007EFF;display-name=FletcherCodes;emotes=;flags=;id=405c4ccb-7d69-4a57-ac16-292e72ba288b;mod=0;room-id=408892348;subscriber=0;tmi-sent-ts=1551478518354;turbo=0;user-id=269899575;user-type= :fletchercodes!fletchercodes@fletchercodes.tmi.twitch.tv PRIVMSG #clippyassistant :showlove5000 Chew your food slower... it's healthier"
 
@@ -399,7 +504,7 @@ func TestCanParseBanMessage(t *testing.T) {
 	assertStringsEqual(t, "", clearchatMessage.Message)
 	assertStringsEqual(t, clearchatMessage.Channel, "clippyassistant")
 	assertStringsEqual(t, "408892348", clearchatMessage.RoomID)
-	assertIntsEqual(t, 0, clearchatMessage.BanDuration)
+	assertTrue(t, clearchatMessage.BanDuration == 0, "ban has a duration")
 	assertStringsEqual(t, "269899575", clearchatMessage.TargetUserID)
 	assertStringsEqual(t, "fletchercodes", clearchatMessage.TargetUsername)
 }
@@ -410,7 +515,40 @@ func TestCanParseTimeoutMessage(t *testing.T) {
 	message := ParseMessage(testMessage)
 	clearchatMessage := message.(*ClearChatMessage)
 
-	assertIntsEqual(t, 5, clearchatMessage.BanDuration)
+	assertTrue(t, clearchatMessage.BanDuration == 5*time.Second, "wrong ban duration "+clearchatMessage.BanDuration.String())
+}
+
+func TestCanClassifyClearChatMessages(t *testing.T) {
+	tests := []struct {
+		line          string
+		fullChatClear bool
+		timeout       bool
+		permanentBan  bool
+	}{
+		{"@room-id=408892348;tmi-sent-ts=1551538522968 :tmi.twitch.tv CLEARCHAT #clippyassistant", true, false, false},
+		{"@ban-duration=5;room-id=408892348;target-user-id=269899575;tmi-sent-ts=1551538496775 :tmi.twitch.tv CLEARCHAT #clippyassistant :fletchercodes", false, true, false},
+		{"@room-id=408892348;target-user-id=269899575;tmi-sent-ts=1551538522968 :tmi.twitch.tv CLEARCHAT #clippyassistant :fletchercodes", false, false, true},
+	}
+
+	for _, test := range tests {
+		message := ParseMessage(test.line).(*ClearChatMessage)
+		assertBoolEqual(t, test.fullChatClear, message.IsFullChatClear())
+		assertBoolEqual(t, test.timeout, message.IsTimeout())
+		assertBoolEqual(t, test.permanentBan, message.IsPermanentBan())
+	}
+}
+
+func TestCanParseLegacyBanReason(t *testing.T) {
+	testMessage := `@ban-duration=1;ban-reason=testing\sxd;room-id=11148817;target-user-id=40910607 :tmi.twitch.tv CLEARCHAT #pajlada :ampzyh`
+
+	message := ParseMessage(testMessage).(*ClearChatMessage)
+	assertStringsEqual(t, "testing xd", message.BanReason)
+
+	// The reason is serialized from the field, not the tags of the parsed line
+	delete(message.Tags, "ban-reason")
+	serialized, err := SerializeMessage(message)
+	assertErrorsEqual(t, nil, err)
+	assertStringsEqual(t, testMessage, serialized)
 }
 
 func TestCanParseCLEARMSGMessage(t *testing.T) {
@@ -627,6 +765,178 @@ func TestCanParseUSERSTATEMessage(t *testing.T) {
 	assertStringSlicesEqual(t, expectedEmoteSets, userstateMessage.EmoteSets)
 }
 
+func TestCanParseUSERSTATEMessageWithLocalizedDisplayName(t *testing.T) {
+	testMessage := "@badges=;color=#1E90FF;display-name=ジュン;emote-sets=0;mod=0;subscriber=0;user-type= :tmi.twitch.tv USERSTATE #clippyassistant"
+
+	message := ParseMessage(testMessage)
+	user := message.(*UserStateMessage).User
+
+	assertStringsEqual(t, "", user.Name)
+	assertStringsEqual(t, "ジュン", user.DisplayName)
+	assertStringsEqual(t, "ジュン", user.DisplayNameOrName())
+}
+
+func TestLoginTagIsPreferredForTheUserName(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		// A localized display name with a login tag uses the login
+		{"@badges=;color=;display-name=ジュン;emotes=;id=1;login=jun_2019;msg-id=raid;room-id=11148817;user-id=1 :tmi.twitch.tv USERNOTICE #pajlada", "jun_2019"},
+		// The login tag wins over a display name that only differs in more than letter case
+		{`@badges=;color=;display-name=Some\sOther\sName;emotes=;id=1;login=somename;msg-id=sub;room-id=11148817;user-id=1 :tmi.twitch.tv USERNOTICE #pajlada`, "somename"},
+		// The IRCv3 account tag is used like the login tag
+		{"@account=gempir;display-name=ジュン :irc.example.com PRIVMSG #pajlada :hi", "gempir"},
+		// Without a login tag, the source is used
+		{"@badges=;color=;display-name=ジュン;emotes=;id=1;room-id=11148817;user-id=1 :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :hi", "gempir"},
+	}
+
+	for _, test := range tests {
+		var user User
+		switch message := ParseMessage(test.line).(type) {
+		case *PrivateMessage:
+			user = message.User
+		case *UserNoticeMessage:
+			user = message.User
+		}
+
+		assertStringsEqual(t, test.expected, user.Name)
+	}
+}
+
+func TestCanParseUSERSTATEMessageWithSpacesInDisplayName(t *testing.T) {
+	testMessage := `@badges=;color=#1E90FF;display-name=Some\sName\s;emote-sets=0;mod=0;subscriber=0;user-type= :tmi.twitch.tv USERSTATE #clippyassistant`
+
+	message := ParseMessage(testMessage)
+	user := message.(*UserStateMessage).User
+
+	assertStringsEqual(t, "somename", user.Name)
+	assertStringsEqual(t, "Some Name", user.DisplayName)
+}
+
+func TestUserDisplayNameOrNameFallsBackToName(t *testing.T) {
+	assertStringsEqual(t, "gempir", User{Name: "gempir"}.DisplayNameOrName())
+	assertStringsEqual(t, "Gempir", User{Name: "gempir", DisplayName: "Gempir"}.DisplayNameOrName())
+}
+
+func TestUserRGB(t *testing.T) {
+	tests := []struct {
+		color   string
+		r, g, b int
+		ok      bool
+	}{
+		{"#FF0000", 255, 0, 0, true},
+		{"#1e90ff", 30, 144, 255, true},
+		{"", 0, 0, 0, false},
+		{"FF0000", 0, 0, 0, false},
+		{"#FF00", 0, 0, 0, false},
+		{"#GG0000", 0, 0, 0, false},
+		{"#+F0000", 0, 0, 0, false},
+	}
+
+	for _, test := range tests {
+		r, g, b, ok := User{Color: test.color}.RGB()
+		assertBoolEqual(t, test.ok, ok)
+		assertIntsEqual(t, test.r, int(r))
+		assertIntsEqual(t, test.g, int(g))
+		assertIntsEqual(t, test.b, int(b))
+	}
+}
+
+func TestCanParseUserType(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected UserType
+		staff    bool
+	}{
+		{"@badges=;color=;display-name=gempir;emotes=;id=1;room-id=11148817;user-id=77829817;user-type= :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :hi", UserTypeNormal, false},
+		{"@badges=moderator/1;color=;display-name=gempir;emotes=;id=1;room-id=11148817;user-id=77829817;user-type=mod :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :hi", UserTypeMod, false},
+		{"@badges=;color=;display-name=gempir;emotes=;message-id=1;thread-id=1_2;user-id=77829817;user-type=global_mod :gempir!gempir@gempir.tmi.twitch.tv WHISPER pajlada :hi", UserTypeGlobalMod, true},
+		{"@badges=;color=;display-name=gempir;emotes=;id=1;login=gempir;msg-id=sub;room-id=11148817;user-id=77829817;user-type=admin :tmi.twitch.tv USERNOTICE #pajlada", UserTypeAdmin, true},
+		{"@badges=staff/1;color=;display-name=gempir;emote-sets=0;mod=0;subscriber=0;user-type=staff\\s :tmi.twitch.tv USERSTATE #pajlada", UserTypeStaff, true},
+	}
+
+	for _, test := range tests {
+		var user User
+		switch message := ParseMessage(test.line).(type) {
+		case *PrivateMessage:
+			user = message.User
+		case *WhisperMessage:
+			user = message.User
+		case *UserNoticeMessage:
+			user = message.User
+		case *UserStateMessage:
+			user = message.User
+		}
+
+		assertStringsEqual(t, string(test.expected), string(user.UserType))
+		assertBoolEqual(t, test.staff, user.IsStaff())
+	}
+}
+
+func TestFoundersAreSubscribers(t *testing.T) {
+	tests := []struct {
+		badges     string
+		subscriber bool
+		founder    bool
+	}{
+		{"founder/0", true, true},
+		{"subscriber/12,premium/1", true, false},
+		{"moderator/1", false, false},
+		{"", false, false},
+	}
+
+	for _, test := range tests {
+		message := ParseMessage("@badge-info=;badges=" + test.badges + ";color=;display-name=gempir;emotes=;id=1;room-id=11148817;user-id=77829817;user-type= :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :hi").(*PrivateMessage)
+
+		assertBoolEqual(t, test.subscriber, message.User.IsSubscriber())
+		assertBoolEqual(t, test.founder, message.User.IsFounder())
+	}
+}
+
+func TestCanParseEmoteOnlyAndHighlightedPrivateMessages(t *testing.T) {
+	tests := []struct {
+		line      string
+		emoteOnly bool
+		msgID     string
+	}{
+		{"@badges=;color=;display-name=gempir;emote-only=1;emotes=25:0-4;id=1;room-id=11148817;user-id=77829817 :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :Kappa", true, ""},
+		{"@badges=;color=;display-name=gempir;emotes=;id=1;msg-id=highlighted-message;room-id=11148817;user-id=77829817 :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :look at me", false, "highlighted-message"},
+		{"@badges=;color=;display-name=gempir;emotes=;id=1;msg-id=skip-subs-mode-message;room-id=11148817;user-id=77829817 :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :let me in", false, "skip-subs-mode-message"},
+		{":gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :hi", false, ""},
+	}
+
+	for _, test := range tests {
+		message := ParseMessage(test.line).(*PrivateMessage)
+
+		assertBoolEqual(t, test.emoteOnly, message.EmoteOnly)
+		assertStringsEqual(t, test.msgID, message.MsgID)
+	}
+
+	// The fields survive serializing the message without its tags
+	message := ParseMessage(tests[1].line).(*PrivateMessage)
+	message.Tags = nil
+	message.EmoteOnly = true
+	line, err := SerializeMessage(message)
+	assertErrorsEqual(t, nil, err)
+
+	serialized := ParseMessage(line).(*PrivateMessage)
+	assertTrue(t, serialized.EmoteOnly, "emote-only was not serialized")
+	assertStringsEqual(t, "highlighted-message", serialized.MsgID)
+}
+
+func TestCanParseTurbo(t *testing.T) {
+	testMessage := "@badges=staff/1,turbo/1;color=#0D4200;display-name=ronni;emotes=25:0-4,12-16/1902:6-10;id=b34ccfc7-4977-403a-8a94-33c6bac34fb8;mod=0;room-id=1337;subscriber=0;tmi-sent-ts=1507246572675;turbo=1;user-id=1337;user-type=staff :ronni!ronni@ronni.tmi.twitch.tv PRIVMSG #ronni :Kappa Keepo Kappa"
+
+	message := ParseMessage(testMessage).(*PrivateMessage)
+
+	assertTrue(t, message.User.Turbo, "turbo tag wasn't parsed")
+	assertStringsEqual(t, string(UserTypeStaff), string(message.User.UserType))
+
+	message = ParseMessage(strings.Replace(testMessage, "turbo=1", "turbo=0", 1)).(*PrivateMessage)
+	assertFalse(t, message.User.Turbo, "turbo=0 was parsed as turbo")
+}
+
 func TestCanParseNOTICEMessage(t *testing.T) {
 	testMessage := "@msg-id=subs_on :tmi.twitch.tv NOTICE #clippyassistant :This room is now in subscribers-only mode."
 
@@ -797,3 +1107,287 @@ func TestCanParseGlobalUserStateMessage(t *testing.T) {
 	expectedEmoteSets := []string{"0", "15961", "24569", "24570"}
 	assertStringSlicesEqual(t, expectedEmoteSets, globalUserStateMessage.EmoteSets)
 }
+
+func TestParseMessageTypedReturnsMessageType(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected MessageType
+		message  Message
+	}{
+		{"@badges=;color=#00FF7F;display-name=Danielps1;emotes=;message-id=20;thread-id=32591953_77829817;turbo=0;user-id=32591953;user-type= :danielps1!danielps1@danielps1.tmi.twitch.tv WHISPER gempir :i like memes", WHISPER, &WhisperMessage{}},
+		{"@badges=;color=;display-name=pajlada;emotes=;mod=0;room-id=11148817;subscriber=0;tmi-sent-ts=1522855191000;turbo=0;user-id=11148817;user-type= :pajlada!pajlada@pajlada.tmi.twitch.tv PRIVMSG #pajlada :hello", PRIVMSG, &PrivateMessage{}},
+		{"@ban-duration=1;room-id=11148817;target-user-id=40910607 :tmi.twitch.tv CLEARCHAT #pajlada :ampzyh", CLEARCHAT, &ClearChatMessage{}},
+		{"@emote-only=0;followers-only=-1;r9k=0;rituals=0;room-id=11148817;slow=0;subs-only=0 :tmi.twitch.tv ROOMSTATE #pajlada", ROOMSTATE, &RoomStateMessage{}},
+		{"@badges=;color=;display-name=FletcherCodes;emotes=;id=e4090aa9-8079-41ff-904d-64c7a2193ee0;login=fletchercodes;msg-id=ritual;msg-param-ritual-name=new_chatter;room-id=408892348;tmi-sent-ts=1551487438943;user-id=412636239 :tmi.twitch.tv USERNOTICE #clippyassistant :SeemsGood", USERNOTICE, &UserNoticeMessage{}},
+		{"@badges=;color=#1E90FF;display-name=FletcherCodes;emote-sets=0;mod=0;subscriber=0;user-type= :tmi.twitch.tv USERSTATE #clippyassistant", USERSTATE, &UserStateMessage{}},
+		{"@msg-id=subs_on :tmi.twitch.tv NOTICE #clippyassistant :This room is now in subscribers-only mode.", NOTICE, &NoticeMessage{}},
+		{":pajlada!pajlada@pajlada.tmi.twitch.tv JOIN #pajlada", JOIN, &UserJoinMessage{}},
+		{":pajlada!pajlada@pajlada.tmi.twitch.tv PART #pajlada", PART, &UserPartMessage{}},
+		{":tmi.twitch.tv RECONNECT", RECONNECT, &ReconnectMessage{}},
+		{":justinfan123123.tmi.twitch.tv 353 justinfan123123 = #pajlada :pajlada gempir", NAMES, &NamesMessage{}},
+		{":justinfan123123.tmi.twitch.tv 366 justinfan123123 #pajlada :End of /NAMES list", END_OF_NAMES, &NamesMessage{}},
+		{"PING :tmi.twitch.tv", PING, &PingMessage{}},
+		{":tmi.twitch.tv PONG tmi.twitch.tv :go-twitch-irc", PONG, &PongMessage{}},
+		{"@login=ronni;room-id=;target-msg-id=abc-123-def;tmi-sent-ts=1642720582342 :tmi.twitch.tv CLEARMSG #dallas :HeyGuys", CLEARMSG, &ClearMessage{}},
+		{"@badge-info=;badges=;color=#0000FF;display-name=FletcherCodes;emote-sets=0;user-id=269899575;user-type= :tmi.twitch.tv GLOBALUSERSTATE", GLOBALUSERSTATE, &GlobalUserStateMessage{}},
+		{":tmi.twitch.tv 001 justinfan123123 :Welcome, GLHF!", UNSET, &RawMessage{}},
+	}
+
+	for _, test := range tests {
+		messageType, message := ParseMessageTyped(test.line)
+
+		assertMessageTypesEqual(t, test.expected, messageType)
+		assertMessageTypesEqual(t, test.expected, message.GetType())
+		assertStringsEqual(t, fmt.Sprintf("%T", test.message), fmt.Sprintf("%T", message))
+	}
+}
+
+func TestMessageTypeStringRoundTrips(t *testing.T) {
+	t.Parallel()
+
+	for _, messageType := range []MessageType{UNSET, WHISPER, PRIVMSG, CLEARCHAT, ROOMSTATE, USERNOTICE, USERSTATE, NOTICE,
+		JOIN, PART, RECONNECT, NAMES, PING, PONG, CLEARMSG, GLOBALUSERSTATE, END_OF_NAMES} {
+		assertMessageTypesEqual(t, messageType, MessageTypeFromString(messageType.String()))
+	}
+
+	assertStringsEqual(t, "PRIVMSG", PRIVMSG.String())
+	assertStringsEqual(t, "NAMES", fmt.Sprintf("%v", NAMES))
+	assertStringsEqual(t, "UNSET", UNSET.String())
+	assertStringsEqual(t, "UNSET(42)", MessageType(42).String())
+	assertMessageTypesEqual(t, NAMES, MessageTypeFromString("353"))
+	assertMessageTypesEqual(t, END_OF_NAMES, MessageTypeFromString("366"))
+	assertMessageTypesEqual(t, UNSET, MessageTypeFromString("001"))
+	assertMessageTypesEqual(t, UNSET, MessageTypeFromString("privmsg"))
+}
+
+func TestCanParseMessagesWithoutParams(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		line     string
+		expected MessageType
+	}{
+		{":bridge!bridge@bridge.example.com PRIVMSG", PRIVMSG},
+		{":bridge!bridge@bridge.example.com WHISPER", WHISPER},
+		{"@room-id=11148817 :tmi.twitch.tv CLEARCHAT", CLEARCHAT},
+		{"@login=ronni :tmi.twitch.tv CLEARMSG", CLEARMSG},
+		{"@slow=10 :tmi.twitch.tv ROOMSTATE", ROOMSTATE},
+		{"@msg-id=resub :tmi.twitch.tv USERNOTICE", USERNOTICE},
+		{"@display-name=gempir :tmi.twitch.tv USERSTATE", USERSTATE},
+		{"@msg-id=host_on :tmi.twitch.tv NOTICE", NOTICE},
+		{":gempir!gempir@gempir.tmi.twitch.tv JOIN", JOIN},
+		{":gempir!gempir@gempir.tmi.twitch.tv PART", PART},
+		{":tmi.twitch.tv 353", NAMES},
+		{"PING", PING},
+		{":tmi.twitch.tv PONG", PONG},
+	}
+
+	for _, test := range tests {
+		message := ParseMessage(test.line)
+
+		assertMessageTypesEqual(t, test.expected, message.GetType())
+	}
+
+	clearChatMessage := ParseMessage("@room-id=11148817 :tmi.twitch.tv CLEARCHAT").(*ClearChatMessage)
+	assertStringsEqual(t, "", clearChatMessage.Channel)
+	assertStringsEqual(t, "11148817", clearChatMessage.RoomID)
+}
+
+func TestCanParseTMITimestamps(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in       string
+		expected time.Time
+	}{
+		{"1594474290", time.Date(2020, 7, 11, 13, 31, 30, 0, time.UTC)},
+		{"1594474290185", time.Date(2020, 7, 11, 13, 31, 30, 185000000, time.UTC)},
+		{"1594474290185123", time.Date(2020, 7, 11, 13, 31, 30, 185123000, time.UTC)},
+		{"1594474290185123456", time.Date(2020, 7, 11, 13, 31, 30, 185123456, time.UTC)},
+		// The largest seconds and the smallest milliseconds
+		{"9999999999", time.Date(2286, 11, 20, 17, 46, 39, 0, time.UTC)},
+		{"10000000000", time.Date(1970, 4, 26, 17, 46, 40, 0, time.UTC)},
+		{"9999999999999", time.Date(2286, 11, 20, 17, 46, 39, 999000000, time.UTC)},
+		{"10000000000000", time.Date(1970, 4, 26, 17, 46, 40, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		parsed, err := ParseTMITimestamp(test.in)
+		assertErrorsEqual(t, nil, err)
+		assertTrue(t, parsed.Equal(test.expected), fmt.Sprintf("%s was parsed as %s, expected %s", test.in, parsed, test.expected))
+		assertTrue(t, parsed.Location() == time.UTC, fmt.Sprintf("%s was not parsed as UTC", test.in))
+	}
+}
+
+func TestParsedMessageTimesAreUTC(t *testing.T) {
+	t.Parallel()
+	expected := time.Date(2020, 7, 11, 13, 31, 30, 185000000, time.UTC)
+
+	messages := []string{
+		"@tmi-sent-ts=1594474290185 :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :hello",
+		"@tmi-sent-ts=1594474290185 :tmi.twitch.tv CLEARCHAT #pajlada :gempir",
+		"@msg-id=raid;tmi-sent-ts=1594474290185 :tmi.twitch.tv USERNOTICE #pajlada",
+	}
+
+	for _, line := range messages {
+		var parsed time.Time
+		switch message := ParseMessage(line).(type) {
+		case *PrivateMessage:
+			parsed = message.Time
+		case *ClearChatMessage:
+			parsed = message.Time
+		case *UserNoticeMessage:
+			parsed = message.Time
+		}
+
+		assertTrue(t, parsed.Equal(expected), fmt.Sprintf("%q was parsed as %s, expected %s", line, parsed, expected))
+		assertStringsEqual(t, "2020-07-11T13:31:30.185Z", parsed.Format(time.RFC3339Nano))
+	}
+}
+
+func TestCanNotParseInvalidTMITimestamps(t *testing.T) {
+	t.Parallel()
+
+	for _, in := range []string{"", "garbage", "159447429018a", "-1594474290185"} {
+		parsed, err := ParseTMITimestamp(in)
+		assertTrue(t, errors.Is(err, ErrInvalidTimestamp), fmt.Sprintf("%q did not return ErrInvalidTimestamp", in))
+		assertTrue(t, parsed.IsZero(), fmt.Sprintf("%q was not parsed as the zero time", in))
+	}
+
+	message := ParseMessage("@tmi-sent-ts=garbage :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #gempir :hello").(*PrivateMessage)
+	assertTrue(t, message.Time.IsZero(), "invalid tmi-sent-ts was not parsed as the zero time")
+}
+
+func TestCanParseMessagesFromReader(t *testing.T) {
+	t.Parallel()
+
+	longText := strings.Repeat("Kappa ", 20000)
+	input := "@badges=;color=;display-name=gempir;emotes=;id=1;tmi-sent-ts=1594474290185;user-id=77829817 :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :hello\r\n" +
+		"\n" +
+		":gempir!gempir@gempir.tmi.twitch.tv JOIN #pajlada\n" +
+		"@badges=;color=;display-name=ZZZi;turbo\r\n" +
+		"\r\n" +
+		":gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :" + longText + "\n" +
+		"PING :tmi.twitch.tv"
+
+	var parsed []Message
+	var errs []error
+	err := ParseMessages(strings.NewReader(input), func(message Message, err error) bool {
+		parsed = append(parsed, message)
+		errs = append(errs, err)
+		return true
+	})
+	assertErrorsEqual(t, nil, err)
+
+	assertIntsEqual(t, 5, len(parsed))
+	assertStringsEqual(t, "hello", parsed[0].(*PrivateMessage).Message)
+	assertStringsEqual(t, "pajlada", parsed[1].(*UserJoinMessage).Channel)
+	assertMessageTypesEqual(t, UNSET, parsed[2].GetType())
+	assertTrue(t, errs[2] != nil, "invalid line did not return an error")
+	assertStringsEqual(t, longText, parsed[3].(*PrivateMessage).Message)
+	assertMessageTypesEqual(t, PING, parsed[4].GetType())
+
+	for _, i := range []int{0, 1, 3, 4} {
+		assertErrorsEqual(t, nil, errs[i])
+	}
+}
+
+func TestParseMessageErrReturnsErrorsOfMalformedLines(t *testing.T) {
+	t.Parallel()
+
+	message, err := ParseMessageErr("@badges=;color=;display-name=ZZZi;turbo")
+	assertTrue(t, err != nil, "malformed line did not return an error")
+	assertMessageTypesEqual(t, UNSET, message.GetType())
+	assertStringsEqual(t, "ZZZi", message.(*RawMessage).Tags["display-name"])
+
+	// A valid line with an unknown command is not an error
+	message, err = ParseMessageErr(":tmi.twitch.tv FOOBAR #pajlada :hello")
+	assertErrorsEqual(t, nil, err)
+	assertStringsEqual(t, "FOOBAR", message.(*RawMessage).RawType)
+
+	message, err = ParseMessageErr(":gempir!gempir@gempir.tmi.twitch.tv JOIN #pajlada")
+	assertErrorsEqual(t, nil, err)
+	assertStringsEqual(t, "pajlada", message.(*UserJoinMessage).Channel)
+}
+
+func TestCanStopParsingMessagesFromReader(t *testing.T) {
+	t.Parallel()
+
+	count := 0
+	err := ParseMessages(strings.NewReader("PING :a\nPING :b\nPING :c\n"), func(message Message, err error) bool {
+		count++
+		return count < 2
+	})
+	assertErrorsEqual(t, nil, err)
+	assertIntsEqual(t, 2, count)
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func TestParseMessagesReturnsReadErrors(t *testing.T) {
+	t.Parallel()
+
+	err := ParseMessages(failingReader{}, func(message Message, err error) bool {
+		t.Error("callback called without a line")
+		return true
+	})
+	assertTrue(t, err != nil && err.Error() == "read failed", "read error was not returned")
+}
+
+func TestCanParseBadgesWithoutVersion(t *testing.T) {
+	t.Parallel()
+	testMessage := "@badges=vip,,subscriber/12;display-name=gempir :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :hello"
+
+	message := ParseMessage(testMessage).(*PrivateMessage)
+
+	assertIntsEqual(t, 2, len(message.User.Badges))
+	assertIntsEqual(t, 1, message.User.Badges["vip"])
+	assertIntsEqual(t, 12, message.User.Badges["subscriber"])
+	assertStringsEqual(t, "hello", message.Message)
+}
+
+func TestCanSkipParsingEmotesAndBadges(t *testing.T) {
+	t.Parallel()
+	testMessage := "@badge-info=subscriber/52;badges=moderator/1,subscriber/48;color=#2E8B57;display-name=pajbot;emotes=25:0-4;id=1ad5dc5b-8e2e-4c60-a9bd-7d9b3ab2e4e1;room-id=11148817;source-badges=subscriber/12;tmi-sent-ts=1594474290185;user-id=82008718 :pajbot!pajbot@pajbot.tmi.twitch.tv PRIVMSG #pajlada :Kappa hello"
+
+	message := ParseMessageWithOptions(testMessage, SkipEmotes|SkipBadges).(*PrivateMessage)
+
+	assertIntsEqual(t, 0, len(message.Emotes))
+	assertIntsEqual(t, 0, len(message.User.Badges))
+	assertIntsEqual(t, 0, len(message.SourceBadges))
+	assertStringsEqual(t, "25:0-4", message.Tags["emotes"])
+	assertStringsEqual(t, "moderator/1,subscriber/48", message.Tags["badges"])
+	assertStringsEqual(t, "subscriber/12", message.Tags["source-badges"])
+	assertStringsEqual(t, "Kappa hello", message.Message)
+
+	message = ParseMessageWithOptions(testMessage, SkipEmotes).(*PrivateMessage)
+	assertIntsEqual(t, 0, len(message.Emotes))
+	assertIntsEqual(t, 48, message.User.Badges["subscriber"])
+
+	message = ParseMessage(testMessage).(*PrivateMessage)
+	assertStringsEqual(t, "Kappa", message.Emotes[0].Name)
+	assertIntsEqual(t, 48, message.User.Badges["subscriber"])
+}
+
+func TestCanParseMessageSource(t *testing.T) {
+	t.Parallel()
+
+	rawMessage := ParseMessage(":tmi.twitch.tv 001 justinfan123123 :Welcome, GLHF!").(*RawMessage)
+	assertStringsEqual(t, "tmi.twitch.tv", rawMessage.Source.Host)
+	assertStringsEqual(t, "", rawMessage.Source.Nickname)
+
+	rawMessage = ParseMessage("CAP * ACK :twitch.tv/tags").(*RawMessage)
+	assertTrue(t, rawMessage.Source == nil, "source of a line without prefix is not nil")
+
+	privateMessage := ParseMessage(":jtv!jtv@jtv.tmi.twitch.tv PRIVMSG #pajlada :pajlada is now hosting gempir").(*PrivateMessage)
+	assertStringsEqual(t, "jtv", privateMessage.Source.Nickname)
+	assertStringsEqual(t, "jtv", privateMessage.Source.Username)
+	assertStringsEqual(t, "jtv.tmi.twitch.tv", privateMessage.Source.Host)
+
+	noticeMessage := ParseMessage("@msg-id=emote_only_on :tmi.twitch.tv NOTICE #pajlada :This room is now in emote-only mode.").(*NoticeMessage)
+	assertStringsEqual(t, "tmi.twitch.tv", noticeMessage.Source.Host)
+}
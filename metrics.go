@@ -0,0 +1,170 @@
+package twitch
+
+import (
+	"sync"
+	"time"
+)
+
+// MetricsCollector receives the metrics of a client, e.g. to export them to Prometheus, see SetMetricsCollector.
+// The methods are called from the go-routines of the client while reading and writing, so they must be safe for concurrent use and fast
+type MetricsCollector interface {
+	// MessageReceived counts a message read from the connection, by its type. Messages of unknown commands are counted as UNSET
+	MessageReceived(messageType MessageType)
+	// MessageSent counts a line written to the connection, including the lines sent to log in
+	MessageSent()
+	// BytesRead counts the bytes read from the connection
+	BytesRead(n int)
+	// BytesWritten counts the bytes written to the connection
+	BytesWritten(n int)
+	// ReconnectAttempt counts a reconnect, e.g. because of a RECONNECT message or a missing PONG
+	ReconnectAttempt()
+	// ParseError counts a received line that isn't valid IRC
+	ParseError()
+	// JoinedChannels sets the number of channels the client joined
+	JoinedChannels(count int)
+	// WriteQueueLength sets the number of messages waiting to be written to the connection
+	WriteQueueLength(length int)
+	// PingLatency observes the time between sending a PING and receiving its PONG
+	PingLatency(latency time.Duration)
+	// RecordingDropped counts a line that wasn't written to the recording of SetRecording
+	RecordingDropped()
+}
+
+// NoopMetricsCollector is a MetricsCollector that ignores all metrics, the default of every client.
+// Embed it to implement only some of the methods of MetricsCollector
+type NoopMetricsCollector struct{}
+
+// MessageReceived implements the MetricsCollector interface
+func (NoopMetricsCollector) MessageReceived(messageType MessageType) {}
+
+// MessageSent implements the MetricsCollector interface
+func (NoopMetricsCollector) MessageSent() {}
+
+// BytesRead implements the MetricsCollector interface
+func (NoopMetricsCollector) BytesRead(n int) {}
+
+// BytesWritten implements the MetricsCollector interface
+func (NoopMetricsCollector) BytesWritten(n int) {}
+
+// ReconnectAttempt implements the MetricsCollector interface
+func (NoopMetricsCollector) ReconnectAttempt() {}
+
+// ParseError implements the MetricsCollector interface
+func (NoopMetricsCollector) ParseError() {}
+
+// JoinedChannels implements the MetricsCollector interface
+func (NoopMetricsCollector) JoinedChannels(count int) {}
+
+// WriteQueueLength implements the MetricsCollector interface
+func (NoopMetricsCollector) WriteQueueLength(length int) {}
+
+// PingLatency implements the MetricsCollector interface
+func (NoopMetricsCollector) PingLatency(latency time.Duration) {}
+
+// RecordingDropped implements the MetricsCollector interface
+func (NoopMetricsCollector) RecordingDropped() {}
+
+// MetricsSnapshot is a copy of the metrics kept by a MemoryMetricsCollector
+type MetricsSnapshot struct {
+	MessagesReceived map[MessageType]int
+	MessagesSent     int
+	BytesRead        int
+	BytesWritten     int
+	Reconnects       int
+	ParseErrors      int
+	JoinedChannels   int
+	WriteQueueLength int
+	// PingLatency is the latency of the last PONG, PingCount the number of PONGs received
+	PingLatency time.Duration
+	PingCount   int
+	// RecordingDropped is the number of lines that weren't written to the recording
+	RecordingDropped int
+}
+
+// MemoryMetricsCollector is a MetricsCollector that keeps the metrics in memory, useful for tests and debugging
+type MemoryMetricsCollector struct {
+	mutex   sync.Mutex
+	metrics MetricsSnapshot
+}
+
+// NewMemoryMetricsCollector creates a MemoryMetricsCollector with all metrics at zero
+func NewMemoryMetricsCollector() *MemoryMetricsCollector {
+	return &MemoryMetricsCollector{
+		metrics: MetricsSnapshot{
+			MessagesReceived: map[MessageType]int{},
+		},
+	}
+}
+
+// Snapshot returns a copy of the current metrics
+func (m *MemoryMetricsCollector) Snapshot() MetricsSnapshot {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	snapshot := m.metrics
+	snapshot.MessagesReceived = make(map[MessageType]int, len(m.metrics.MessagesReceived))
+	for messageType, count := range m.metrics.MessagesReceived {
+		snapshot.MessagesReceived[messageType] = count
+	}
+
+	return snapshot
+}
+
+func (m *MemoryMetricsCollector) update(update func(metrics *MetricsSnapshot)) {
+	m.mutex.Lock()
+	update(&m.metrics)
+	m.mutex.Unlock()
+}
+
+// MessageReceived implements the MetricsCollector interface
+func (m *MemoryMetricsCollector) MessageReceived(messageType MessageType) {
+	m.update(func(metrics *MetricsSnapshot) { metrics.MessagesReceived[messageType]++ })
+}
+
+// MessageSent implements the MetricsCollector interface
+func (m *MemoryMetricsCollector) MessageSent() {
+	m.update(func(metrics *MetricsSnapshot) { metrics.MessagesSent++ })
+}
+
+// BytesRead implements the MetricsCollector interface
+func (m *MemoryMetricsCollector) BytesRead(n int) {
+	m.update(func(metrics *MetricsSnapshot) { metrics.BytesRead += n })
+}
+
+// BytesWritten implements the MetricsCollector interface
+func (m *MemoryMetricsCollector) BytesWritten(n int) {
+	m.update(func(metrics *MetricsSnapshot) { metrics.BytesWritten += n })
+}
+
+// ReconnectAttempt implements the MetricsCollector interface
+func (m *MemoryMetricsCollector) ReconnectAttempt() {
+	m.update(func(metrics *MetricsSnapshot) { metrics.Reconnects++ })
+}
+
+// ParseError implements the MetricsCollector interface
+func (m *MemoryMetricsCollector) ParseError() {
+	m.update(func(metrics *MetricsSnapshot) { metrics.ParseErrors++ })
+}
+
+// JoinedChannels implements the MetricsCollector interface
+func (m *MemoryMetricsCollector) JoinedChannels(count int) {
+	m.update(func(metrics *MetricsSnapshot) { metrics.JoinedChannels = count })
+}
+
+// WriteQueueLength implements the MetricsCollector interface
+func (m *MemoryMetricsCollector) WriteQueueLength(length int) {
+	m.update(func(metrics *MetricsSnapshot) { metrics.WriteQueueLength = length })
+}
+
+// PingLatency implements the MetricsCollector interface
+func (m *MemoryMetricsCollector) PingLatency(latency time.Duration) {
+	m.update(func(metrics *MetricsSnapshot) {
+		metrics.PingLatency = latency
+		metrics.PingCount++
+	})
+}
+
+// RecordingDropped implements the MetricsCollector interface
+func (m *MemoryMetricsCollector) RecordingDropped() {
+	m.update(func(metrics *MetricsSnapshot) { metrics.RecordingDropped++ })
+}
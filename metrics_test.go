@@ -0,0 +1,98 @@
+package twitch
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryMetricsCollectorSnapshotIsACopy(t *testing.T) {
+	t.Parallel()
+
+	metrics := NewMemoryMetricsCollector()
+	metrics.MessageReceived(PRIVMSG)
+	metrics.BytesRead(10)
+
+	snapshot := metrics.Snapshot()
+	metrics.MessageReceived(PRIVMSG)
+	metrics.BytesRead(5)
+
+	assertIntsEqual(t, 1, snapshot.MessagesReceived[PRIVMSG])
+	assertIntsEqual(t, 10, snapshot.BytesRead)
+	assertIntsEqual(t, 2, metrics.Snapshot().MessagesReceived[PRIVMSG])
+	assertIntsEqual(t, 15, metrics.Snapshot().BytesRead)
+}
+
+func TestClientReportsMetrics(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+
+	metrics := NewMemoryMetricsCollector()
+	received := make(chan struct{})
+	client := newTestClient(server.Addr)
+	client.SetMetricsCollector(metrics)
+	client.IdlePingInterval = time.Millisecond * 100
+	client.OnPrivateMessage(func(message PrivateMessage) {
+		close(received)
+	})
+	client.Join("gempir", "pajlada")
+	client.Depart("pajlada")
+	disconnected := connectAndEnsureGoodDisconnect(t, client)
+
+	waitForLine(t, server, "JOIN")
+	send(t, server, "@badges= :tmi.twitch.tv")
+	send(t, server, ":gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #gempir :hello")
+	select {
+	case <-received:
+	case <-time.After(time.Second * 3):
+		t.Fatal("no message received")
+	}
+
+	// The server answers the PING with a PONG
+	waitForLine(t, server, "PING")
+	waitForLine(t, server, "PING")
+	send(t, server, ":tmi.twitch.tv RECONNECT")
+	// The channels are joined again once the new connection is welcomed
+	waitForLine(t, server, "JOIN")
+
+	client.Say("gempir", "hi")
+	waitForLine(t, server, "PRIVMSG")
+	client.Disconnect()
+	<-disconnected
+
+	snapshot := metrics.Snapshot()
+	assertIntsEqual(t, 1, snapshot.MessagesReceived[PRIVMSG])
+	assertTrue(t, snapshot.MessagesReceived[PONG] >= 1, "PONG was not counted")
+	assertIntsEqual(t, 1, snapshot.ParseErrors)
+	assertIntsEqual(t, 1, snapshot.Reconnects)
+	assertIntsEqual(t, 1, snapshot.JoinedChannels)
+	assertTrue(t, snapshot.PingCount >= 1, "ping latency was not observed")
+	assertTrue(t, snapshot.PingLatency > 0, "ping latency was not observed")
+	assertTrue(t, snapshot.BytesRead > 0, "bytes read were not counted")
+	// CAP REQ, PASS, NICK and JOIN on both connections, the PRIVMSG and at least one PING
+	assertTrue(t, snapshot.MessagesSent >= 10, "sent messages were not counted")
+	assertTrue(t, snapshot.BytesWritten > 0, "bytes written were not counted")
+
+	// The built-in stats count the same as the collector
+	stats := client.Stats()
+	assertIntsEqual(t, 1, stats.MessagesReceived[PRIVMSG])
+	assertIntsEqual(t, snapshot.MessagesReceived[PONG], stats.MessagesReceived[PONG])
+	assertIntsEqual(t, snapshot.MessagesReceived[UNSET], stats.MessagesReceived[UNSET])
+	assertIntsEqual(t, snapshot.MessagesSent, stats.MessagesSent)
+	assertIntsEqual(t, 1, stats.Reconnects)
+	assertTrue(t, stats.Latency == snapshot.PingLatency, "latency differs from the collector")
+}
+
+func TestStatsAreCopies(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123123")
+	assertErrorsEqual(t, nil, client.Replay(strings.NewReader(":gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #gempir :hello\r\n:tmi.twitch.tv FOOBAR")))
+
+	stats := client.Stats()
+	assertIntsEqual(t, 1, stats.MessagesReceived[PRIVMSG])
+	assertIntsEqual(t, 1, stats.MessagesReceived[UNSET])
+	assertIntsEqual(t, 0, stats.Reconnects)
+
+	stats.MessagesReceived[PRIVMSG] = 10
+	assertIntsEqual(t, 1, client.Stats().MessagesReceived[PRIVMSG])
+}
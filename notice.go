@@ -0,0 +1,85 @@
+package twitch
+
+import "strings"
+
+// NoticeID is the msg-id of a NOTICE message Twitch sends when it rejects a message sent by the client
+// See https://dev.twitch.tv/docs/irc/msg-id/
+type NoticeID string
+
+const (
+	// NoticeUnknown is the reason of a rejection with a msg-id this library doesn't know yet, see NoticeMessage.MsgID for the actual msg-id
+	NoticeUnknown NoticeID = "unknown"
+	// NoticeBanned the client's user is banned from the channel
+	NoticeBanned NoticeID = "msg_banned"
+	// NoticeTimedOut the client's user is timed out in the channel
+	NoticeTimedOut NoticeID = "msg_timedout"
+	// NoticeRateLimit the client sent messages too quickly
+	NoticeRateLimit NoticeID = "msg_ratelimit"
+	// NoticeDuplicate the message is identical to the previous message, sent less than 30 seconds ago
+	NoticeDuplicate NoticeID = "msg_duplicate"
+	// NoticeSlowMode the channel is in slow mode, and the client sent messages too quickly
+	NoticeSlowMode NoticeID = "msg_slowmode"
+	// NoticeFollowersOnly the channel is in followers-only mode, and the client's user doesn't follow the channel
+	NoticeFollowersOnly NoticeID = "msg_followersonly"
+	// NoticeFollowersOnlyFollowed the channel is in followers-only mode, and the client's user doesn't follow the channel long enough
+	NoticeFollowersOnlyFollowed NoticeID = "msg_followersonly_followed"
+	// NoticeFollowersOnlyZero the channel is in followers-only mode, and the client's user doesn't follow the channel
+	NoticeFollowersOnlyZero NoticeID = "msg_followersonly_zero"
+	// NoticeSubsOnly the channel is in subscribers-only mode, and the client's user isn't subscribed
+	NoticeSubsOnly NoticeID = "msg_subsonly"
+	// NoticeEmoteOnly the channel is in emote-only mode, and the message contains text
+	NoticeEmoteOnly NoticeID = "msg_emoteonly"
+	// NoticeR9K the channel is in unique-chat mode, and the message isn't unique
+	NoticeR9K NoticeID = "msg_r9k"
+	// NoticeRejected the message was held back by AutoMod
+	NoticeRejected NoticeID = "msg_rejected"
+	// NoticeRejectedMandatory the message contains a term blocked by the channel
+	NoticeRejectedMandatory NoticeID = "msg_rejected_mandatory"
+	// NoticeChannelSuspended the channel is suspended
+	NoticeChannelSuspended NoticeID = "msg_channel_suspended"
+	// NoticeChannelBlocked the client's user blocked the channel owner
+	NoticeChannelBlocked NoticeID = "msg_channel_blocked"
+	// NoticeSuspended the client's user is suspended
+	NoticeSuspended NoticeID = "msg_suspended"
+	// NoticeVerifiedEmail the channel requires a verified email address to chat
+	NoticeVerifiedEmail NoticeID = "msg_verified_email"
+	// NoticeRequiresVerifiedPhoneNumber the channel requires a verified phone number to chat
+	NoticeRequiresVerifiedPhoneNumber NoticeID = "msg_requires_verified_phone_number"
+)
+
+var sendErrorNoticeIDs = map[NoticeID]bool{
+	NoticeBanned:                      true,
+	NoticeTimedOut:                    true,
+	NoticeRateLimit:                   true,
+	NoticeDuplicate:                   true,
+	NoticeSlowMode:                    true,
+	NoticeFollowersOnly:               true,
+	NoticeFollowersOnlyFollowed:       true,
+	NoticeFollowersOnlyZero:           true,
+	NoticeSubsOnly:                    true,
+	NoticeEmoteOnly:                   true,
+	NoticeR9K:                         true,
+	NoticeRejected:                    true,
+	NoticeRejectedMandatory:           true,
+	NoticeChannelSuspended:            true,
+	NoticeChannelBlocked:              true,
+	NoticeSuspended:                   true,
+	NoticeVerifiedEmail:               true,
+	NoticeRequiresVerifiedPhoneNumber: true,
+}
+
+// parseSendError returns the reason a NOTICE rejects a sent message for.
+// All msg-ids of rejections start with msg_, the ones not known yet are returned as NoticeUnknown.
+// The second return value is false if the NOTICE isn't about a rejected message
+func parseSendError(message *NoticeMessage) (NoticeID, bool) {
+	if !strings.HasPrefix(message.MsgID, "msg_") {
+		return "", false
+	}
+
+	reason := NoticeID(message.MsgID)
+	if !sendErrorNoticeIDs[reason] {
+		return NoticeUnknown, true
+	}
+
+	return reason, true
+}
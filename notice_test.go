@@ -0,0 +1,27 @@
+package twitch
+
+import "testing"
+
+func TestCanParseSendErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		message  string
+		reason   NoticeID
+		rejected bool
+	}{
+		{"@msg-id=msg_banned :tmi.twitch.tv NOTICE #forsen :You are permanently banned from talking in forsen.", NoticeBanned, true},
+		{"@msg-id=msg_followersonly :tmi.twitch.tv NOTICE #forsen :This room is in 10 minutes followers-only mode.", NoticeFollowersOnly, true},
+		{"@msg-id=msg_rejected_mandatory :tmi.twitch.tv NOTICE #forsen :Your message wasn't posted due to conflicts with the channel's moderation settings.", NoticeRejectedMandatory, true},
+		{"@msg-id=msg_something_new :tmi.twitch.tv NOTICE #forsen :Your message was not sent.", NoticeUnknown, true},
+		{"@msg-id=host_on :tmi.twitch.tv NOTICE #forsen :Now hosting nymn.", "", false},
+		{":tmi.twitch.tv NOTICE * :Login authentication failed", "", false},
+	}
+
+	for _, test := range tests {
+		reason, rejected := parseSendError(ParseMessage(test.message).(*NoticeMessage))
+
+		assertStringsEqual(t, string(test.reason), string(reason))
+		assertTrue(t, test.rejected == rejected, "wrong rejection of "+test.message)
+	}
+}
@@ -0,0 +1,100 @@
+package twitch
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// RecordMode decides which lines are written to the recording of a client, see SetRecording
+type RecordMode int
+
+const (
+	// RecordReceived records the lines read from the connection
+	RecordReceived RecordMode = iota
+	// RecordAll records the lines read from the connection and the lines sent by the client, prefixed with "> "
+	RecordAll
+)
+
+// sentLinePrefix marks the lines sent by the client in a recording
+const sentLinePrefix = "> "
+
+// RecordingBufferSize can be modified to change how many lines can wait to be written to the recording.
+// Once exceeded, new lines are dropped instead of blocking the client, see RecordingDropped.
+// Must be configured before SetRecording is called to take effect
+var RecordingBufferSize = 1024
+
+// recorder writes the recorded lines to the writer on its own go-routine, so a slow writer doesn't block reading
+type recorder struct {
+	client     *Client
+	writer     io.Writer
+	mode       RecordMode
+	bufferSize int
+
+	lines   chan string
+	wg      sync.WaitGroup
+	dropped uint64
+}
+
+// start starts writing the recorded lines, the returned function waits until all recorded lines are written
+func (r *recorder) start() func() {
+	if r == nil {
+		return func() {}
+	}
+
+	r.lines = make(chan string, r.bufferSize)
+
+	r.wg.Add(1)
+	go r.write(r.lines)
+
+	return func() {
+		close(r.lines)
+		r.wg.Wait()
+	}
+}
+
+func (r *recorder) write(lines chan string) {
+	defer r.wg.Done()
+
+	failed := false
+	for line := range lines {
+		if failed {
+			r.drop()
+			continue
+		}
+
+		if _, err := io.WriteString(r.writer, line+"\r\n"); err != nil {
+			// The remaining lines are dropped, so the channel doesn't fill up
+			r.client.logger.Errorf("failed to write to the recording, stopped recording: %s", err)
+			failed = true
+			r.drop()
+		}
+	}
+}
+
+// recordReceived records a line read from the connection. The recorder of a client without recording is nil
+func (r *recorder) recordReceived(line string) {
+	if r != nil {
+		r.record(line)
+	}
+}
+
+// recordSent records a line sent by the client, if sent lines are recorded
+func (r *recorder) recordSent(line string) {
+	if r != nil && r.mode == RecordAll {
+		r.record(sentLinePrefix + redactLine(line))
+	}
+}
+
+func (r *recorder) record(line string) {
+	select {
+	case r.lines <- line:
+	default:
+		r.drop()
+	}
+}
+
+func (r *recorder) drop() {
+	atomic.AddUint64(&r.dropped, 1)
+	r.client.metrics.RecordingDropped()
+}
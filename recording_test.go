@@ -0,0 +1,78 @@
+package twitch
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCanRecordSession(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+	// Without the CAP ACK, all lines are read after the client sent its NICK, which keeps the order of the recording stable
+	server.Handle("CAP", nil)
+
+	recording := &bytes.Buffer{}
+	client := newTestClient(server.Addr)
+	client.SetRecording(recording, RecordAll)
+
+	received := make(chan struct{})
+	client.OnPrivateMessage(func(message PrivateMessage) {
+		close(received)
+	})
+	disconnected := connectAndEnsureGoodDisconnect(t, client)
+	waitForLine(t, server, "NICK")
+
+	send(t, server,
+		"@badge-info=subscriber/1;badges=subscriber/0;color=#0000FF;display-name=gempir;emotes=;flags=;id=e8a0ad77-0b3c-4d67-a5fd-4d6f0b8c6c6a;login=gempir;mod=0;msg-id=sub;msg-param-cumulative-months=1;msg-param-sub-plan=1000;room-id=11148817;subscriber=1;system-msg=gempir\\ssubscribed\\sat\\sTier\\s1.;tmi-sent-ts=1490382457309;user-id=77829817;user-type= :tmi.twitch.tv USERNOTICE #pajlada",
+		"@tmi-sent-ts=1490382457359 :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :hello",
+	)
+
+	select {
+	case <-received:
+	case <-time.After(time.Second * 3):
+		t.Fatal("message not received")
+	}
+
+	client.Disconnect()
+	<-disconnected
+
+	assertGolden(t, "recording.txt", recording.Bytes())
+	assertIntsEqual(t, 0, int(client.RecordingDropped()))
+}
+
+func TestCanReplayRecording(t *testing.T) {
+	t.Parallel()
+	recording := "> PASS <redacted>\r\n> NICK justinfan123123\r\n" + recordedSession
+
+	client := NewClient("justinfan123123", "oauth:123123123")
+	var received []string
+	client.OnPrivateMessage(func(message PrivateMessage) {
+		received = append(received, message.Message)
+	})
+
+	assertErrorsEqual(t, nil, client.Replay(strings.NewReader(recording)))
+	assertStringSlicesEqual(t, []string{"first", "second"}, received)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestRecordingDropsLinesOfFailingWriter(t *testing.T) {
+	t.Parallel()
+	metrics := NewMemoryMetricsCollector()
+
+	client := NewClient("justinfan123123", "oauth:123123123")
+	client.SetMetricsCollector(metrics)
+	client.SetRecording(failingWriter{}, RecordReceived)
+
+	assertErrorsEqual(t, nil, client.Replay(strings.NewReader(recordedSession)))
+
+	assertIntsEqual(t, 5, int(client.RecordingDropped()))
+	assertIntsEqual(t, 5, metrics.Snapshot().RecordingDropped)
+}
@@ -0,0 +1,268 @@
+package twitch
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConnectWithConn runs the client on the given stream instead of connecting to Twitch, e.g. to test a bot with a recorded session.
+// The lines read from conn are parsed and dispatched like the lines of a connection, and the lines sent by the client,
+// starting with PASS and NICK, are written to conn. The client is connected once a welcome message (001) is read.
+// Returns nil once conn is read to the end, or ErrClientDisconnected after Disconnect was called.
+// The client doesn't send PINGs and doesn't reconnect, the lines after a RECONNECT message are handled like the lines of a new connection.
+// If conn is an io.Closer, it's closed once the client stops reading
+func (c *Client) ConnectWithConn(conn io.ReadWriter) error {
+	return c.connectStream(&streamConn{reader: conn, writer: conn})
+}
+
+// Replay runs the client on the lines read from reader and discards the lines sent by the client, see ConnectWithConn.
+// The reader can be a recording of SetRecording, the recorded lines sent by the client are skipped.
+// The lines are handled as fast as they're read, wrap reader with RealtimeReader to replay them at their original speed:
+//
+//	file, _ := os.Open("session.log")
+//	client.Replay(twitch.RealtimeReader(file))
+func (c *Client) Replay(reader io.Reader) error {
+	return c.connectStream(&streamConn{reader: reader, writer: io.Discard})
+}
+
+func (c *Client) connectStream(conn *streamConn) error {
+	c.userDisconnect.Reset()
+	c.running.set(true)
+	defer c.running.set(false)
+
+	c.setState(StateConnecting)
+	token, err := c.fetchToken()
+	if err != nil {
+		c.setStopped(err)
+		return err
+	}
+
+	defer c.closeMessages()
+
+	stopRecording := c.recorder.start()
+	defer stopRecording()
+
+	stopDispatchPool := c.startDispatchPool()
+	defer stopDispatchPool()
+
+	c.logger.Infof("reading from a stream")
+
+	err = c.runStream(conn, token)
+	if err != nil && err != ErrClientDisconnected {
+		c.logger.Errorf("reading from the stream failed: %s", err)
+	}
+	c.setStopped(err)
+
+	return err
+}
+
+// runStream reads the lines of conn on the calling go-routine, the writer go-routine writes the sent lines to conn
+func (c *Client) runStream(conn *streamConn, token string) error {
+	c.resetChannelStates()
+
+	wg := sync.WaitGroup{}
+	c.clientReconnect.Reset()
+
+	c.setState(StateAuthenticating)
+	c.setupConnection(conn, token)
+
+	wg.Add(1)
+	go c.startWriter(conn, &wg)
+
+	// Reading blocks until the next line, closing conn makes the read return once Disconnect was called
+	stopped := make(chan struct{})
+	userDisconnect := c.userDisconnect.channel
+	watcher := sync.WaitGroup{}
+	watcher.Add(1)
+	go func() {
+		defer watcher.Done()
+		select {
+		case <-userDisconnect:
+			conn.Close()
+		case <-stopped:
+		}
+	}()
+
+	err := c.readStream(conn)
+	close(stopped)
+	watcher.Wait()
+
+	// Closing clientReconnect stops the writer, the lines it didn't write yet are written afterwards
+	c.clientReconnect.Close()
+	wg.Wait()
+	if err == nil {
+		c.flushWrites(conn)
+	}
+
+	conn.Close()
+
+	return err
+}
+
+func (c *Client) readStream(reader io.Reader) error {
+	tp := textproto.NewReader(bufio.NewReader(reader))
+
+	for {
+		line, err := tp.ReadLine()
+
+		select {
+		case <-c.userDisconnect.channel:
+			return ErrClientDisconnected
+		default:
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// Lines sent by the client in a recording of SetRecording are skipped
+		if strings.HasPrefix(line, sentLinePrefix) {
+			continue
+		}
+		c.metrics.BytesRead(len(line) + 2)
+		c.recorder.recordReceived(line)
+
+		c.handleWelcome(line)
+
+		err = c.handleLine(line)
+		if err == errReconnect {
+			// There's no other stream to connect to, the following lines are expected to start with the welcome of the new connection
+			c.setState(StateReconnecting)
+			c.resetChannelStates()
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// flushWrites writes the lines still queued once the stream ended, so all lines sent while reading the stream are written
+func (c *Client) flushWrites(conn net.Conn) {
+	for {
+		line, ok := c.queuedWrite()
+		if !ok {
+			return
+		}
+
+		if err := c.writeLine(conn, line); err != nil {
+			return
+		}
+	}
+}
+
+// streamConn is the net.Conn of a stream passed to ConnectWithConn or Replay
+type streamConn struct {
+	reader    io.Reader
+	writer    io.Writer
+	closeOnce sync.Once
+}
+
+func (c *streamConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+func (c *streamConn) Write(p []byte) (int, error) {
+	return c.writer.Write(p)
+}
+
+// Close closes the reader if it's an io.Closer, which makes a blocked Read return
+func (c *streamConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		if closer, ok := c.reader.(io.Closer); ok {
+			err = closer.Close()
+		}
+	})
+
+	return err
+}
+
+func (c *streamConn) LocalAddr() net.Addr {
+	return streamAddr{}
+}
+
+func (c *streamConn) RemoteAddr() net.Addr {
+	return streamAddr{}
+}
+
+func (c *streamConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *streamConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *streamConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+type streamAddr struct{}
+
+func (streamAddr) Network() string {
+	return "stream"
+}
+
+func (streamAddr) String() string {
+	return "stream"
+}
+
+// RealtimeReader returns a reader of the lines of reader that delays every line by the time between its tmi-sent-ts tag
+// and the tmi-sent-ts tag of the previous line, so Replay handles a recorded session at its original speed.
+// Lines without a tmi-sent-ts tag aren't delayed
+func RealtimeReader(reader io.Reader) io.Reader {
+	pipeReader, pipeWriter := io.Pipe()
+
+	go func() {
+		buffered := bufio.NewReader(reader)
+		var previous time.Time
+
+		for {
+			line, err := buffered.ReadString('\n')
+			if line != "" {
+				if sent, ok := lineSentTime(line); ok {
+					if !previous.IsZero() && sent.After(previous) {
+						time.Sleep(sent.Sub(previous))
+					}
+					previous = sent
+				}
+
+				// Writing fails once the returned reader was closed
+				if _, writeErr := pipeWriter.Write([]byte(line)); writeErr != nil {
+					return
+				}
+			}
+
+			if err != nil {
+				_ = pipeWriter.CloseWithError(err)
+				return
+			}
+		}
+	}()
+
+	return pipeReader
+}
+
+// lineSentTime returns the time of the tmi-sent-ts tag of a raw line
+func lineSentTime(line string) (time.Time, bool) {
+	if !strings.HasPrefix(line, "@") {
+		return time.Time{}, false
+	}
+
+	rawTags := line
+	if index := strings.IndexByte(line, ' '); index >= 0 {
+		rawTags = line[:index]
+	}
+
+	sent, err := ParseTMITimestamp(parseIRCTags(rawTags)["tmi-sent-ts"])
+
+	return sent, err == nil
+}
@@ -0,0 +1,120 @@
+package twitch
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const recordedSession = ":tmi.twitch.tv 001 justinfan123123 :Welcome, GLHF!\r\n" +
+	":justinfan123123!justinfan123123@justinfan123123.tmi.twitch.tv JOIN #pajlada\r\n" +
+	"@tmi-sent-ts=1490382457309 :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :first\r\n" +
+	"PING :tmi.twitch.tv\r\n" +
+	"@tmi-sent-ts=1490382457359 :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :second"
+
+func TestCanReplayRecordedSession(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123123")
+
+	connects := 0
+	client.OnConnect(func() {
+		connects++
+	})
+	var received []string
+	client.OnPrivateMessage(func(message PrivateMessage) {
+		received = append(received, message.Message)
+	})
+	client.OnSelfJoinMessage(func(message UserJoinMessage) {
+		received = append(received, "joined "+message.Channel)
+	})
+
+	assertErrorsEqual(t, nil, client.Replay(strings.NewReader(recordedSession)))
+
+	assertIntsEqual(t, 1, connects)
+	assertStringSlicesEqual(t, []string{"joined pajlada", "first", "second"}, received)
+	assertFalse(t, client.Connected(), "client is connected after the replay ended")
+}
+
+func TestCanReplayTwice(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123123")
+
+	var received []string
+	client.OnPrivateMessage(func(message PrivateMessage) {
+		received = append(received, message.Message)
+	})
+
+	assertErrorsEqual(t, nil, client.Replay(strings.NewReader(recordedSession)))
+	assertErrorsEqual(t, nil, client.Replay(strings.NewReader(recordedSession)))
+
+	assertStringSlicesEqual(t, []string{"first", "second", "first", "second"}, received)
+}
+
+func TestConnectWithConnWritesSentLines(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123123")
+	client.Join("pajlada")
+
+	written := &bytes.Buffer{}
+	conn := struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader(recordedSession), written}
+
+	assertErrorsEqual(t, nil, client.ConnectWithConn(conn))
+
+	lines := strings.Split(strings.TrimSuffix(written.String(), "\r\n"), "\r\n")
+	assertStringSlicesEqual(t, []string{
+		"CAP REQ :" + strings.Join(DefaultCapabilities, " "),
+		"PASS oauth:123123123",
+		"NICK justinfan123123",
+	}, lines[:3])
+
+	// The PONG is written before the JOIN if both are waiting to be written
+	queued := lines[3:]
+	sort.Strings(queued)
+	assertStringSlicesEqual(t, []string{"JOIN #pajlada", "PONG :tmi.twitch.tv"}, queued)
+}
+
+func TestCanDisconnectWhileReplaying(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123123")
+
+	reader, writer := io.Pipe()
+	go func() {
+		_, _ = writer.Write([]byte(":tmi.twitch.tv 001 justinfan123123 :Welcome, GLHF!\r\n"))
+	}()
+
+	replayed := make(chan error)
+	go func() {
+		replayed <- client.Replay(reader)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	assertErrorsEqual(t, nil, client.WaitConnected(ctx))
+	assertErrorsEqual(t, nil, client.Disconnect())
+
+	select {
+	case err := <-replayed:
+		assertErrorsEqual(t, ErrClientDisconnected, err)
+	case <-time.After(time.Second * 3):
+		t.Fatal("Replay didn't return after Disconnect")
+	}
+}
+
+func TestRealtimeReaderDelaysLinesByTheirTimestamps(t *testing.T) {
+	t.Parallel()
+
+	start := time.Now()
+	data, err := io.ReadAll(RealtimeReader(strings.NewReader(recordedSession)))
+	elapsed := time.Since(start)
+
+	assertErrorsEqual(t, nil, err)
+	assertStringsEqual(t, recordedSession, string(data))
+	assertTrue(t, elapsed >= 50*time.Millisecond, "lines weren't delayed, took "+elapsed.String())
+}
@@ -0,0 +1,244 @@
+package twitch
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// RoomState is the current state of a channel, merged from all ROOMSTATE messages received since joining it.
+// Twitch sends the full state when joining a channel, and only the changed settings afterwards
+// See https://dev.twitch.tv/docs/irc/tags/#roomstate-tags
+type RoomState struct {
+	Channel string
+	RoomID  string
+
+	// EmoteOnly whether only messages made of emotes are allowed
+	EmoteOnly bool
+	// FollowersOnly is the number of minutes a user has to follow the channel to chat.
+	// 0 means all followers can chat, -1 means followers-only mode is disabled
+	FollowersOnly int
+	// R9K whether unique-chat mode is enabled
+	R9K bool
+	// Rituals whether new chatter rituals are enabled
+	Rituals bool
+	// Slow is the number of seconds users have to wait between messages, 0 if slow mode is disabled
+	Slow int
+	// SubsOnly whether only subscribers can chat
+	SubsOnly bool
+
+	// State contains the raw values of all state tags received so far
+	State map[string]int
+}
+
+func newRoomState(channel, roomID string, state map[string]int) RoomState {
+	roomState := RoomState{
+		Channel: channel,
+		RoomID:  roomID,
+		State:   make(map[string]int, len(state)),
+	}
+
+	for tag, value := range state {
+		roomState.State[tag] = value
+	}
+
+	roomState.EmoteOnly = state["emote-only"] == 1
+	roomState.FollowersOnly = -1
+	if value, ok := state["followers-only"]; ok {
+		roomState.FollowersOnly = value
+	}
+	roomState.R9K = state["r9k"] == 1
+	roomState.Rituals = state["rituals"] == 1
+	roomState.Slow = state["slow"]
+	roomState.SubsOnly = state["subs-only"] == 1
+
+	return roomState
+}
+
+// Twitch sends the full state when joining a channel, but only the changed tags afterwards. The bool accessors of
+// a RoomStateMessage return false for tags the message doesn't contain, the int accessors return false as the second value
+
+// EmoteOnlyEnabled returns whether the message enables emote-only mode
+func (msg *RoomStateMessage) EmoteOnlyEnabled() bool {
+	return msg.State["emote-only"] == 1
+}
+
+// R9KEnabled returns whether the message enables unique-chat mode
+func (msg *RoomStateMessage) R9KEnabled() bool {
+	return msg.State["r9k"] == 1
+}
+
+// RitualsEnabled returns whether the message enables new chatter rituals
+func (msg *RoomStateMessage) RitualsEnabled() bool {
+	return msg.State["rituals"] == 1
+}
+
+// SubsOnlyEnabled returns whether the message enables subscribers-only mode
+func (msg *RoomStateMessage) SubsOnlyEnabled() bool {
+	return msg.State["subs-only"] == 1
+}
+
+// FollowersOnlyMinutes returns the number of minutes a user has to follow the channel to chat, see RoomState.FollowersOnly.
+// The second return value is false if the message doesn't contain the followers-only tag
+func (msg *RoomStateMessage) FollowersOnlyMinutes() (int, bool) {
+	minutes, ok := msg.State["followers-only"]
+	return minutes, ok
+}
+
+// SlowSeconds returns the number of seconds users have to wait between messages, 0 if slow mode is disabled.
+// The second return value is false if the message doesn't contain the slow tag
+func (msg *RoomStateMessage) SlowSeconds() (int, bool) {
+	seconds, ok := msg.State["slow"]
+	return seconds, ok
+}
+
+// roomModeChange is the payload of the events of the room modes, e.g. the slowModeEvent. value is the raw value of the ROOMSTATE tag
+type roomModeChange struct {
+	channel string
+	value   int
+}
+
+// roomModes are the ROOMSTATE tags of the modes with their own callbacks, like OnSlowMode
+var roomModes = []struct {
+	tag   string
+	event handlerEvent
+}{
+	{"emote-only", emoteOnlyEvent},
+	{"subs-only", subModeEvent},
+	{"slow", slowModeEvent},
+	{"followers-only", followersModeEvent},
+}
+
+// RoomStateChange is a setting of a channel that changed, see Client.OnRoomStateChange.
+// The values are bools for the on/off settings emote-only, r9k, rituals and subs-only, and ints for all others
+type RoomStateChange struct {
+	// Setting is the ROOMSTATE tag of the setting, e.g. "slow"
+	Setting string
+	// OldValue is nil if the setting was unknown before, which is the case for the state received when joining the channel
+	OldValue interface{}
+	NewValue interface{}
+}
+
+func (c RoomStateChange) String() string {
+	oldValue := "unknown"
+	if c.OldValue != nil {
+		oldValue = fmt.Sprint(c.OldValue)
+	}
+
+	return fmt.Sprintf("%s: %s -> %v", c.Setting, oldValue, c.NewValue)
+}
+
+// roomStateChanges is the payload of the roomStateChangeEvent
+type roomStateChanges struct {
+	channel string
+	changes []RoomStateChange
+}
+
+// roomStateValue returns the typed value of a raw ROOMSTATE tag value
+func roomStateValue(tag string, value int) interface{} {
+	switch tag {
+	case "emote-only", "r9k", "rituals", "subs-only":
+		return value == 1
+	}
+
+	return value
+}
+
+// diffRoomStates returns the settings that differ between the states of a channel, sorted by their tag
+func diffRoomStates(before, after RoomState) []RoomStateChange {
+	tags := make([]string, 0, len(after.State))
+	for tag := range after.State {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	var changes []RoomStateChange
+	for _, tag := range tags {
+		value := after.State[tag]
+
+		change := RoomStateChange{
+			Setting:  tag,
+			NewValue: roomStateValue(tag, value),
+		}
+		if previous, ok := before.State[tag]; ok {
+			if previous == value {
+				continue
+			}
+			change.OldValue = roomStateValue(tag, previous)
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+type roomStateEntry struct {
+	roomID string
+	state  map[string]int
+}
+
+// roomStateCache merges the ROOMSTATE messages of each channel
+type roomStateCache struct {
+	mutex    sync.RWMutex
+	channels map[string]*roomStateEntry
+}
+
+func newRoomStateCache() *roomStateCache {
+	return &roomStateCache{
+		channels: map[string]*roomStateEntry{},
+	}
+}
+
+// update merges the message into the state of its channel and returns the state before and after merging
+func (r *roomStateCache) update(message *RoomStateMessage) (before RoomState, after RoomState) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	entry, ok := r.channels[message.Channel]
+	if !ok {
+		entry = &roomStateEntry{
+			state: map[string]int{},
+		}
+		r.channels[message.Channel] = entry
+	}
+
+	before = newRoomState(message.Channel, entry.roomID, entry.state)
+
+	if message.RoomID != "" {
+		entry.roomID = message.RoomID
+	}
+	for tag, value := range message.State {
+		entry.state[tag] = value
+	}
+
+	after = newRoomState(message.Channel, entry.roomID, entry.state)
+
+	return before, after
+}
+
+func (r *roomStateCache) get(channel string) (RoomState, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	entry, ok := r.channels[channel]
+	if !ok {
+		return RoomState{}, false
+	}
+
+	return newRoomState(channel, entry.roomID, entry.state), true
+}
+
+func (r *roomStateCache) remove(channel string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.channels, channel)
+}
+
+func (r *roomStateCache) reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.channels = map[string]*roomStateEntry{}
+}
@@ -0,0 +1,186 @@
+package twitch
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRoomStateCacheMergesDeltas(t *testing.T) {
+	cache := newRoomStateCache()
+
+	fullState := ParseMessage("@emote-only=0;followers-only=-1;r9k=0;rituals=0;room-id=11148817;slow=0;subs-only=0 :tmi.twitch.tv ROOMSTATE #pajlada").(*RoomStateMessage)
+	cache.update(fullState)
+
+	slowDelta := ParseMessage("@room-id=11148817;slow=10 :tmi.twitch.tv ROOMSTATE #pajlada").(*RoomStateMessage)
+	before, after := cache.update(slowDelta)
+
+	assertIntsEqual(t, 0, before.Slow)
+	assertIntsEqual(t, 10, after.Slow)
+
+	roomState, ok := cache.get("pajlada")
+	assertTrue(t, ok, "room state of pajlada is missing")
+	assertStringsEqual(t, "pajlada", roomState.Channel)
+	assertStringsEqual(t, "11148817", roomState.RoomID)
+	assertIntsEqual(t, 10, roomState.Slow)
+	assertIntsEqual(t, -1, roomState.FollowersOnly)
+	assertFalse(t, roomState.EmoteOnly, "emote-only was enabled")
+	assertFalse(t, roomState.SubsOnly, "subs-only was enabled")
+	assertIntsEqual(t, 6, len(roomState.State))
+
+	cache.remove("pajlada")
+	_, ok = cache.get("pajlada")
+	assertFalse(t, ok, "room state of pajlada was not removed")
+}
+
+func TestRoomStateIsACopy(t *testing.T) {
+	cache := newRoomStateCache()
+	cache.update(ParseMessage("@room-id=11148817;slow=10 :tmi.twitch.tv ROOMSTATE #pajlada").(*RoomStateMessage))
+
+	roomState, _ := cache.get("pajlada")
+	roomState.State["slow"] = 20
+
+	roomState, _ = cache.get("pajlada")
+	assertIntsEqual(t, 10, roomState.State["slow"])
+}
+
+const roomModesSession = "@emote-only=0;followers-only=-1;r9k=0;rituals=0;room-id=11148817;slow=0;subs-only=0 :tmi.twitch.tv ROOMSTATE #pajlada\r\n" +
+	"@room-id=11148817;slow=10 :tmi.twitch.tv ROOMSTATE #pajlada\r\n" +
+	"@room-id=11148817;slow=10 :tmi.twitch.tv ROOMSTATE #pajlada\r\n" +
+	"@emote-only=1;room-id=11148817 :tmi.twitch.tv ROOMSTATE #pajlada\r\n" +
+	"@followers-only=10;room-id=11148817 :tmi.twitch.tv ROOMSTATE #pajlada\r\n" +
+	"@room-id=11148817;subs-only=1 :tmi.twitch.tv ROOMSTATE #pajlada\r\n" +
+	"@emote-only=0;room-id=11148817 :tmi.twitch.tv ROOMSTATE #pajlada"
+
+func recordRoomModes(client *Client) *[]string {
+	var changes []string
+	client.OnEmoteOnly(func(channel string, enabled bool) {
+		changes = append(changes, fmt.Sprintf("%s emote-only %t", channel, enabled))
+	})
+	client.OnSubMode(func(channel string, enabled bool) {
+		changes = append(changes, fmt.Sprintf("%s subs-only %t", channel, enabled))
+	})
+	client.OnSlowMode(func(channel string, seconds int) {
+		changes = append(changes, fmt.Sprintf("%s slow %d", channel, seconds))
+	})
+	client.OnFollowersMode(func(channel string, minutes int) {
+		changes = append(changes, fmt.Sprintf("%s followers-only %d", channel, minutes))
+	})
+
+	return &changes
+}
+
+func TestRoomModeCallbacksAreCalledForChanges(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123123")
+	changes := recordRoomModes(client)
+
+	assertErrorsEqual(t, nil, client.Replay(strings.NewReader(roomModesSession)))
+
+	assertStringSlicesEqual(t, []string{
+		"pajlada slow 10",
+		"pajlada emote-only true",
+		"pajlada followers-only 10",
+		"pajlada subs-only true",
+		"pajlada emote-only false",
+	}, *changes)
+}
+
+func TestRoomModeCallbacksCanBeCalledForTheInitialState(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123123")
+	client.SetNotifyInitialRoomModes(true)
+	changes := recordRoomModes(client)
+
+	firstLine := strings.SplitN(roomModesSession, "\r\n", 2)[0]
+	assertErrorsEqual(t, nil, client.Replay(strings.NewReader(firstLine)))
+
+	assertStringSlicesEqual(t, []string{
+		"pajlada emote-only false",
+		"pajlada subs-only false",
+		"pajlada slow 0",
+		"pajlada followers-only -1",
+	}, *changes)
+}
+
+func TestCanReportRoomStateChanges(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123123")
+
+	var changes []string
+	client.OnRoomStateChange(func(channel string, roomStateChanges []RoomStateChange) {
+		for _, change := range roomStateChanges {
+			changes = append(changes, channel+" "+change.String())
+		}
+	})
+
+	firstLine := strings.SplitN(roomModesSession, "\r\n", 2)[0]
+	assertErrorsEqual(t, nil, client.Replay(strings.NewReader(firstLine)))
+
+	// The state received when joining changes all settings from unknown
+	assertStringSlicesEqual(t, []string{
+		"pajlada emote-only: unknown -> false",
+		"pajlada followers-only: unknown -> -1",
+		"pajlada r9k: unknown -> false",
+		"pajlada rituals: unknown -> false",
+		"pajlada slow: unknown -> 0",
+		"pajlada subs-only: unknown -> false",
+	}, changes)
+
+	changes = nil
+	assertErrorsEqual(t, nil, client.Replay(strings.NewReader(roomModesSession)))
+
+	// Replay resets the room states when it starts, so the first line is reported from unknown again
+	assertStringSlicesEqual(t, []string{
+		"pajlada slow: 0 -> 10",
+		"pajlada emote-only: false -> true",
+		"pajlada followers-only: -1 -> 10",
+		"pajlada subs-only: false -> true",
+		"pajlada emote-only: true -> false",
+	}, changes[6:])
+}
+
+func TestRoomStateChangesAreTyped(t *testing.T) {
+	before := newRoomState("pajlada", "11148817", map[string]int{"slow": 0, "subs-only": 0})
+	after := newRoomState("pajlada", "11148817", map[string]int{"slow": 30, "subs-only": 1, "r9k": 1})
+
+	changes := diffRoomStates(before, after)
+	assertIntsEqual(t, 3, len(changes))
+
+	assertStringsEqual(t, "r9k", changes[0].Setting)
+	assertTrue(t, changes[0].OldValue == nil, "r9k was known before")
+	assertTrue(t, changes[0].NewValue == true, "r9k isn't a bool")
+
+	assertStringsEqual(t, "slow", changes[1].Setting)
+	assertTrue(t, changes[1].OldValue == 0, "old slow isn't the int 0")
+	assertTrue(t, changes[1].NewValue == 30, "new slow isn't the int 30")
+
+	assertStringsEqual(t, "subs-only: false -> true", changes[2].String())
+	assertIntsEqual(t, 0, len(diffRoomStates(after, after)))
+}
+
+func TestRoomStateMessageAccessors(t *testing.T) {
+	fullState := ParseMessage("@emote-only=1;followers-only=10;r9k=0;rituals=1;room-id=11148817;slow=0;subs-only=1 :tmi.twitch.tv ROOMSTATE #pajlada").(*RoomStateMessage)
+
+	assertTrue(t, fullState.EmoteOnlyEnabled(), "emote-only was not enabled")
+	assertFalse(t, fullState.R9KEnabled(), "r9k was enabled")
+	assertTrue(t, fullState.RitualsEnabled(), "rituals were not enabled")
+	assertTrue(t, fullState.SubsOnlyEnabled(), "subs-only was not enabled")
+
+	minutes, ok := fullState.FollowersOnlyMinutes()
+	assertTrue(t, ok, "followers-only was missing")
+	assertIntsEqual(t, 10, minutes)
+	seconds, ok := fullState.SlowSeconds()
+	assertTrue(t, ok, "slow was missing")
+	assertIntsEqual(t, 0, seconds)
+
+	// A delta only contains the changed tags
+	slowDelta := ParseMessage("@room-id=11148817;slow=30 :tmi.twitch.tv ROOMSTATE #pajlada").(*RoomStateMessage)
+
+	assertFalse(t, slowDelta.RitualsEnabled(), "rituals were enabled by a slow mode delta")
+	_, ok = slowDelta.FollowersOnlyMinutes()
+	assertFalse(t, ok, "followers-only was in a slow mode delta")
+	seconds, ok = slowDelta.SlowSeconds()
+	assertTrue(t, ok, "slow was missing")
+	assertIntsEqual(t, 30, seconds)
+}
@@ -0,0 +1,156 @@
+package twitch
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// SentMessageConfirmation reports whether Twitch acknowledged a message sent with Say, SendMe or Reply.
+// Twitch acknowledges a message with a USERSTATE message, which echoes the client-nonce of the sent message
+type SentMessageConfirmation struct {
+	Channel string
+	Nonce   string
+	Text    string
+	SentAt  time.Time
+
+	// Confirmed is false if Twitch didn't acknowledge the message within the SendConfirmationTimeout,
+	// e.g. because the message was held by AutoMod or dropped
+	Confirmed bool
+	// MessageID is the id Twitch gave the message, which can be used to delete it. Empty if the message is unconfirmed
+	MessageID string
+	// RejectReason is the reason Twitch rejected the message for, see OnSendError. Empty if the message wasn't rejected
+	RejectReason NoticeID
+}
+
+type pendingSend struct {
+	confirmation SentMessageConfirmation
+	timer        *time.Timer
+	// done receives the message once it's confirmed, rejected or given up on, nil if nobody waits for it, see SayAndWait
+	done chan<- SentMessageConfirmation
+}
+
+// finish hands the final state of the message to the waiter, done is buffered so this never blocks
+func (p *pendingSend) finish(confirmation SentMessageConfirmation) SentMessageConfirmation {
+	if p.done != nil {
+		p.done <- confirmation
+	}
+
+	return confirmation
+}
+
+// sendTracker keeps the sent messages waiting for their confirmation, in the order they were sent.
+// Once the limit is reached, the oldest pending message is given up on to make room for the next
+type sendTracker struct {
+	mutex   sync.Mutex
+	limit   int
+	pending map[string]*list.Element
+	order   *list.List
+}
+
+func newSendTracker(limit int) *sendTracker {
+	if limit < 1 {
+		limit = 1
+	}
+
+	return &sendTracker{
+		limit:   limit,
+		pending: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// add starts waiting for the confirmation of a sent message. expire is called with the unconfirmed message after the timeout.
+// If the tracker is full, the oldest pending message is removed and returned, it must be reported as unconfirmed by the caller.
+// done may be nil, otherwise it must be buffered and receives the message once it's no longer pending
+func (t *sendTracker) add(confirmation SentMessageConfirmation, timeout time.Duration, expire func(SentMessageConfirmation),
+	done chan<- SentMessageConfirmation) (SentMessageConfirmation, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var evicted SentMessageConfirmation
+	full := t.order.Len() >= t.limit
+	if full {
+		oldest := t.removeElement(t.order.Front())
+		evicted = oldest.finish(oldest.confirmation)
+	}
+
+	nonce := confirmation.Nonce
+	t.pending[nonce] = t.order.PushBack(&pendingSend{
+		confirmation: confirmation,
+		done:         done,
+		timer: time.AfterFunc(timeout, func() {
+			if expired, ok := t.remove(nonce); ok {
+				expire(expired.finish(expired.confirmation))
+			}
+		}),
+	})
+
+	return evicted, full
+}
+
+// confirm removes a pending message and returns it confirmed with the given message id.
+// Returns false if no message with the nonce is pending, e.g. because it was sent by another client
+func (t *sendTracker) confirm(nonce, messageID string) (SentMessageConfirmation, bool) {
+	pending, ok := t.remove(nonce)
+	if !ok {
+		return SentMessageConfirmation{}, false
+	}
+
+	confirmation := pending.confirmation
+	confirmation.Confirmed = true
+	confirmation.MessageID = messageID
+
+	return pending.finish(confirmation), true
+}
+
+// reject removes the oldest pending message of the channel and returns it with the reason it was rejected for.
+// Rejections don't echo the client-nonce, so they can only be matched by channel, and Twitch handles messages in order.
+// Returns false if no message of the channel is pending
+func (t *sendTracker) reject(channel string, reason NoticeID) (SentMessageConfirmation, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for element := t.order.Front(); element != nil; element = element.Next() {
+		if element.Value.(*pendingSend).confirmation.Channel != channel {
+			continue
+		}
+
+		pending := t.removeElement(element)
+		confirmation := pending.confirmation
+		confirmation.RejectReason = reason
+
+		return pending.finish(confirmation), true
+	}
+
+	return SentMessageConfirmation{}, false
+}
+
+// remove removes a pending message without finishing it, the caller reports its final state
+func (t *sendTracker) remove(nonce string) (*pendingSend, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	element, ok := t.pending[nonce]
+	if !ok {
+		return nil, false
+	}
+
+	return t.removeElement(element), true
+}
+
+// removeElement must be called with the mutex held
+func (t *sendTracker) removeElement(element *list.Element) *pendingSend {
+	pending := t.order.Remove(element).(*pendingSend)
+	pending.timer.Stop()
+	delete(t.pending, pending.confirmation.Nonce)
+
+	return pending
+}
+
+func (t *sendTracker) len() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.order.Len()
+}
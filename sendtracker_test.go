@@ -0,0 +1,112 @@
+package twitch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSendTrackerConfirmsPendingMessages(t *testing.T) {
+	t.Parallel()
+	tracker := newSendTracker(10)
+
+	_, evicted := tracker.add(SentMessageConfirmation{Channel: "pajlada", Nonce: "a", Text: "hello"}, time.Minute, func(SentMessageConfirmation) {
+		t.Error("confirmed message expired")
+	}, nil)
+	assertFalse(t, evicted, "message was evicted from a tracker with room")
+
+	confirmation, ok := tracker.confirm("a", "1234")
+	assertTrue(t, ok, "pending message was not confirmed")
+	assertTrue(t, confirmation.Confirmed, "confirmation is not marked as confirmed")
+	assertStringsEqual(t, "1234", confirmation.MessageID)
+	assertStringsEqual(t, "hello", confirmation.Text)
+
+	_, ok = tracker.confirm("a", "1234")
+	assertFalse(t, ok, "message was confirmed twice")
+	assertIntsEqual(t, 0, tracker.len())
+}
+
+func TestSendTrackerExpiresPendingMessages(t *testing.T) {
+	t.Parallel()
+	tracker := newSendTracker(10)
+	expired := make(chan SentMessageConfirmation, 1)
+
+	tracker.add(SentMessageConfirmation{Nonce: "a"}, time.Millisecond, func(confirmation SentMessageConfirmation) {
+		expired <- confirmation
+	}, nil)
+
+	select {
+	case confirmation := <-expired:
+		assertStringsEqual(t, "a", confirmation.Nonce)
+		assertFalse(t, confirmation.Confirmed, "expired message is marked as confirmed")
+	case <-time.After(time.Second):
+		t.Fatal("pending message did not expire")
+	}
+
+	_, ok := tracker.confirm("a", "1234")
+	assertFalse(t, ok, "expired message was confirmed")
+}
+
+func TestSendTrackerIsBounded(t *testing.T) {
+	t.Parallel()
+	tracker := newSendTracker(2)
+	noExpire := func(SentMessageConfirmation) {}
+
+	tracker.add(SentMessageConfirmation{Nonce: "a"}, time.Minute, noExpire, nil)
+	tracker.add(SentMessageConfirmation{Nonce: "b"}, time.Minute, noExpire, nil)
+	evicted, ok := tracker.add(SentMessageConfirmation{Nonce: "c"}, time.Minute, noExpire, nil)
+
+	assertTrue(t, ok, "no message was evicted from a full tracker")
+	assertStringsEqual(t, "a", evicted.Nonce)
+	assertIntsEqual(t, 2, tracker.len())
+
+	_, ok = tracker.confirm("a", "1234")
+	assertFalse(t, ok, "evicted message was confirmed")
+}
+
+func TestSendTrackerRejectsOldestMessageOfChannel(t *testing.T) {
+	t.Parallel()
+	tracker := newSendTracker(10)
+	noExpire := func(SentMessageConfirmation) {}
+
+	tracker.add(SentMessageConfirmation{Channel: "pajlada", Nonce: "a"}, time.Minute, noExpire, nil)
+	tracker.add(SentMessageConfirmation{Channel: "forsen", Nonce: "b"}, time.Minute, noExpire, nil)
+	tracker.add(SentMessageConfirmation{Channel: "forsen", Nonce: "c"}, time.Minute, noExpire, nil)
+
+	rejected, ok := tracker.reject("forsen", NoticeBanned)
+	assertTrue(t, ok, "pending message was not rejected")
+	assertStringsEqual(t, "b", rejected.Nonce)
+	assertStringsEqual(t, string(NoticeBanned), string(rejected.RejectReason))
+	assertFalse(t, rejected.Confirmed, "rejected message is marked as confirmed")
+
+	_, ok = tracker.reject("nymn", NoticeBanned)
+	assertFalse(t, ok, "message of another channel was rejected")
+	assertIntsEqual(t, 2, tracker.len())
+}
+
+func TestSendTrackerFinishesWaitedMessages(t *testing.T) {
+	t.Parallel()
+	tracker := newSendTracker(2)
+	noExpire := func(SentMessageConfirmation) {}
+
+	confirmed := make(chan SentMessageConfirmation, 1)
+	rejected := make(chan SentMessageConfirmation, 1)
+	evicted := make(chan SentMessageConfirmation, 1)
+
+	tracker.add(SentMessageConfirmation{Channel: "forsen", Nonce: "a"}, time.Minute, noExpire, evicted)
+	tracker.add(SentMessageConfirmation{Channel: "pajlada", Nonce: "b"}, time.Minute, noExpire, confirmed)
+	tracker.confirm("b", "1234")
+	tracker.add(SentMessageConfirmation{Channel: "pajlada", Nonce: "c"}, time.Minute, noExpire, rejected)
+	tracker.add(SentMessageConfirmation{Channel: "pajlada", Nonce: "d"}, time.Minute, noExpire, nil)
+	tracker.reject("pajlada", NoticeBanned)
+
+	confirmation := <-confirmed
+	assertTrue(t, confirmation.Confirmed, "waited message was not confirmed")
+	assertStringsEqual(t, "1234", confirmation.MessageID)
+
+	confirmation = <-evicted
+	assertStringsEqual(t, "a", confirmation.Nonce)
+	assertFalse(t, confirmation.Confirmed, "evicted message was confirmed")
+
+	confirmation = <-rejected
+	assertStringsEqual(t, string(NoticeBanned), string(confirmation.RejectReason))
+}
@@ -0,0 +1,291 @@
+package twitch
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnsupportedMessage returned from SerializeMessage for message types that can't be serialized
+var ErrUnsupportedMessage = errors.New("message type can not be serialized")
+
+// twitchHost is the source of messages sent by the Twitch server itself
+const twitchHost = "tmi.twitch.tv"
+
+// SerializeMessage turns a message back into a raw IRC line, the inverse of ParseMessage.
+// Supported are PRIVMSG, WHISPER, CLEARCHAT, USERNOTICE, ROOMSTATE, NOTICE, JOIN and PART messages.
+//
+// The Tags map is the source of the tags of the line. The typed fields (ID, RoomID, Time, User, Emotes, ...)
+// are only used for tags missing from Tags, so messages built by hand without a Tags map serialize as well.
+// The source of the line is the parsed Source of the message, or the source of the Raw line for messages without one.
+// Only when both are empty a source is built, <login>!<login>@<login>.tmi.twitch.tv for users and tmi.twitch.tv otherwise.
+// Some details of the original line can't be represented and are not kept: the rest of the Raw line is ignored,
+// tags are written sorted by key, and tag values lose the leading and trailing whitespace ParseMessage trims
+func SerializeMessage(message Message) (string, error) {
+	switch msg := message.(type) {
+	case *PrivateMessage:
+		return serializePrivateMessage(msg), nil
+	case *WhisperMessage:
+		return serializeWhisperMessage(msg), nil
+	case *ClearChatMessage:
+		return serializeClearChatMessage(msg), nil
+	case *UserNoticeMessage:
+		return serializeUserNoticeMessage(msg), nil
+	case *RoomStateMessage:
+		return serializeRoomStateMessage(msg), nil
+	case *NoticeMessage:
+		return serializeNoticeMessage(msg), nil
+	case *UserJoinMessage:
+		return formatIRCLine(nil, messageSource(nil, msg.Raw, userSource(msg.User)), "JOIN", "#"+msg.Channel), nil
+	case *UserPartMessage:
+		return formatIRCLine(nil, messageSource(nil, msg.Raw, userSource(msg.User)), "PART", "#"+msg.Channel), nil
+	}
+
+	return "", ErrUnsupportedMessage
+}
+
+func serializePrivateMessage(msg *PrivateMessage) string {
+	tags := copyTags(msg.Tags)
+	setUserTags(tags, msg.User)
+	setTag(tags, "id", msg.ID)
+	setTag(tags, "room-id", msg.RoomID)
+	setTag(tags, "tmi-sent-ts", formatTime(msg.Time))
+	setTag(tags, "emotes", formatEmotes(msg.Emotes))
+	setTag(tags, "custom-reward-id", msg.CustomRewardID)
+	setTag(tags, "client-nonce", msg.ClientNonce)
+	setTag(tags, "source-room-id", msg.SourceRoomID)
+	setTag(tags, "source-id", msg.SourceID)
+	setTag(tags, "source-badges", formatBadges(msg.SourceBadges))
+	if msg.Bits != 0 {
+		setTag(tags, "bits", strconv.Itoa(msg.Bits))
+	}
+	if msg.FirstMessage {
+		setTag(tags, "first-msg", "1")
+	}
+	if msg.EmoteOnly {
+		setTag(tags, "emote-only", "1")
+	}
+	setTag(tags, "msg-id", msg.MsgID)
+	setTag(tags, "flags", formatFlags(msg.Flags))
+	if msg.Reply != nil {
+		setTag(tags, "reply-parent-msg-id", msg.Reply.ParentMsgID)
+		setTag(tags, "reply-parent-user-id", msg.Reply.ParentUserID)
+		setTag(tags, "reply-parent-user-login", msg.Reply.ParentUserLogin)
+		setTag(tags, "reply-parent-display-name", msg.Reply.ParentDisplayName)
+		setTag(tags, "reply-parent-msg-body", msg.Reply.ParentMsgBody)
+	}
+
+	return formatIRCLine(tags, messageSource(msg.Source, msg.Raw, userSource(msg.User.Name)), "PRIVMSG", "#"+msg.Channel, ":"+formatAction(msg.Message, msg.Action))
+}
+
+func serializeWhisperMessage(msg *WhisperMessage) string {
+	tags := copyTags(msg.Tags)
+	setUserTags(tags, msg.User)
+	setTag(tags, "message-id", msg.MessageID)
+	setTag(tags, "thread-id", msg.ThreadID)
+	setTag(tags, "emotes", formatEmotes(msg.Emotes))
+
+	return formatIRCLine(tags, messageSource(msg.Source, msg.Raw, userSource(msg.User.Name)), "WHISPER", msg.Target, ":"+formatAction(msg.Message, msg.Action))
+}
+
+func serializeClearChatMessage(msg *ClearChatMessage) string {
+	tags := copyTags(msg.Tags)
+	setTag(tags, "room-id", msg.RoomID)
+	setTag(tags, "tmi-sent-ts", formatTime(msg.Time))
+	setTag(tags, "target-user-id", msg.TargetUserID)
+	if msg.BanDuration != 0 {
+		setTag(tags, "ban-duration", strconv.Itoa(int(msg.BanDuration/time.Second)))
+	}
+	setTag(tags, "ban-reason", msg.BanReason)
+
+	params := []string{"#" + msg.Channel}
+	if msg.TargetUsername != "" {
+		params = append(params, ":"+msg.TargetUsername)
+	}
+
+	return formatIRCLine(tags, messageSource(nil, msg.Raw, ":"+twitchHost), "CLEARCHAT", params...)
+}
+
+func serializeUserNoticeMessage(msg *UserNoticeMessage) string {
+	tags := copyTags(msg.Tags)
+	setUserTags(tags, msg.User)
+	setTag(tags, "login", msg.User.Name)
+	setTag(tags, "id", msg.ID)
+	setTag(tags, "room-id", msg.RoomID)
+	setTag(tags, "tmi-sent-ts", formatTime(msg.Time))
+	setTag(tags, "emotes", formatEmotes(msg.Emotes))
+	setTag(tags, "msg-id", msg.MsgID)
+	setTag(tags, "system-msg", msg.SystemMsg)
+	for tag, value := range msg.MsgParams {
+		setTag(tags, tag, value)
+	}
+
+	params := []string{"#" + msg.Channel}
+	if msg.Message != "" {
+		params = append(params, ":"+msg.Message)
+	}
+
+	return formatIRCLine(tags, messageSource(nil, msg.Raw, ":"+twitchHost), "USERNOTICE", params...)
+}
+
+func serializeRoomStateMessage(msg *RoomStateMessage) string {
+	tags := copyTags(msg.Tags)
+	setTag(tags, "room-id", msg.RoomID)
+	for tag, value := range msg.State {
+		setTag(tags, tag, strconv.Itoa(value))
+	}
+
+	return formatIRCLine(tags, messageSource(nil, msg.Raw, ":"+twitchHost), "ROOMSTATE", "#"+msg.Channel)
+}
+
+func serializeNoticeMessage(msg *NoticeMessage) string {
+	tags := copyTags(msg.Tags)
+	setTag(tags, "msg-id", msg.MsgID)
+
+	// Notices not bound to a channel, like a failed login, are sent to *
+	target := "#" + msg.Channel
+	if msg.Channel == "*" {
+		target = msg.Channel
+	}
+
+	return formatIRCLine(tags, messageSource(msg.Source, msg.Raw, ":"+twitchHost), "NOTICE", target, ":"+msg.Message)
+}
+
+// formatIRCLine joins the parts of a line, the trailing parameter must already be prefixed with a colon
+func formatIRCLine(tags map[string]string, source, command string, params ...string) string {
+	var line strings.Builder
+
+	if len(tags) > 0 {
+		line.WriteString(formatIRCTags(tags))
+		line.WriteByte(' ')
+	}
+
+	line.WriteString(source)
+	line.WriteByte(' ')
+	line.WriteString(command)
+
+	for _, param := range params {
+		line.WriteByte(' ')
+		line.WriteString(param)
+	}
+
+	return line.String()
+}
+
+func userSource(login string) string {
+	return ":" + login + "!" + login + "@" + login + "." + twitchHost
+}
+
+// messageSource returns the parsed source if it's set, else the source of the raw line, else the built source
+func messageSource(source *IRCMessageSource, raw, built string) string {
+	if source != nil && *source != (IRCMessageSource{}) {
+		return formatIRCMessageSource(*source)
+	}
+
+	if raw != "" {
+		if parsed, err := ParseIRCLine(raw); err == nil && parsed.Source != (IRCMessageSource{}) {
+			return formatIRCMessageSource(parsed.Source)
+		}
+	}
+
+	return built
+}
+
+// formatIRCMessageSource formats a source as nickname!username@host, leaving out the missing parts
+func formatIRCMessageSource(source IRCMessageSource) string {
+	var formatted strings.Builder
+	formatted.WriteByte(':')
+	formatted.WriteString(source.Nickname)
+
+	if source.Username != "" {
+		formatted.WriteByte('!')
+		formatted.WriteString(source.Username)
+	}
+
+	if source.Host != "" {
+		if source.Nickname != "" || source.Username != "" {
+			formatted.WriteByte('@')
+		}
+		formatted.WriteString(source.Host)
+	}
+
+	return formatted.String()
+}
+
+func copyTags(tags map[string]string) map[string]string {
+	copied := make(map[string]string, len(tags))
+	for tag, value := range tags {
+		copied[tag] = value
+	}
+
+	return copied
+}
+
+// setTag sets a tag from a typed field, unless the tag is already set or the field is empty
+func setTag(tags map[string]string, tag, value string) {
+	if value == "" {
+		return
+	}
+
+	if _, ok := tags[tag]; !ok {
+		tags[tag] = value
+	}
+}
+
+func setUserTags(tags map[string]string, user User) {
+	setTag(tags, "user-id", user.ID)
+	setTag(tags, "display-name", user.DisplayName)
+	setTag(tags, "color", user.Color)
+	setTag(tags, "badges", formatBadges(user.Badges))
+	setTag(tags, "user-type", string(user.UserType))
+	if user.Turbo {
+		setTag(tags, "turbo", "1")
+	}
+}
+
+func formatAction(text string, action bool) string {
+	if !action {
+		return text
+	}
+
+	return "\u0001ACTION " + text + "\u0001"
+}
+
+func formatTime(sent time.Time) string {
+	if sent.IsZero() {
+		return ""
+	}
+
+	return strconv.FormatInt(sent.UnixNano()/1e6, 10)
+}
+
+func formatBadges(badges map[string]int) string {
+	names := make([]string, 0, len(badges))
+	for name := range badges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	formatted := make([]string, len(names))
+	for i, name := range names {
+		formatted[i] = name + "/" + strconv.Itoa(badges[name])
+	}
+
+	return strings.Join(formatted, ",")
+}
+
+func formatEmotes(emotes []*Emote) string {
+	formatted := make([]string, 0, len(emotes))
+	for _, emote := range emotes {
+		positions := make([]string, len(emote.Positions))
+		for i, position := range emote.Positions {
+			positions[i] = strconv.Itoa(position.Start) + "-" + strconv.Itoa(position.End)
+		}
+
+		formatted = append(formatted, emote.ID+":"+strings.Join(positions, ","))
+	}
+
+	return strings.Join(formatted, "/")
+}
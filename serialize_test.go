@@ -0,0 +1,134 @@
+package twitch
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// clearRaw removes the Raw field, which holds the original line and differs after serializing
+func clearRaw(message Message) Message {
+	switch msg := message.(type) {
+	case *PrivateMessage:
+		msg.Raw = ""
+	case *WhisperMessage:
+		msg.Raw = ""
+	case *ClearChatMessage:
+		msg.Raw = ""
+	case *UserNoticeMessage:
+		msg.Raw = ""
+	case *RoomStateMessage:
+		msg.Raw = ""
+	case *NoticeMessage:
+		msg.Raw = ""
+	case *UserJoinMessage:
+		msg.Raw = ""
+	case *UserPartMessage:
+		msg.Raw = ""
+	}
+
+	return message
+}
+
+func assertRoundTrip(t *testing.T, line string) {
+	original := ParseMessage(line)
+
+	serialized, err := SerializeMessage(original)
+	if err != nil {
+		t.Fatalf("failed to serialize %q: %s", line, err)
+	}
+
+	reparsed := ParseMessage(serialized)
+
+	if !reflect.DeepEqual(clearRaw(original), clearRaw(reparsed)) {
+		t.Fatalf("round trip changed message\noriginal:   %s\nserialized: %s", line, serialized)
+	}
+}
+
+func TestCanRoundTripLog(t *testing.T) {
+	t.Parallel()
+
+	for _, line := range messages {
+		assertRoundTrip(t, line)
+	}
+}
+
+func TestCanRoundTripMessages(t *testing.T) {
+	t.Parallel()
+
+	testMessages := []string{
+		"@badges=;color=#00FF7F;display-name=Danielps1;emotes=;message-id=20;thread-id=32591953_77829817;turbo=0;user-id=32591953;user-type= :danielps1!danielps1@danielps1.tmi.twitch.tv WHISPER gempir :i like memes",
+		"@badges=;color=#1E90FF;display-name=FletcherCodes;emotes=;message-id=50;thread-id=269899575_408892348;turbo=0;user-id=269899575;user-type= :fletchercodes!fletchercodes@fletchercodes.tmi.twitch.tv WHISPER clippyassistant :\u0001ACTION tests whisper action\u0001",
+		"@badge-info=subscriber/52;badges=moderator/1,subscriber/48;color=#2E8B57;display-name=pajbot;emotes=80481_BW:28-34,36-42/301683486:44-53;flags=;id=1ad5dc5b-8e2e-4c60-a9bd-7d9b3ab2e4e1;mod=1;room-id=11148817;subscriber=1;tmi-sent-ts=1594474290185;turbo=0;user-id=82008718;user-type=mod :pajbot!pajbot@pajbot.tmi.twitch.tv PRIVMSG #pajlada :pajaCheese pajaCheese pajaCheese _pajaW _pajaW LUL LUL pajaCheese",
+		"@badges=;color=;display-name=gempir;emotes=;id=1;mod=0;reply-parent-display-name=Pajlada;reply-parent-msg-body=hello\\sthere\\:\\sa\\\\b;reply-parent-msg-id=2;reply-parent-user-id=3;reply-parent-user-login=pajlada;room-id=11148817;tmi-sent-ts=1594474290185;user-id=77829817 :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :\u0001ACTION :) waves\u0001",
+		"@ban-duration=600;room-id=11148817;target-user-id=40910607;tmi-sent-ts=1594474290185 :tmi.twitch.tv CLEARCHAT #pajlada :ampzyh",
+		"@room-id=11148817;tmi-sent-ts=1594474290185 :tmi.twitch.tv CLEARCHAT #pajlada",
+		`@badge-info=subscriber/34;badges=subscriber/24,premium/1;color=#1FD2FF;display-name=Karl_Kons;emotes=28087:0-6;flags=;id=7c95beea-a7ac-4c10-9e0a-d7dbf163c038;login=karl_kons;mod=0;msg-id=resub;msg-param-cumulative-months=34;msg-param-months=0;msg-param-should-share-streak=0;msg-param-sub-plan-name=look\sat\sthose\sshitty\semotes,\srip\s$5\sLUL;msg-param-sub-plan=1000;room-id=11148817;subscriber=1;system-msg=Karl_Kons\ssubscribed\sat\sTier\s1.\sThey've\ssubscribed\sfor\s34\smonths!;tmi-sent-ts=1540140252828;turbo=0;user-id=68706331;user-type= :tmi.twitch.tv USERNOTICE #pajlada :WutFace WutFace`,
+		"@emote-only=0;followers-only=-1;r9k=0;rituals=0;room-id=11148817;slow=0;subs-only=0 :tmi.twitch.tv ROOMSTATE #pajlada",
+		"@msg-id=host_on :tmi.twitch.tv NOTICE #pajlada :Now hosting nymn.",
+		":tmi.twitch.tv NOTICE * :Login authentication failed",
+		":gempir!gempir@gempir.tmi.twitch.tv JOIN #pajlada",
+		":gempir!gempir@gempir.tmi.twitch.tv PART #pajlada",
+	}
+
+	for _, line := range testMessages {
+		assertRoundTrip(t, line)
+	}
+}
+
+func TestSerializeKeepsTheSourceOfMessages(t *testing.T) {
+	t.Parallel()
+
+	testMessages := []string{
+		":irc.example.com NOTICE * :Improperly formatted auth",
+		":gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :hello",
+		"@msg-id=host_on :jtv!jtv@jtv.tmi.twitch.tv NOTICE #pajlada :Now hosting nymn.",
+		"@room-id=11148817 :irc.example.com CLEARCHAT #pajlada",
+		":gempir!gempir@irc.example.com JOIN #pajlada",
+	}
+
+	for _, line := range testMessages {
+		serialized, err := SerializeMessage(ParseMessage(line))
+		assertErrorsEqual(t, nil, err)
+		assertStringsEqual(t, line, serialized)
+	}
+}
+
+func TestCanSerializeMessageWithoutTags(t *testing.T) {
+	t.Parallel()
+
+	message := &PrivateMessage{
+		User: User{
+			ID:          "77829817",
+			Name:        "gempir",
+			DisplayName: "gempir",
+			Badges:      map[string]int{"subscriber": 12, "moderator": 1},
+		},
+		Channel: "pajlada",
+		RoomID:  "11148817",
+		ID:      "1ad5dc5b",
+		Message: "hello there; Kappa",
+		Time:    time.Unix(1594474290, 185000000),
+		Emotes: []*Emote{
+			{ID: "25", Positions: []EmotePosition{{Start: 13, End: 17}}},
+		},
+	}
+
+	serialized, err := SerializeMessage(message)
+	assertErrorsEqual(t, nil, err)
+	assertStringsEqual(t, "@badges=moderator/1,subscriber/12;display-name=gempir;emotes=25:13-17;id=1ad5dc5b;room-id=11148817;tmi-sent-ts=1594474290185;user-id=77829817 :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #pajlada :hello there; Kappa", serialized)
+
+	parsed := ParseMessage(serialized).(*PrivateMessage)
+	assertStringsEqual(t, message.Message, parsed.Message)
+	assertStringsEqual(t, message.ID, parsed.ID)
+	assertStringIntMapsEqual(t, message.User.Badges, parsed.User.Badges)
+	assertTrue(t, message.Time.Equal(parsed.Time), "time changed")
+	assertStringsEqual(t, "Kappa", parsed.Emotes[0].Name)
+}
+
+func TestCanNotSerializeUnsupportedMessage(t *testing.T) {
+	t.Parallel()
+
+	_, err := SerializeMessage(ParseMessage(":tmi.twitch.tv RECONNECT"))
+	assertErrorsEqual(t, ErrUnsupportedMessage, err)
+}
@@ -0,0 +1,577 @@
+package twitch
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ShardedClient spreads the joined channels over multiple connections, called shards.
+// A single connection degrades with hundreds of busy channels, and every connection has its own join rate limit.
+// Each channel is joined on the shard with the fewest channels. When a shard stops for good,
+// e.g. because Twitch rejected its login, its channels are joined on the remaining shards.
+// All shards share the callbacks attached to the ShardedClient, callbacks like OnConnect are called once per shard
+type ShardedClient struct {
+	shards []*Client
+
+	mutex sync.Mutex
+	// channelShards is the index of the shard each joined channel is assigned to
+	channelShards map[string]int
+	// stopped holds the shards whose Connect returned
+	stopped       []bool
+	disconnecting bool
+}
+
+// NewShardedClient creates a ShardedClient with the given number of shards, which all log in as the same user.
+// Configure the shards through Shards before calling Connect
+func NewShardedClient(username, oauth string, shards int) *ShardedClient {
+	if shards < 1 {
+		shards = 1
+	}
+
+	client := &ShardedClient{
+		shards:        make([]*Client, shards),
+		channelShards: map[string]int{},
+		stopped:       make([]bool, shards),
+	}
+
+	handlers := newHandlerRegistry()
+	idle := newIdleTimers()
+	for i := range client.shards {
+		shard := NewClient(username, oauth)
+		shard.handlers = handlers
+		shard.idleTimers = idle
+		client.shards[i] = shard
+	}
+
+	return client
+}
+
+// Shards returns the clients of all shards, e.g. to set options on each of them before calling Connect.
+// Join, Depart and sending messages must go through the ShardedClient, so the channels are joined on the right shard
+func (s *ShardedClient) Shards() []*Client {
+	return append([]*Client(nil), s.shards...)
+}
+
+// ShardCount returns the number of shards
+func (s *ShardedClient) ShardCount() int {
+	return len(s.shards)
+}
+
+// ChannelCounts returns the number of channels assigned to each shard, in the order of Shards
+func (s *ShardedClient) ChannelCounts() []int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.channelCounts()
+}
+
+// channelCounts must be called with the mutex held
+func (s *ShardedClient) channelCounts() []int {
+	counts := make([]int, len(s.shards))
+	for _, shard := range s.channelShards {
+		counts[shard]++
+	}
+
+	return counts
+}
+
+// assignShard returns the running shard with the fewest channels, or the first shard if all shards stopped.
+// Must be called with the mutex held
+func (s *ShardedClient) assignShard() int {
+	counts := s.channelCounts()
+
+	assigned := -1
+	for shard, count := range counts {
+		if s.stopped[shard] {
+			continue
+		}
+
+		if assigned < 0 || count < counts[assigned] {
+			assigned = shard
+		}
+	}
+
+	if assigned < 0 {
+		return 0
+	}
+
+	return assigned
+}
+
+// Join joins the channels, each on the shard with the fewest channels.
+// Returns ErrInvalidChannel without joining any of the channels if one of them is invalid, see Client.Join
+func (s *ShardedClient) Join(channels ...string) error {
+	channels, err := normalizeChannels(channels)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	joins := make([][]string, len(s.shards))
+	for _, channel := range channels {
+		if _, ok := s.channelShards[channel]; ok {
+			continue
+		}
+
+		shard := s.assignShard()
+		s.channelShards[channel] = shard
+		joins[shard] = append(joins[shard], channel)
+	}
+	s.mutex.Unlock()
+
+	for shard, channels := range joins {
+		if len(channels) > 0 {
+			_ = s.shards[shard].Join(channels...)
+		}
+	}
+
+	return nil
+}
+
+// Depart leaves the channel on the shard it was joined on.
+// Returns ErrInvalidChannel if the channel is invalid, see Client.Depart
+func (s *ShardedClient) Depart(channel string) error {
+	channel, err := normalizeChannel(channel)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	shard, ok := s.channelShards[channel]
+	delete(s.channelShards, channel)
+	s.mutex.Unlock()
+
+	if ok {
+		return s.shards[shard].Depart(channel)
+	}
+
+	return nil
+}
+
+// ShardOf returns the index in Shards of the shard the channel is joined on, false if the channel wasn't joined
+func (s *ShardedClient) ShardOf(channel string) (int, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	channel, _ = normalizeChannel(channel)
+	shard, ok := s.channelShards[channel]
+
+	return shard, ok
+}
+
+// Rebalance moves channels from the running shards with the most channels to the ones with the fewest channels,
+// until their channel counts differ by at most one. Moved channels are parted on their old shard and joined on the new one.
+// Connect rebalances the channels before connecting, so the channels of shards that stopped before are spread again
+func (s *ShardedClient) Rebalance() {
+	s.mutex.Lock()
+	moves := s.rebalance()
+	s.mutex.Unlock()
+
+	for _, move := range moves {
+		_ = s.shards[move.from].Depart(move.channel)
+		_ = s.shards[move.to].Join(move.channel)
+	}
+}
+
+// channelMove is a channel moved from one shard to another by rebalance
+type channelMove struct {
+	channel  string
+	from, to int
+}
+
+// rebalance assigns the channels to their new shards and returns the moves. Must be called with the mutex held
+func (s *ShardedClient) rebalance() []channelMove {
+	shardChannels := make([][]string, len(s.shards))
+	for channel, shard := range s.channelShards {
+		shardChannels[shard] = append(shardChannels[shard], channel)
+	}
+	for _, channels := range shardChannels {
+		sort.Strings(channels)
+	}
+
+	var moves []channelMove
+	for {
+		fullest, emptiest := -1, -1
+		for shard, channels := range shardChannels {
+			if s.stopped[shard] {
+				continue
+			}
+			if fullest < 0 || len(channels) > len(shardChannels[fullest]) {
+				fullest = shard
+			}
+			if emptiest < 0 || len(channels) < len(shardChannels[emptiest]) {
+				emptiest = shard
+			}
+		}
+
+		if fullest < 0 || len(shardChannels[fullest])-len(shardChannels[emptiest]) <= 1 {
+			return moves
+		}
+
+		last := len(shardChannels[fullest]) - 1
+		channel := shardChannels[fullest][last]
+		shardChannels[fullest] = shardChannels[fullest][:last]
+		shardChannels[emptiest] = append(shardChannels[emptiest], channel)
+
+		s.channelShards[channel] = emptiest
+		moves = append(moves, channelMove{channel: channel, from: fullest, to: emptiest})
+	}
+}
+
+// Client returns the shard the channel is joined on. Use it for the methods of the channel not on ShardedClient,
+// e.g. RoomState or the chat commands. Channels that weren't joined are sent from the first shard
+func (s *ShardedClient) Client(channel string) *Client {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	channel, _ = normalizeChannel(channel)
+
+	return s.shards[s.channelShards[channel]]
+}
+
+// Say write something in a chat, from the shard the channel is joined on
+func (s *ShardedClient) Say(channel, text string) error {
+	return s.Client(channel).Say(channel, text)
+}
+
+// SayAndWait write something in a chat and wait for Twitch to acknowledge it, from the shard the channel is joined on, see Client.SayAndWait
+func (s *ShardedClient) SayAndWait(ctx context.Context, channel, text string) (PrivateMessage, error) {
+	return s.Client(channel).SayAndWait(ctx, channel, text)
+}
+
+// SendMe write a /me message in a chat, from the shard the channel is joined on
+func (s *ShardedClient) SendMe(channel, text string) error {
+	return s.Client(channel).SendMe(channel, text)
+}
+
+// Reply to a message previously sent in the same channel, from the shard the channel is joined on
+func (s *ShardedClient) Reply(channel, parentMsgID, text string) error {
+	return s.Client(channel).Reply(channel, parentMsgID, text)
+}
+
+// Userlist returns the users in the channel, from the shard the channel is joined on
+func (s *ShardedClient) Userlist(channel string) ([]string, error) {
+	return s.Client(channel).Userlist(channel)
+}
+
+// UnknownMessageCount returns how many messages of unknown commands all shards received, see Client.UnknownMessageCount
+func (s *ShardedClient) UnknownMessageCount() uint64 {
+	var count uint64
+	for _, shard := range s.shards {
+		count += shard.UnknownMessageCount()
+	}
+
+	return count
+}
+
+// PendingSends returns the number of lines waiting to be written on all shards, see Client.PendingSends
+func (s *ShardedClient) PendingSends() int {
+	pending := 0
+	for _, shard := range s.shards {
+		pending += shard.PendingSends()
+	}
+
+	return pending
+}
+
+// Stats returns the counters of all shards added up, see Client.Stats. Latency is the highest latency of the shards
+func (s *ShardedClient) Stats() Stats {
+	stats := Stats{
+		MessagesReceived: map[MessageType]int{},
+	}
+
+	for _, shard := range s.shards {
+		shardStats := shard.Stats()
+		for messageType, count := range shardStats.MessagesReceived {
+			stats.MessagesReceived[messageType] += count
+		}
+		stats.MessagesSent += shardStats.MessagesSent
+		stats.Reconnects += shardStats.Reconnects
+		if shardStats.Latency > stats.Latency {
+			stats.Latency = shardStats.Latency
+		}
+	}
+
+	return stats
+}
+
+// Connect connects all shards, and blocks until all of them stopped.
+// Returns ErrClientDisconnected after Disconnect, otherwise the error of the last shard that stopped
+func (s *ShardedClient) Connect() error {
+	s.mutex.Lock()
+	s.disconnecting = false
+	for shard := range s.stopped {
+		s.stopped[shard] = false
+	}
+	s.mutex.Unlock()
+
+	// The shards that stopped during the last Connect are running again
+	s.Rebalance()
+
+	errs := make(chan error, len(s.shards))
+	for shard := range s.shards {
+		go func(shard int) {
+			err := s.shards[shard].Connect()
+			s.shardStopped(shard)
+			errs <- err
+		}(shard)
+	}
+
+	var err error
+	for range s.shards {
+		err = <-errs
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.disconnecting {
+		return ErrClientDisconnected
+	}
+
+	return err
+}
+
+// shardStopped joins the channels of a stopped shard on the remaining shards, unless the ShardedClient is disconnecting
+func (s *ShardedClient) shardStopped(stopped int) {
+	s.mutex.Lock()
+	s.stopped[stopped] = true
+	if s.disconnecting {
+		s.mutex.Unlock()
+		return
+	}
+
+	var moved []string
+	for channel, shard := range s.channelShards {
+		if shard == stopped {
+			moved = append(moved, channel)
+			delete(s.channelShards, channel)
+		}
+	}
+	s.mutex.Unlock()
+
+	for _, channel := range moved {
+		_ = s.shards[stopped].Depart(channel)
+	}
+
+	// All shards stopped, the channels are kept on the first shard to be joined on the next Connect
+	_ = s.Join(moved...)
+}
+
+// Disconnect disconnects all shards. Returns ErrConnectionIsNotOpen if none of the shards were connected
+func (s *ShardedClient) Disconnect() error {
+	s.mutex.Lock()
+	s.disconnecting = true
+	s.mutex.Unlock()
+
+	err := ErrConnectionIsNotOpen
+	for _, shard := range s.shards {
+		if shard.Disconnect() == nil {
+			err = nil
+		}
+	}
+
+	return err
+}
+
+// OnConnect attaches the callback to all shards, see Client.OnConnect
+func (s *ShardedClient) OnConnect(callback func()) HandlerID {
+	return s.shards[0].OnConnect(callback)
+}
+
+// OnWhisperMessage attaches the callback to all shards, see Client.OnWhisperMessage
+func (s *ShardedClient) OnWhisperMessage(callback func(message WhisperMessage)) HandlerID {
+	return s.shards[0].OnWhisperMessage(callback)
+}
+
+// OnPrivateMessage attaches the callback to all shards, see Client.OnPrivateMessage
+func (s *ShardedClient) OnPrivateMessage(callback func(message PrivateMessage)) HandlerID {
+	return s.shards[0].OnPrivateMessage(callback)
+}
+
+// OnClearChatMessage attaches the callback to all shards, see Client.OnClearChatMessage
+func (s *ShardedClient) OnClearChatMessage(callback func(message ClearChatMessage)) HandlerID {
+	return s.shards[0].OnClearChatMessage(callback)
+}
+
+// OnClearMessage attaches the callback to all shards, see Client.OnClearMessage
+func (s *ShardedClient) OnClearMessage(callback func(message ClearMessage)) HandlerID {
+	return s.shards[0].OnClearMessage(callback)
+}
+
+// OnRoomStateMessage attaches the callback to all shards, see Client.OnRoomStateMessage
+func (s *ShardedClient) OnRoomStateMessage(callback func(message RoomStateMessage)) HandlerID {
+	return s.shards[0].OnRoomStateMessage(callback)
+}
+
+// OnUserNoticeMessage attaches the callback to all shards, see Client.OnUserNoticeMessage
+func (s *ShardedClient) OnUserNoticeMessage(callback func(message UserNoticeMessage)) HandlerID {
+	return s.shards[0].OnUserNoticeMessage(callback)
+}
+
+// OnUserStateMessage attaches the callback to all shards, see Client.OnUserStateMessage
+func (s *ShardedClient) OnUserStateMessage(callback func(message UserStateMessage)) HandlerID {
+	return s.shards[0].OnUserStateMessage(callback)
+}
+
+// OnGlobalUserStateMessage attaches the callback to all shards, see Client.OnGlobalUserStateMessage
+func (s *ShardedClient) OnGlobalUserStateMessage(callback func(message GlobalUserStateMessage)) HandlerID {
+	return s.shards[0].OnGlobalUserStateMessage(callback)
+}
+
+// OnNoticeMessage attaches the callback to all shards, see Client.OnNoticeMessage
+func (s *ShardedClient) OnNoticeMessage(callback func(message NoticeMessage)) HandlerID {
+	return s.shards[0].OnNoticeMessage(callback)
+}
+
+// OnUserJoinMessage attaches the callback to all shards, see Client.OnUserJoinMessage
+func (s *ShardedClient) OnUserJoinMessage(callback func(message UserJoinMessage)) HandlerID {
+	return s.shards[0].OnUserJoinMessage(callback)
+}
+
+// OnUserPartMessage attaches the callback to all shards, see Client.OnUserPartMessage
+func (s *ShardedClient) OnUserPartMessage(callback func(message UserPartMessage)) HandlerID {
+	return s.shards[0].OnUserPartMessage(callback)
+}
+
+// OnSelfJoinMessage attaches the callback to all shards, see Client.OnSelfJoinMessage
+func (s *ShardedClient) OnSelfJoinMessage(callback func(message UserJoinMessage)) HandlerID {
+	return s.shards[0].OnSelfJoinMessage(callback)
+}
+
+// OnSelfPartMessage attaches the callback to all shards, see Client.OnSelfPartMessage
+func (s *ShardedClient) OnSelfPartMessage(callback func(message UserPartMessage)) HandlerID {
+	return s.shards[0].OnSelfPartMessage(callback)
+}
+
+// OnReconnectMessage attaches the callback to all shards, see Client.OnReconnectMessage
+func (s *ShardedClient) OnReconnectMessage(callback func(message ReconnectMessage)) HandlerID {
+	return s.shards[0].OnReconnectMessage(callback)
+}
+
+// OnNamesMessage attaches the callback to all shards, see Client.OnNamesMessage
+func (s *ShardedClient) OnNamesMessage(callback func(message NamesMessage)) HandlerID {
+	return s.shards[0].OnNamesMessage(callback)
+}
+
+// OnPingMessage attaches the callback to all shards, see Client.OnPingMessage
+func (s *ShardedClient) OnPingMessage(callback func(message PingMessage)) HandlerID {
+	return s.shards[0].OnPingMessage(callback)
+}
+
+// OnPongMessage attaches the callback to all shards, see Client.OnPongMessage
+func (s *ShardedClient) OnPongMessage(callback func(message PongMessage)) HandlerID {
+	return s.shards[0].OnPongMessage(callback)
+}
+
+// OnUnsetMessage attaches the callback to all shards, see Client.OnUnsetMessage
+func (s *ShardedClient) OnUnsetMessage(callback func(message RawMessage)) HandlerID {
+	return s.shards[0].OnUnsetMessage(callback)
+}
+
+// OnUnknownMessage attaches the callback to all shards, see Client.OnUnknownMessage
+func (s *ShardedClient) OnUnknownMessage(callback func(message RawMessage)) HandlerID {
+	return s.shards[0].OnUnknownMessage(callback)
+}
+
+// OnPingSent attaches the callback to all shards, see Client.OnPingSent
+func (s *ShardedClient) OnPingSent(callback func()) HandlerID {
+	return s.shards[0].OnPingSent(callback)
+}
+
+// OnHandlerPanic attaches the callback to all shards, see Client.OnHandlerPanic
+func (s *ShardedClient) OnHandlerPanic(callback func(message Message, recovered interface{}, stack []byte)) HandlerID {
+	return s.shards[0].OnHandlerPanic(callback)
+}
+
+// OnMessageDropped attaches the callback to all shards, see Client.OnMessageDropped
+func (s *ShardedClient) OnMessageDropped(callback func(message Message)) HandlerID {
+	return s.shards[0].OnMessageDropped(callback)
+}
+
+// OnEmoteSetsChanged attaches the callback to all shards, see Client.OnEmoteSetsChanged
+func (s *ShardedClient) OnEmoteSetsChanged(callback func(added, removed []string)) HandlerID {
+	return s.shards[0].OnEmoteSetsChanged(callback)
+}
+
+// OnSendError attaches the callback to all shards, see Client.OnSendError
+func (s *ShardedClient) OnSendError(callback func(channel string, reason NoticeID, notice NoticeMessage)) HandlerID {
+	return s.shards[0].OnSendError(callback)
+}
+
+// OnUserlistChange attaches the callback to all shards, see Client.OnUserlistChange
+func (s *ShardedClient) OnUserlistChange(callback func(channel string, joined, parted []string)) HandlerID {
+	return s.shards[0].OnUserlistChange(callback)
+}
+
+// OnRawLine attaches the callback to all shards, see Client.OnRawLine
+func (s *ShardedClient) OnRawLine(callback func(line string)) HandlerID {
+	return s.shards[0].OnRawLine(callback)
+}
+
+// OnHost attaches the callback to all shards, see Client.OnHost
+func (s *ShardedClient) OnHost(callback func(channel, target string, viewers int)) HandlerID {
+	return s.shards[0].OnHost(callback)
+}
+
+// OnStateChange attaches the callback to all shards, it's called with the state changes of every shard, see Client.OnStateChange
+func (s *ShardedClient) OnStateChange(callback func(oldState, newState ConnectionState)) HandlerID {
+	return s.shards[0].OnStateChange(callback)
+}
+
+// OnSendQueueFull attaches the callback to all shards, it's called for the queue of every shard, see Client.OnSendQueueFull
+func (s *ShardedClient) OnSendQueueFull(callback func()) HandlerID {
+	return s.shards[0].OnSendQueueFull(callback)
+}
+
+// OnChannelIdle attaches the callback to all shards, see Client.OnChannelIdle
+func (s *ShardedClient) OnChannelIdle(channel string, after time.Duration, callback func(channel string)) HandlerID {
+	shard, _ := s.ShardOf(channel)
+
+	return s.shards[shard].OnChannelIdle(channel, after, callback)
+}
+
+// OnMessageSent attaches the callback to all shards, see Client.OnMessageSent
+func (s *ShardedClient) OnMessageSent(callback func(confirmation SentMessageConfirmation)) HandlerID {
+	for _, shard := range s.shards[1:] {
+		shard.trackSends.set(true)
+	}
+
+	return s.shards[0].OnMessageSent(callback)
+}
+
+// OnEmoteOnly attaches the callback to all shards, see Client.OnEmoteOnly
+func (s *ShardedClient) OnEmoteOnly(callback func(channel string, enabled bool)) HandlerID {
+	return s.shards[0].OnEmoteOnly(callback)
+}
+
+// OnSubMode attaches the callback to all shards, see Client.OnSubMode
+func (s *ShardedClient) OnSubMode(callback func(channel string, enabled bool)) HandlerID {
+	return s.shards[0].OnSubMode(callback)
+}
+
+// OnSlowMode attaches the callback to all shards, see Client.OnSlowMode
+func (s *ShardedClient) OnSlowMode(callback func(channel string, seconds int)) HandlerID {
+	return s.shards[0].OnSlowMode(callback)
+}
+
+// OnRoomStateChange attaches the callback to all shards, see Client.OnRoomStateChange
+func (s *ShardedClient) OnRoomStateChange(callback func(channel string, changes []RoomStateChange)) HandlerID {
+	return s.shards[0].OnRoomStateChange(callback)
+}
+
+// OnFollowersMode attaches the callback to all shards, see Client.OnFollowersMode
+func (s *ShardedClient) OnFollowersMode(callback func(channel string, minutes int)) HandlerID {
+	return s.shards[0].OnFollowersMode(callback)
+}
+
+// Channel returns a ChannelHandlers to attach callbacks of a single channel to all shards, see Client.Channel
+func (s *ShardedClient) Channel(channel string) *ChannelHandlers {
+	return s.shards[0].Channel(channel)
+}
+
+// RemoveHandler detaches a callback attached with one of the On methods of the ShardedClient
+func (s *ShardedClient) RemoveHandler(id HandlerID) bool {
+	return s.shards[0].RemoveHandler(id)
+}
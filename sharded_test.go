@@ -0,0 +1,149 @@
+package twitch
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gempir/go-twitch-irc/v4/twitchtest"
+)
+
+func newShardedTestClient(servers ...*twitchtest.Server) *ShardedClient {
+	client := NewShardedClient("justinfan123123", "oauth:123123132", len(servers))
+	for i, shard := range client.Shards() {
+		shard.IrcAddress = servers[i].Addr
+	}
+
+	return client
+}
+
+// waitForJoinedChannels returns the sorted channels of the next JOIN line the server receives
+func waitForJoinedChannels(t *testing.T, server *twitchtest.Server) []string {
+	t.Helper()
+
+	channels := strings.Split(strings.TrimPrefix(waitForLine(t, server, "JOIN"), "JOIN "), ",")
+	sort.Strings(channels)
+
+	return channels
+}
+
+func TestShardedClientSpreadsChannelsOverShards(t *testing.T) {
+	t.Parallel()
+	first, second := newTestServer(t), newTestServer(t)
+
+	client := newShardedTestClient(first, second)
+	client.Join("Gempir", "pajlada", "nymn", "forsen", "gempir")
+	assertIntsEqual(t, 2, client.ShardCount())
+	assertIntsEqual(t, 2, client.ChannelCounts()[0])
+	assertIntsEqual(t, 2, client.ChannelCounts()[1])
+
+	connectErr := make(chan error)
+	go func() {
+		connectErr <- client.Connect()
+	}()
+	assertStringSlicesEqual(t, []string{"#gempir", "#nymn"}, waitForJoinedChannels(t, first))
+	assertStringSlicesEqual(t, []string{"#forsen", "#pajlada"}, waitForJoinedChannels(t, second))
+
+	client.Say("pajlada", "hello")
+	assertStringsEqual(t, "PRIVMSG #pajlada :hello", waitForLine(t, second, "PRIVMSG"))
+
+	client.Depart("nymn")
+	assertStringsEqual(t, "PART #nymn", waitForLine(t, first, "PART"))
+	client.Join("zneix")
+	assertStringsEqual(t, "JOIN #zneix", waitForLine(t, first, "JOIN"))
+
+	assertErrorsEqual(t, nil, client.Disconnect())
+	select {
+	case err := <-connectErr:
+		assertErrorsEqual(t, ErrClientDisconnected, err)
+	case <-time.After(time.Second * 3):
+		t.Fatal("Connect did not return after Disconnect")
+	}
+}
+
+func TestShardedClientCallsHandlersForAllShards(t *testing.T) {
+	t.Parallel()
+	first, second := newTestServer(t), newTestServer(t)
+
+	received := make(chan string)
+	client := newShardedTestClient(first, second)
+	client.OnPrivateMessage(func(message PrivateMessage) {
+		received <- message.Channel
+	})
+	client.Join("gempir", "pajlada")
+	go client.Connect()
+
+	waitForLine(t, first, "JOIN")
+	waitForLine(t, second, "JOIN")
+
+	send(t, second, ":pajlada!pajlada@pajlada.tmi.twitch.tv PRIVMSG #pajlada :hello")
+	send(t, first, ":gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #gempir :hello")
+
+	var channels []string
+	for i := 0; i < 2; i++ {
+		select {
+		case channel := <-received:
+			channels = append(channels, channel)
+		case <-time.After(time.Second * 3):
+			t.Fatal("OnPrivateMessage not called for all shards")
+		}
+	}
+	sort.Strings(channels)
+	assertStringSlicesEqual(t, []string{"gempir", "pajlada"}, channels)
+}
+
+func TestShardedClientRebalancesChannelsOfStoppedShard(t *testing.T) {
+	t.Parallel()
+	first, second := newTestServer(t), newTestServer(t)
+
+	client := newShardedTestClient(first, second)
+	client.Join("gempir", "pajlada", "nymn", "forsen")
+	go client.Connect()
+
+	assertStringSlicesEqual(t, []string{"#gempir", "#nymn"}, waitForJoinedChannels(t, first))
+	assertStringSlicesEqual(t, []string{"#forsen", "#pajlada"}, waitForJoinedChannels(t, second))
+
+	send(t, first, ":tmi.twitch.tv NOTICE * :Login authentication failed")
+
+	assertStringSlicesEqual(t, []string{"#gempir", "#nymn"}, waitForJoinedChannels(t, second))
+	assertIntsEqual(t, 0, client.ChannelCounts()[0])
+	assertIntsEqual(t, 4, client.ChannelCounts()[1])
+
+	client.Say("gempir", "hello")
+	assertStringsEqual(t, "PRIVMSG #gempir :hello", waitForLine(t, second, "PRIVMSG"))
+}
+
+func TestShardedClientRebalancesChannelsOnConnect(t *testing.T) {
+	t.Parallel()
+	client := NewShardedClient("justinfan123123", "oauth:123123132", 3)
+	client.Join("gempir", "pajlada", "nymn", "forsen", "zneix", "pepega")
+	assertIntsEqual(t, 3, client.ShardCount())
+
+	_, ok := client.ShardOf("#Gempir")
+	assertTrue(t, ok, "joined channel has no shard")
+	_, ok = client.ShardOf("xqc")
+	assertFalse(t, ok, "channel that wasn't joined has a shard")
+
+	// The channels of a stopped shard are joined on the other shards
+	client.shardStopped(2)
+	assertIntsEqual(t, 3, client.ChannelCounts()[0])
+	assertIntsEqual(t, 3, client.ChannelCounts()[1])
+	assertIntsEqual(t, 0, client.ChannelCounts()[2])
+
+	// Connect runs the stopped shard again, and rebalances the channels
+	client.mutex.Lock()
+	client.stopped[2] = false
+	client.mutex.Unlock()
+	client.Rebalance()
+
+	for shard, count := range client.ChannelCounts() {
+		assertIntsEqual(t, 2, count)
+		// The moved channels are departed on their old shard, and joined on the new one
+		assertIntsEqual(t, 2, len(client.shards[shard].channels))
+		for channel := range client.shards[shard].channels {
+			joined, _ := client.ShardOf(channel)
+			assertIntsEqual(t, shard, joined)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package twitch
+
+// ConnectionState is the state of the connection of a client, see Client.State
+type ConnectionState int
+
+const (
+	// StateDisconnected is the state before Connect is called, and after Connect returned with an error other than ErrClientDisconnected
+	StateDisconnected ConnectionState = iota
+	// StateConnecting is the state while the client dials the server the first time
+	StateConnecting
+	// StateAuthenticating is the state after the connection was opened, until Twitch welcomed the client
+	StateAuthenticating
+	// StateConnected is the state while the client is connected and authenticated, see Client.Connected
+	StateConnected
+	// StateReconnecting is the state after the connection was lost or Twitch asked to reconnect, while the client dials the server again
+	StateReconnecting
+	// StateClosed is the state after Connect returned because Disconnect was called
+	StateClosed
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateAuthenticating:
+		return "authenticating"
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateClosed:
+		return "closed"
+	}
+
+	return "unknown"
+}
+
+// stateChange is the payload of the stateChangeEvent
+type stateChange struct {
+	from ConnectionState
+	to   ConnectionState
+}
+
+// stateAfter returns the state of a client after the connection ended with err
+func stateAfter(err error) ConnectionState {
+	switch err {
+	case errReconnect:
+		return StateReconnecting
+	case ErrClientDisconnected:
+		return StateClosed
+	}
+
+	return StateDisconnected
+}
+
+// State returns the current state of the connection, e.g. for a health check
+func (c *Client) State() ConnectionState {
+	c.connectedMtx.Lock()
+	defer c.connectedMtx.Unlock()
+
+	return c.state
+}
+
+// OnStateChange attaches callback to the state of the connection changing, see State.
+// The callback is called on the go-routine making the transition, before the callbacks of the message that caused it
+func (c *Client) OnStateChange(callback func(oldState, newState ConnectionState)) HandlerID {
+	return c.handlers.add(stateChangeEvent, func(payload interface{}) {
+		change := payload.(stateChange)
+		callback(change.from, change.to)
+	})
+}
+
+// setStopped updates the state once Connect or connectStream stopped with err, and wakes up the callers of WaitForConnect
+func (c *Client) setStopped(err error) {
+	c.connectedMtx.Lock()
+	c.stopErr = err
+	select {
+	case <-c.stopped:
+	default:
+		close(c.stopped)
+	}
+	c.connectedMtx.Unlock()
+
+	c.setState(stateAfter(err))
+}
+
+// setState updates the connection state, and wakes up the callers of WaitConnected once connected
+func (c *Client) setState(state ConnectionState) {
+	c.connectedMtx.Lock()
+
+	old := c.state
+	if old == state {
+		c.connectedMtx.Unlock()
+		return
+	}
+	c.state = state
+
+	// A new Connect starts, WaitForConnect waits for it instead of returning the error of the previous one
+	if state == StateConnecting {
+		select {
+		case <-c.stopped:
+			c.stopped = make(chan struct{})
+			c.stopErr = nil
+		default:
+		}
+	}
+
+	connected := state == StateConnected
+	if connected != c.connActive.get() {
+		c.connActive.set(connected)
+
+		if connected {
+			close(c.connected)
+		} else {
+			c.connected = make(chan struct{})
+		}
+	}
+
+	c.connectedMtx.Unlock()
+
+	c.callHandlers(stateChangeEvent, stateChange{from: old, to: state})
+}
@@ -0,0 +1,92 @@
+package twitch
+
+import (
+	"testing"
+	"time"
+)
+
+// waitForState returns the next state change reported to the channel as "old -> new"
+func waitForState(t *testing.T, changes chan string) string {
+	t.Helper()
+
+	select {
+	case change := <-changes:
+		return change
+	case <-time.After(time.Second * 3):
+		t.Fatal("no state change")
+	}
+
+	return ""
+}
+
+func TestConnectionStateTransitions(t *testing.T) {
+	t.Parallel()
+	server := newTestServer(t)
+
+	client := newTestClient(server.Addr)
+	assertStringsEqual(t, "disconnected", client.State().String())
+
+	changes := make(chan string, 20)
+	client.OnStateChange(func(oldState, newState ConnectionState) {
+		changes <- oldState.String() + " -> " + newState.String()
+	})
+
+	// State and Connected are read concurrently to the transitions, for the race detector
+	stopPolling := make(chan struct{})
+	defer close(stopPolling)
+	go func() {
+		for {
+			select {
+			case <-stopPolling:
+				return
+			default:
+				_ = client.State()
+				_ = client.Connected()
+			}
+		}
+	}()
+
+	connected := make(chan error)
+	go func() {
+		connected <- client.Connect()
+	}()
+
+	assertStringsEqual(t, "disconnected -> connecting", waitForState(t, changes))
+	assertStringsEqual(t, "connecting -> authenticating", waitForState(t, changes))
+	assertStringsEqual(t, "authenticating -> connected", waitForState(t, changes))
+	assertTrue(t, client.Connected(), "client isn't connected in the connected state")
+
+	// The client reconnects after the server closed the connection
+	if err := server.DropConnection(); err != nil {
+		t.Fatal(err)
+	}
+	assertStringsEqual(t, "connected -> reconnecting", waitForState(t, changes))
+	assertStringsEqual(t, "reconnecting -> authenticating", waitForState(t, changes))
+	assertStringsEqual(t, "authenticating -> connected", waitForState(t, changes))
+
+	assertErrorsEqual(t, nil, client.Disconnect())
+	assertStringsEqual(t, "connected -> closed", waitForState(t, changes))
+
+	select {
+	case err := <-connected:
+		assertErrorsEqual(t, ErrClientDisconnected, err)
+	case <-time.After(time.Second * 3):
+		t.Fatal("Connect didn't return after Disconnect")
+	}
+	assertStringsEqual(t, "closed", client.State().String())
+	assertFalse(t, client.Connected(), "client is connected after Disconnect")
+}
+
+func TestConnectionStateAfterFailedConnect(t *testing.T) {
+	t.Parallel()
+	client := NewClient("justinfan123123", "oauth:123123123")
+	client.IrcAddress = "127.0.0.1:1"
+
+	var states []string
+	client.OnStateChange(func(oldState, newState ConnectionState) {
+		states = append(states, newState.String())
+	})
+
+	assertTrue(t, client.Connect() != nil, "connecting to a closed port succeeded")
+	assertStringSlicesEqual(t, []string{"connecting", "disconnected"}, states)
+}
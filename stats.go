@@ -0,0 +1,75 @@
+package twitch
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the counters every client keeps, see Client.Stats.
+// Unlike a MetricsCollector it needs no setup, for dashboards that only poll the client now and then
+type Stats struct {
+	// MessagesReceived counts the messages read from the connection by their type, messages of unknown commands are counted as UNSET
+	MessagesReceived map[MessageType]int
+	// MessagesSent counts the lines written to the connection, including the lines sent to log in
+	MessagesSent int
+	// Reconnects counts the reconnects, e.g. because of a RECONNECT message or a missing PONG
+	Reconnects int
+	// Latency is the time between the last PING sent by the client and its PONG, 0 until the first PONG
+	Latency time.Duration
+}
+
+// messageTypeCount is the number of known message types, the counters are indexed by the type plus one for UNSET
+const messageTypeCount = int(END_OF_NAMES) + 2
+
+// clientStats are the counters of Stats, updated atomically by the reading and writing go-routines.
+// The int64 fields come first, so they are aligned for the atomic operations on 32-bit platforms
+type clientStats struct {
+	received   [messageTypeCount]int64
+	sent       int64
+	reconnects int64
+	latency    int64
+}
+
+func (s *clientStats) messageReceived(messageType MessageType) {
+	index := int(messageType) + 1
+	if index < 0 || index >= messageTypeCount {
+		index = int(UNSET) + 1
+	}
+
+	atomic.AddInt64(&s.received[index], 1)
+}
+
+func (s *clientStats) messageSent() {
+	atomic.AddInt64(&s.sent, 1)
+}
+
+func (s *clientStats) reconnected() {
+	atomic.AddInt64(&s.reconnects, 1)
+}
+
+func (s *clientStats) setLatency(latency time.Duration) {
+	atomic.StoreInt64(&s.latency, int64(latency))
+}
+
+func (s *clientStats) snapshot() Stats {
+	stats := Stats{
+		MessagesReceived: map[MessageType]int{},
+		MessagesSent:     int(atomic.LoadInt64(&s.sent)),
+		Reconnects:       int(atomic.LoadInt64(&s.reconnects)),
+		Latency:          time.Duration(atomic.LoadInt64(&s.latency)),
+	}
+
+	for index := range s.received {
+		if count := atomic.LoadInt64(&s.received[index]); count > 0 {
+			stats.MessagesReceived[MessageType(index-1)] = int(count)
+		}
+	}
+
+	return stats
+}
+
+// Stats returns a snapshot of the messages received by type, the messages sent, the reconnects and the latency of the client.
+// The counters keep counting across reconnects
+func (c *Client) Stats() Stats {
+	return c.stats.snapshot()
+}
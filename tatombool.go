@@ -16,3 +16,12 @@ func (b *tAtomBool) set(value bool) {
 func (b *tAtomBool) get() bool {
 	return atomic.LoadInt32(&(b.flag)) != 0
 }
+
+// swap sets the value and returns the previous value
+func (b *tAtomBool) swap(value bool) bool {
+	var i int32
+	if value {
+		i = 1
+	}
+	return atomic.SwapInt32(&(b.flag), i) != 0
+}
@@ -0,0 +1,123 @@
+package twitch
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gempir/go-twitch-irc/v4/twitchtest"
+)
+
+// newTestServer starts a TLS twitchtest server answering like Twitch, which is closed when the test ends
+func newTestServer(t *testing.T) *twitchtest.Server {
+	server := twitchtest.NewServer()
+	t.Cleanup(func() {
+		server.Close()
+	})
+
+	return server
+}
+
+// waitForLine returns the next line received by the server starting with prefix, the lines before it are skipped.
+// Fails the test if no such line is received within 3 seconds
+func waitForLine(t *testing.T, server *twitchtest.Server, prefix string) string {
+	t.Helper()
+
+	line, err := server.WaitForLine(prefix, time.Second*3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return line
+}
+
+// send writes the lines to the client connected to the server, the test fails if no client is connected
+func send(t *testing.T, server *twitchtest.Server, lines ...string) {
+	if err := server.Send(lines...); err != nil {
+		t.Error(err)
+	}
+}
+
+type testServer struct {
+	host string
+
+	// stopped is closed once all connections of the server ended
+	stopped chan struct{}
+}
+
+// serveTestConnections makes the server call onConnect once a client sent NICK, and onMessage with every other line.
+// Logins with a malformed or empty token, or the "oauth:wrong" token are rejected. The server is closed once numConns connections ended,
+// further connections are closed right away
+func serveTestConnections(t *testing.T, server *twitchtest.Server, numConns int, onConnect func(*twitchtest.Conn), onMessage func(string)) *testServer {
+	s := &testServer{
+		host:    server.Addr,
+		stopped: make(chan struct{}),
+	}
+
+	server.Handle("CAP", nil)
+	server.Handle("PING", nil)
+	server.Handle("NICK", func(conn *twitchtest.Conn, line string) {
+		_ = conn.Send(":tmi.twitch.tv 001 justinfan123123 :Welcome, GLHF!")
+		onConnect(conn)
+	})
+	server.Handle("PASS", func(conn *twitchtest.Conn, line string) {
+		pass := strings.TrimPrefix(line, "PASS ")
+		if !strings.HasPrefix(pass, "oauth:") || pass == "oauth:" {
+			_ = conn.Send(":tmi.twitch.tv NOTICE * :Improperly formatted auth")
+			conn.Close()
+			return
+		} else if pass == "oauth:wrong" {
+			_ = conn.Send(":tmi.twitch.tv NOTICE * :Login authentication failed")
+			conn.Close()
+			return
+		}
+
+		onMessage(line)
+	})
+	server.Handle("*", func(conn *twitchtest.Conn, line string) {
+		onMessage(line)
+	})
+
+	var accepted, ended int32
+	server.OnAccept(func(conn *twitchtest.Conn) {
+		if atomic.AddInt32(&accepted, 1) > int32(numConns) {
+			conn.Close()
+			return
+		}
+
+		go func() {
+			<-conn.Done()
+			if atomic.AddInt32(&ended, 1) == int32(numConns) {
+				server.Close()
+				close(s.stopped)
+			}
+		}()
+	})
+	t.Cleanup(func() {
+		server.Close()
+	})
+
+	return s
+}
+
+func startServer(t *testing.T, onConnect func(*twitchtest.Conn), onMessage func(string)) string {
+	s := startServer2(t, onConnect, onMessage)
+	return s.host
+}
+
+func startServer2(t *testing.T, onConnect func(*twitchtest.Conn), onMessage func(string)) *testServer {
+	return serveTestConnections(t, twitchtest.NewServer(), 1, onConnect, onMessage)
+}
+
+func startServerMultiConns(t *testing.T, numConns int, onConnect func(*twitchtest.Conn), onMessage func(string)) string {
+	return serveTestConnections(t, twitchtest.NewServer(), numConns, onConnect, onMessage).host
+}
+
+func startServerMultiConnsNoTLS(t *testing.T, numConns int, onConnect func(*twitchtest.Conn), onMessage func(string)) string {
+	return serveTestConnections(t, twitchtest.NewPlainServer(), numConns, onConnect, onMessage).host
+}
+
+func startNoTLSServer(t *testing.T, onConnect func(*twitchtest.Conn), onMessage func(string)) string {
+	return serveTestConnections(t, twitchtest.NewPlainServer(), 1, onConnect, onMessage).host
+}
@@ -0,0 +1,85 @@
+package twitch
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// tokenPrefix is the prefix Twitch expects in front of the oauth token of the PASS line
+	tokenPrefix = "oauth:"
+
+	// defaultTokenRetryDelay is the delay before asking a failed token provider again, it doubles after every failure
+	defaultTokenRetryDelay = time.Second
+	// maxTokenRetryDelay caps the doubling delay between asking a failed token provider again
+	maxTokenRetryDelay = time.Second * 30
+	// maxTokenAttempts is how often the token provider is asked in a row before Connect gives up
+	maxTokenAttempts = 10
+)
+
+// TokenProvider provides the oauth token the client authenticates with, with or without the "oauth:" prefix.
+// Token is called on every connect and reconnect, which lets a provider refresh expired tokens
+type TokenProvider interface {
+	Token() (string, error)
+}
+
+// StaticToken is a TokenProvider that always provides the same token
+type StaticToken string
+
+// Token implements the TokenProvider interface, and returns the token itself
+func (t StaticToken) Token() (string, error) {
+	return string(t), nil
+}
+
+// TokenFunc is an adapter to use an ordinary function as a TokenProvider:
+//
+//	client.SetTokenProvider(twitch.TokenFunc(func() (string, error) {
+//		return refreshToken()
+//	}))
+type TokenFunc func() (string, error)
+
+// Token implements the TokenProvider interface, and calls the function
+func (f TokenFunc) Token() (string, error) {
+	return f()
+}
+
+// fetchToken asks the token provider for the token of the next connection. A failed attempt is logged and the provider
+// is asked again after a delay, which starts at one second and doubles up to 30 seconds. Returns ErrClientDisconnected
+// if Disconnect was called while waiting, and the error of the provider once it failed maxTokenAttempts times in a row
+func (c *Client) fetchToken() (string, error) {
+	delay := c.tokenRetryDelay
+
+	for attempt := 1; ; attempt++ {
+		token, err := c.tokenProvider.Token()
+		if err == nil {
+			return token, nil
+		}
+
+		if attempt >= maxTokenAttempts {
+			return "", fmt.Errorf("failed to get oauth token: %w", err)
+		}
+
+		c.logger.Warnf("failed to get oauth token, retrying in %s: %s", delay, err)
+
+		select {
+		case <-time.After(delay):
+		case <-c.userDisconnect.channel:
+			return "", ErrClientDisconnected
+		}
+
+		delay *= 2
+		if delay > maxTokenRetryDelay {
+			delay = maxTokenRetryDelay
+		}
+	}
+}
+
+// formatToken adds the "oauth:" prefix to a token stored without it
+func formatToken(token string) string {
+	if token == "" || strings.HasPrefix(token, tokenPrefix) {
+		return token
+	}
+
+	return tokenPrefix + token
+}
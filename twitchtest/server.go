@@ -0,0 +1,387 @@
+// Package twitchtest provides a fake Twitch IRC server for integration tests of bots built with go-twitch-irc.
+//
+// The server listens on an ephemeral port of 127.0.0.1 and answers like Twitch does by default:
+// CAP REQ is acknowledged, NICK is welcomed with 001 and GLOBALUSERSTATE, and PING is answered with PONG.
+// Every received line is recorded, lines can be sent to the connected client at any time:
+//
+//	server := twitchtest.NewServer()
+//	defer server.Close()
+//
+//	client := twitch.NewClient("justinfan123123", "oauth:123123123")
+//	client.IrcAddress = server.Addr
+//	client.Join("gempir")
+//	go client.Connect()
+//
+//	line, err := server.WaitForLine("JOIN", time.Second) // "JOIN #gempir"
+//	server.Send("@room-id=11148817 :gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #gempir :hello")
+package twitchtest
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTimeout returned from WaitForLine when no matching line was received in time
+	ErrTimeout = errors.New("twitchtest: timed out")
+	// ErrNoConnection returned from Send when no client is connected
+	ErrNoConnection = errors.New("twitchtest: no client connected")
+)
+
+// Handler is called with every received line of the command it was registered for, see Server.Handle.
+// It's called on the go-routine reading from the connection, the next line is read once it returns
+type Handler func(conn *Conn, line string)
+
+// Server is a fake Twitch IRC server. It accepts any number of connections, e.g. a client reconnecting,
+// and Send writes to the connection accepted last
+type Server struct {
+	// Addr is the host:port the server listens on, use it as the IrcAddress of the client
+	Addr string
+
+	listener net.Listener
+
+	mutex    sync.Mutex
+	handlers map[string]Handler
+	onAccept func(conn *Conn)
+	conns    []*Conn
+	current  *Conn
+	closed   bool
+
+	lines []string
+	// cursor is the index of the first line WaitForLine hasn't looked at yet
+	cursor int
+	// newLine is closed and replaced whenever a line is received
+	newLine chan struct{}
+
+	// accepting is done once the server stopped accepting connections
+	accepting sync.WaitGroup
+}
+
+// NewServer starts a TLS server. The client doesn't verify the certificate of servers on 127.0.0.1,
+// so the self-signed certificate of the server is accepted. Panics if the server can't listen
+func NewServer() *Server {
+	certificate, err := selfSignedCertificate()
+	if err != nil {
+		panic(fmt.Sprintf("twitchtest: failed to create certificate: %s", err))
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{certificate},
+	})
+	if err != nil {
+		panic(fmt.Sprintf("twitchtest: failed to listen: %s", err))
+	}
+
+	return newServer(listener)
+}
+
+// NewPlainServer starts a server without TLS, for clients with TLS turned off. Panics if the server can't listen
+func NewPlainServer() *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("twitchtest: failed to listen: %s", err))
+	}
+
+	return newServer(listener)
+}
+
+func newServer(listener net.Listener) *Server {
+	s := &Server{
+		Addr:     listener.Addr().String(),
+		listener: listener,
+		handlers: map[string]Handler{
+			"CAP":  acknowledgeCapabilities,
+			"NICK": welcome,
+			"PING": pong,
+		},
+		newLine: make(chan struct{}),
+	}
+
+	s.accepting.Add(1)
+	go s.accept()
+
+	return s
+}
+
+// Handle sets the handler of the given command, e.g. "PRIVMSG", replacing the default handler of the command.
+// The handler of "*" is called for the commands without a handler. A nil handler removes the handler of the command
+func (s *Server) Handle(command string, handler Handler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if handler == nil {
+		delete(s.handlers, command)
+		return
+	}
+
+	s.handlers[command] = handler
+}
+
+// OnAccept sets a callback that's called with every accepted connection, before its first line is read
+func (s *Server) OnAccept(callback func(conn *Conn)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.onAccept = callback
+}
+
+// Send writes the lines to the connection accepted last, the line endings are added.
+// Returns ErrNoConnection if no client is connected
+func (s *Server) Send(lines ...string) error {
+	s.mutex.Lock()
+	conn := s.current
+	s.mutex.Unlock()
+
+	if conn == nil {
+		return ErrNoConnection
+	}
+
+	return conn.Send(lines...)
+}
+
+// DropConnection closes the connection accepted last, like a connection lost without a goodbye.
+// Returns ErrNoConnection if no client is connected
+func (s *Server) DropConnection() error {
+	s.mutex.Lock()
+	conn := s.current
+	s.mutex.Unlock()
+
+	if conn == nil {
+		return ErrNoConnection
+	}
+
+	return conn.Close()
+}
+
+// Lines returns every line received so far, of all connections, without their line endings
+func (s *Server) Lines() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]string(nil), s.lines...)
+}
+
+// WaitForLine returns the next received line starting with prefix. Every call continues after the line returned last,
+// the lines before the matching line are skipped. Returns ErrTimeout if no such line is received within the timeout
+func (s *Server) WaitForLine(prefix string, timeout time.Duration) (string, error) {
+	deadline := time.After(timeout)
+
+	for {
+		s.mutex.Lock()
+		for s.cursor < len(s.lines) {
+			line := s.lines[s.cursor]
+			s.cursor++
+
+			if strings.HasPrefix(line, prefix) {
+				s.mutex.Unlock()
+				return line, nil
+			}
+		}
+		newLine := s.newLine
+		s.mutex.Unlock()
+
+		select {
+		case <-newLine:
+		case <-deadline:
+			return "", fmt.Errorf("%w waiting for a line starting with %q", ErrTimeout, prefix)
+		}
+	}
+}
+
+// Close stops the server and closes all connections. Handlers still running aren't waited for
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closed = true
+	conns := s.conns
+	s.mutex.Unlock()
+
+	err := s.listener.Close()
+	for _, conn := range conns {
+		conn.Close()
+	}
+	s.accepting.Wait()
+
+	return err
+}
+
+func (s *Server) accept() {
+	defer s.accepting.Done()
+
+	for {
+		netConn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		conn := &Conn{
+			conn: netConn,
+			done: make(chan struct{}),
+		}
+
+		s.mutex.Lock()
+		if s.closed {
+			s.mutex.Unlock()
+			netConn.Close()
+			return
+		}
+		s.conns = append(s.conns, conn)
+		s.current = conn
+		onAccept := s.onAccept
+		s.mutex.Unlock()
+
+		go s.serve(conn, onAccept)
+	}
+}
+
+func (s *Server) serve(conn *Conn, onAccept func(conn *Conn)) {
+	defer func() {
+		conn.Close()
+		close(conn.done)
+
+		s.mutex.Lock()
+		if s.current == conn {
+			s.current = nil
+		}
+		s.mutex.Unlock()
+	}()
+
+	if onAccept != nil {
+		onAccept(conn)
+	}
+
+	reader := textproto.NewReader(bufio.NewReader(conn.conn))
+	for {
+		line, err := reader.ReadLine()
+		if err != nil {
+			return
+		}
+
+		s.mutex.Lock()
+		s.lines = append(s.lines, line)
+		close(s.newLine)
+		s.newLine = make(chan struct{})
+
+		command, _ := splitLine(line)
+		handler, ok := s.handlers[command]
+		if !ok {
+			handler = s.handlers["*"]
+		}
+		s.mutex.Unlock()
+
+		if handler != nil {
+			handler(conn, line)
+		}
+	}
+}
+
+// Conn is a connection of a client to the Server
+type Conn struct {
+	conn      net.Conn
+	writeMtx  sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Send writes the lines to the client, the line endings are added
+func (c *Conn) Send(lines ...string) error {
+	for _, line := range lines {
+		if _, err := c.Write([]byte(line + "\r\n")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Write writes raw bytes to the client, without adding line endings. Useful for testing lines split across writes
+func (c *Conn) Write(p []byte) (int, error) {
+	c.writeMtx.Lock()
+	defer c.writeMtx.Unlock()
+
+	return c.conn.Write(p)
+}
+
+// Close closes the connection
+func (c *Conn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		err = c.conn.Close()
+	})
+
+	return err
+}
+
+// Done returns a channel that's closed once the connection is closed, by either side
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// splitLine returns the command of a raw IRC line and the parameters after it, with the trailing parameter as the last one.
+// The tags and source of the line are skipped
+func splitLine(line string) (string, []string) {
+	for _, prefix := range []string{"@", ":"} {
+		if strings.HasPrefix(line, prefix) {
+			index := strings.IndexByte(line, ' ')
+			if index < 0 {
+				return "", nil
+			}
+			line = strings.TrimLeft(line[index+1:], " ")
+		}
+	}
+
+	var trailing []string
+	if strings.HasPrefix(line, ":") {
+		trailing, line = []string{line[1:]}, ""
+	} else if index := strings.Index(line, " :"); index >= 0 {
+		trailing, line = []string{line[index+2:]}, line[:index]
+	}
+
+	fields := append(strings.Fields(line), trailing...)
+	if len(fields) == 0 {
+		return "", nil
+	}
+
+	return fields[0], fields[1:]
+}
+
+func acknowledgeCapabilities(conn *Conn, line string) {
+	_, p := splitLine(line)
+	if len(p) < 2 || p[0] != "REQ" {
+		return
+	}
+
+	_ = conn.Send(":tmi.twitch.tv CAP * ACK :" + p[1])
+}
+
+func welcome(conn *Conn, line string) {
+	nick := "justinfan123123"
+	if _, p := splitLine(line); len(p) > 0 {
+		nick = p[0]
+	}
+
+	_ = conn.Send(
+		":tmi.twitch.tv 001 "+nick+" :Welcome, GLHF!",
+		"@badge-info=;badges=;color=;display-name="+nick+";emote-sets=0;user-id=123456789;user-type= :tmi.twitch.tv GLOBALUSERSTATE",
+	)
+}
+
+func pong(conn *Conn, line string) {
+	argument := "tmi.twitch.tv"
+	if _, p := splitLine(line); len(p) > 0 {
+		argument = p[len(p)-1]
+	}
+
+	_ = conn.Send(":tmi.twitch.tv PONG tmi.twitch.tv :" + argument)
+}
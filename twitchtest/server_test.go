@@ -0,0 +1,145 @@
+package twitchtest_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	twitch "github.com/gempir/go-twitch-irc/v4"
+	"github.com/gempir/go-twitch-irc/v4/twitchtest"
+)
+
+func waitForLine(t *testing.T, server *twitchtest.Server, prefix string) string {
+	t.Helper()
+
+	line, err := server.WaitForLine(prefix, time.Second*3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return line
+}
+
+func TestClientCanConnect(t *testing.T) {
+	t.Parallel()
+	server := twitchtest.NewServer()
+	defer server.Close()
+
+	connected := make(chan struct{})
+	received := make(chan twitch.PrivateMessage, 1)
+	client := twitch.NewClient("justinfan123123", "oauth:123123123")
+	client.IrcAddress = server.Addr
+	client.OnConnect(func() {
+		close(connected)
+	})
+	client.OnPrivateMessage(func(message twitch.PrivateMessage) {
+		received <- message
+	})
+	client.Join("gempir")
+	go client.Connect()
+	defer client.Disconnect()
+
+	if line := waitForLine(t, server, "PASS"); line != "PASS oauth:123123123" {
+		t.Errorf("received %q", line)
+	}
+	if line := waitForLine(t, server, "JOIN"); line != "JOIN #gempir" {
+		t.Errorf("received %q", line)
+	}
+	<-connected
+
+	if err := server.Send(":gempir!gempir@gempir.tmi.twitch.tv PRIVMSG #gempir :hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case message := <-received:
+		if message.Message != "hello" {
+			t.Errorf("received message %q", message.Message)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("no message received")
+	}
+
+	if len(server.Lines()) < 4 {
+		t.Errorf("received lines %q", server.Lines())
+	}
+}
+
+func TestClientReconnectsAfterDroppedConnection(t *testing.T) {
+	t.Parallel()
+	server := twitchtest.NewServer()
+	defer server.Close()
+
+	client := twitch.NewClient("justinfan123123", "oauth:123123123")
+	client.IrcAddress = server.Addr
+	client.Join("gempir")
+	go client.Connect()
+	defer client.Disconnect()
+
+	waitForLine(t, server, "JOIN")
+	if err := server.DropConnection(); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForLine(t, server, "NICK")
+	waitForLine(t, server, "JOIN")
+}
+
+func TestServerAnswersPings(t *testing.T) {
+	t.Parallel()
+	server := twitchtest.NewServer()
+	defer server.Close()
+
+	pongs := make(chan twitch.PongMessage, 1)
+	client := twitch.NewClient("justinfan123123", "oauth:123123123")
+	client.IrcAddress = server.Addr
+	client.IdlePingInterval = time.Millisecond * 50
+	client.OnPongMessage(func(message twitch.PongMessage) {
+		select {
+		case pongs <- message:
+		default:
+		}
+	})
+	go client.Connect()
+	defer client.Disconnect()
+
+	select {
+	case message := <-pongs:
+		if message.Message != "go-twitch-irc" {
+			t.Errorf("received pong %q", message.Message)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("no pong received")
+	}
+}
+
+func TestServerCanScriptResponses(t *testing.T) {
+	t.Parallel()
+	server := twitchtest.NewPlainServer()
+	defer server.Close()
+
+	server.Handle("PASS", func(conn *twitchtest.Conn, line string) {
+		_ = conn.Send(":tmi.twitch.tv NOTICE * :Login authentication failed")
+	})
+
+	client := twitch.NewClient("justinfan123123", "oauth:wrong")
+	client.IrcAddress = server.Addr
+	client.TLS = false
+
+	if err := client.Connect(); !errors.Is(err, twitch.ErrLoginAuthenticationFailed) {
+		t.Errorf("Connect returned %v", err)
+	}
+}
+
+func TestWaitForLineTimesOut(t *testing.T) {
+	t.Parallel()
+	server := twitchtest.NewServer()
+	defer server.Close()
+
+	if _, err := server.WaitForLine("JOIN", time.Millisecond*10); !errors.Is(err, twitchtest.ErrTimeout) {
+		t.Errorf("WaitForLine returned %v", err)
+	}
+	if err := server.Send("PING"); !errors.Is(err, twitchtest.ErrNoConnection) {
+		t.Errorf("Send returned %v", err)
+	}
+}
@@ -0,0 +1,443 @@
+package twitch
+
+import "strconv"
+
+// AnnouncementColor is the highlight color of an announcement made with /announce
+type AnnouncementColor string
+
+const (
+	// AnnouncementColorPrimary is the channel's accent color, used when no color was specified
+	AnnouncementColorPrimary AnnouncementColor = "PRIMARY"
+	// AnnouncementColorBlue blue announcement
+	AnnouncementColorBlue AnnouncementColor = "BLUE"
+	// AnnouncementColorGreen green announcement
+	AnnouncementColorGreen AnnouncementColor = "GREEN"
+	// AnnouncementColorOrange orange announcement
+	AnnouncementColorOrange AnnouncementColor = "ORANGE"
+	// AnnouncementColorPurple purple announcement
+	AnnouncementColorPurple AnnouncementColor = "PURPLE"
+)
+
+// AnnouncementEvent data of a USERNOTICE with the msg-id "announcement"
+// See https://dev.twitch.tv/docs/irc/tags/#usernotice-tags
+type AnnouncementEvent struct {
+	Color   AnnouncementColor
+	Message string
+}
+
+// Announcement returns the announcement data of this message.
+// The second return value is false if this message is not an announcement
+func (msg *UserNoticeMessage) Announcement() (*AnnouncementEvent, bool) {
+	if msg.MsgID != "announcement" {
+		return nil, false
+	}
+
+	color := AnnouncementColor(msg.MsgParams["msg-param-color"])
+	if color == "" {
+		color = AnnouncementColorPrimary
+	}
+
+	return &AnnouncementEvent{
+		Color:   color,
+		Message: msg.Message,
+	}, true
+}
+
+// RaidEvent data of a USERNOTICE with the msg-id "raid"
+// See https://dev.twitch.tv/docs/irc/tags/#usernotice-tags
+type RaidEvent struct {
+	RaiderName  string
+	RaiderLogin string
+	Viewers     int
+}
+
+// Raid returns the raid data of this message, the raider is the broadcaster of the raiding channel.
+// The second return value is false if this message is not a raid
+func (msg *UserNoticeMessage) Raid() (*RaidEvent, bool) {
+	if msg.MsgID != "raid" {
+		return nil, false
+	}
+
+	// Twitch sends these msg-params in camelCase, unlike most others
+	return &RaidEvent{
+		RaiderName:  msg.MsgParams["msg-param-displayName"],
+		RaiderLogin: msg.MsgParams["msg-param-login"],
+		Viewers:     msg.msgParamInt("msg-param-viewerCount"),
+	}, true
+}
+
+// SubEvent data of a USERNOTICE with the msg-id "sub" or "resub"
+type SubEvent struct {
+	// CumulativeMonths is the total number of months the user is subscribed for
+	CumulativeMonths int
+	// StreakMonths is the number of consecutive months the user is subscribed for, 0 if the user doesn't share the streak
+	StreakMonths int
+	SubPlan      SubPlan
+	SubPlanName  string
+	// WasGifted whether the sub was gifted, a resub then continues a gifted sub instead of being paid by the user
+	WasGifted bool
+	// AnonymousGifter whether the gifted sub was gifted anonymously, the gifter is empty then
+	AnonymousGifter bool
+	GifterID        string
+	GifterLogin     string
+	GifterName      string
+}
+
+// Sub returns the subscription data of this message.
+// The second return value is false if this message is not a sub or resub
+func (msg *UserNoticeMessage) Sub() (*SubEvent, bool) {
+	if msg.MsgID != "sub" && msg.MsgID != "resub" {
+		return nil, false
+	}
+
+	event := &SubEvent{
+		CumulativeMonths: msg.msgParamInt("msg-param-cumulative-months"),
+		StreakMonths:     msg.msgParamInt("msg-param-streak-months"),
+		SubPlan:          msg.SubPlan(),
+		SubPlanName:      msg.MsgParams["msg-param-sub-plan-name"],
+		WasGifted:        msg.MsgParams["msg-param-was-gifted"] == "true",
+	}
+	if event.WasGifted {
+		event.AnonymousGifter = msg.MsgParams["msg-param-anon-gift"] == "true" || msg.MsgParams["msg-param-gifter-login"] == anonymousGifterLogin
+		if !event.AnonymousGifter {
+			event.GifterID = msg.MsgParams["msg-param-gifter-id"]
+			event.GifterLogin = msg.MsgParams["msg-param-gifter-login"]
+			event.GifterName = msg.MsgParams["msg-param-gifter-name"]
+		}
+	}
+
+	return event, true
+}
+
+// SubGiftEvent data of a USERNOTICE with the msg-id "subgift" or "anonsubgift", a single gifted sub.
+// The gifter is the User of the message
+type SubGiftEvent struct {
+	// IsAnonymous whether the sub was gifted anonymously, the User of the message is the placeholder user then, see User.IsAnonymous
+	IsAnonymous          bool
+	RecipientID          string
+	RecipientLogin       string
+	RecipientDisplayName string
+	// Months is the number of months the recipient is subscribed for, including the gifted sub
+	Months int
+	// GiftMonths is the number of months gifted at once, 1 for messages without the msg-param
+	GiftMonths int
+	SubPlan    SubPlan
+	// SenderCount is the number of subs the gifter gifted in the channel so far, 0 if the gifter keeps it private
+	SenderCount int
+}
+
+// SubGift returns the gifted sub data of this message.
+// The second return value is false if this message is not a gifted sub
+func (msg *UserNoticeMessage) SubGift() (*SubGiftEvent, bool) {
+	if msg.MsgID != "subgift" && msg.MsgID != "anonsubgift" {
+		return nil, false
+	}
+
+	giftMonths, ok := msg.MsgParamInt("msg-param-gift-months")
+	if !ok {
+		giftMonths = 1
+	}
+
+	return &SubGiftEvent{
+		IsAnonymous:          msg.MsgID == "anonsubgift" || msg.User.IsAnonymous(),
+		RecipientID:          msg.MsgParams["msg-param-recipient-id"],
+		RecipientLogin:       msg.MsgParams["msg-param-recipient-user-name"],
+		RecipientDisplayName: msg.MsgParams["msg-param-recipient-display-name"],
+		Months:               msg.msgParamInt("msg-param-months"),
+		GiftMonths:           giftMonths,
+		SubPlan:              msg.SubPlan(),
+		SenderCount:          msg.msgParamInt("msg-param-sender-count"),
+	}, true
+}
+
+// MysteryGiftEvent data of a USERNOTICE with the msg-id "submysterygift", which announces a community gift.
+// Each of the gifted subs follows as its own "subgift" message
+type MysteryGiftEvent struct {
+	// IsAnonymous whether the subs were gifted anonymously, the User of the message is the placeholder user then, see User.IsAnonymous
+	IsAnonymous bool
+	// GiftCount is the number of subs gifted to the community at once
+	GiftCount int
+	SubPlan   SubPlan
+	// SenderCount is the number of subs the gifter gifted in the channel so far, 0 if the gifter keeps it private
+	SenderCount int
+}
+
+// MysteryGift returns the community gift data of this message.
+// The second return value is false if this message is not a community gift
+func (msg *UserNoticeMessage) MysteryGift() (*MysteryGiftEvent, bool) {
+	if msg.MsgID != "submysterygift" && msg.MsgID != "anonsubmysterygift" {
+		return nil, false
+	}
+
+	return &MysteryGiftEvent{
+		IsAnonymous: msg.MsgID == "anonsubmysterygift" || msg.User.IsAnonymous(),
+		GiftCount:   msg.msgParamInt("msg-param-mass-gift-count"),
+		SubPlan:     msg.SubPlan(),
+		SenderCount: msg.msgParamInt("msg-param-sender-count"),
+	}, true
+}
+
+// GiftUpgradeEvent data of a USERNOTICE with the msg-id "giftpaidupgrade" or "anongiftpaidupgrade", the user continues a gifted sub
+// by paying for it
+type GiftUpgradeEvent struct {
+	// IsAnonymous whether the sub was gifted anonymously, the sender is empty then
+	IsAnonymous bool
+	SenderLogin string
+	SenderName  string
+	// PromoName is the name of the promotion the sub was gifted in, empty if there was none
+	PromoName string
+	// PromoGiftTotal is the number of subs gifted in the promotion, 0 if there was none
+	PromoGiftTotal int
+}
+
+// GiftUpgrade returns the upgraded gift sub data of this message.
+// The second return value is false if this message is not an upgraded gift sub
+func (msg *UserNoticeMessage) GiftUpgrade() (*GiftUpgradeEvent, bool) {
+	if msg.MsgID != "giftpaidupgrade" && msg.MsgID != "anongiftpaidupgrade" {
+		return nil, false
+	}
+
+	// Older messages attribute anonymous gifts to the placeholder user instead of using the anon msg-id
+	event := &GiftUpgradeEvent{
+		IsAnonymous:    msg.MsgID == "anongiftpaidupgrade" || msg.MsgParams["msg-param-sender-login"] == anonymousGifterLogin,
+		PromoName:      msg.MsgParams["msg-param-promo-name"],
+		PromoGiftTotal: msg.msgParamInt("msg-param-promo-gift-total"),
+	}
+	if !event.IsAnonymous {
+		event.SenderLogin = msg.MsgParams["msg-param-sender-login"]
+		event.SenderName = msg.MsgParams["msg-param-sender-name"]
+	}
+
+	return event, true
+}
+
+// PrimeUpgradeEvent data of a USERNOTICE with the msg-id "primepaidupgrade", the user switched from a Prime Gaming sub to a paid sub
+type PrimeUpgradeEvent struct {
+	SubPlan SubPlan
+}
+
+// PrimeUpgrade returns the upgraded Prime Gaming sub data of this message.
+// The second return value is false if this message is not an upgraded Prime Gaming sub
+func (msg *UserNoticeMessage) PrimeUpgrade() (*PrimeUpgradeEvent, bool) {
+	if msg.MsgID != "primepaidupgrade" {
+		return nil, false
+	}
+
+	return &PrimeUpgradeEvent{
+		SubPlan: msg.SubPlan(),
+	}, true
+}
+
+// PayForwardEvent data of a USERNOTICE with the msg-id "standardpayforward" or "communitypayforward", the user pays forward
+// a sub they were gifted, to a single recipient or to the community
+type PayForwardEvent struct {
+	// IsCommunity whether the sub was paid forward to the community, the recipient is empty then
+	IsCommunity bool
+	// IsAnonymous whether the prior gifter gifted anonymously, the prior gifter is empty then
+	IsAnonymous          bool
+	PriorGifterID        string
+	PriorGifterLogin     string
+	PriorGifterName      string
+	RecipientID          string
+	RecipientLogin       string
+	RecipientDisplayName string
+}
+
+// PayForward returns the paid forward gift sub data of this message.
+// The second return value is false if this message is not a paid forward gift sub
+func (msg *UserNoticeMessage) PayForward() (*PayForwardEvent, bool) {
+	if msg.MsgID != "standardpayforward" && msg.MsgID != "communitypayforward" {
+		return nil, false
+	}
+
+	event := &PayForwardEvent{
+		IsCommunity:          msg.MsgID == "communitypayforward",
+		IsAnonymous:          msg.MsgParams["msg-param-prior-gifter-anonymous"] == "true" || msg.MsgParams["msg-param-prior-gifter-id"] == anonymousGifterID,
+		RecipientID:          msg.MsgParams["msg-param-recipient-id"],
+		RecipientLogin:       msg.MsgParams["msg-param-recipient-user-name"],
+		RecipientDisplayName: msg.MsgParams["msg-param-recipient-display-name"],
+	}
+	if !event.IsAnonymous {
+		event.PriorGifterID = msg.MsgParams["msg-param-prior-gifter-id"]
+		event.PriorGifterLogin = msg.MsgParams["msg-param-prior-gifter-user-name"]
+		event.PriorGifterName = msg.MsgParams["msg-param-prior-gifter-display-name"]
+	}
+
+	return event, true
+}
+
+// RitualNewChatter is the RitualName of the ritual of users chatting in a channel for the first time
+const RitualNewChatter = "new_chatter"
+
+// RitualEvent data of a USERNOTICE with the msg-id "ritual"
+type RitualEvent struct {
+	// RitualName is the name of the ritual, e.g. RitualNewChatter
+	RitualName string
+}
+
+// Ritual returns the ritual data of this message.
+// The second return value is false if this message is not a ritual
+func (msg *UserNoticeMessage) Ritual() (*RitualEvent, bool) {
+	if msg.MsgID != "ritual" {
+		return nil, false
+	}
+
+	return &RitualEvent{
+		RitualName: msg.MsgParams["msg-param-ritual-name"],
+	}, true
+}
+
+// IsNewChatterRitual returns whether this message is the ritual of a user chatting in the channel for the first time
+func (msg *UserNoticeMessage) IsNewChatterRitual() bool {
+	ritual, ok := msg.Ritual()
+	return ok && ritual.RitualName == RitualNewChatter
+}
+
+// BitsBadgeTierEvent data of a USERNOTICE with the msg-id "bitsbadgetier", the user earned a new bits badge
+type BitsBadgeTierEvent struct {
+	// Threshold is the tier of the badge, the number of bits the user cheered in the channel, e.g. 10000
+	Threshold int
+}
+
+// BitsBadgeTier returns the bits badge data of this message.
+// The second return value is false if this message is not a new bits badge
+func (msg *UserNoticeMessage) BitsBadgeTier() (*BitsBadgeTierEvent, bool) {
+	if msg.MsgID != "bitsbadgetier" {
+		return nil, false
+	}
+
+	return &BitsBadgeTierEvent{
+		Threshold: msg.msgParamInt("msg-param-threshold"),
+	}, true
+}
+
+// ExtendSubEvent data of a USERNOTICE with the msg-id "extendsub", the user extended their sub
+type ExtendSubEvent struct {
+	SubPlan SubPlan
+	// CumulativeMonths is the total number of months the user is subscribed for, 0 if missing
+	CumulativeMonths int
+	// BenefitEndMonth is the month the sub ends with the extension, from 1 for January to 12 for December, 0 if missing
+	BenefitEndMonth int
+}
+
+// ExtendSub returns the extended sub data of this message.
+// The second return value is false if this message is not an extended sub
+func (msg *UserNoticeMessage) ExtendSub() (*ExtendSubEvent, bool) {
+	if msg.MsgID != "extendsub" {
+		return nil, false
+	}
+
+	return &ExtendSubEvent{
+		SubPlan:          msg.SubPlan(),
+		CumulativeMonths: msg.msgParamInt("msg-param-cumulative-months"),
+		BenefitEndMonth:  msg.msgParamInt("msg-param-sub-benefit-end-month"),
+	}, true
+}
+
+// ViewerMilestoneWatchStreak is the Category of a ViewerMilestoneEvent for a watch streak
+const ViewerMilestoneWatchStreak = "watch-streak"
+
+// ViewerMilestoneEvent data of a USERNOTICE with the msg-id "viewermilestone", e.g. a watch streak of the user.
+// Categories other than ViewerMilestoneWatchStreak are parsed the same way, their other msg-params stay in the MsgParams of the message
+type ViewerMilestoneEvent struct {
+	// Category is the kind of milestone, e.g. ViewerMilestoneWatchStreak
+	Category string
+	// ID identifies the milestone
+	ID string
+	// Value is the count the milestone was reached with, e.g. the number of consecutive streams watched
+	Value int
+	// CopoReward is the number of channel points the user was rewarded with, 0 if there was no reward
+	CopoReward int
+}
+
+// ViewerMilestone returns the viewer milestone data of this message.
+// The second return value is false if this message is not a viewer milestone
+func (msg *UserNoticeMessage) ViewerMilestone() (*ViewerMilestoneEvent, bool) {
+	if msg.MsgID != "viewermilestone" {
+		return nil, false
+	}
+
+	// Twitch sends copoReward in camelCase, unlike the other msg-params of this message
+	return &ViewerMilestoneEvent{
+		Category:   msg.MsgParams["msg-param-category"],
+		ID:         msg.MsgParams["msg-param-id"],
+		Value:      msg.msgParamInt("msg-param-value"),
+		CopoReward: msg.msgParamInt("msg-param-copoReward"),
+	}, true
+}
+
+// MsgParamInt returns the value of a numeric msg-param, e.g. "msg-param-cumulative-months".
+// The second return value is false if the msg-param is missing or not a number
+func (msg *UserNoticeMessage) MsgParamInt(key string) (int, bool) {
+	rawValue, ok := msg.MsgParams[key]
+	if !ok {
+		return 0, false
+	}
+
+	value, err := strconv.Atoi(rawValue)
+	if err != nil {
+		return 0, false
+	}
+
+	return value, true
+}
+
+// msgParamInt returns the value of a numeric msg-param, or 0 if it is missing or not a number
+func (msg *UserNoticeMessage) msgParamInt(key string) int {
+	value, _ := msg.MsgParamInt(key)
+	return value
+}
+
+// SubPlan is the tier of a subscription
+type SubPlan int
+
+const (
+	// SubPlanUnknown is for sub plans we currently don't support, or messages without a sub plan
+	SubPlanUnknown SubPlan = iota
+	// SubPlanPrime subscription with Prime Gaming
+	SubPlanPrime
+	// SubPlanTier1 tier 1 subscription
+	SubPlanTier1
+	// SubPlanTier2 tier 2 subscription
+	SubPlanTier2
+	// SubPlanTier3 tier 3 subscription
+	SubPlanTier3
+)
+
+// String returns the name of the sub plan, e.g. "Tier 1"
+func (p SubPlan) String() string {
+	switch p {
+	case SubPlanPrime:
+		return "Prime"
+	case SubPlanTier1:
+		return "Tier 1"
+	case SubPlanTier2:
+		return "Tier 2"
+	case SubPlanTier3:
+		return "Tier 3"
+	}
+
+	return "Unknown"
+}
+
+var subPlanMap = map[string]SubPlan{
+	"Prime": SubPlanPrime,
+	"1000":  SubPlanTier1,
+	"2000":  SubPlanTier2,
+	"3000":  SubPlanTier3,
+}
+
+// parseSubPlan parses the value of the msg-param-sub-plan tag
+func parseSubPlan(rawSubPlan string) SubPlan {
+	if subPlan, ok := subPlanMap[rawSubPlan]; ok {
+		return subPlan
+	}
+
+	return SubPlanUnknown
+}
+
+// SubPlan returns the sub plan of sub, resub and gift messages from the msg-param-sub-plan tag.
+// Returns SubPlanUnknown for messages without a sub plan
+func (msg *UserNoticeMessage) SubPlan() SubPlan {
+	return parseSubPlan(msg.MsgParams["msg-param-sub-plan"])
+}
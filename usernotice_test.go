@@ -0,0 +1,362 @@
+package twitch
+
+import (
+	"testing"
+)
+
+func TestCanParseUSERNOTICEAnnouncementMessage(t *testing.T) {
+	testMessage := `@badge-info=;badges=broadcaster/1;color=#033700;display-name=pajlada;emotes=;flags=;id=55d90904-e515-47d4-ac1c-72d91f32e6a0;login=pajlada;mod=0;msg-id=announcement;msg-param-color=BLUE;room-id=11148817;subscriber=0;system-msg=;tmi-sent-ts=1648758023469;user-id=11148817;user-type= :tmi.twitch.tv USERNOTICE #pajlada :Stream starting in 5 minutes!`
+
+	message := ParseMessage(testMessage).(*UserNoticeMessage)
+
+	announcement, ok := message.Announcement()
+	assertTrue(t, ok, "message was not detected as an announcement")
+	assertStringsEqual(t, string(AnnouncementColorBlue), string(announcement.Color))
+	assertStringsEqual(t, "Stream starting in 5 minutes!", announcement.Message)
+}
+
+func TestCanParseUSERNOTICEAnnouncementMessageWithoutColor(t *testing.T) {
+	testMessage := `@badge-info=;badges=broadcaster/1;color=#033700;display-name=pajlada;emotes=;flags=;id=55d90904-e515-47d4-ac1c-72d91f32e6a0;login=pajlada;mod=0;msg-id=announcement;room-id=11148817;subscriber=0;system-msg=;tmi-sent-ts=1648758023469;user-id=11148817;user-type= :tmi.twitch.tv USERNOTICE #pajlada :hello`
+
+	message := ParseMessage(testMessage).(*UserNoticeMessage)
+
+	announcement, ok := message.Announcement()
+	assertTrue(t, ok, "message was not detected as an announcement")
+	assertStringsEqual(t, string(AnnouncementColorPrimary), string(announcement.Color))
+	assertStringsEqual(t, "hello", announcement.Message)
+}
+
+func TestNonAnnouncementUSERNOTICEIsNotAnAnnouncement(t *testing.T) {
+	testMessage := "@badges=;color=;display-name=FletcherCodes;emotes=64138:0-8;flags=;id=e4090aa9-8079-41ff-904d-64c7a2193ee0;login=fletchercodes;mod=0;msg-id=ritual;msg-param-ritual-name=new_chatter;room-id=408892348;subscriber=0;system-msg=@FletcherCodes\\sis\\snew\\shere.\\sSay\\shello!;tmi-sent-ts=1551487438943;turbo=0;user-id=412636239;user-type= :tmi.twitch.tv USERNOTICE #clippyassistant :SeemsGood"
+
+	message := ParseMessage(testMessage).(*UserNoticeMessage)
+
+	announcement, ok := message.Announcement()
+	assertFalse(t, ok, "ritual message was detected as an announcement")
+	assertTrue(t, announcement == nil, "announcement of a ritual message was not nil")
+}
+
+func TestCanGetRaidOfUSERNOTICEMessage(t *testing.T) {
+	testMessage := "@badges=partner/1;color=#00FF7F;display-name=FletcherCodes;emotes=;flags=;id=7a61cd41-f049-466b-9654-43e5bfc554aa;login=fletchercodes;mod=0;msg-id=raid;msg-param-displayName=FletcherCodes;msg-param-login=fletchercodes;msg-param-profileImageURL=https://static-cdn.jtvnw.net/jtv_user_pictures/herr_currywurst-profile_image-e6c037c9d321b955-70x70.jpeg;msg-param-viewerCount=538;room-id=269899575;subscriber=0;system-msg=538\\sraiders\\sfrom\\sFletcherCodes\\shave\\sjoined\\n!;tmi-sent-ts=1551490358542;turbo=0;user-id=269899575;user-type= :tmi.twitch.tv USERNOTICE #clippyassistant"
+
+	message := ParseMessage(testMessage).(*UserNoticeMessage)
+
+	raid, ok := message.Raid()
+	assertTrue(t, ok, "message was not detected as a raid")
+	assertStringsEqual(t, "FletcherCodes", raid.RaiderName)
+	assertStringsEqual(t, "fletchercodes", raid.RaiderLogin)
+	assertIntsEqual(t, 538, raid.Viewers)
+}
+
+func TestNonRaidUSERNOTICEIsNotARaid(t *testing.T) {
+	testMessage := `@badge-info=;badges=broadcaster/1;color=#033700;display-name=pajlada;emotes=;flags=;id=55d90904-e515-47d4-ac1c-72d91f32e6a0;login=pajlada;mod=0;msg-id=announcement;msg-param-color=BLUE;room-id=11148817;subscriber=0;system-msg=;tmi-sent-ts=1648758023469;user-id=11148817;user-type= :tmi.twitch.tv USERNOTICE #pajlada :Stream starting in 5 minutes!`
+
+	message := ParseMessage(testMessage).(*UserNoticeMessage)
+
+	raid, ok := message.Raid()
+	assertFalse(t, ok, "announcement was detected as a raid")
+	assertTrue(t, raid == nil, "raid of an announcement was not nil")
+}
+
+func TestCanGetSubGiftOfUSERNOTICEMessage(t *testing.T) {
+	testMessage := `@badges=subscriber/0,premium/1;color=#00FF7F;display-name=FletcherCodes;emotes=;flags=;id=b608909e-2089-4f97-9475-f2cd93f6717a;login=fletchercodes;mod=0;msg-id=subgift;msg-param-months=1;msg-param-recipient-display-name=NSFletcher;msg-param-recipient-id=418105091;msg-param-recipient-user-name=nsfletcher;msg-param-sender-count=5;msg-param-sub-plan-name=Channel\sSubscription\s(clippyassistant);msg-param-sub-plan=1000;room-id=408892348;subscriber=1;system-msg=FletcherCodes\sgifted\sa\sTier\s1\ssub\sto\sNSFletcher!;tmi-sent-ts=1551487298580;turbo=0;user-id=79793581;user-type= :tmi.twitch.tv USERNOTICE #clippyassistant`
+
+	message := ParseMessage(testMessage).(*UserNoticeMessage)
+
+	subGift, ok := message.SubGift()
+	assertTrue(t, ok, "message was not detected as a gifted sub")
+	assertStringsEqual(t, "418105091", subGift.RecipientID)
+	assertStringsEqual(t, "nsfletcher", subGift.RecipientLogin)
+	assertStringsEqual(t, "NSFletcher", subGift.RecipientDisplayName)
+	assertIntsEqual(t, 1, subGift.Months)
+	assertIntsEqual(t, 5, subGift.SenderCount)
+	assertIntsEqual(t, 1, subGift.GiftMonths)
+	assertTrue(t, subGift.SubPlan == SubPlanTier1, "sub plan was not tier 1")
+	assertFalse(t, subGift.IsAnonymous, "gifted sub was anonymous")
+
+	_, ok = message.MysteryGift()
+	assertFalse(t, ok, "gifted sub was detected as a community gift")
+}
+
+func TestCanGetMultiMonthSubGiftOfUSERNOTICEMessage(t *testing.T) {
+	testMessage := `@badges=;color=;display-name=FletcherCodes;emotes=;id=b608909e-2089-4f97-9475-f2cd93f6717a;login=fletchercodes;msg-id=subgift;msg-param-gift-months=6;msg-param-months=3;msg-param-recipient-display-name=NSFletcher;msg-param-recipient-id=418105091;msg-param-recipient-user-name=nsfletcher;msg-param-sub-plan=1000;room-id=408892348;tmi-sent-ts=1551487298580;user-id=79793581 :tmi.twitch.tv USERNOTICE #clippyassistant`
+
+	message := ParseMessage(testMessage).(*UserNoticeMessage)
+
+	subGift, ok := message.SubGift()
+	assertTrue(t, ok, "message was not detected as a gifted sub")
+	assertIntsEqual(t, 3, subGift.Months)
+	assertIntsEqual(t, 6, subGift.GiftMonths)
+}
+
+func TestCanGetMysteryGiftOfUSERNOTICEMessage(t *testing.T) {
+	testMessage := `@badge-info=;badges=premium/1;color=#0000FF;display-name=FletcherCodes;emotes=;flags=;id=3e6d6d2b-0c9a-4fe7-ae4f-e8c8e7c4f0b8;login=fletchercodes;mod=0;msg-id=submysterygift;msg-param-mass-gift-count=5;msg-param-origin-id=1d\s6a\s0b\s43\s66\s93\sd4\s1a\sdb\s54\s2e\s8c\s5b\sfd\s47\s6a\s56\sec\s55\s66;msg-param-sender-count=20;msg-param-sub-plan=2000;room-id=408892348;subscriber=0;system-msg=FletcherCodes\sis\sgifting\s5\sTier\s2\sSubs\sto\sclippyassistant's\scommunity!\sThey've\sgifted\sa\stotal\sof\s20\sin\sthe\schannel!;tmi-sent-ts=1551487298580;user-id=79793581;user-type= :tmi.twitch.tv USERNOTICE #clippyassistant`
+
+	message := ParseMessage(testMessage).(*UserNoticeMessage)
+
+	mysteryGift, ok := message.MysteryGift()
+	assertTrue(t, ok, "message was not detected as a community gift")
+	assertIntsEqual(t, 5, mysteryGift.GiftCount)
+	assertIntsEqual(t, 20, mysteryGift.SenderCount)
+	assertTrue(t, mysteryGift.SubPlan == SubPlanTier2, "sub plan was not tier 2")
+
+	_, ok = message.SubGift()
+	assertFalse(t, ok, "community gift was detected as a gifted sub")
+}
+
+func TestCanGetSubOfUSERNOTICEMessage(t *testing.T) {
+	testMessage := `@badge-info=subscriber/34;badges=subscriber/24,premium/1;color=#1FD2FF;display-name=Karl_Kons;emotes=;id=7c95beea-a7ac-4c10-9e0a-d7dbf163c038;login=karl_kons;msg-id=resub;msg-param-cumulative-months=34;msg-param-should-share-streak=1;msg-param-streak-months=12;msg-param-sub-plan-name=look\sat\sthose\sshitty\semotes;msg-param-sub-plan=Prime;room-id=11148817;tmi-sent-ts=1540140252828;user-id=68706331 :tmi.twitch.tv USERNOTICE #pajlada :WutFace`
+
+	message := ParseMessage(testMessage).(*UserNoticeMessage)
+
+	sub, ok := message.Sub()
+	assertTrue(t, ok, "message was not detected as a sub")
+	assertIntsEqual(t, 34, sub.CumulativeMonths)
+	assertIntsEqual(t, 12, sub.StreakMonths)
+	assertStringsEqual(t, "look at those shitty emotes", sub.SubPlanName)
+	assertTrue(t, sub.SubPlan == SubPlanPrime, "sub plan was not prime")
+
+	_, ok = message.SubGift()
+	assertFalse(t, ok, "resub was detected as a gifted sub")
+}
+
+func TestCanGetMsgParamIntOfUSERNOTICEMessage(t *testing.T) {
+	testMessage := `@badges=;color=;display-name=Karl_Kons;emotes=;id=7c95beea-a7ac-4c10-9e0a-d7dbf163c038;login=karl_kons;msg-id=resub;msg-param-cumulative-months=34;msg-param-streak-months=;msg-param-sub-plan=Prime;room-id=11148817;tmi-sent-ts=1540140252828;user-id=68706331 :tmi.twitch.tv USERNOTICE #pajlada`
+
+	message := ParseMessage(testMessage).(*UserNoticeMessage)
+
+	months, ok := message.MsgParamInt("msg-param-cumulative-months")
+	assertTrue(t, ok, "numeric msg-param was not converted")
+	assertIntsEqual(t, 34, months)
+
+	for _, key := range []string{"msg-param-streak-months", "msg-param-sub-plan", "msg-param-gift-months"} {
+		value, ok := message.MsgParamInt(key)
+		assertFalse(t, ok, key+" was converted")
+		assertIntsEqual(t, 0, value)
+	}
+}
+
+func TestUSERNOTICESystemMsgIsUnescaped(t *testing.T) {
+	testMessage := `@badges=;color=;display-name=FletcherCodes;emotes=;id=57cbe8d9-8d17-4760-b1e7-0d888e1fdc60;login=fletchercodes;msg-id=sub;msg-param-sub-plan=1000;room-id=408892348;system-msg=FletcherCodes\sjust\ssubscribed\:\sa\\b;tmi-sent-ts=1551486064328;user-id=269899575 :tmi.twitch.tv USERNOTICE #clippyassistant`
+
+	message := ParseMessage(testMessage).(*UserNoticeMessage)
+
+	assertStringsEqual(t, `FletcherCodes just subscribed; a\b`, message.SystemMsg)
+}
+
+func TestCanParseUSERNOTICESubPlan(t *testing.T) {
+	tests := []struct {
+		rawSubPlan string
+		expected   SubPlan
+		name       string
+	}{
+		{"Prime", SubPlanPrime, "Prime"},
+		{"1000", SubPlanTier1, "Tier 1"},
+		{"2000", SubPlanTier2, "Tier 2"},
+		{"3000", SubPlanTier3, "Tier 3"},
+		{"4000", SubPlanUnknown, "Unknown"},
+		{"", SubPlanUnknown, "Unknown"},
+	}
+
+	for _, test := range tests {
+		testMessage := `@badges=subscriber/0,premium/1;color=;display-name=FletcherCodes;emotes=;flags=;id=57cbe8d9-8d17-4760-b1e7-0d888e1fdc60;login=fletchercodes;mod=0;msg-id=sub;msg-param-cumulative-months=0;msg-param-months=0;msg-param-should-share-streak=0;msg-param-sub-plan-name=The\sWhatevas;msg-param-sub-plan=` + test.rawSubPlan + `;room-id=408892348;subscriber=1;system-msg=fletchercodes\ssubscribed\swith\sTwitch\sPrime.;tmi-sent-ts=1551486064328;turbo=0;user-id=269899575;user-type= :tmi.twitch.tv USERNOTICE #clippyassistant`
+
+		message := ParseMessage(testMessage).(*UserNoticeMessage)
+
+		if message.SubPlan() != test.expected {
+			t.Errorf("sub plan %q was parsed as %d, expected %d", test.rawSubPlan, message.SubPlan(), test.expected)
+		}
+		assertStringsEqual(t, test.name, message.SubPlan().String())
+	}
+}
+
+func TestUSERNOTICEWithoutSubPlanHasUnknownSubPlan(t *testing.T) {
+	testMessage := "@badges=;color=;display-name=FletcherCodes;emotes=64138:0-8;flags=;id=e4090aa9-8079-41ff-904d-64c7a2193ee0;login=fletchercodes;mod=0;msg-id=ritual;msg-param-ritual-name=new_chatter;room-id=408892348;subscriber=0;system-msg=@FletcherCodes\\sis\\snew\\shere.\\sSay\\shello!;tmi-sent-ts=1551487438943;turbo=0;user-id=412636239;user-type= :tmi.twitch.tv USERNOTICE #clippyassistant :SeemsGood"
+
+	message := ParseMessage(testMessage).(*UserNoticeMessage)
+
+	if message.SubPlan() != SubPlanUnknown {
+		t.Errorf("ritual message has sub plan %d", message.SubPlan())
+	}
+}
+
+func TestCanGetViewerMilestoneOfUSERNOTICEMessage(t *testing.T) {
+	testMessage := `@badge-info=;badges=;color=#8A2BE2;display-name=ShiroNoKami;emotes=;flags=;id=7dab2c46-4fe3-4d32-9ea2-1a8e6ee1e4c7;login=shironokami;mod=0;msg-id=viewermilestone;msg-param-category=watch-streak;msg-param-copoReward=450;msg-param-id=f2fb1a0b-61a5-4be3-8a4f-5e7d7f5a3f7c;msg-param-value=3;room-id=11148817;subscriber=0;system-msg=ShiroNoKami\swatched\s3\sconsecutive\sstreams\sthis\smonth\sand\ssparked\sa\swatch\sstreak!;tmi-sent-ts=1722898210432;user-id=404210839;user-type=;vip=0 :tmi.twitch.tv USERNOTICE #pajlada :three in a row`
+
+	message := ParseMessage(testMessage).(*UserNoticeMessage)
+
+	milestone, ok := message.ViewerMilestone()
+	assertTrue(t, ok, "message was not detected as a viewer milestone")
+	assertStringsEqual(t, ViewerMilestoneWatchStreak, milestone.Category)
+	assertStringsEqual(t, "f2fb1a0b-61a5-4be3-8a4f-5e7d7f5a3f7c", milestone.ID)
+	assertIntsEqual(t, 3, milestone.Value)
+	assertIntsEqual(t, 450, milestone.CopoReward)
+	assertStringsEqual(t, "three in a row", message.Message)
+}
+
+func TestCanGetViewerMilestoneOfUnknownCategory(t *testing.T) {
+	testMessage := `@badge-info=;badges=;color=;display-name=gempir;emotes=;flags=;id=1;login=gempir;mod=0;msg-id=viewermilestone;msg-param-category=chat-streak;msg-param-value=7;msg-param-emoji=tada;room-id=11148817;subscriber=0;system-msg=;tmi-sent-ts=1722898210432;user-id=77829817;user-type= :tmi.twitch.tv USERNOTICE #pajlada`
+
+	message := ParseMessage(testMessage).(*UserNoticeMessage)
+
+	milestone, ok := message.ViewerMilestone()
+	assertTrue(t, ok, "message was not detected as a viewer milestone")
+	assertStringsEqual(t, "chat-streak", milestone.Category)
+	assertIntsEqual(t, 7, milestone.Value)
+	assertIntsEqual(t, 0, milestone.CopoReward)
+	assertStringsEqual(t, "tada", message.MsgParams["msg-param-emoji"])
+
+	_, ok = ParseMessage("@msg-id=raid :tmi.twitch.tv USERNOTICE #pajlada").(*UserNoticeMessage).ViewerMilestone()
+	assertFalse(t, ok, "raid was detected as a viewer milestone")
+}
+
+func TestCanGetGiftUpgradeOfUSERNOTICEMessage(t *testing.T) {
+	testMessage := `@badge-info=subscriber/1;badges=subscriber/0;color=#1E90FF;display-name=FletcherCodes;emotes=;flags=;id=9d10a1d8-1f08-4f36-89da-bc2a0a1c2e44;login=fletchercodes;mod=0;msg-id=giftpaidupgrade;msg-param-promo-gift-total=3;msg-param-promo-name=Subtember\s2018;msg-param-sender-login=pajlada;msg-param-sender-name=pajlada;room-id=11148817;subscriber=1;system-msg=FletcherCodes\sis\scontinuing\sthe\sGift\sSub\sthey\sgot\sfrom\spajlada!;tmi-sent-ts=1537980337216;user-id=269899575;user-type= :tmi.twitch.tv USERNOTICE #pajlada`
+
+	upgrade, ok := ParseMessage(testMessage).(*UserNoticeMessage).GiftUpgrade()
+	assertTrue(t, ok, "message was not detected as a gift upgrade")
+	assertFalse(t, upgrade.IsAnonymous, "gift upgrade was anonymous")
+	assertStringsEqual(t, "pajlada", upgrade.SenderLogin)
+	assertStringsEqual(t, "pajlada", upgrade.SenderName)
+	assertStringsEqual(t, "Subtember 2018", upgrade.PromoName)
+	assertIntsEqual(t, 3, upgrade.PromoGiftTotal)
+}
+
+func TestCanGetAnonymousGiftUpgradeOfUSERNOTICEMessage(t *testing.T) {
+	testMessage := `@badge-info=subscriber/1;badges=subscriber/0;color=#1E90FF;display-name=FletcherCodes;emotes=;flags=;id=bd1bdcf7-2b0c-4b69-8e0c-8ad2d4ef1d0e;login=fletchercodes;mod=0;msg-id=anongiftpaidupgrade;room-id=11148817;subscriber=1;system-msg=FletcherCodes\sis\scontinuing\sthe\sGift\sSub\sthey\sgot\sfrom\san\sanonymous\suser!;tmi-sent-ts=1537980337216;user-id=269899575;user-type= :tmi.twitch.tv USERNOTICE #pajlada`
+
+	upgrade, ok := ParseMessage(testMessage).(*UserNoticeMessage).GiftUpgrade()
+	assertTrue(t, ok, "message was not detected as a gift upgrade")
+	assertTrue(t, upgrade.IsAnonymous, "anonymous gift upgrade was not anonymous")
+	assertStringsEqual(t, "", upgrade.SenderLogin)
+	assertStringsEqual(t, "", upgrade.PromoName)
+	assertIntsEqual(t, 0, upgrade.PromoGiftTotal)
+}
+
+func TestCanGetPrimeUpgradeOfUSERNOTICEMessage(t *testing.T) {
+	testMessage := `@badge-info=subscriber/3;badges=subscriber/3;color=;display-name=FletcherCodes;emotes=;flags=;id=4b4e1a64-8b8e-4c3f-9e2e-dc45a6a6a1a7;login=fletchercodes;mod=0;msg-id=primepaidupgrade;msg-param-sub-plan=1000;room-id=11148817;subscriber=1;system-msg=FletcherCodes\sconverted\sfrom\sa\sPrime\ssub\sto\sa\sTier\s1\ssub!;tmi-sent-ts=1537980337216;user-id=269899575;user-type= :tmi.twitch.tv USERNOTICE #pajlada`
+
+	upgrade, ok := ParseMessage(testMessage).(*UserNoticeMessage).PrimeUpgrade()
+	assertTrue(t, ok, "message was not detected as a prime upgrade")
+	assertTrue(t, upgrade.SubPlan == SubPlanTier1, "sub plan was not tier 1")
+}
+
+func TestCanGetStandardPayForwardOfUSERNOTICEMessage(t *testing.T) {
+	testMessage := `@badge-info=subscriber/1;badges=subscriber/0;color=#8A2BE2;display-name=FletcherCodes;emotes=;flags=;id=ebd5f7b6-7e0f-4f8d-a4c4-a6f5d8f2b0a3;login=fletchercodes;mod=0;msg-id=standardpayforward;msg-param-prior-gifter-anonymous=false;msg-param-prior-gifter-display-name=pajlada;msg-param-prior-gifter-id=11148817;msg-param-prior-gifter-user-name=pajlada;msg-param-recipient-display-name=Gempir;msg-param-recipient-id=77829817;msg-param-recipient-user-name=gempir;room-id=11148817;subscriber=1;system-msg=FletcherCodes\sis\spaying\sforward\sthe\sGift\sthey\sgot\sfrom\spajlada\sto\sGempir!;tmi-sent-ts=1590599440829;user-id=269899575;user-type= :tmi.twitch.tv USERNOTICE #pajlada`
+
+	payForward, ok := ParseMessage(testMessage).(*UserNoticeMessage).PayForward()
+	assertTrue(t, ok, "message was not detected as a pay forward")
+	assertFalse(t, payForward.IsCommunity, "standard pay forward was to the community")
+	assertFalse(t, payForward.IsAnonymous, "pay forward was anonymous")
+	assertStringsEqual(t, "11148817", payForward.PriorGifterID)
+	assertStringsEqual(t, "pajlada", payForward.PriorGifterLogin)
+	assertStringsEqual(t, "pajlada", payForward.PriorGifterName)
+	assertStringsEqual(t, "77829817", payForward.RecipientID)
+	assertStringsEqual(t, "gempir", payForward.RecipientLogin)
+	assertStringsEqual(t, "Gempir", payForward.RecipientDisplayName)
+}
+
+func TestCanGetCommunityPayForwardOfUSERNOTICEMessage(t *testing.T) {
+	testMessage := `@badge-info=subscriber/1;badges=subscriber/0;color=#8A2BE2;display-name=FletcherCodes;emotes=;flags=;id=2f0e5c0f-f4f7-43d1-a0aa-f4c8a6e1ba96;login=fletchercodes;mod=0;msg-id=communitypayforward;msg-param-prior-gifter-anonymous=true;msg-param-prior-gifter-display-name=AnAnonymousGifter;msg-param-prior-gifter-id=274598607;msg-param-prior-gifter-user-name=ananonymousgifter;room-id=11148817;subscriber=1;system-msg=FletcherCodes\sis\spaying\sforward\sthe\sGift\sthey\sgot\sfrom\san\sanonymous\suser\sto\sthe\scommunity!;tmi-sent-ts=1590599440829;user-id=269899575;user-type= :tmi.twitch.tv USERNOTICE #pajlada`
+
+	payForward, ok := ParseMessage(testMessage).(*UserNoticeMessage).PayForward()
+	assertTrue(t, ok, "message was not detected as a pay forward")
+	assertTrue(t, payForward.IsCommunity, "community pay forward was not to the community")
+	assertTrue(t, payForward.IsAnonymous, "anonymous pay forward was not anonymous")
+	assertStringsEqual(t, "", payForward.PriorGifterLogin)
+	assertStringsEqual(t, "", payForward.RecipientLogin)
+
+	_, ok = ParseMessage(testMessage).(*UserNoticeMessage).GiftUpgrade()
+	assertFalse(t, ok, "pay forward was detected as a gift upgrade")
+}
+
+func TestCanGetBitsBadgeTierOfUSERNOTICEMessage(t *testing.T) {
+	testMessage := `@badge-info=;badges=bits/10000;color=#FF0000;display-name=FletcherCodes;emotes=;flags=;id=8a8e7e68-3b6e-4b36-9f6c-2c0bd0f3f8e2;login=fletchercodes;mod=0;msg-id=bitsbadgetier;msg-param-threshold=10000;room-id=11148817;subscriber=0;system-msg=bits\sbadge\stier\snotification;tmi-sent-ts=1594520403813;user-id=269899575;user-type= :tmi.twitch.tv USERNOTICE #pajlada :cheering all the way`
+
+	bitsBadge, ok := ParseMessage(testMessage).(*UserNoticeMessage).BitsBadgeTier()
+	assertTrue(t, ok, "message was not detected as a bits badge tier")
+	assertIntsEqual(t, 10000, bitsBadge.Threshold)
+}
+
+func TestCanGetExtendSubOfUSERNOTICEMessage(t *testing.T) {
+	testMessage := `@badge-info=subscriber/14;badges=subscriber/12;color=;display-name=FletcherCodes;emotes=;flags=;id=0f3c2a1e-8f47-4ae4-9f5c-0e0b8d9d7a5b;login=fletchercodes;mod=0;msg-id=extendsub;msg-param-cumulative-months=14;msg-param-sub-benefit-end-month=11;msg-param-sub-plan=2000;room-id=11148817;subscriber=1;system-msg=FletcherCodes\sextended\stheir\sTier\s2\ssubscription\sthrough\sNovember!;tmi-sent-ts=1594520403813;user-id=269899575;user-type= :tmi.twitch.tv USERNOTICE #pajlada`
+
+	extendSub, ok := ParseMessage(testMessage).(*UserNoticeMessage).ExtendSub()
+	assertTrue(t, ok, "message was not detected as an extended sub")
+	assertTrue(t, extendSub.SubPlan == SubPlanTier2, "sub plan was not tier 2")
+	assertIntsEqual(t, 14, extendSub.CumulativeMonths)
+	assertIntsEqual(t, 11, extendSub.BenefitEndMonth)
+
+	// Malformed numbers are parsed as 0
+	extendSub, _ = ParseMessage("@msg-id=extendsub;msg-param-sub-benefit-end-month=nov :tmi.twitch.tv USERNOTICE #pajlada").(*UserNoticeMessage).ExtendSub()
+	assertIntsEqual(t, 0, extendSub.BenefitEndMonth)
+
+	_, ok = ParseMessage(testMessage).(*UserNoticeMessage).BitsBadgeTier()
+	assertFalse(t, ok, "extended sub was detected as a bits badge tier")
+}
+
+func TestCanGetRitualOfUSERNOTICEMessage(t *testing.T) {
+	testMessage := "@badges=;color=;display-name=FletcherCodes;emotes=64138:0-8;flags=;id=e4090aa9-8079-41ff-904d-64c7a2193ee0;login=fletchercodes;mod=0;msg-id=ritual;msg-param-ritual-name=new_chatter;room-id=408892348;subscriber=0;system-msg=@FletcherCodes\\sis\\snew\\shere.\\sSay\\shello!;tmi-sent-ts=1551487438943;turbo=0;user-id=412636239;user-type= :tmi.twitch.tv USERNOTICE #clippyassistant :SeemsGood"
+
+	message := ParseMessage(testMessage).(*UserNoticeMessage)
+
+	ritual, ok := message.Ritual()
+	assertTrue(t, ok, "message was not detected as a ritual")
+	assertStringsEqual(t, RitualNewChatter, ritual.RitualName)
+	assertTrue(t, message.IsNewChatterRitual(), "message was not detected as a new chatter ritual")
+
+	otherRitual := ParseMessage("@msg-id=ritual;msg-param-ritual-name=birthday :tmi.twitch.tv USERNOTICE #clippyassistant").(*UserNoticeMessage)
+	assertFalse(t, otherRitual.IsNewChatterRitual(), "another ritual was detected as a new chatter ritual")
+
+	raid := ParseMessage("@msg-id=raid;msg-param-ritual-name=new_chatter :tmi.twitch.tv USERNOTICE #clippyassistant").(*UserNoticeMessage)
+	assertFalse(t, raid.IsNewChatterRitual(), "raid was detected as a new chatter ritual")
+}
+
+func TestCanDetectAnonymousGifts(t *testing.T) {
+	// Gifts by the placeholder user, without the anon msg-id
+	loginBased := ParseMessage(`@badge-info=;badges=;color=;display-name=AnAnonymousGifter;emotes=;flags=;id=1;login=ananonymousgifter;mod=0;msg-id=subgift;msg-param-months=1;msg-param-recipient-display-name=NSFletcher;msg-param-recipient-id=418105091;msg-param-recipient-user-name=nsfletcher;msg-param-sub-plan=1000;room-id=408892348;subscriber=0;system-msg=An\sanonymous\suser\sgifted\sa\sTier\s1\ssub\sto\sNSFletcher!;tmi-sent-ts=1551487298580;user-id=274598607;user-type= :tmi.twitch.tv USERNOTICE #clippyassistant`).(*UserNoticeMessage)
+
+	assertTrue(t, loginBased.User.IsAnonymous(), "placeholder user was not anonymous")
+	subGift, _ := loginBased.SubGift()
+	assertTrue(t, subGift.IsAnonymous, "gift of the placeholder user was not anonymous")
+
+	// Gifts with the anon msg-ids
+	idBased := ParseMessage(`@badge-info=;badges=;color=;display-name=;emotes=;flags=;id=2;login=;mod=0;msg-id=anonsubgift;msg-param-months=1;msg-param-recipient-display-name=NSFletcher;msg-param-recipient-id=418105091;msg-param-recipient-user-name=nsfletcher;msg-param-sub-plan=1000;room-id=408892348;subscriber=0;system-msg=;tmi-sent-ts=1551487298580;user-id=;user-type= :tmi.twitch.tv USERNOTICE #clippyassistant`).(*UserNoticeMessage)
+
+	subGift, _ = idBased.SubGift()
+	assertTrue(t, subGift.IsAnonymous, "anonsubgift was not anonymous")
+
+	mysteryGift, _ := ParseMessage("@login=;msg-id=anonsubmysterygift;msg-param-mass-gift-count=5;msg-param-sub-plan=1000;user-id= :tmi.twitch.tv USERNOTICE #clippyassistant").(*UserNoticeMessage).MysteryGift()
+	assertTrue(t, mysteryGift.IsAnonymous, "anonsubmysterygift was not anonymous")
+
+	upgrade, _ := ParseMessage("@msg-id=giftpaidupgrade;msg-param-sender-login=ananonymousgifter;msg-param-sender-name=AnAnonymousGifter :tmi.twitch.tv USERNOTICE #clippyassistant").(*UserNoticeMessage).GiftUpgrade()
+	assertTrue(t, upgrade.IsAnonymous, "upgrade of a gift of the placeholder user was not anonymous")
+	assertStringsEqual(t, "", upgrade.SenderLogin)
+
+	assertFalse(t, User{ID: "79793581", Name: "fletchercodes"}.IsAnonymous(), "regular user was anonymous")
+}
+
+func TestCanGetGifterOfResub(t *testing.T) {
+	testMessage := `@badge-info=subscriber/2;badges=subscriber/0;color=;display-name=NSFletcher;emotes=;flags=;id=3c3f0a4f-0c45-4b1b-9a8f-43a3d6b0b4c5;login=nsfletcher;mod=0;msg-id=resub;msg-param-anon-gift=false;msg-param-cumulative-months=2;msg-param-gift-month-being-redeemed=2;msg-param-gift-months=3;msg-param-gifter-id=79793581;msg-param-gifter-login=fletchercodes;msg-param-gifter-name=FletcherCodes;msg-param-months=0;msg-param-should-share-streak=0;msg-param-sub-plan-name=Channel\sSubscription\s(clippyassistant);msg-param-sub-plan=1000;msg-param-was-gifted=true;room-id=408892348;subscriber=1;system-msg=NSFletcher\ssubscribed\sat\sTier\s1.\sThey've\ssubscribed\sfor\s2\smonths!;tmi-sent-ts=1551487298580;user-id=418105091;user-type= :tmi.twitch.tv USERNOTICE #clippyassistant`
+
+	sub, ok := ParseMessage(testMessage).(*UserNoticeMessage).Sub()
+	assertTrue(t, ok, "message was not detected as a sub")
+	assertTrue(t, sub.WasGifted, "gifted resub was not gifted")
+	assertFalse(t, sub.AnonymousGifter, "gifted resub had an anonymous gifter")
+	assertStringsEqual(t, "79793581", sub.GifterID)
+	assertStringsEqual(t, "fletchercodes", sub.GifterLogin)
+	assertStringsEqual(t, "FletcherCodes", sub.GifterName)
+
+	anonymous := `@login=nsfletcher;msg-id=resub;msg-param-anon-gift=true;msg-param-cumulative-months=2;msg-param-gifter-id=274598607;msg-param-gifter-login=ananonymousgifter;msg-param-gifter-name=AnAnonymousGifter;msg-param-sub-plan=1000;msg-param-was-gifted=true;user-id=418105091 :tmi.twitch.tv USERNOTICE #clippyassistant`
+
+	sub, _ = ParseMessage(anonymous).(*UserNoticeMessage).Sub()
+	assertTrue(t, sub.WasGifted, "anonymously gifted resub was not gifted")
+	assertTrue(t, sub.AnonymousGifter, "anonymously gifted resub didn't have an anonymous gifter")
+	assertStringsEqual(t, "", sub.GifterLogin)
+
+	selfPaid := `@login=karl_kons;msg-id=resub;msg-param-cumulative-months=34;msg-param-sub-plan=1000;msg-param-was-gifted=false;user-id=68706331 :tmi.twitch.tv USERNOTICE #pajlada`
+
+	sub, _ = ParseMessage(selfPaid).(*UserNoticeMessage).Sub()
+	assertFalse(t, sub.WasGifted, "self-paid resub was gifted")
+	assertFalse(t, sub.AnonymousGifter, "self-paid resub had an anonymous gifter")
+}
@@ -0,0 +1,79 @@
+package twitch
+
+import "sync"
+
+// UserState is the state of the client's own user in a channel, taken from the last USERSTATE message of the channel.
+// Twitch sends a USERSTATE message when joining a channel and after every message sent to it
+// See https://dev.twitch.tv/docs/irc/tags/#userstate-tags
+type UserState struct {
+	Channel   string
+	User      User
+	EmoteSets []string
+
+	// Mod whether the user is a moderator or the broadcaster of the channel
+	Mod bool
+	// VIP whether the user is a VIP of the channel
+	VIP bool
+	// Broadcaster whether the user is the broadcaster of the channel
+	Broadcaster bool
+	// Subscriber whether the user is subscribed to the channel, which includes founders like User.IsSubscriber
+	Subscriber bool
+}
+
+func newUserState(message *UserStateMessage) UserState {
+	badges := message.User.Badges
+	_, broadcaster := badges["broadcaster"]
+	_, vip := badges["vip"]
+
+	return UserState{
+		Channel:   message.Channel,
+		User:      message.User,
+		EmoteSets: message.EmoteSets,
+
+		Mod:         message.Tags["mod"] == "1" || broadcaster,
+		VIP:         vip,
+		Broadcaster: broadcaster,
+		Subscriber:  message.Tags["subscriber"] == "1" || message.User.IsSubscriber(),
+	}
+}
+
+// userStateCache keeps the last USERSTATE of each channel
+type userStateCache struct {
+	mutex    sync.RWMutex
+	channels map[string]UserState
+}
+
+func newUserStateCache() *userStateCache {
+	return &userStateCache{
+		channels: map[string]UserState{},
+	}
+}
+
+func (u *userStateCache) update(message *UserStateMessage) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	u.channels[message.Channel] = newUserState(message)
+}
+
+func (u *userStateCache) get(channel string) (UserState, bool) {
+	u.mutex.RLock()
+	defer u.mutex.RUnlock()
+
+	userState, ok := u.channels[channel]
+	return userState, ok
+}
+
+func (u *userStateCache) remove(channel string) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	delete(u.channels, channel)
+}
+
+func (u *userStateCache) reset() {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	u.channels = map[string]UserState{}
+}